@@ -2,45 +2,965 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/config"
+	"github.com/canpacis/birlang/src/coverage"
+	"github.com/canpacis/birlang/src/dap"
 	"github.com/canpacis/birlang/src/engine"
+	"github.com/canpacis/birlang/src/format"
+	"github.com/canpacis/birlang/src/implementor"
+	"github.com/canpacis/birlang/src/lsp"
+	"github.com/canpacis/birlang/src/parser"
+	"github.com/canpacis/birlang/src/profile"
+	"github.com/canpacis/birlang/src/scope"
+	"github.com/canpacis/birlang/src/tester"
+	"github.com/canpacis/birlang/src/thrower"
+	"github.com/canpacis/birlang/src/trace"
+	"github.com/canpacis/birlang/src/util"
+	"github.com/canpacis/birlang/src/vm"
 )
 
-func main() {
-	std_path := os.Getenv("BirStd")
-	if std_path != "" {
-		if len(os.Args) > 1 {
-			instance := engine.NewEngine(os.Args[1], std_path, false, false, 0)
-			instance.Init()
-			instance.Run()
+const version = "0.1.1"
+
+const usage = `Usage: bir <command> [flags] [arguments]
+
+Commands:
+  run      run a program, 'bir <file>' is short for 'bir run <file>'
+  repl     start an interactive session, the default without arguments
+  check    report the errors of programs without running them
+  fmt      format programs
+  parse    print the syntax tree of a program as json
+  test     run the tests of '_test.bir' files
+  lsp      serve the language server protocol on the standard streams
+  debug    serve the debug adapter protocol
+  version  print the version of bir
+
+Run 'bir help <command>' for the flags of a command.
+`
+
+// Exit codes of the commands
+const (
+	exitSuccess = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// options are the flags every command that runs a program shares, the ones given on the command line
+// override the environment variables and the bir.config.json of the program
+type options struct {
+	std_path           string
+	color              bool
+	verbosity          int
+	callstack_size     int
+	search_paths       paths
+	warnings_as_errors bool
+	step_budget        int64
+	allow              string
+	set                map[string]bool
+	overrides          *config.Config
+	settings           *config.Config
+}
+
+// paths is a flag that can be given more than once
+type paths []string
+
+func (p *paths) String() string {
+	return strings.Join(*p, string(filepath.ListSeparator))
+}
+
+func (p *paths) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+func newFlags(name string, synopsis string, description string, options *options) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		io.WriteString(flags.Output(), "Usage: bir "+synopsis+"\n\n"+description+"\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+
+	if options != nil {
+		flags.StringVar(&options.std_path, "std", "", "directory of the standard library, the embedded one when not set")
+		flags.BoolVar(&options.color, "color", false, "color the error messages")
+		flags.IntVar(&options.verbosity, "verbosity", 0, "verbosity level of the warnings")
+		flags.IntVar(&options.callstack_size, "callstack-size", 0, "maximum size of the callstack, 8000 when not set")
+		flags.Var(&options.search_paths, "search-path", "directory 'module:' imports are looked up in, can be given more than once")
+		flags.BoolVar(&options.warnings_as_errors, "warnings-as-errors", false, "stop the program at its first warning")
+		flags.Int64Var(&options.step_budget, "step-budget", 0, "maximum number of loop iterations and block calls, no limit when not set")
+		flags.StringVar(&options.allow, "allow", "read,write", "comma separated permissions of the program, 'read' and 'write'")
+	}
+	return flags
+}
+
+// parseFlags parses the arguments of a command, the command stops with the returned code when they are
+// not valid or only ask for help. Help goes to the standard output, mistakes to the standard error.
+func parseFlags(flags *flag.FlagSet, options *options, arguments []string) (int, bool) {
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(arguments); err != nil {
+		if err == flag.ErrHelp {
+			flags.SetOutput(os.Stdout)
+			flags.Usage()
+			return exitSuccess, false
+		}
+		flags.SetOutput(os.Stderr)
+		os.Stderr.WriteString(err.Error() + "\n")
+		flags.Usage()
+		return exitUsage, false
+	}
+	flags.SetOutput(os.Stderr)
+
+	if options != nil {
+		options.set = map[string]bool{}
+		flags.Visit(func(f *flag.Flag) {
+			options.set[f.Name] = true
+		})
+		if err := options.override(); err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			flags.Usage()
+			return exitUsage, false
+		}
+	}
+	return exitSuccess, true
+}
+
+// override collects the settings of the flags that were given
+func (options *options) override() error {
+	overrides := &config.Config{}
+	if options.set["std"] {
+		overrides.StdPath = &options.std_path
+	}
+	if options.set["color"] {
+		overrides.ColoredOutput = &options.color
+	}
+	if options.set["verbosity"] {
+		overrides.VerbosityLevel = &options.verbosity
+	}
+	if options.set["callstack-size"] {
+		overrides.MaximumCallstackSize = &options.callstack_size
+	}
+	if options.set["search-path"] {
+		overrides.SearchPaths = options.search_paths
+	}
+	if options.set["warnings-as-errors"] {
+		overrides.WarningsAsErrors = &options.warnings_as_errors
+	}
+	if options.set["step-budget"] {
+		overrides.StepBudget = &options.step_budget
+	}
+
+	if options.set["allow"] {
+		read, write := false, false
+		overrides.Permissions = &config.Permissions{Read: &read, Write: &write}
+		for _, permission := range strings.Split(options.allow, ",") {
+			switch strings.TrimSpace(permission) {
+			case "read":
+				read = true
+			case "write":
+				write = true
+			case "":
+			default:
+				return errors.New("Unknown permission '" + permission + "', expected read or write")
+			}
+		}
+	}
+	options.overrides = overrides
+	return nil
+}
+
+// load resolves the settings of a program in a directory, its closest bir.config.json comes first, then
+// the environment variables and then the flags
+func (options *options) load(directory string) error {
+	settings, err := config.Resolve(directory, options.overrides)
+	if err != nil {
+		return err
+	}
+
+	// The embedded standard library is used when no directory is given
+	options.settings = settings
+	options.std_path = ""
+	if settings.StdPath != nil {
+		options.std_path = *settings.StdPath
+	}
+	if settings.ColoredOutput != nil {
+		options.color = *settings.ColoredOutput
+	}
+	return nil
+}
+
+func (options *options) engine(file_path string, anonymous bool) (engine.BirEngine, error) {
+	instance := engine.NewEngine(file_path, options.std_path, anonymous, options.color, 0)
+	return instance, engine.ApplyConfig(options.settings.Map(), &instance)
+}
+
+func (options *options) machine() *vm.Machine {
+	settings := options.settings
+	machine := vm.NewMachine(options.std_path, options.color, 0)
+	if settings.VerbosityLevel != nil {
+		machine.VerbosityLevel = *settings.VerbosityLevel
+	}
+	if settings.MaximumCallstackSize != nil && *settings.MaximumCallstackSize > 0 {
+		machine.MaximumCallstackSize = *settings.MaximumCallstackSize
+	}
+	if settings.StepBudget != nil {
+		machine.StepBudget = *settings.StepBudget
+	}
+	if settings.WarningsAsErrors != nil {
+		machine.WarningsAsErrors = *settings.WarningsAsErrors
+	}
+	machine.SearchPaths = settings.SearchPaths
+	if settings.Permissions != nil {
+		machine.Permissions = &implementor.Permissions{
+			Read:  settings.Permissions.Read == nil || *settings.Permissions.Read,
+			Write: settings.Permissions.Write == nil || *settings.Permissions.Write,
+		}
+	}
+	return machine
+}
+
+// report prints an error returned by the engine
+func (options *options) report(err error) {
+	if bir_error, ok := err.(*thrower.BirError); ok {
+		os.Stderr.WriteString(bir_error.Format(util.NewColor(options.color)))
+	} else {
+		os.Stderr.WriteString(err.Error() + "\n")
+	}
+}
+
+// source reads the program a command works on, the standard input when the argument is '-'. Programs
+// that do not come from a file are named in brackets.
+func source(argument string) (string, string, error) {
+	if argument == "-" {
+		raw, err := io.ReadAll(os.Stdin)
+		return "[stdin]", string(raw), err
+	}
+	raw, err := os.ReadFile(argument)
+	if err != nil {
+		return argument, "", errors.New("Could not read file '" + argument + "'")
+	}
+	return argument, string(raw), nil
+}
 
-			// v, _ := json.MarshalIndent(instance.GetCurrentScope().Frame, "", "  ")
-			// fmt.Println(string(v))
+// run runs a program with the options of the 'run' command and returns the exit code of the process
+func run(arguments []string) int {
+	options := &options{}
+	flags := newFlags("run", "run [flags] <file | -> | run [flags] -e <program>", "Runs a bir program, '-' reads it from the standard input.", options)
+	inline := flags.String("e", "", "run the given program instead of a file")
+	use_vm := flags.Bool("vm", false, "compile the program to bytecode and run it on the virtual machine")
+	trace_enabled := flags.Bool("trace", false, "log every statement and block call the engine runs")
+	trace_format := flags.String("trace-format", "text", "format of the trace, 'text' or 'json'")
+	trace_output := flags.String("trace-output", "", "write the trace to a file instead of the standard error")
+	profile_output := flags.String("profile", "", "write a pprof profile of the block calls and loops to a file and print a summary")
+	cover := flags.Bool("cover", false, "record which statements and branches run")
+	cover_output := flags.String("cover-output", "coverage.lcov", "write the lcov coverage report to a file")
+	cover_annotate := flags.String("cover-annotate", "", "write the annotated source report to a file instead of the standard error")
+	if code, ok := parseFlags(flags, options, arguments); !ok {
+		return code
+	}
+
+	if (flags.NArg() != 1 && !options.set["e"]) || (flags.NArg() != 0 && options.set["e"]) {
+		flags.Usage()
+		return exitUsage
+	}
+	if *use_vm && (*trace_enabled || *profile_output != "" || *cover) {
+		os.Stderr.WriteString("The virtual machine can not be traced, profiled or covered\n")
+		return exitUsage
+	}
+
+	// The program is given to the engine as its content when it does not come from a file, the engine
+	// reads files itself
+	file_path, content, directory := "[eval]", *inline, "."
+	if flags.Arg(0) == "-" {
+		var err error
+		if file_path, content, err = source("-"); err != nil {
+			options.report(err)
+			return exitFailure
+		}
+	} else if !options.set["e"] {
+		file_path, directory = flags.Arg(0), filepath.Dir(flags.Arg(0))
+	}
+	if file_path != flags.Arg(0) && strings.TrimSpace(content) == "" {
+		return exitSuccess
+	}
+	if err := options.load(directory); err != nil {
+		options.report(err)
+		return exitFailure
+	}
+
+	if *use_vm {
+		if err := options.machine().RunSource(file_path, content); err != nil {
+			options.report(err)
+			return exitFailure
+		}
+		return exitSuccess
+	}
+
+	instance, err := options.engine(file_path, false)
+	if err != nil {
+		options.report(err)
+		return exitFailure
+	}
+	instance.Content = content
+	tracers := engine.Tracers{}
+
+	if *trace_enabled {
+		format, err := trace.ParseFormat(*trace_format)
+		if err != nil {
+			options.report(err)
+			return exitUsage
+		}
+
+		var output io.Writer = os.Stderr
+		if *trace_output != "" {
+			file, err := os.Create(*trace_output)
+			if err != nil {
+				options.report(err)
+				return exitFailure
+			}
+			defer file.Close()
+			output = bufio.NewWriter(file)
+			defer output.(*bufio.Writer).Flush()
+		}
+		tracers = append(tracers, trace.New(output, format))
+	}
+
+	var profiler *profile.Profile
+	if *profile_output != "" {
+		profiler = profile.New()
+		tracers = append(tracers, profiler)
+	}
+
+	var recorder *coverage.Coverage
+	if *cover {
+		recorder = coverage.New()
+		tracers = append(tracers, recorder)
+	}
+
+	if len(tracers) == 1 {
+		instance.Tracer = tracers[0]
+	} else if len(tracers) > 1 {
+		instance.Tracer = tracers
+	}
+
+	code := exitSuccess
+	err = instance.Init()
+	if err == nil {
+		err = instance.Run()
+	}
+	if err != nil {
+		options.report(err)
+		code = exitFailure
+	}
+
+	if profiler != nil {
+		profiler.Stop()
+		file, err := os.Create(*profile_output)
+		if err == nil {
+			defer file.Close()
+			err = profiler.WritePprof(file)
+		}
+		if err != nil {
+			options.report(err)
+			return exitFailure
+		}
+		profiler.WriteSummary(os.Stderr)
+	}
+
+	if recorder != nil {
+		recorder.Collect(&instance)
+		if err := writeCoverage(recorder, *cover_output, *cover_annotate); err != nil {
+			options.report(err)
+			return exitFailure
+		}
+	}
+	return code
+}
+
+// writeCoverage writes the lcov report to a file and the annotated report to a file or the standard error
+func writeCoverage(recorder *coverage.Coverage, output string, annotate string) error {
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	recorder.WriteLCOV(file)
 
-			// v, _ := json.MarshalIndent(instance.GetCurrentScope().Blocks[1], "", "  ")
-			// fmt.Println(string(v))
+	if annotate == "" {
+		recorder.WriteAnnotated(os.Stderr)
+		return nil
+	}
+	annotated, err := os.Create(annotate)
+	if err != nil {
+		return err
+	}
+	defer annotated.Close()
+	recorder.WriteAnnotated(annotated)
+	return nil
+}
+
+func repl(arguments []string) int {
+	options := &options{}
+	flags := newFlags("repl", "repl [flags]", "Starts an interactive session, every input is run on top of the ones before and may span several lines until its braces are balanced.", options)
+	if code, ok := parseFlags(flags, options, arguments); !ok {
+		return code
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if err := options.load("."); err != nil {
+		options.report(err)
+		return exitFailure
+	}
 
-			// for _, block := range instance.GetCurrentScope().Blocks {
-			// 	fmt.Printf("%+v\n", block.Instance)
-			// }
+	repl_caret, continuation_caret := "> ", ". "
+	// The session reads its lines from the same reader the programs read the standard input from
+	session := &session{options: options, reader: bufio.NewReader(os.Stdin)}
+	if err := session.start(); err != nil {
+		options.report(err)
+		return exitFailure
+	}
+	os.Stdout.WriteString("Bir v" + version + "\n")
+	os.Stdout.WriteString("Exit using ctrl+c, :help lists the commands\n")
+	os.Stdout.WriteString(repl_caret)
 
+	// Lines are collected until their braces are balanced so that a block can span several of them
+	input := ""
+	for {
+		line, read_error := session.reader.ReadString('\n')
+		if line == "" && read_error != nil {
+			break
+		}
+		if input == "" && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			session.command(strings.TrimSpace(line))
 		} else {
-			repl_caret := "> "
-			instance := engine.NewEngine("", std_path, true, false, 1)
-			instance.Init()
-			scanner := bufio.NewScanner(os.Stdin)
-			os.Stdout.WriteString("Bir v0.1.1\n")
-			os.Stdout.WriteString("Exit using ctrl+c\n")
-			os.Stdout.WriteString(repl_caret)
+			input += line
+			if strings.TrimSpace(input) == "" {
+				input = ""
+			} else if parser.Incomplete(input) && read_error == nil {
+				os.Stdout.WriteString(continuation_caret)
+				continue
+			} else {
+				session.eval(input)
+				input = ""
+			}
+		}
+		if read_error != nil {
+			break
+		}
+		os.Stdout.WriteString(repl_caret)
+	}
+	os.Stdout.WriteString("\n")
+	return exitSuccess
+}
+
+const repl_help = `Commands:
+  :vars              list the variables of the session
+  :blocks            list the blocks the session can call
+  :instance <block>  print the frame and the cells of a block instance
+  :load <file>       run a file in the session
+  :reset             start over with an empty session
+  :callstack         print the callstack of the last error
+  :time <input>      run an input and print how long it took
+  :save <file>       write the inputs that ran without an error to a file
+  :help              print this list
+`
+
+// session is the state of a repl, the engine keeps the declarations and the inputs are kept to be saved
+type session struct {
+	options  *options
+	reader   *bufio.Reader
+	instance *engine.BirEngine
+	// history holds the inputs that ran without an error
+	history []string
+	// failed tells if an input has thrown an error, the engine keeps its callstack for :callstack
+	failed bool
+}
+
+func (session *session) start() error {
+	instance, err := session.options.engine("", true)
+	if err != nil {
+		return err
+	}
+	instance.Stdin = session.reader
+	if err := instance.Init(); err != nil {
+		return err
+	}
+	session.instance = &instance
+	session.history = nil
+	session.failed = false
+	return nil
+}
+
+// eval runs an input and prints its value, an input that fails is reported and is not kept
+func (session *session) eval(input string) {
+	result, err := session.instance.Feed(input)
+	if err != nil {
+		session.failed = true
+		session.options.report(err)
+		return
+	}
+	session.history = append(session.history, strings.TrimRight(input, "\n"))
+	os.Stdout.WriteString(result + "\n")
+}
+
+// command runs a line that starts with ':', the commands inspect and manage the session
+func (session *session) command(line string) {
+	name, argument := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, argument = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	expects := func(what string) bool {
+		if argument == "" {
+			session.options.report(errors.New("Command '" + name + "' expects " + what))
+			return false
+		}
+		return true
+	}
+
+	switch name {
+	case ":help":
+		os.Stdout.WriteString(repl_help)
+	case ":vars":
+		session.variables()
+	case ":blocks":
+		session.blocks()
+	case ":instance":
+		if expects("a block name") {
+			session.dumpInstance(argument)
+		}
+	case ":load":
+		if expects("a file") {
+			session.load(argument)
+		}
+	case ":reset":
+		if err := session.start(); err != nil {
+			session.options.report(err)
+		}
+	case ":callstack":
+		if !session.failed {
+			os.Stdout.WriteString("No error has been thrown\n")
+			return
+		}
+		if len(session.instance.Unwound) == 0 {
+			os.Stdout.WriteString("The last error was thrown before the input ran\n")
+			return
+		}
+		for _, entry := range session.instance.Unwound {
+			os.Stdout.WriteString("  " + entry.Label + "\n")
+		}
+	case ":time":
+		if expects("an input") {
+			started := time.Now()
+			session.eval(argument + "\n")
+			os.Stdout.WriteString("Took " + time.Since(started).String() + "\n")
+		}
+	case ":save":
+		if !expects("a file") {
+			return
+		}
+		content := strings.Join(session.history, "\n")
+		if content != "" {
+			content += "\n"
+		}
+		if err := os.WriteFile(argument, []byte(content), 0644); err != nil {
+			session.options.report(errors.New("Could not write file '" + argument + "'"))
+			return
+		}
+		os.Stdout.WriteString("Saved " + strconv.Itoa(len(session.history)) + " input(s) to '" + argument + "'\n")
+	default:
+		session.options.report(errors.New("Unknown command '" + name + "', :help lists the commands"))
+	}
+}
+
+// variables prints the variables that the session can read, closest scope first
+func (session *session) variables() {
+	seen := map[string]bool{}
+	scopes := session.instance.Scopestack.Scopes
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if scopes[i].Alias != "" {
+			continue
+		}
+		for _, value := range scopes[i].Frame {
+			if seen[value.Key.Value] || !scopes[i].Visible(value.Key.Value) {
+				continue
+			}
+			seen[value.Key.Value] = true
+			os.Stdout.WriteString(value.Kind + " " + value.Key.Value + " = " + strconv.FormatInt(value.Value.Value, 10) + "\n")
+		}
+	}
+}
+
+// blocks prints the blocks that a call in the session would find, closest scope first
+func (session *session) blocks() {
+	seen := map[string]bool{}
+	scopes := session.instance.Scopestack.Scopes
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if scopes[i].Alias != "" {
+			continue
+		}
+		for j := range scopes[i].Blocks {
+			block := &scopes[i].Blocks[j]
+			if seen[block.Name.Value] || !scopes[i].Visible(block.Name.Value) {
+				continue
+			}
+			seen[block.Name.Value] = true
+			if block.Native {
+				os.Stdout.WriteString(block.Name.Value + " (native)\n")
+				continue
+			}
+			os.Stdout.WriteString(strings.Split(lsp.Describe(block), "\n")[0] + "\n")
+		}
+	}
+}
 
-			for scanner.Scan() {
-				result := instance.Feed(scanner.Text())
-				os.Stdout.WriteString(result + "\n")
-				os.Stdout.WriteString(repl_caret)
+// dumpInstance prints the variables and the cells of the instance of a block, blocks of namespaces are
+// given by their qualified names
+func (session *session) dumpInstance(name string) {
+	scopestack := &session.instance.Scopestack
+	found := scopestack.FindBlock(name)
+	if i := strings.LastIndex(name, "."); i >= 0 && scopestack.NamespaceExists(name[:i]) {
+		found = scopestack.FindInNamespaceBlock(name[:i], name[i+1:])
+	}
+	if found.Block == nil {
+		session.options.report(errors.New("Could not find block '" + name + "'"))
+		return
+	}
+	instance, ok := found.Block.Instance.(*scope.Scope)
+	if !ok || instance == nil {
+		session.options.report(errors.New("Block '" + name + "' has no instance"))
+		return
+	}
+
+	os.Stdout.WriteString("frame:\n")
+	for _, value := range instance.Frame {
+		os.Stdout.WriteString("  " + value.Kind + " " + value.Key.Value + " = " + strconv.FormatInt(value.Value.Value, 10) + "\n")
+	}
+	indexes := []int64{}
+	for index := range instance.Cells {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	os.Stdout.WriteString("cells:\n")
+	for _, index := range indexes {
+		os.Stdout.WriteString("  [" + strconv.FormatInt(index, 10) + "] = " + strconv.FormatInt(instance.Cells[index].Value, 10) + "\n")
+	}
+}
+
+// load runs a file in the session, its relative imports are found next to it
+func (session *session) load(file_path string) {
+	raw, err := os.ReadFile(file_path)
+	if err != nil {
+		session.options.report(errors.New("Could not read file '" + file_path + "'"))
+		return
+	}
+
+	directory := session.instance.Directory
+	session.instance.Directory, _ = filepath.Split(file_path)
+	session.eval(string(raw))
+	session.instance.Directory = directory
+}
+
+// check reports what the language server would report for each program, warnings do not fail it
+func check(arguments []string) int {
+	options := &options{}
+	flags := newFlags("check", "check [flags] <file | -> ...", "Reports the syntax and reference errors of programs without running them.", options)
+	if code, ok := parseFlags(flags, options, arguments); !ok {
+		return code
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	code := exitSuccess
+	for _, argument := range flags.Args() {
+		file_path, content, err := source(argument)
+		if err == nil && argument != "-" {
+			err = options.load(filepath.Dir(file_path))
+		} else if err == nil {
+			err = options.load(".")
+		}
+		if err != nil {
+			options.report(err)
+			code = exitFailure
+			continue
+		}
+		analyzer := lsp.Analyzer{StdPath: options.std_path, SearchPaths: options.settings.SearchPaths}
+
+		absolute, err := filepath.Abs(file_path)
+		if err != nil {
+			absolute = file_path
+		}
+		document := analyzer.Analyze(lsp.PathToURI(filepath.ToSlash(absolute)), content)
+		sort.SliceStable(document.Diagnostics, func(i, j int) bool {
+			a, b := document.Diagnostics[i].Range.Start, document.Diagnostics[j].Range.Start
+			return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+		})
+		for _, diagnostic := range document.Diagnostics {
+			severity := "warning"
+			if diagnostic.Severity == lsp.SeverityError {
+				severity = "error"
+				code = exitFailure
 			}
+			start := diagnostic.Range.Start
+			os.Stderr.WriteString(file_path + ":" + strconv.Itoa(start.Line+1) + ":" + strconv.Itoa(start.Character+1) + ": " + severity + ": " + diagnostic.Message + "\n")
+		}
+	}
+	return code
+}
+
+func formatCommand(arguments []string) int {
+	flags := newFlags("fmt", "fmt [flags] <file | -> ...", "Formats programs and prints them, '-' reads one from the standard input.", nil)
+	write := flags.Bool("w", false, "write the result to the file instead of printing it")
+	list := flags.Bool("l", false, "list the files whose formatting differs instead of printing them")
+	if code, ok := parseFlags(flags, nil, arguments); !ok {
+		return code
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	code := exitSuccess
+	for _, argument := range flags.Args() {
+		file_path, content, err := source(argument)
+		if err == nil {
+			var formatted string
+			if formatted, err = format.Format(content); err == nil {
+				switch {
+				case *list:
+					if formatted != content {
+						os.Stdout.WriteString(file_path + "\n")
+					}
+				case *write && argument != "-":
+					if formatted != content {
+						err = os.WriteFile(file_path, []byte(formatted), 0644)
+					}
+				default:
+					os.Stdout.WriteString(formatted)
+				}
+			}
+		}
+
+		if err != nil {
+			os.Stderr.WriteString(file_path + ": " + err.Error() + "\n")
+			code = exitFailure
+		}
+	}
+	return code
+}
+
+func parse(arguments []string) int {
+	flags := newFlags("parse", "parse [flags] <file | ->", "Prints the syntax tree of a program as json.", nil)
+	if code, ok := parseFlags(flags, nil, arguments); !ok {
+		return code
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file_path, content, err := source(flags.Arg(0))
+	if err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		return exitFailure
+	}
+
+	result := parser.Parse(content)
+	if result.Error {
+		raw := result.Content.(map[string]interface{})
+		position := raw["position"].(ast.Position)
+		os.Stderr.WriteString(file_path + ":" + strconv.Itoa(int(position.Line)) + ":" + strconv.Itoa(int(position.Col)) + ": " + raw["message"].(string) + "\n")
+		return exitFailure
+	}
+	program, err := ast.Decode(result.Content)
+	if err != nil {
+		os.Stderr.WriteString(file_path + ": " + err.Error() + "\n")
+		return exitFailure
+	}
+
+	output, err := json.MarshalIndent(program, "", "  ")
+	if err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		return exitFailure
+	}
+	os.Stdout.Write(append(output, '\n'))
+	return exitSuccess
+}
+
+// test runs the tests of the given files and directories and returns the exit code of the process
+func test(arguments []string) int {
+	options := &options{}
+	flags := newFlags("test", "test [flags] [file | directory] ...", "Runs every block starting with 'test' in the '_test.bir' files, the current directory is searched when none is given.", options)
+	cover := flags.Bool("cover", false, "record which statements and branches the tests run")
+	cover_output := flags.String("cover-output", "coverage.lcov", "write the lcov coverage report to a file")
+	cover_annotate := flags.String("cover-annotate", "", "write the annotated source report to a file instead of the standard error")
+	if code, ok := parseFlags(flags, options, arguments); !ok {
+		return code
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := tester.Discover(paths)
+	if err != nil {
+		options.report(err)
+		return exitUsage
+	}
+	if len(files) == 0 {
+		os.Stderr.WriteString("No test files found\n")
+		return exitFailure
+	}
+	if err := options.load("."); err != nil {
+		options.report(err)
+		return exitFailure
+	}
+
+	runner := tester.New(options.std_path)
+	// Every test file takes the config file closest to it
+	runner.Configure = func(instance *engine.BirEngine) error {
+		if err := options.load(filepath.Dir(instance.Path)); err != nil {
+			return err
 		}
+		return engine.ApplyConfig(options.settings.Map(), instance)
+	}
+	var recorder *coverage.Coverage
+	if *cover {
+		recorder = coverage.New()
+		runner.Tracer = recorder
+	}
+
+	for _, file := range files {
+		for _, result := range runner.RunFile(file) {
+			tester.WriteResult(os.Stdout, result, util.NewColor(options.color))
+		}
+	}
+	runner.WriteSummary(os.Stdout)
+
+	if recorder != nil {
+		for _, instance := range runner.Engines {
+			recorder.Collect(instance)
+		}
+		if err := writeCoverage(recorder, *cover_output, *cover_annotate); err != nil {
+			options.report(err)
+			return exitFailure
+		}
+	}
+
+	if runner.Failed() > 0 {
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+func serve(arguments []string) int {
+	options := &options{}
+	flags := newFlags("lsp", "lsp [flags]", "Serves the language server protocol on the standard input and output.", options)
+	if code, ok := parseFlags(flags, options, arguments); !ok {
+		return code
+	}
+	if err := options.load("."); err != nil {
+		options.report(err)
+		return exitFailure
+	}
+
+	if err := lsp.NewServer(options.settings).Serve(os.Stdin, os.Stdout); err != nil {
+		options.report(err)
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+func debug(arguments []string) int {
+	options := &options{}
+	flags := newFlags("debug", "debug [flags] [file]", "Serves the debug adapter protocol on the standard streams or on a tcp address, the file is debugged when the client does not name a program.", options)
+	address := flags.String("listen", "", "listen on a tcp address instead of the standard streams")
+	if code, ok := parseFlags(flags, options, arguments); !ok {
+		return code
+	}
+	directory := "."
+	if flags.NArg() > 0 {
+		directory = filepath.Dir(flags.Arg(0))
+	}
+	if err := options.load(directory); err != nil {
+		options.report(err)
+		return exitFailure
+	}
+
+	session := dap.NewSession(options.settings, flags.Arg(0))
+	var err error
+	if *address != "" {
+		err = session.Listen(*address)
 	} else {
-		os.Stdout.WriteString("Could not find bir standard path (BirStd) in your environment variables")
+		err = session.Serve(os.Stdin, os.Stdout)
+	}
+	if err != nil {
+		options.report(err)
+		return exitFailure
 	}
+	return exitSuccess
+}
+
+var commands = map[string]func(arguments []string) int{
+	"run":   run,
+	"repl":  repl,
+	"check": check,
+	"fmt":   formatCommand,
+	"parse": parse,
+	"test":  test,
+	"lsp":   serve,
+	"debug": debug,
+}
+
+func help(arguments []string) int {
+	if len(arguments) == 0 {
+		os.Stdout.WriteString(usage)
+		return exitSuccess
+	}
+	if command, ok := commands[arguments[0]]; ok {
+		return command([]string{"--help"})
+	}
+	os.Stderr.WriteString("Unknown command '" + arguments[0] + "'\n\n" + usage)
+	return exitUsage
+}
+
+func dispatch(arguments []string) int {
+	if len(arguments) == 0 {
+		return repl(arguments)
+	}
+
+	if command, ok := commands[arguments[0]]; ok {
+		return command(arguments[1:])
+	}
+	switch arguments[0] {
+	case "help", "-h", "-help", "--help":
+		return help(arguments[1:])
+	case "version", "-version", "--version":
+		os.Stdout.WriteString("Bir v" + version + "\n")
+		return exitSuccess
+	}
+
+	// 'bir <file>', 'bir -' and 'bir -e <program>' are short for 'bir run'
+	if _, err := os.Stat(arguments[0]); err != nil && !strings.HasPrefix(arguments[0], "-") && filepath.Ext(arguments[0]) == "" {
+		os.Stderr.WriteString("Unknown command '" + arguments[0] + "'\n\n" + usage)
+		return exitUsage
+	}
+	return run(arguments)
+}
+
+func main() {
+	os.Exit(dispatch(os.Args[1:]))
 }
@@ -0,0 +1,163 @@
+// Package bir lets Go programs host bir scripts without depending on the engine's internals
+package bir
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/canpacis/birlang/src/engine"
+	"github.com/canpacis/birlang/src/implementor"
+	"github.com/canpacis/birlang/src/thrower"
+	"github.com/canpacis/birlang/src/util"
+)
+
+type Options struct {
+	// StdPath is the directory 'std:' imports are loaded from, BirStd is used when it is empty and the
+	// embedded library when neither is set
+	StdPath string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	// Stderr receives warnings, errors are returned to the caller
+	Stderr               io.Writer
+	ColoredOutput        bool
+	VerbosityLevel       int
+	MaximumCallstackSize int
+	// StepBudget limits the loop iterations and block calls of every evaluation, 0 means no limit
+	StepBudget int64
+	// Implementors are registered as native blocks next to the 'bir' block
+	Implementors []implementor.Implementor
+	// Tracer is told about every statement and block call, see the trace package
+	Tracer engine.Tracer
+}
+
+// Interpreter is a bir engine whose top level persists between evaluations, variables and blocks
+// declared by one evaluation are visible to the next ones
+type Interpreter struct {
+	instance *engine.BirEngine
+}
+
+func New(options Options) (*Interpreter, error) {
+	if options.StdPath == "" {
+		options.StdPath = os.Getenv("BirStd")
+	}
+
+	instance := engine.NewEngine("", options.StdPath, true, options.ColoredOutput, options.VerbosityLevel)
+	for _, i := range options.Implementors {
+		instance.Register(i)
+	}
+	instance.MaximumCallstackSize = options.MaximumCallstackSize
+	instance.StepBudget = options.StepBudget
+	instance.Stdin = options.Stdin
+	instance.Stdout = options.Stdout
+	instance.Stderr = options.Stderr
+	instance.Tracer = options.Tracer
+
+	if err := instance.Init(); err != nil {
+		return nil, err
+	}
+	return &Interpreter{instance: &instance}, nil
+}
+
+// EvalString runs a piece of bir source and returns the value of its last block call
+func (interpreter *Interpreter) EvalString(source string) (int64, error) {
+	return interpreter.EvalStringContext(context.Background(), source)
+}
+
+// EvalStringContext is EvalString that stops once the context is done
+func (interpreter *Interpreter) EvalStringContext(ctx context.Context, source string) (int64, error) {
+	interpreter.begin(ctx)
+	defer interpreter.save()()
+	interpreter.instance.Anonymous = true
+	interpreter.instance.Content = source
+
+	value, err := interpreter.instance.Eval(source)
+	return value.Value, err
+}
+
+// EvalFile runs a bir file, its 'module:' imports are resolved relative to its directory
+func (interpreter *Interpreter) EvalFile(file_path string) (int64, error) {
+	return interpreter.EvalFileContext(context.Background(), file_path)
+}
+
+// EvalFileContext is EvalFile that stops once the context is done
+func (interpreter *Interpreter) EvalFileContext(ctx context.Context, file_path string) (int64, error) {
+	raw, err := os.ReadFile(file_path)
+	if err != nil {
+		return -1, interpreter.instance.Thrower.ThrowAnonymous(thrower.ImportError, "Could not read file '"+file_path+"'")
+	}
+
+	interpreter.begin(ctx)
+	defer interpreter.save()()
+	file_path = strings.ReplaceAll(file_path, "\\", "/")
+	dir, file := path.Split(file_path)
+	interpreter.instance.Anonymous = false
+	interpreter.instance.Path = file_path
+	interpreter.instance.URI = "file://" + file_path
+	interpreter.instance.Directory = dir
+	interpreter.instance.Filename = file
+	interpreter.instance.Content = string(raw)
+
+	value, err := interpreter.instance.Eval(string(raw))
+	return value.Value, err
+}
+
+// CallBlock calls a block declared by an earlier evaluation or an import
+func (interpreter *Interpreter) CallBlock(name string, verbs []int64, arguments []int64) (int64, error) {
+	return interpreter.CallBlockContext(context.Background(), name, verbs, arguments)
+}
+
+// CallBlockContext is CallBlock that stops once the context is done
+func (interpreter *Interpreter) CallBlockContext(ctx context.Context, name string, verbs []int64, arguments []int64) (int64, error) {
+	interpreter.begin(ctx)
+
+	value, err := interpreter.instance.CallBlock(name, verbs, arguments)
+	return value.Value, err
+}
+
+// save records the source the engine runs, the returned function restores it once an evaluation of
+// another source is done
+func (interpreter *Interpreter) save() func() {
+	instance := interpreter.instance
+	anonymous, file_path, uri, directory, filename, content := instance.Anonymous, instance.Path, instance.URI, instance.Directory, instance.Filename, instance.Content
+
+	return func() {
+		instance.Anonymous, instance.Path, instance.URI = anonymous, file_path, uri
+		instance.Directory, instance.Filename, instance.Content = directory, filename, content
+	}
+}
+
+// begin prepares the engine for an evaluation, every evaluation has the whole step budget
+func (interpreter *Interpreter) begin(ctx context.Context) {
+	interpreter.instance.Context = ctx
+	interpreter.instance.ResetSteps()
+}
+
+func (interpreter *Interpreter) GetVariable(name string) (int64, error) {
+	result := interpreter.instance.Scopestack.FindVariable(name)
+
+	if result.Value == nil {
+		return -1, interpreter.instance.Thrower.ThrowAnonymous(thrower.ReferenceError, "Could not find variable '"+name+"' in the frame")
+	}
+	return result.Value.Value.Value, nil
+}
+
+// SetVariable assigns to a variable that an evaluation declared
+func (interpreter *Interpreter) SetVariable(name string, value int64) error {
+	result := interpreter.instance.Scopestack.FindVariable(name)
+
+	if result.Value == nil {
+		return interpreter.instance.Thrower.ThrowAnonymous(thrower.ReferenceError, "Could not assign to a variable that does not exist")
+	}
+	if result.Immutable || result.Value.Kind == "const" {
+		return interpreter.instance.Thrower.ThrowAnonymous(thrower.RuntimeError, "Could not assign to an immutable variable")
+	}
+	if result.Foreign {
+		return interpreter.instance.Thrower.ThrowAnonymous(thrower.RuntimeError, "Could not assign to a foreign variable")
+	}
+
+	result.Value.Value = util.GenerateIntPrimitive(value)
+	return nil
+}
@@ -0,0 +1,154 @@
+package bir
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/canpacis/birlang/internal/testfiles"
+	"github.com/canpacis/birlang/src/thrower"
+)
+
+func newInterpreter(t *testing.T, options Options) *Interpreter {
+	t.Helper()
+	interpreter, err := New(options)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return interpreter
+}
+
+func TestEvalString(t *testing.T) {
+	interpreter := newInterpreter(t, Options{})
+
+	if _, err := interpreter.EvalString("let a = 20\ndouble [n] { return n * 2 }"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	value, err := interpreter.EvalString("double (a + 1)")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if value != 42 {
+		t.Errorf("got %d, want 42, declarations should persist between evaluations", value)
+	}
+}
+
+func TestEvalStringErrors(t *testing.T) {
+	interpreter := newInterpreter(t, Options{})
+
+	_, err := interpreter.EvalString("let a = b")
+	var bir_error *thrower.BirError
+	if !errors.As(err, &bir_error) {
+		t.Fatalf("got %v, want a bir error", err)
+	}
+	if bir_error.Kind != thrower.ReferenceError || bir_error.Message != "Could not find variable 'b' in the frame" {
+		t.Errorf("got %s %q", bir_error.Kind, bir_error.Message)
+	}
+
+	if _, err := interpreter.EvalString("let a = 1"); err != nil {
+		t.Errorf("a failed evaluation broke the interpreter: %v", err)
+	}
+	if _, err := interpreter.EvalString("let b = 1 / 0"); err == nil {
+		t.Errorf("divided by zero without an error")
+	}
+}
+
+func TestVariables(t *testing.T) {
+	interpreter := newInterpreter(t, Options{})
+
+	if err := interpreter.SetVariable("limit", 5); err == nil {
+		t.Errorf("assigned to a variable that does not exist")
+	}
+	if _, err := interpreter.EvalString("let limit = 1"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := interpreter.SetVariable("limit", 5); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := interpreter.EvalString("limit = limit * 3"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if value, err := interpreter.GetVariable("limit"); err != nil || value != 15 {
+		t.Errorf("got %d %v, want 15", value, err)
+	}
+
+	if _, err := interpreter.EvalString("const fixed = 1"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := interpreter.SetVariable("fixed", 2); err == nil {
+		t.Errorf("assigned to a constant")
+	}
+	if _, err := interpreter.GetVariable("missing"); err == nil {
+		t.Errorf("read a variable that does not exist")
+	}
+}
+
+func TestCallBlock(t *testing.T) {
+	interpreter := newInterpreter(t, Options{})
+
+	if _, err := interpreter.EvalString("pick:verb [n] {\n  switch verb {\n    case 1 { return n * 10 }\n    default { return n }\n  }\n}"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if value, err := interpreter.CallBlock("pick", []int64{1}, []int64{4}); err != nil || value != 40 {
+		t.Errorf("got %d %v, want 40", value, err)
+	}
+	if value, err := interpreter.CallBlock("pick", []int64{2}, []int64{4}); err != nil || value != 4 {
+		t.Errorf("got %d %v, want 4", value, err)
+	}
+	if _, err := interpreter.CallBlock("missing", nil, nil); err == nil {
+		t.Errorf("called a block that does not exist")
+	}
+}
+
+func TestEvalFile(t *testing.T) {
+	directory := testfiles.Write(t, map[string]string{
+		"lib.bir":  "export square [n] { return n * n }\n",
+		"main.bir": "use \"std:util\"\nuse \"./lib.bir\"\nbir:util.push (square (8) + 1)\nbir:util.write (util.out)\n",
+	})
+
+	output := &bytes.Buffer{}
+	interpreter := newInterpreter(t, Options{Stdout: output})
+	if _, err := interpreter.EvalFile(directory + "/main.bir"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if output.String() != "A" {
+		t.Errorf("got %q, want %q", output.String(), "A")
+	}
+	if instance := interpreter.instance; !instance.Anonymous || instance.Path != "" || instance.Filename != "" || instance.Content != "" {
+		t.Errorf("the source of the file is left in the engine, got %q %q", instance.Path, instance.Content)
+	}
+
+	if _, err := interpreter.EvalFile(directory + "/missing.bir"); err == nil {
+		t.Errorf("evaluated a file that does not exist")
+	}
+}
+
+func TestStepBudget(t *testing.T) {
+	interpreter := newInterpreter(t, Options{StepBudget: 50})
+
+	for i := 0; i < 3; i++ {
+		if _, err := interpreter.EvalString("for 40 as i {\n  let x = i\n}"); err != nil {
+			t.Fatalf("evaluation %d: unexpected error %v, every evaluation has the whole budget", i, err)
+		}
+	}
+	_, err := interpreter.EvalString("for 60 as i {\n  let x = i\n}")
+	var bir_error *thrower.BirError
+	if !errors.As(err, &bir_error) || bir_error.Kind != thrower.BudgetError {
+		t.Errorf("got %v, want the budget to be exceeded", err)
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	interpreter := newInterpreter(t, Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := interpreter.EvalStringContext(ctx, "let n = 0\nwhile 1 == 1 {\n  n++\n}")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want the evaluation to be cancelled", err)
+	}
+	if _, err := interpreter.EvalString("let m = 1"); err != nil {
+		t.Errorf("a cancelled evaluation broke the interpreter: %v", err)
+	}
+}
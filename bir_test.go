@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/canpacis/birlang/internal/testfiles"
+)
+
+// capture runs a command with its standard streams redirected and returns its exit code and its output
+func capture(t *testing.T, stdin string, command func() int) (int, string, string) {
+	t.Helper()
+	streams := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	defer func() {
+		os.Stdin, os.Stdout, os.Stderr = streams[0], streams[1], streams[2]
+	}()
+
+	input_reader, input_writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		io.WriteString(input_writer, stdin)
+		input_writer.Close()
+	}()
+
+	outputs := []*bytes.Buffer{{}, {}}
+	done := make(chan struct{})
+	writers := []*os.File{}
+	for _, output := range outputs {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		writers = append(writers, writer)
+		go func(output *bytes.Buffer) {
+			io.Copy(output, reader)
+			done <- struct{}{}
+		}(output)
+	}
+
+	os.Stdin, os.Stdout, os.Stderr = input_reader, writers[0], writers[1]
+	code := command()
+	for _, writer := range writers {
+		writer.Close()
+		<-done
+	}
+	input_reader.Close()
+	return code, outputs[0].String(), outputs[1].String()
+}
+
+func TestDispatch(t *testing.T) {
+	directory := testfiles.Write(t, map[string]string{
+		"main.bir": "use \"std:util\"\nbir:util.push (104)\nbir:util.push (105)\nbir:util.write (util.out)\n",
+		"fail.bir": "let a = b\n",
+	})
+
+	tests := []struct {
+		name      string
+		arguments []string
+		stdin     string
+		code      int
+		stdout    string
+		stderr    string
+	}{
+		{"version", []string{"version"}, "", exitSuccess, "Bir v" + version + "\n", ""},
+		{"help", []string{"help"}, "", exitSuccess, usage, ""},
+		{"unknown command", []string{"build"}, "", exitUsage, "", "Unknown command 'build'\n\n" + usage},
+		{"unknown help", []string{"help", "build"}, "", exitUsage, "", "Unknown command 'build'\n\n" + usage},
+		{"run", []string{"run", directory + "/main.bir"}, "", exitSuccess, "hi", ""},
+		{"run a file", []string{directory + "/main.bir"}, "", exitSuccess, "hi", ""},
+		{"run on the vm", []string{"run", "--vm", directory + "/main.bir"}, "", exitSuccess, "hi", ""},
+		{"run inline", []string{"-e", "use \"std:util\"\nbir:util.push (33)\nbir:util.write (util.out)"}, "", exitSuccess, "!", ""},
+		{"run stdin", []string{"run", "-"}, "use \"std:util\"\nbir:util.push (63)\nbir:util.write (util.out)\n", exitSuccess, "?", ""},
+		{"run failure", []string{"run", directory + "/fail.bir"}, "", exitFailure, "", ""},
+		{"missing file", []string{"run", directory + "/missing.bir"}, "", exitFailure, "", "[ERROR] Could not read file '" + directory + "/missing.bir'\n"},
+		{"bad flag", []string{"run", "--allow", "exec", directory + "/main.bir"}, "", exitUsage, "", ""},
+		{"vm tracing", []string{"run", "--vm", "--trace", directory + "/main.bir"}, "", exitUsage, "", "The virtual machine can not be traced, profiled or covered\n"},
+	}
+
+	for _, test := range tests {
+		arguments := test.arguments
+		code, stdout, stderr := capture(t, test.stdin, func() int { return dispatch(arguments) })
+		if code != test.code {
+			t.Errorf("%s: got exit code %d, want %d, %q", test.name, code, test.code, stderr)
+		}
+		if stdout != test.stdout {
+			t.Errorf("%s: got output %q, want %q", test.name, stdout, test.stdout)
+		}
+		if test.stderr != "" && stderr != test.stderr {
+			t.Errorf("%s: got errors %q, want %q", test.name, stderr, test.stderr)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	directory := testfiles.Write(t, map[string]string{
+		"ok.bir":   "f [n] {\n  return n\n}\nlet a = f (1)\n",
+		"warn.bir": "f [n] {\n  return n\n}\nlet a = f (1, 2)\n",
+		"fail.bir": "let a = b\nlet c = d\n",
+	})
+
+	tests := []struct {
+		file   string
+		code   int
+		stderr string
+	}{
+		{"ok.bir", exitSuccess, ""},
+		{"warn.bir", exitSuccess, directory + "/warn.bir:4:9: warning: Expected 1 argument(s), found 2 while calling 'f'\n"},
+		{"fail.bir", exitFailure, directory + "/fail.bir:1:9: error: Could not find variable 'b' in the frame\n" + directory + "/fail.bir:2:9: error: Could not find variable 'd' in the frame\n"},
+	}
+	for _, test := range tests {
+		code, _, stderr := capture(t, "", func() int { return dispatch([]string{"check", directory + "/" + test.file}) })
+		if code != test.code || stderr != test.stderr {
+			t.Errorf("%s: got %d %q, want %d %q", test.file, code, stderr, test.code, test.stderr)
+		}
+	}
+}
+
+func TestFormatCommand(t *testing.T) {
+	directory := testfiles.Write(t, map[string]string{
+		"messy.bir": "let a=1\n",
+		"clean.bir": "let a = 1\n",
+	})
+
+	code, stdout, _ := capture(t, "", func() int { return dispatch([]string{"fmt", directory + "/messy.bir"}) })
+	if code != exitSuccess || stdout != "let a = 1\n" {
+		t.Errorf("got %d %q", code, stdout)
+	}
+	code, stdout, _ = capture(t, "", func() int {
+		return dispatch([]string{"fmt", "-l", directory + "/messy.bir", directory + "/clean.bir"})
+	})
+	if code != exitSuccess || stdout != directory+"/messy.bir\n" {
+		t.Errorf("got %d %q, want only the messy file to be listed", code, stdout)
+	}
+
+	code, stdout, _ = capture(t, "", func() int { return dispatch([]string{"fmt", "-w", directory + "/messy.bir"}) })
+	content, _ := os.ReadFile(directory + "/messy.bir")
+	if code != exitSuccess || stdout != "" || string(content) != "let a = 1\n" {
+		t.Errorf("got %d %q and %q in the file", code, stdout, content)
+	}
+
+	code, _, stderr := capture(t, "let a = \n", func() int { return dispatch([]string{"fmt", "-"}) })
+	if code != exitFailure || !strings.HasPrefix(stderr, "[stdin]: ") {
+		t.Errorf("got %d %q, want the program of the standard input to fail", code, stderr)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	code, stdout, _ := capture(t, "let a = 1\n", func() int { return dispatch([]string{"parse", "-"}) })
+	if code != exitSuccess {
+		t.Fatalf("got exit code %d", code)
+	}
+	tree := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(stdout), &tree); err != nil {
+		t.Fatalf("the output is not json: %v", err)
+	}
+	program, ok := tree["program"].([]interface{})
+	if !ok || len(program) != 1 {
+		t.Errorf("got %s, want a program of one statement", stdout)
+	}
+
+	code, _, stderr := capture(t, "let a = \n", func() int { return dispatch([]string{"parse", "-"}) })
+	if code != exitFailure || !strings.HasPrefix(stderr, "[stdin]:") {
+		t.Errorf("got %d %q", code, stderr)
+	}
+	if code, _, _ := capture(t, "", func() int { return dispatch([]string{"parse"}) }); code != exitUsage {
+		t.Errorf("got exit code %d without a file, want %d", code, exitUsage)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	directory := testfiles.Write(t, map[string]string{
+		"bir.config.json": `{"step_budget": 20}`,
+		"main.bir":        "let a = 0\nfor 50 as i {\n  a++\n}\n",
+	})
+
+	code, _, stderr := capture(t, "", func() int { return dispatch([]string{"run", directory + "/main.bir"}) })
+	if code != exitFailure || !strings.Contains(stderr, "exceeded its budget of 20 steps") {
+		t.Errorf("got %d %q, want the budget of the config file", code, stderr)
+	}
+	code, _, stderr = capture(t, "", func() int { return dispatch([]string{"run", "--step-budget", "100", directory + "/main.bir"}) })
+	if code != exitSuccess {
+		t.Errorf("got %d %q, want the flag to override the config file", code, stderr)
+	}
+	code, _, stderr = capture(t, "", func() int { return dispatch([]string{"run", "--vm", directory + "/main.bir"}) })
+	if code != exitFailure || !strings.Contains(stderr, "exceeded its budget of 20 steps") {
+		t.Errorf("got %d %q, want the virtual machine to follow the config file", code, stderr)
+	}
+
+	if err := os.WriteFile(directory+"/bir.config.json", []byte(`{"step_limit": 20}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	code, _, stderr = capture(t, "", func() int { return dispatch([]string{"run", directory + "/main.bir"}) })
+	if code != exitFailure || !strings.HasPrefix(stderr, "Unknown key 'step_limit'") {
+		t.Errorf("got %d %q, want the config file to be rejected", code, stderr)
+	}
+}
+
+// prompt is what the repl prints before its first input
+const prompt = "Bir v" + version + "\nExit using ctrl+c, :help lists the commands\n> "
+
+func TestRepl(t *testing.T) {
+	input := strings.Join([]string{
+		"let a = 20",
+		"double [n] {",
+		"  return n * 2",
+		"}",
+		"",
+		"double (a + 1)",
+		"let b = c",
+		"f [] { /* open",
+		"*/ return 1 }",
+		"f ()",
+		"double (",
+	}, "\n")
+	code, stdout, stderr := capture(t, input, func() int { return dispatch([]string{"repl"}) })
+
+	// Declarations persist between inputs, unbalanced braces and unterminated comments continue the input
+	// and an input that is cut off by the end of the input is run as it is
+	want := prompt + strings.Join([]string{
+		"-1",
+		"> . . -1",
+		"> > 42",
+		"> > . -1",
+		"> 1",
+		"> ",
+	}, "\n") + "\n"
+	if code != exitSuccess || stdout != want {
+		t.Errorf("got %d\n%s\nwant\n%s", code, stdout, want)
+	}
+	if !strings.HasPrefix(stderr, "[ERROR] Could not find variable 'c' in the frame in [REPL]\n") || strings.Count(stderr, "[ERROR]") != 2 {
+		t.Errorf("got errors %q", stderr)
+	}
+
+	if code, _, _ := capture(t, "", func() int { return dispatch([]string{"repl", "file.bir"}) }); code != exitUsage {
+		t.Errorf("got exit code %d for an argument, want %d", code, exitUsage)
+	}
+}
+
+func TestReplStdin(t *testing.T) {
+	// Programs read the standard input from the lines that follow them
+	input := "use \"std:util\"\nbir:util.read (util.out)\nxy\nbir:util.write (util.out)\n"
+	_, stdout, stderr := capture(t, input, func() int { return dispatch([]string{"repl"}) })
+	if !strings.Contains(stdout, "xy") || stderr != "" {
+		t.Errorf("got %q %q, want the line after the read to be the input of the program", stdout, stderr)
+	}
+}
+
+func TestReplCommands(t *testing.T) {
+	directory := testfiles.Write(t, map[string]string{
+		"lib.bir":  "export let base = 40\n",
+		"load.bir": "use \"./lib.bir\"\nlet loaded = base + 2\n",
+	})
+	input := strings.Join([]string{
+		"let a = 1",
+		"counter [] {",
+		"  init { let n = 0 }",
+		"  n++",
+		"  return n",
+		"}",
+		"counter ()",
+		":vars",
+		":blocks",
+		":instance counter",
+		":instance",
+		":instance missing",
+		":callstack",
+		"fail [] { throw 3 }",
+		"fail ()",
+		":callstack",
+		":time counter ()",
+		":save " + directory + "/saved.bir",
+		":load " + directory + "/load.bir",
+		":vars",
+		":reset",
+		":vars",
+		":bogus",
+	}, "\n") + "\n"
+	_, stdout, stderr := capture(t, input, func() int { return dispatch([]string{"repl"}) })
+
+	lines := []string{}
+	for _, line := range strings.Split(stdout, "\n") {
+		// The time an input took changes from run to run
+		if !strings.HasPrefix(line, "Took ") {
+			lines = append(lines, line)
+		}
+	}
+	want := prompt + strings.Join([]string{
+		"-1",
+		"> . . . . -1",
+		"> 1",
+		"> let a = 1",
+		"> bir (native)",
+		"counter []",
+		"> frame:",
+		"  let n = 1",
+		"cells:",
+		"> > > No error has been thrown",
+		"> -1",
+		"> >   main []",
+		"  fail",
+		"> 2",
+		"> Saved 5 input(s) to '" + directory + "/saved.bir'",
+		"> -1",
+		"> let a = 1",
+		"let loaded = 42",
+		"let base = 40",
+		"> > > > ",
+	}, "\n") + "\n"
+	if got := strings.Join(lines, "\n"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	messages := []string{
+		"Command ':instance' expects a block name",
+		"Could not find block 'missing'",
+		"[ERROR] Bir process has thrown error with value '3' in [REPL]",
+		"Unknown command ':bogus', :help lists the commands",
+	}
+	for _, message := range messages {
+		if !strings.Contains(stderr, message) {
+			t.Errorf("%q is not in the errors %q", message, stderr)
+		}
+	}
+
+	// Only the inputs that ran without an error are saved
+	saved, _ := os.ReadFile(directory + "/saved.bir")
+	if want := "let a = 1\ncounter [] {\n  init { let n = 0 }\n  n++\n  return n\n}\ncounter ()\nfail [] { throw 3 }\ncounter ()\n"; string(saved) != want {
+		t.Errorf("saved %q, want %q", saved, want)
+	}
+}
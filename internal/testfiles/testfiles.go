@@ -0,0 +1,25 @@
+// Package testfiles writes the files a test runs to disk
+package testfiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Write puts the files of a test in a directory of their own and returns the directory with forward
+// slashes, the names of the files could start with the directories they are in
+func Write(t *testing.T, files map[string]string) string {
+	t.Helper()
+	directory := filepath.ToSlash(t.TempDir())
+	for name, content := range files {
+		file_path := directory + "/" + name
+		if err := os.MkdirAll(filepath.Dir(file_path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file_path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return directory
+}
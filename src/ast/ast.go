@@ -10,54 +10,143 @@ type ErrorContent struct {
 	Position Position `json:"position"`
 }
 
+type Node interface {
+	GetOperation() string
+	GetPosition() Position
+}
+
+type Statement interface {
+	Node
+	statementNode()
+}
+
+type Expression interface {
+	Node
+	expressionNode()
+}
+
 type Program struct {
-	Imports []UseStatement `json:"imports"`
-	Program []interface{}  `json:"program"`
+	Imports []*UseStatement `json:"imports"`
+	Program []Statement     `json:"program"`
+}
+
+// Exports tells for each top level declaration of a program whether the files importing it can use
+// it, every declaration is exported when none of them is marked
+func (program *Program) Exports() map[string]bool {
+	marked := false
+	for _, statement := range program.Program {
+		switch statement := statement.(type) {
+		case *VariableDeclarationStatement:
+			marked = marked || statement.Exported
+		case *BlockDeclarationStatement:
+			marked = marked || statement.Exported
+		case *NamespaceDeclarationStatement:
+			marked = marked || statement.Exported
+		}
+	}
+
+	exports := map[string]bool{}
+	for _, statement := range program.Program {
+		switch statement := statement.(type) {
+		case *VariableDeclarationStatement:
+			exports[statement.Left.Value] = exports[statement.Left.Value] || statement.Exported || !marked
+		case *BlockDeclarationStatement:
+			exports[statement.Name.Value] = exports[statement.Name.Value] || statement.Exported || !marked
+		case *NamespaceDeclarationStatement:
+			exports[statement.Name.Value] = exports[statement.Name.Value] || statement.Exported || !marked
+		}
+	}
+	return exports
+}
+
+// ImportError is a name a use statement could not bring from the program it imports
+type ImportError struct {
+	Message  string   `json:"message"`
+	Position Position `json:"position"`
 }
 
+func (err ImportError) Error() string {
+	return err.Message
+}
+
+// Visible returns the names a use statement brings from a program with the given exports, which are
+// all the exported ones unless the statement names them
+func (statement *UseStatement) Visible(exports map[string]bool) (map[string]bool, error) {
+	if len(statement.Names) == 0 {
+		visible := map[string]bool{}
+		for name, exported := range exports {
+			if exported {
+				visible[name] = true
+			}
+		}
+		return visible, nil
+	}
+
+	visible := map[string]bool{}
+	for _, name := range statement.Names {
+		exported, declared := exports[name.Value]
+		if !declared {
+			return nil, ImportError{Message: "Could not find '" + name.Value + "' in '" + statement.Source.Value + "'", Position: name.Position}
+		}
+		if !exported {
+			return nil, ImportError{Message: "Could not import '" + name.Value + "', it is not exported by '" + statement.Source.Value + "'", Position: name.Position}
+		}
+		visible[name.Value] = true
+	}
+	return visible, nil
+}
+
+// UseStatement imports a module, an aliased module is only reachable through its alias as in 'enc.block'
+// and a module with names only brings those names as in 'use "std:io" { console }'
 type UseStatement struct {
-	Source   StringPrimitiveExpression `json:"source"`
-	Position Position                  `json:"position"`
+	Operation string                    `json:"operation"`
+	Source    StringPrimitiveExpression `json:"source"`
+	Alias     Identifier                `json:"alias"`
+	Names     []Identifier              `json:"names"`
+	Position  Position                  `json:"position"`
 }
 
-// export type Main = Statement | BlockCallExpression | Comment;
-type Main []interface{}
-
 type VariableDeclarationStatement struct {
-	Operation string                 `json:"operation"`
-	Kind      string                 `json:"kind"`
-	Left      Identifier             `json:"left"`
-	Right     map[string]interface{} `json:"right"`
-	Position  Position               `json:"position"`
+	Operation string     `json:"operation"`
+	Kind      string     `json:"kind"`
+	Left      Identifier `json:"left"`
+	Right     Expression `json:"right"`
+	Exported  bool       `json:"exported"`
+	Position  Position   `json:"position"`
 }
 
 type NamespaceDeclarationStatement struct {
-	Operation string                   `json:"operation"`
-	Name      Identifier               `json:"name"`
-	Body      []map[string]interface{} `json:"body"`
-	Position  Position                 `json:"position"`
+	Operation string      `json:"operation"`
+	Name      Identifier  `json:"name"`
+	Body      []Statement `json:"body"`
+	Exported  bool        `json:"exported"`
+	Position  Position    `json:"position"`
 }
 
 type BlockDeclarationStatement struct {
-	Operation    string       `json:"operation"`
-	Owner        string       `json:"owner"`
-	Name         Identifier   `json:"name"`
-	Verbs        []Identifier `json:"verbs"`
-	Arguments    []Identifier `json:"arguments"`
-	Body         interface{}  `json:"body"`
-	Implementing bool         `json:"implementing"`
-	Implements   Identifier   `json:"implements"`
-	Populate     []Population `json:"populate"`
-	Position     Position     `json:"position"`
-	Instance     interface{}  `json:"instance"`
-	Native       bool         `json:"native"`
+	Operation    string                     `json:"operation"`
+	Owner        string                     `json:"owner"`
+	Name         Identifier                 `json:"name"`
+	Verbs        []Identifier               `json:"verbs"`
+	Arguments    []Identifier               `json:"arguments"`
+	Body         *BlockBody                 `json:"body"`
+	Implementing bool                       `json:"implementing"`
+	Implements   Identifier                 `json:"implements"`
+	Populate     []Population               `json:"populate"`
+	Position     Position                   `json:"position"`
+	Instance     interface{}                `json:"instance"`
+	Namespaces   interface{}                `json:"-"`
+	Implemented  *BlockDeclarationStatement `json:"-"`
+	Native       bool                       `json:"native"`
+	Exported     bool                       `json:"exported"`
+	Function     NativeFunction             `json:"-"`
 }
 
 type Population struct {
-	Operation string      `json:"operation"`
-	Key       string      `json:"key"`
-	Value     interface{} `json:"value"`
-	Position  Position    `json:"position"`
+	Operation string     `json:"operation"`
+	Key       string     `json:"key"`
+	Value     Expression `json:"value"`
+	Position  Position   `json:"position"`
 }
 
 type NativeFunction func(arguments []IntPrimitiveExpression, verbs []IntPrimitiveExpression) NativeFunctionReturn
@@ -69,45 +158,45 @@ type NativeFunctionReturn struct {
 }
 
 type ForStatement struct {
-	Operation   string                 `json:"operation"`
-	Statement   map[string]interface{} `json:"statement"`
-	Placeholder string                 `json:"placeholder"`
-	Body        []interface{}          `json:"body"`
-	Position    Position               `json:"position"`
+	Operation   string      `json:"operation"`
+	Statement   Expression  `json:"statement"`
+	Placeholder string      `json:"placeholder"`
+	Body        []Statement `json:"body"`
+	Position    Position    `json:"position"`
 }
 
 type SwitchStatement struct {
-	Operation string                 `json:"operation"`
-	Condition map[string]interface{} `json:"condition"`
-	Cases     []SwitchCase           `json:"cases"`
-	Default   SwitchCase             `json:"default"`
-	Position  Position               `json:"position"`
+	Operation string       `json:"operation"`
+	Condition Expression   `json:"condition"`
+	Cases     []SwitchCase `json:"cases"`
+	Default   SwitchCase   `json:"default"`
+	Position  Position     `json:"position"`
 }
 
 type SwitchCase struct {
-	Case map[string]interface{} `json:"case"`
-	Body []interface{}          `json:"body"`
+	Case Expression  `json:"case"`
+	Body []Statement `json:"body"`
 }
 
 type WhileStatement struct {
-	Operation string                 `json:"operation"`
-	Statement map[string]interface{} `json:"statement"`
-	Body      []interface{}          `json:"body"`
-	Position  Position               `json:"position"`
+	Operation string      `json:"operation"`
+	Statement Expression  `json:"statement"`
+	Body      []Statement `json:"body"`
+	Position  Position    `json:"position"`
 }
 
 type IfStatement struct {
-	Operation string                 `json:"operation"`
-	Condition map[string]interface{} `json:"condition"`
-	Body      []interface{}          `json:"body"`
-	Else      []interface{}          `json:"else"`
-	Elifs     []Elif                 `json:"elifs"`
-	Position  Position               `json:"position"`
+	Operation string      `json:"operation"`
+	Condition Expression  `json:"condition"`
+	Body      []Statement `json:"body"`
+	Else      []Statement `json:"else"`
+	Elifs     []Elif      `json:"elifs"`
+	Position  Position    `json:"position"`
 }
 
 type Elif struct {
-	Condition map[string]interface{} `json:"condition"`
-	Body      []interface{}          `json:"body"`
+	Condition Expression  `json:"condition"`
+	Body      []Statement `json:"body"`
 }
 
 type ReturnStatement struct {
@@ -123,28 +212,24 @@ type ThrowStatement struct {
 }
 
 type AssignStatement struct {
-	Operation string                 `json:"operation"`
-	Left      Identifier             `json:"left"`
-	Right     map[string]interface{} `json:"right"`
-	Position  Position               `json:"position"`
+	Operation string     `json:"operation"`
+	Left      Identifier `json:"left"`
+	Right     Expression `json:"right"`
+	Binding   Binding    `json:"binding"`
+	Position  Position   `json:"position"`
 }
 
 type QuantityModifierStatement struct {
-	Operation string                 `json:"operation"`
-	Type      string                 `json:"type"`
-	Statement map[string]interface{} `json:"statement"`
-	Right     map[string]interface{} `json:"right"`
-	Position  Position               `json:"position"`
+	Operation string     `json:"operation"`
+	Type      string     `json:"type"`
+	Statement Expression `json:"statement"`
+	Right     Expression `json:"right"`
+	Position  Position   `json:"position"`
 }
 
 type BlockBody struct {
-	Init    []interface{} `json:"init"`
-	Program []interface{} `json:"program"`
-}
-
-type Expression struct {
-	Operation string   `json:"operation"`
-	Position  Position `json:"position"`
+	Init    []Statement `json:"init"`
+	Program []Statement `json:"program"`
 }
 
 type NamespaceIndexerExpression struct {
@@ -166,6 +251,7 @@ type ReferenceExpression struct {
 	Operation string   `json:"operation"`
 	Negative  bool     `json:"negative"`
 	Value     string   `json:"value"`
+	Binding   Binding  `json:"binding"`
 	Position  Position `json:"position"`
 }
 
@@ -177,19 +263,23 @@ type ArithmeticExpression struct {
 	Position  Position   `json:"position"`
 }
 
+// BlockCallExpression calls a block, the namespace is the alias of the module the block is in for
+// qualified calls like 'enc.block (x)' and empty otherwise
 type BlockCallExpression struct {
-	Operation string                   `json:"operation"`
-	Name      Identifier               `json:"name"`
-	Verbs     []map[string]interface{} `json:"verbs"`
-	Arguments []map[string]interface{} `json:"arguments"`
-	Position  Position                 `json:"position"`
+	Operation string       `json:"operation"`
+	Namespace Identifier   `json:"namespace"`
+	Name      Identifier   `json:"name"`
+	Verbs     []Expression `json:"verbs"`
+	Arguments []Expression `json:"arguments"`
+	Binding   Binding      `json:"binding"`
+	Position  Position     `json:"position"`
 }
 
 type ScopeMutaterExpression struct {
-	Operation string                   `json:"operation"`
-	Mutater   MutaterKeyword           `json:"mutater"`
-	Arguments []map[string]interface{} `json:"arguments"`
-	Position  Position                 `json:"position"`
+	Operation string         `json:"operation"`
+	Mutater   MutaterKeyword `json:"mutater"`
+	Arguments []Expression   `json:"arguments"`
+	Position  Position       `json:"position"`
 }
 
 type MutaterKeyword struct {
@@ -206,9 +296,6 @@ type Identifier struct {
 	Position  Position `json:"position"`
 }
 
-type PrimitiveExpression struct {
-}
-
 type StringPrimitiveExpression struct {
 	Operation string   `json:"operation"`
 	Type      string   `json:"type"`
@@ -224,10 +311,20 @@ type IntPrimitiveExpression struct {
 }
 
 type ArrayPrimitiveExpression struct {
-	Operation string                   `json:"operation"`
-	Type      string                   `json:"type"`
-	Values    []map[string]interface{} `json:"values"`
-	Position  Position                 `json:"position"`
+	Operation string       `json:"operation"`
+	Type      string       `json:"type"`
+	Values    []Expression `json:"values"`
+	Position  Position     `json:"position"`
+}
+
+// Binding locates a name on the scopestack, Depth counts the scopes below the current one and Index is
+// the position of the value in that scope. Bindings are filled in by the resolver before execution.
+// A block runs on top of the scopes of its caller, the names it does not declare itself are Dynamic
+// and they are found by their names when the block runs.
+type Binding struct {
+	Depth   int  `json:"depth"`
+	Index   int  `json:"index"`
+	Dynamic bool `json:"dynamic"`
 }
 
 type Position struct {
@@ -240,3 +337,78 @@ type Comment struct {
 	Value     string   `json:"value"`
 	Position  Position `json:"position"`
 }
+
+func (node UseStatement) GetOperation() string                  { return node.Operation }
+func (node VariableDeclarationStatement) GetOperation() string  { return node.Operation }
+func (node NamespaceDeclarationStatement) GetOperation() string { return node.Operation }
+func (node BlockDeclarationStatement) GetOperation() string     { return node.Operation }
+func (node ForStatement) GetOperation() string                  { return node.Operation }
+func (node SwitchStatement) GetOperation() string               { return node.Operation }
+func (node WhileStatement) GetOperation() string                { return node.Operation }
+func (node IfStatement) GetOperation() string                   { return node.Operation }
+func (node ReturnStatement) GetOperation() string               { return node.Operation }
+func (node ThrowStatement) GetOperation() string                { return node.Operation }
+func (node AssignStatement) GetOperation() string               { return node.Operation }
+func (node QuantityModifierStatement) GetOperation() string     { return node.Operation }
+func (node NamespaceIndexerExpression) GetOperation() string    { return node.Operation }
+func (node ConditionExpression) GetOperation() string           { return node.Operation }
+func (node ReferenceExpression) GetOperation() string           { return node.Operation }
+func (node ArithmeticExpression) GetOperation() string          { return node.Operation }
+func (node BlockCallExpression) GetOperation() string           { return node.Operation }
+func (node ScopeMutaterExpression) GetOperation() string        { return node.Operation }
+func (node StringPrimitiveExpression) GetOperation() string     { return node.Operation }
+func (node IntPrimitiveExpression) GetOperation() string        { return node.Operation }
+func (node ArrayPrimitiveExpression) GetOperation() string      { return node.Operation }
+func (node Comment) GetOperation() string                       { return node.Operation }
+func (node Identifier) GetOperation() string                    { return node.Operation }
+
+func (node UseStatement) GetPosition() Position                  { return node.Position }
+func (node VariableDeclarationStatement) GetPosition() Position  { return node.Position }
+func (node NamespaceDeclarationStatement) GetPosition() Position { return node.Position }
+func (node BlockDeclarationStatement) GetPosition() Position     { return node.Position }
+func (node ForStatement) GetPosition() Position                  { return node.Position }
+func (node SwitchStatement) GetPosition() Position               { return node.Position }
+func (node WhileStatement) GetPosition() Position                { return node.Position }
+func (node IfStatement) GetPosition() Position                   { return node.Position }
+func (node ReturnStatement) GetPosition() Position               { return node.Position }
+func (node ThrowStatement) GetPosition() Position                { return node.Position }
+func (node AssignStatement) GetPosition() Position               { return node.Position }
+func (node QuantityModifierStatement) GetPosition() Position     { return node.Position }
+func (node NamespaceIndexerExpression) GetPosition() Position    { return node.Position }
+func (node ConditionExpression) GetPosition() Position           { return node.Position }
+func (node ReferenceExpression) GetPosition() Position           { return node.Position }
+func (node ArithmeticExpression) GetPosition() Position          { return node.Position }
+func (node BlockCallExpression) GetPosition() Position           { return node.Position }
+func (node ScopeMutaterExpression) GetPosition() Position        { return node.Position }
+func (node StringPrimitiveExpression) GetPosition() Position     { return node.Position }
+func (node IntPrimitiveExpression) GetPosition() Position        { return node.Position }
+func (node ArrayPrimitiveExpression) GetPosition() Position      { return node.Position }
+func (node Comment) GetPosition() Position                       { return node.Position }
+func (node Identifier) GetPosition() Position                    { return node.Position }
+
+func (UseStatement) statementNode()                  {}
+func (VariableDeclarationStatement) statementNode()  {}
+func (NamespaceDeclarationStatement) statementNode() {}
+func (BlockDeclarationStatement) statementNode()     {}
+func (ForStatement) statementNode()                  {}
+func (SwitchStatement) statementNode()               {}
+func (WhileStatement) statementNode()                {}
+func (IfStatement) statementNode()                   {}
+func (ReturnStatement) statementNode()               {}
+func (ThrowStatement) statementNode()                {}
+func (AssignStatement) statementNode()               {}
+func (QuantityModifierStatement) statementNode()     {}
+func (NamespaceIndexerExpression) statementNode()    {}
+func (BlockCallExpression) statementNode()           {}
+func (ScopeMutaterExpression) statementNode()        {}
+func (Comment) statementNode()                       {}
+
+func (NamespaceIndexerExpression) expressionNode() {}
+func (ConditionExpression) expressionNode()        {}
+func (ReferenceExpression) expressionNode()        {}
+func (ArithmeticExpression) expressionNode()       {}
+func (BlockCallExpression) expressionNode()        {}
+func (ScopeMutaterExpression) expressionNode()     {}
+func (StringPrimitiveExpression) expressionNode()  {}
+func (IntPrimitiveExpression) expressionNode()     {}
+func (ArrayPrimitiveExpression) expressionNode()   {}
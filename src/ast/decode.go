@@ -0,0 +1,414 @@
+package ast
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+type DecodeError struct {
+	Message  string   `json:"message"`
+	Position Position `json:"position"`
+}
+
+func (err DecodeError) Error() string {
+	return err.Message
+}
+
+type decoder struct {
+	position Position
+}
+
+// Decode builds a typed program out of the parser output, which is the same tree of maps and
+// slices the javascript parser used to print as json. Malformed input is reported as a DecodeError
+// with the position of the closest node that could be read.
+func Decode(content interface{}) (program *Program, err error) {
+	d := decoder{}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if decode_error, ok := r.(DecodeError); ok {
+				program = nil
+				err = decode_error
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	raw := d.object(content, "program")
+	program = &Program{}
+
+	for _, use := range d.list(raw["imports"]) {
+		program.Imports = append(program.Imports, d.use(use))
+	}
+	program.Program = d.statements(raw["program"])
+	if program.Program == nil {
+		program.Program = []Statement{}
+	}
+
+	return program, nil
+}
+
+func (d *decoder) fail(message string) {
+	panic(DecodeError{Message: message, Position: d.position})
+}
+
+func (d *decoder) object(value interface{}, what string) map[string]interface{} {
+	raw, ok := value.(map[string]interface{})
+	if !ok {
+		d.fail("Malformed syntax tree, expected " + what)
+	}
+	if position, ok := raw["position"]; ok {
+		d.position = d.decodePosition(position)
+	}
+	return raw
+}
+
+func (d *decoder) list(value interface{}) []interface{} {
+	if value == nil {
+		return nil
+	}
+	raw, ok := value.([]interface{})
+	if !ok {
+		d.fail("Malformed syntax tree, expected a list")
+	}
+	return raw
+}
+
+func (d *decoder) string(raw map[string]interface{}, key string) string {
+	value, ok := raw[key].(string)
+	if !ok && raw[key] != nil {
+		d.fail("Malformed syntax tree, expected '" + key + "' to be a string")
+	}
+	return value
+}
+
+func (d *decoder) bool(raw map[string]interface{}, key string) bool {
+	value, ok := raw[key].(bool)
+	if !ok && raw[key] != nil {
+		d.fail("Malformed syntax tree, expected '" + key + "' to be a boolean")
+	}
+	return value
+}
+
+func (d *decoder) int(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case json.Number:
+		result, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			d.fail("Malformed syntax tree, '" + string(v) + "' is not an integer")
+		}
+		return result
+	}
+	d.fail("Malformed syntax tree, expected an integer")
+	return 0
+}
+
+func (d *decoder) decodePosition(value interface{}) Position {
+	switch v := value.(type) {
+	case Position:
+		return v
+	case map[string]interface{}:
+		return Position{Line: uint32(d.int(v["line"])), Col: uint32(d.int(v["col"]))}
+	}
+	d.fail("Malformed syntax tree, expected a position")
+	return Position{}
+}
+
+func (d *decoder) positionOf(raw map[string]interface{}) Position {
+	if raw["position"] == nil {
+		return d.position
+	}
+	return d.decodePosition(raw["position"])
+}
+
+func (d *decoder) identifier(value interface{}) Identifier {
+	if value == nil {
+		return Identifier{}
+	}
+	raw := d.object(value, "an identifier")
+	return Identifier{
+		Operation: "identifier",
+		Negative:  d.bool(raw, "negative"),
+		Value:     d.string(raw, "value"),
+		Position:  d.positionOf(raw),
+	}
+}
+
+func (d *decoder) identifiers(value interface{}) []Identifier {
+	result := []Identifier{}
+	for _, raw := range d.list(value) {
+		result = append(result, d.identifier(raw))
+	}
+	return result
+}
+
+func (d *decoder) use(value interface{}) *UseStatement {
+	raw := d.object(value, "a use statement")
+	source := d.expression(raw["source"])
+	str, ok := source.(*StringPrimitiveExpression)
+	if !ok {
+		d.fail("Use statements expect a string source")
+	}
+
+	return &UseStatement{Operation: "use_statement", Source: *str, Alias: d.identifier(raw["alias"]), Names: d.identifiers(raw["names"]), Position: d.positionOf(raw)}
+}
+
+func (d *decoder) statements(value interface{}) []Statement {
+	if value == nil {
+		return nil
+	}
+	result := []Statement{}
+	for _, raw := range d.list(value) {
+		result = append(result, d.statement(raw))
+	}
+	return result
+}
+
+func (d *decoder) statement(value interface{}) Statement {
+	raw := d.object(value, "a statement")
+	operation := d.string(raw, "operation")
+	position := d.positionOf(raw)
+
+	switch operation {
+	case "variable_declaration":
+		return &VariableDeclarationStatement{
+			Operation: operation,
+			Kind:      d.string(raw, "kind"),
+			Left:      d.identifier(raw["left"]),
+			Right:     d.expression(raw["right"]),
+			Exported:  d.bool(raw, "exported"),
+			Position:  position,
+		}
+	case "namespace_declaration":
+		return &NamespaceDeclarationStatement{
+			Operation: operation,
+			Name:      d.identifier(raw["name"]),
+			Body:      d.statements(raw["body"]),
+			Exported:  d.bool(raw, "exported"),
+			Position:  position,
+		}
+	case "block_declaration":
+		return d.blockDeclaration(raw, position)
+	case "for_statement":
+		return &ForStatement{
+			Operation:   operation,
+			Statement:   d.expression(raw["statement"]),
+			Placeholder: d.string(raw, "placeholder"),
+			Body:        d.statements(raw["body"]),
+			Position:    position,
+		}
+	case "while_statement":
+		return &WhileStatement{
+			Operation: operation,
+			Statement: d.expression(raw["statement"]),
+			Body:      d.statements(raw["body"]),
+			Position:  position,
+		}
+	case "if_statement":
+		statement := &IfStatement{
+			Operation: operation,
+			Condition: d.expression(raw["condition"]),
+			Body:      d.statements(raw["body"]),
+			Else:      d.statements(raw["else"]),
+			Position:  position,
+		}
+		if raw["elifs"] != nil {
+			statement.Elifs = []Elif{}
+		}
+		for _, elif := range d.list(raw["elifs"]) {
+			raw_elif := d.object(elif, "an elif clause")
+			statement.Elifs = append(statement.Elifs, Elif{
+				Condition: d.expression(raw_elif["condition"]),
+				Body:      d.statements(raw_elif["body"]),
+			})
+		}
+		return statement
+	case "switch_statement":
+		statement := &SwitchStatement{
+			Operation: operation,
+			Condition: d.expression(raw["condition"]),
+			Cases:     []SwitchCase{},
+			Position:  position,
+		}
+		for _, _case := range d.list(raw["cases"]) {
+			raw_case := d.object(_case, "a switch case")
+			statement.Cases = append(statement.Cases, SwitchCase{
+				Case: d.expression(raw_case["case"]),
+				Body: d.statements(raw_case["body"]),
+			})
+		}
+		if raw["default"] != nil {
+			raw_default := d.object(raw["default"], "a default case")
+			statement.Default = SwitchCase{Body: d.statements(raw_default["body"])}
+		}
+		return statement
+	case "return_statement":
+		return &ReturnStatement{Operation: operation, Expression: d.expression(raw["expression"]), Position: position}
+	case "throw_statement":
+		return &ThrowStatement{Operation: operation, Expression: d.expression(raw["expression"]), Position: position}
+	case "assign_statement":
+		return &AssignStatement{
+			Operation: operation,
+			Left:      d.identifier(raw["left"]),
+			Right:     d.expression(raw["right"]),
+			Position:  position,
+		}
+	case "quantity_modifier_statement":
+		statement := &QuantityModifierStatement{
+			Operation: operation,
+			Type:      d.string(raw, "type"),
+			Statement: d.expression(raw["statement"]),
+			Position:  position,
+		}
+		switch statement.Type {
+		case "increment", "decrement":
+		case "add", "subtract", "multiply", "divide":
+			statement.Right = d.expression(raw["right"])
+		default:
+			d.fail("Unknown quantity modifier '" + statement.Type + "'")
+		}
+		return statement
+	case "block_call", "scope_mutater_expression", "namespace_indexer":
+		return d.expression(raw).(Statement)
+	case "comment":
+		return &Comment{Operation: operation, Value: d.string(raw, "value"), Position: position}
+	}
+
+	d.fail("Unknown statement '" + operation + "'")
+	return nil
+}
+
+func (d *decoder) blockDeclaration(raw map[string]interface{}, position Position) *BlockDeclarationStatement {
+	statement := &BlockDeclarationStatement{
+		Operation:    "block_declaration",
+		Name:         d.identifier(raw["name"]),
+		Verbs:        d.identifiers(raw["verbs"]),
+		Arguments:    d.identifiers(raw["arguments"]),
+		Implementing: d.bool(raw, "implementing"),
+		Implements:   d.identifier(raw["implements"]),
+		Exported:     d.bool(raw, "exported"),
+		Populate:     []Population{},
+		Position:     position,
+	}
+
+	if statement.Implementing {
+		for _, population := range d.list(raw["populate"]) {
+			raw_population := d.object(population, "a population")
+			value := d.expression(raw_population["value"])
+
+			switch value.(type) {
+			case *StringPrimitiveExpression, *ArrayPrimitiveExpression:
+			default:
+				d.fail("Populations can only be strings or arrays")
+			}
+
+			statement.Populate = append(statement.Populate, Population{
+				Operation: "population",
+				Key:       d.string(raw_population, "key"),
+				Value:     value,
+				Position:  d.positionOf(raw_population),
+			})
+		}
+	} else {
+		body := d.object(raw["body"], "a block body")
+		statement.Body = &BlockBody{
+			Init:    d.statements(body["init"]),
+			Program: d.statements(body["program"]),
+		}
+		if statement.Body.Program == nil {
+			statement.Body.Program = []Statement{}
+		}
+		d.position = position
+	}
+
+	return statement
+}
+
+func (d *decoder) expressions(value interface{}) []Expression {
+	result := []Expression{}
+	for _, raw := range d.list(value) {
+		result = append(result, d.expression(raw))
+	}
+	return result
+}
+
+func (d *decoder) expression(value interface{}) Expression {
+	if value == nil {
+		d.fail("Malformed syntax tree, missing expression")
+	}
+	raw := d.object(value, "an expression")
+	operation := d.string(raw, "operation")
+	position := d.positionOf(raw)
+
+	switch operation {
+	case "primitive":
+		switch d.string(raw, "type") {
+		case "int":
+			return &IntPrimitiveExpression{Operation: operation, Type: "int", Value: d.int(raw["value"]), Position: position}
+		case "string":
+			return &StringPrimitiveExpression{Operation: operation, Type: "string", Value: d.string(raw, "value"), Position: position}
+		case "array":
+			return &ArrayPrimitiveExpression{Operation: operation, Type: "array", Values: d.expressions(raw["values"]), Position: position}
+		}
+		d.fail("Unknown primitive type '" + d.string(raw, "type") + "'")
+	case "block_call":
+		return &BlockCallExpression{
+			Operation: operation,
+			Namespace: d.identifier(raw["namespace"]),
+			Name:      d.identifier(raw["name"]),
+			Verbs:     d.expressions(raw["verbs"]),
+			Arguments: d.expressions(raw["arguments"]),
+			Position:  position,
+		}
+	case "namespace_indexer":
+		return &NamespaceIndexerExpression{
+			Operation: operation,
+			Namespace: d.identifier(raw["namespace"]),
+			Index:     d.identifier(raw["index"]),
+			Position:  position,
+		}
+	case "scope_mutater_expression":
+		mutater := d.identifier(raw["mutater"])
+		return &ScopeMutaterExpression{
+			Operation: operation,
+			Mutater:   MutaterKeyword{Operation: "mutater_keyword", Value: mutater.Value, Position: mutater.Position},
+			Arguments: d.expressions(raw["arguments"]),
+			Position:  position,
+		}
+	case "arithmetic":
+		return &ArithmeticExpression{
+			Operation: operation,
+			Type:      d.string(raw, "type"),
+			Left:      d.expression(raw["left"]),
+			Right:     d.expression(raw["right"]),
+			Position:  position,
+		}
+	case "condition":
+		return &ConditionExpression{
+			Operation: operation,
+			Type:      d.string(raw, "type"),
+			Left:      d.expression(raw["left"]),
+			Right:     d.expression(raw["right"]),
+			Position:  position,
+		}
+	case "reference":
+		return &ReferenceExpression{
+			Operation: operation,
+			Negative:  d.bool(raw, "negative"),
+			Value:     d.string(raw, "value"),
+			Position:  position,
+		}
+	}
+
+	d.fail("Unknown expression '" + operation + "'")
+	return nil
+}
@@ -0,0 +1,131 @@
+package ast
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// decode reads a program the way the javascript parser printed it, '@' stands for a position at 1:1
+func decode(t *testing.T, text string) (*Program, error) {
+	t.Helper()
+	text = strings.ReplaceAll(text, "@", `"position": {"line": 1, "col": 1}`)
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var content interface{}
+	if err := decoder.Decode(&content); err != nil {
+		t.Fatalf("invalid test input %s: %v", text, err)
+	}
+	return Decode(content)
+}
+
+func TestDecodeStatements(t *testing.T) {
+	tests := []struct {
+		statement string
+		check     func(statement Statement) bool
+	}{
+		{
+			`{"operation": "variable_declaration", "kind": "const", "left": {"operation": "identifier", "value": "a", @}, "right": {"operation": "primitive", "type": "int", "value": 7, @}, "exported": true, @}`,
+			func(statement Statement) bool {
+				declaration, ok := statement.(*VariableDeclarationStatement)
+				return ok && declaration.Kind == "const" && declaration.Left.Value == "a" && declaration.Right.(*IntPrimitiveExpression).Value == 7 && declaration.Exported
+			},
+		},
+		{
+			`{"operation": "assign_statement", "left": {"operation": "identifier", "value": "a", @}, "right": {"operation": "reference", "value": "b", "negative": true, @}, @}`,
+			func(statement Statement) bool {
+				assign, ok := statement.(*AssignStatement)
+				return ok && assign.Left.Value == "a" && assign.Right.(*ReferenceExpression).Negative
+			},
+		},
+		{
+			`{"operation": "block_declaration", "name": {"operation": "identifier", "value": "add", @}, "verbs": [], "arguments": [{"operation": "identifier", "value": "x", @}], "implementing": false, "body": {"init": [], "program": []}, @}`,
+			func(statement Statement) bool {
+				block, ok := statement.(*BlockDeclarationStatement)
+				return ok && block.Name.Value == "add" && len(block.Arguments) == 1 && block.Body != nil && len(block.Body.Program) == 0
+			},
+		},
+		{
+			`{"operation": "block_declaration", "name": {"operation": "identifier", "value": "e", @}, "implementing": true, "implements": {"operation": "identifier", "value": "enc", @}, "populate": [{"operation": "population", "key": "name", "value": {"operation": "primitive", "type": "string", "value": "x", @}, @}], @}`,
+			func(statement Statement) bool {
+				block, ok := statement.(*BlockDeclarationStatement)
+				return ok && block.Implementing && block.Implements.Value == "enc" && len(block.Populate) == 1 && block.Body == nil
+			},
+		},
+		{
+			`{"operation": "namespace_declaration", "name": {"operation": "identifier", "value": "codes", @}, "body": [], "exported": true, @}`,
+			func(statement Statement) bool {
+				namespace, ok := statement.(*NamespaceDeclarationStatement)
+				return ok && namespace.Name.Value == "codes" && namespace.Exported
+			},
+		},
+		{
+			`{"operation": "block_call", "namespace": {"operation": "identifier", "value": "bir", @}, "name": {"operation": "identifier", "value": "util", @}, "verbs": [], "arguments": [{"operation": "arithmetic", "type": "addition", "left": {"operation": "primitive", "type": "int", "value": 1, @}, "right": {"operation": "primitive", "type": "int", "value": 2, @}, @}], @}`,
+			func(statement Statement) bool {
+				call, ok := statement.(*BlockCallExpression)
+				return ok && call.Namespace.Value == "bir" && call.Arguments[0].(*ArithmeticExpression).Type == "addition"
+			},
+		},
+		{
+			`{"operation": "scope_mutater_expression", "mutater": {"operation": "identifier", "value": "Write", @}, "arguments": [{"operation": "primitive", "type": "int", "value": 1, @}], @}`,
+			func(statement Statement) bool {
+				mutater, ok := statement.(*ScopeMutaterExpression)
+				return ok && mutater.Mutater.Value == "Write" && len(mutater.Arguments) == 1
+			},
+		},
+	}
+
+	for _, test := range tests {
+		program, err := decode(t, `{"imports": [], "program": [`+test.statement+`]}`)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.statement, err)
+			continue
+		}
+		if len(program.Program) != 1 || !test.check(program.Program[0]) {
+			t.Errorf("%s: decoded to %#v", test.statement, program.Program)
+		}
+	}
+}
+
+func TestDecodeImports(t *testing.T) {
+	program, err := decode(t, `{"imports": [{"operation": "use_statement", "source": {"operation": "primitive", "type": "string", "value": "std:util", @}, "alias": null, "names": [{"operation": "identifier", "value": "out", @}], @}], "program": []}`)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(program.Imports) != 1 {
+		t.Fatalf("got %d imports, want 1", len(program.Imports))
+	}
+	use := program.Imports[0]
+	if use.Source.Value != "std:util" || use.Alias.Value != "" || len(use.Names) != 1 || use.Names[0].Value != "out" {
+		t.Errorf("decoded to %#v", use)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		content  string
+		message  string
+		position Position
+	}{
+		{`[]`, "Malformed syntax tree, expected program", Position{}},
+		{`{"program": {}}`, "Malformed syntax tree, expected a list", Position{}},
+		{`{"program": [{"operation": "jump", "position": {"line": 3, "col": 2}}]}`, "Unknown statement 'jump'", Position{Line: 3, Col: 2}},
+		{`{"program": [{"operation": "assign_statement", "left": {"operation": "identifier", "value": "a", @}, "right": {"operation": "lambda", "position": {"line": 2, "col": 5}}, @}]}`, "Unknown expression 'lambda'", Position{Line: 2, Col: 5}},
+		{`{"program": [{"operation": "assign_statement", "left": {"operation": "identifier", "value": "a", @}, @}]}`, "Malformed syntax tree, missing expression", Position{Line: 1, Col: 1}},
+		{`{"program": [{"operation": "variable_declaration", "kind": 1, @}]}`, "Malformed syntax tree, expected 'kind' to be a string", Position{Line: 1, Col: 1}},
+		{`{"program": [{"operation": "assign_statement", "left": {"operation": "identifier", "value": "a", @}, "right": {"operation": "primitive", "type": "int", "value": 1.5, @}, @}]}`, "Malformed syntax tree, '1.5' is not an integer", Position{Line: 1, Col: 1}},
+		{`{"program": [{"operation": "block_declaration", "name": {"operation": "identifier", "value": "e", @}, "implementing": true, "populate": [{"key": "a", "value": {"operation": "primitive", "type": "int", "value": 1, @}, @}], @}]}`, "Populations can only be strings or arrays", Position{Line: 1, Col: 1}},
+	}
+
+	for _, test := range tests {
+		_, err := decode(t, test.content)
+		decode_error, ok := err.(DecodeError)
+		if !ok {
+			t.Errorf("%s: got %v, want a decode error", test.content, err)
+			continue
+		}
+		if decode_error.Message != test.message || decode_error.Position != test.position {
+			t.Errorf("%s: got %q at %v, want %q at %v", test.content, decode_error.Message, decode_error.Position, test.message, test.position)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package ast_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/parser"
+)
+
+func parse(t *testing.T, content string) *ast.Program {
+	t.Helper()
+	result := parser.Parse(content)
+	if result.Error {
+		t.Fatalf("could not parse %q", content)
+	}
+	program, err := ast.Decode(result.Content)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return program
+}
+
+// names lists the names of a set in order, the ones that are set to false are marked with a '-'
+func names(set map[string]bool) string {
+	result := []string{}
+	for name, value := range set {
+		if !value {
+			name = "-" + name
+		}
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return strings.Join(result, ",")
+}
+
+func TestExports(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		exports string
+	}{
+		{"nothing marked", "let a = 1\nf [] { return 1 }\nnamespace n {\n  let b = 1\n}\n", "a,f,n"},
+		{"marked variable", "export let a = 1\nconst b = 2\nf [] { return 1 }\n", "-b,-f,a"},
+		{"marked block", "let a = 1\nexport f [] { return 1 }\n", "-a,f"},
+		{"marked namespace", "export namespace n {\n  let b = 1\n}\nnamespace m {\n  let c = 1\n}\nlet a = 1\n", "-a,-m,n"},
+		{"redeclared", "export let a = 1\nlet a = 2\n", "a"},
+		{"empty", "", ""},
+	}
+
+	for _, test := range tests {
+		if got := names(parse(t, test.content).Exports()); got != test.exports {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.exports)
+		}
+	}
+}
+
+func TestVisible(t *testing.T) {
+	exports := map[string]bool{"a": true, "f": true, "hidden": false}
+
+	tests := []struct {
+		use      string
+		visible  string
+		message  string
+		position ast.Position
+	}{
+		{"use \"./lib.bir\"", "a,f", "", ast.Position{}},
+		{"use \"./lib.bir\" as m", "a,f", "", ast.Position{}},
+		{"use \"./lib.bir\" { f }", "f", "", ast.Position{}},
+		{"use \"./lib.bir\" { a, f }", "a,f", "", ast.Position{}},
+		{"use \"./lib.bir\" { a, missing }", "", "Could not find 'missing' in './lib.bir'", ast.Position{Line: 1, Col: 22}},
+		{"use \"./lib.bir\" { hidden }", "", "Could not import 'hidden', it is not exported by './lib.bir'", ast.Position{Line: 1, Col: 19}},
+	}
+
+	for _, test := range tests {
+		statement := parse(t, test.use).Imports[0]
+		visible, err := statement.Visible(exports)
+		if test.message != "" {
+			import_error, ok := err.(ast.ImportError)
+			if !ok || import_error.Message != test.message || import_error.Position != test.position {
+				t.Errorf("%s: got %v, want %q at %v", test.use, err, test.message, test.position)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.use, err)
+		} else if got := names(visible); got != test.visible {
+			t.Errorf("%s: got %q, want %q", test.use, got, test.visible)
+		}
+	}
+}
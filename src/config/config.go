@@ -2,33 +2,308 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
-	"path"
-
-	"github.com/canpacis/birlang/src/engine"
-	"github.com/mitchellh/mapstructure"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 )
 
+const FileName = "bir.config.json"
+
+type Permissions struct {
+	Read  *bool `json:"read"`
+	Write *bool `json:"write"`
+}
+
+// Config holds the settings of a program, a nil field is not set and leaves the setting to the next
+// source. Config files come first, then the environment variables and then the command line flags.
 type Config struct {
-	ColoredOutput        bool `json:"colored_output"`
-	VerbosityLevel       int  `json:"verbosity_level"`
-	MaximumCallstackSize int  `json:"maximum_callstack_size"`
+	ColoredOutput        *bool        `json:"colored_output"`
+	VerbosityLevel       *int         `json:"verbosity_level"`
+	MaximumCallstackSize *int         `json:"maximum_callstack_size"`
+	StdPath              *string      `json:"std_path"`
+	SearchPaths          []string     `json:"search_paths"`
+	WarningsAsErrors     *bool        `json:"warnings_as_errors"`
+	StepBudget           *int64       `json:"step_budget"`
+	Permissions          *Permissions `json:"permissions"`
+}
+
+// keys lists the json keys of a struct's fields in order
+func keys(target reflect.Type) []string {
+	result := []string{}
+	for i := 0; i < target.NumField(); i++ {
+		result = append(result, target.Field(i).Tag.Get("json"))
+	}
+	return result
+}
+
+func describe(kind reflect.Type) string {
+	for kind.Kind() == reflect.Ptr {
+		kind = kind.Elem()
+	}
+
+	switch kind.Kind() {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int64:
+		return "a whole number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice:
+		return "a list of strings"
+	}
+	return "an object"
+}
+
+// decode fills a struct from a json object key by key so that an unknown key or a value of the wrong
+// type is reported by its name
+func decode(raw []byte, target interface{}, prefix string, file_path string) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		if prefix == "" {
+			return errors.New("Could not parse config file '" + file_path + "', " + err.Error())
+		}
+		return errors.New("Key '" + strings.TrimSuffix(prefix, ".") + "' in config file '" + file_path + "' should be an object")
+	}
+
+	value := reflect.ValueOf(target).Elem()
+	names := keys(value.Type())
+	for key, field_raw := range fields {
+		index := -1
+		for i, name := range names {
+			if name == key {
+				index = i
+			}
+		}
+		if index < 0 {
+			return errors.New("Unknown key '" + prefix + key + "' in config file '" + file_path + "', expected one of " + strings.Join(names, ", "))
+		}
+
+		field := value.Field(index)
+		if field.Type() == reflect.TypeOf(&Permissions{}) {
+			permissions := &Permissions{}
+			if err := decode(field_raw, permissions, prefix+key+".", file_path); err != nil {
+				return err
+			}
+			field.Set(reflect.ValueOf(permissions))
+			continue
+		}
+
+		if err := json.Unmarshal(field_raw, field.Addr().Interface()); err != nil {
+			return errors.New("Key '" + prefix + key + "' in config file '" + file_path + "' should be " + describe(field.Type()))
+		}
+	}
+	return nil
+}
+
+// Load reads a config file, relative paths in it are relative to the directory of the file
+func Load(file_path string) (*Config, error) {
+	raw, err := os.ReadFile(file_path)
+	if err != nil {
+		return nil, errors.New("Could not read config file '" + file_path + "'")
+	}
+
+	config := &Config{}
+	if err := decode(raw, config, "", file_path); err != nil {
+		return nil, err
+	}
+
+	directory := filepath.Dir(file_path)
+	if config.StdPath != nil && !filepath.IsAbs(*config.StdPath) {
+		std_path := filepath.Join(directory, *config.StdPath)
+		config.StdPath = &std_path
+	}
+	for i, search_path := range config.SearchPaths {
+		if !filepath.IsAbs(search_path) {
+			config.SearchPaths[i] = filepath.Join(directory, search_path)
+		}
+	}
+	return config, nil
 }
 
-func HandleConfig(instance *engine.BirEngine) {
-	config_path := path.Join(instance.Directory, "bir.config.json")
+// Find returns the config file that is closest to a directory, in it or in one of its parents, an empty
+// path means there is none
+func Find(directory string) string {
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		return ""
+	}
+
+	for {
+		file_path := filepath.Join(directory, FileName)
+		if info, err := os.Stat(file_path); err == nil && !info.IsDir() {
+			return file_path
+		}
 
-	if _, err := os.Stat(config_path); !os.IsNotExist(err) {
-		config := Config{}
-		raw, _ := os.ReadFile(config_path)
-		err := json.Unmarshal(raw, &config)
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			return ""
+		}
+		directory = parent
+	}
+}
 
-		if err != nil {
-			instance.Thrower.WarnAnonymous("Could not properly parse the config file")
-		} else {
-			var mapped map[string]interface{}
-			mapstructure.Decode(config, &mapped)
-			instance.Config = mapped
+// Discover loads the config file that is closest to a directory, a directory without one has an empty
+// config
+func Discover(directory string) (*Config, error) {
+	file_path := Find(directory)
+	if file_path == "" {
+		return &Config{}, nil
+	}
+	return Load(file_path)
+}
+
+// Environment reads the settings of the environment variables
+func Environment() (*Config, error) {
+	config := &Config{}
+
+	boolean := func(name string, target **bool) error {
+		if value, ok := os.LookupEnv(name); ok && value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.New("Environment variable '" + name + "' should be true or false")
+			}
+			*target = &parsed
+		}
+		return nil
+	}
+	number := func(name string) (*int64, error) {
+		if value, ok := os.LookupEnv(name); ok && value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, errors.New("Environment variable '" + name + "' should be a whole number")
+			}
+			return &parsed, nil
+		}
+		return nil, nil
+	}
+
+	if value := os.Getenv("BirStd"); value != "" {
+		config.StdPath = &value
+	}
+	if value := os.Getenv("BirSearchPaths"); value != "" {
+		config.SearchPaths = filepath.SplitList(value)
+	}
+	if err := boolean("BirColor", &config.ColoredOutput); err != nil {
+		return nil, err
+	}
+	if err := boolean("BirWarningsAsErrors", &config.WarningsAsErrors); err != nil {
+		return nil, err
+	}
+
+	verbosity, err := number("BirVerbosity")
+	if err != nil {
+		return nil, err
+	} else if verbosity != nil {
+		level := int(*verbosity)
+		config.VerbosityLevel = &level
+	}
+	callstack_size, err := number("BirCallstackSize")
+	if err != nil {
+		return nil, err
+	} else if callstack_size != nil {
+		size := int(*callstack_size)
+		config.MaximumCallstackSize = &size
+	}
+	if config.StepBudget, err = number("BirStepBudget"); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Merge sets the settings the other config has on this one
+func (config *Config) Merge(other *Config) {
+	if other == nil {
+		return
+	}
+
+	if other.ColoredOutput != nil {
+		config.ColoredOutput = other.ColoredOutput
+	}
+	if other.VerbosityLevel != nil {
+		config.VerbosityLevel = other.VerbosityLevel
+	}
+	if other.MaximumCallstackSize != nil {
+		config.MaximumCallstackSize = other.MaximumCallstackSize
+	}
+	if other.StdPath != nil {
+		config.StdPath = other.StdPath
+	}
+	if other.SearchPaths != nil {
+		config.SearchPaths = other.SearchPaths
+	}
+	if other.WarningsAsErrors != nil {
+		config.WarningsAsErrors = other.WarningsAsErrors
+	}
+	if other.StepBudget != nil {
+		config.StepBudget = other.StepBudget
+	}
+	if other.Permissions != nil {
+		if config.Permissions == nil {
+			config.Permissions = &Permissions{}
+		}
+		if other.Permissions.Read != nil {
+			config.Permissions.Read = other.Permissions.Read
+		}
+		if other.Permissions.Write != nil {
+			config.Permissions.Write = other.Permissions.Write
+		}
+	}
+}
+
+// Resolve merges the config file closest to a directory, the environment variables and the given
+// overrides, usually the command line flags
+func Resolve(directory string, overrides *Config) (*Config, error) {
+	config, err := Discover(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	environment, err := Environment()
+	if err != nil {
+		return nil, err
+	}
+	config.Merge(environment)
+	config.Merge(overrides)
+	return config, nil
+}
+
+// Map returns the settings that are set in the form engine.ApplyConfig takes
+func (config *Config) Map() map[string]interface{} {
+	result := map[string]interface{}{}
+
+	if config.ColoredOutput != nil {
+		result["colored_output"] = *config.ColoredOutput
+	}
+	if config.VerbosityLevel != nil {
+		result["verbosity_level"] = *config.VerbosityLevel
+	}
+	if config.MaximumCallstackSize != nil {
+		result["maximum_callstack_size"] = *config.MaximumCallstackSize
+	}
+	if config.StdPath != nil {
+		result["std_path"] = *config.StdPath
+	}
+	if config.SearchPaths != nil {
+		result["search_paths"] = config.SearchPaths
+	}
+	if config.WarningsAsErrors != nil {
+		result["warnings_as_errors"] = *config.WarningsAsErrors
+	}
+	if config.StepBudget != nil {
+		result["step_budget"] = *config.StepBudget
+	}
+	if config.Permissions != nil {
+		permissions := map[string]interface{}{}
+		if config.Permissions.Read != nil {
+			permissions["read"] = *config.Permissions.Read
+		}
+		if config.Permissions.Write != nil {
+			permissions["write"] = *config.Permissions.Write
 		}
+		result["permissions"] = permissions
 	}
+	return result
 }
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setenv sets an environment variable for the duration of a test
+func setenv(t *testing.T, name string, value string) {
+	t.Helper()
+	previous, ok := os.LookupEnv(name)
+	os.Setenv(name, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+// clearenv unsets the variables Environment reads so that the environment of the test run does not leak in
+func clearenv(t *testing.T) {
+	for _, name := range []string{"BirStd", "BirSearchPaths", "BirColor", "BirWarningsAsErrors", "BirVerbosity", "BirCallstackSize", "BirStepBudget"} {
+		setenv(t, name, "")
+	}
+}
+
+func write(t *testing.T, file_path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file_path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file_path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	directory := t.TempDir()
+	file_path := filepath.Join(directory, FileName)
+	write(t, file_path, `{
+  "colored_output": true,
+  "verbosity_level": 2,
+  "std_path": "lib/std",
+  "search_paths": ["modules", "/opt/bir"],
+  "step_budget": 1000,
+  "permissions": {"write": false}
+}`)
+
+	config, err := Load(file_path)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if config.ColoredOutput == nil || !*config.ColoredOutput || config.VerbosityLevel == nil || *config.VerbosityLevel != 2 || config.StepBudget == nil || *config.StepBudget != 1000 {
+		t.Errorf("got %+v", config)
+	}
+	if config.MaximumCallstackSize != nil || config.WarningsAsErrors != nil {
+		t.Errorf("set the settings the file does not have")
+	}
+	// Relative paths are relative to the file
+	if config.StdPath == nil || *config.StdPath != filepath.Join(directory, "lib/std") {
+		t.Errorf("got std path %v", config.StdPath)
+	}
+	if !reflect.DeepEqual(config.SearchPaths, []string{filepath.Join(directory, "modules"), "/opt/bir"}) {
+		t.Errorf("got search paths %q", config.SearchPaths)
+	}
+	if config.Permissions == nil || config.Permissions.Read != nil || config.Permissions.Write == nil || *config.Permissions.Write {
+		t.Errorf("got permissions %+v", config.Permissions)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	directory := t.TempDir()
+	file_path := filepath.Join(directory, FileName)
+
+	tests := []struct {
+		content string
+		message string
+	}{
+		{`{"colour": true}`, "Unknown key 'colour' in config file '" + file_path + "', expected one of colored_output, verbosity_level, maximum_callstack_size, std_path, search_paths, warnings_as_errors, step_budget, permissions"},
+		{`{"verbosity_level": "high"}`, "Key 'verbosity_level' in config file '" + file_path + "' should be a whole number"},
+		{`{"search_paths": "lib"}`, "Key 'search_paths' in config file '" + file_path + "' should be a list of strings"},
+		{`{"permissions": true}`, "Key 'permissions' in config file '" + file_path + "' should be an object"},
+		{`{"permissions": {"execute": true}}`, "Unknown key 'permissions.execute' in config file '" + file_path + "', expected one of read, write"},
+		{`{"permissions": {"read": 1}}`, "Key 'permissions.read' in config file '" + file_path + "' should be true or false"},
+		{`{`, "Could not parse config file '" + file_path + "', unexpected end of JSON input"},
+	}
+	for _, test := range tests {
+		write(t, file_path, test.content)
+		if _, err := Load(file_path); err == nil || err.Error() != test.message {
+			t.Errorf("%s: got %v, want %q", test.content, err, test.message)
+		}
+	}
+
+	if _, err := Load(filepath.Join(directory, "missing.json")); err == nil || !strings.HasPrefix(err.Error(), "Could not read config file") {
+		t.Errorf("got %v for a missing file", err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	directory := t.TempDir()
+	nested := filepath.Join(directory, "project", "src", "deep")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write(t, filepath.Join(directory, FileName), `{"verbosity_level": 1}`)
+	write(t, filepath.Join(directory, "project", FileName), `{"verbosity_level": 2}`)
+	// A directory with the name of the file is not a config file
+	if err := os.MkdirAll(filepath.Join(nested, FileName), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if found := Find(nested); found != filepath.Join(directory, "project", FileName) {
+		t.Errorf("got %q, want the closest file", found)
+	}
+	config, err := Discover(nested)
+	if err != nil || config.VerbosityLevel == nil || *config.VerbosityLevel != 2 {
+		t.Errorf("got %+v %v", config, err)
+	}
+	if found := Find(directory); found != filepath.Join(directory, FileName) {
+		t.Errorf("got %q, want the file of the directory itself", found)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	clearenv(t)
+	setenv(t, "BirStd", "/opt/std")
+	setenv(t, "BirSearchPaths", "/a"+string(filepath.ListSeparator)+"/b")
+	setenv(t, "BirColor", "true")
+	setenv(t, "BirVerbosity", "3")
+	setenv(t, "BirStepBudget", "500")
+
+	config, err := Environment()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if *config.StdPath != "/opt/std" || !reflect.DeepEqual(config.SearchPaths, []string{"/a", "/b"}) || !*config.ColoredOutput || *config.VerbosityLevel != 3 || *config.StepBudget != 500 {
+		t.Errorf("got %+v", config)
+	}
+	if config.WarningsAsErrors != nil || config.MaximumCallstackSize != nil {
+		t.Errorf("set the settings the environment does not have")
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		message string
+	}{
+		{"BirColor", "maybe", "Environment variable 'BirColor' should be true or false"},
+		{"BirCallstackSize", "big", "Environment variable 'BirCallstackSize' should be a whole number"},
+	}
+	for _, test := range tests {
+		clearenv(t)
+		setenv(t, test.name, test.value)
+		if _, err := Environment(); err == nil || err.Error() != test.message {
+			t.Errorf("%s=%s: got %v, want %q", test.name, test.value, err, test.message)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	clearenv(t)
+	directory := t.TempDir()
+	write(t, filepath.Join(directory, FileName), `{"verbosity_level": 1, "colored_output": true, "step_budget": 10, "permissions": {"read": false, "write": false}}`)
+	setenv(t, "BirVerbosity", "2")
+	setenv(t, "BirStepBudget", "20")
+
+	budget := int64(30)
+	write_permission := true
+	config, err := Resolve(directory, &Config{StepBudget: &budget, Permissions: &Permissions{Write: &write_permission}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// The file comes first, then the environment and then the overrides
+	if !*config.ColoredOutput || *config.VerbosityLevel != 2 || *config.StepBudget != 30 {
+		t.Errorf("got %+v", config)
+	}
+	if *config.Permissions.Read || !*config.Permissions.Write {
+		t.Errorf("got read %v and write %v, want the overrides to be merged per permission", *config.Permissions.Read, *config.Permissions.Write)
+	}
+
+	want := map[string]interface{}{
+		"colored_output":  true,
+		"verbosity_level": 2,
+		"step_budget":     int64(30),
+		"permissions":     map[string]interface{}{"read": false, "write": true},
+	}
+	if got := config.Map(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	write(t, filepath.Join(directory, FileName), `{"step_budget": "many"}`)
+	if _, err := Resolve(directory, nil); err == nil {
+		t.Errorf("resolved a config file that is not valid")
+	}
+}
+
+func TestMergeNil(t *testing.T) {
+	verbosity := 1
+	config := &Config{VerbosityLevel: &verbosity}
+	config.Merge(nil)
+	config.Merge(&Config{})
+	if config.VerbosityLevel == nil || *config.VerbosityLevel != 1 {
+		t.Errorf("an empty config changed the settings")
+	}
+}
@@ -0,0 +1,263 @@
+// Package coverage records which statements and which arms of the if and switch statements of a bir
+// program have run
+package coverage
+
+import (
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/engine"
+	"github.com/canpacis/birlang/std"
+)
+
+// File holds the statements and the branching statements of a file in source order
+type File struct {
+	Path       string
+	Content    string
+	Statements []ast.Statement
+	Branches   []ast.Statement
+}
+
+// point identifies a statement by where it is written, so that the counts of engines that parsed the
+// same file separately add up
+type point struct {
+	path      string
+	position  ast.Position
+	operation string
+}
+
+func pointOf(path string, statement ast.Statement) point {
+	return point{path: path, position: statement.GetPosition(), operation: statement.GetOperation()}
+}
+
+// Coverage is an engine tracer that counts how many times each statement and each arm has run
+type Coverage struct {
+	Files      []*File
+	statements map[point]int64
+	arms       map[point][]int64
+	paths      map[string]bool
+}
+
+func New() *Coverage {
+	return &Coverage{
+		statements: map[point]int64{},
+		arms:       map[point][]int64{},
+		paths:      map[string]bool{},
+	}
+}
+
+func (coverage *Coverage) Statement(instance *engine.BirEngine, statement ast.Statement, value *ast.IntPrimitiveExpression, err error) {
+	coverage.statements[pointOf(instance.Path, statement)]++
+}
+
+func (coverage *Coverage) Branch(instance *engine.BirEngine, statement ast.Statement, arm int) {
+	key := pointOf(instance.Path, statement)
+	arms := coverage.arms[key]
+	for len(arms) <= arm {
+		arms = append(arms, 0)
+	}
+	arms[arm]++
+	coverage.arms[key] = arms
+}
+
+func (coverage *Coverage) Enter(instance *engine.BirEngine, expression *ast.BlockCallExpression, label string, verbs []int64, arguments []int64) {
+}
+
+func (coverage *Coverage) Exit(instance *engine.BirEngine, expression *ast.BlockCallExpression, label string, value ast.IntPrimitiveExpression, err error) {
+}
+
+// Collect adds the file of an engine and the files it uses to the report, the standard library is
+// left out and a file that is already in the report is only added once
+func (coverage *Coverage) Collect(instance *engine.BirEngine) {
+	if instance.Parsed == nil || coverage.paths[instance.Path] {
+		return
+	}
+	if std.Embedded(instance.Path) {
+		return
+	}
+	if instance.StdPath != "" && strings.HasPrefix(filepath.Clean(instance.Path), filepath.Clean(instance.StdPath)+string(filepath.Separator)) {
+		return
+	}
+	coverage.paths[instance.Path] = true
+
+	file := &File{Path: instance.Path, Content: instance.Content}
+	file.walk(instance.Parsed.Program)
+	coverage.Files = append(coverage.Files, file)
+
+	for _, use := range instance.Uses {
+		coverage.Collect(use)
+	}
+}
+
+func (file *File) walk(statements []ast.Statement) {
+	for _, statement := range statements {
+		if _, ok := statement.(*ast.Comment); ok {
+			continue
+		}
+		file.Statements = append(file.Statements, statement)
+
+		switch statement := statement.(type) {
+		case *ast.BlockDeclarationStatement:
+			if statement.Body != nil {
+				file.walk(statement.Body.Init)
+				file.walk(statement.Body.Program)
+			}
+		case *ast.ForStatement:
+			file.walk(statement.Body)
+		case *ast.WhileStatement:
+			file.walk(statement.Body)
+		case *ast.IfStatement:
+			file.Branches = append(file.Branches, statement)
+			file.walk(statement.Body)
+			for _, elif := range statement.Elifs {
+				file.walk(elif.Body)
+			}
+			file.walk(statement.Else)
+		case *ast.SwitchStatement:
+			file.Branches = append(file.Branches, statement)
+			for _, _case := range statement.Cases {
+				file.walk(_case.Body)
+			}
+			file.walk(statement.Default.Body)
+		}
+	}
+}
+
+// Arms returns how many times each arm of a branching statement of a file has run, the else or the
+// default arm comes last
+func (coverage *Coverage) Arms(file *File, statement ast.Statement) []int64 {
+	count := 0
+	switch statement := statement.(type) {
+	case *ast.IfStatement:
+		count = len(statement.Elifs) + 2
+	case *ast.SwitchStatement:
+		count = len(statement.Cases) + 1
+	}
+
+	result := make([]int64, count)
+	copy(result, coverage.arms[pointOf(file.Path, statement)])
+	return result
+}
+
+// Lines returns the execution count of every line that starts a statement
+func (coverage *Coverage) Lines(file *File) map[int]int64 {
+	lines := map[int]int64{}
+	for _, statement := range file.Statements {
+		line := int(statement.GetPosition().Line)
+		executed := coverage.statements[pointOf(file.Path, statement)]
+		if count, ok := lines[line]; !ok || executed > count {
+			lines[line] = executed
+		}
+	}
+	return lines
+}
+
+func sortedLines(lines map[int]int64) []int {
+	result := []int{}
+	for line := range lines {
+		result = append(result, line)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// WriteLCOV writes the report in the lcov tracefile format
+func (coverage *Coverage) WriteLCOV(output io.Writer) {
+	for _, file := range coverage.Files {
+		path, err := filepath.Abs(file.Path)
+		if err != nil {
+			path = file.Path
+		}
+		io.WriteString(output, "TN:\nSF:"+path+"\n")
+
+		found, hit := 0, 0
+		for i, statement := range file.Branches {
+			key := pointOf(file.Path, statement)
+			reached := coverage.statements[key] > 0 || len(coverage.arms[key]) > 0
+			for arm, count := range coverage.Arms(file, statement) {
+				taken := "-"
+				if reached {
+					taken = strconv.FormatInt(count, 10)
+				}
+				io.WriteString(output, "BRDA:"+strconv.Itoa(int(statement.GetPosition().Line))+","+strconv.Itoa(i)+","+strconv.Itoa(arm)+","+taken+"\n")
+				found++
+				if count > 0 {
+					hit++
+				}
+			}
+		}
+		io.WriteString(output, "BRF:"+strconv.Itoa(found)+"\nBRH:"+strconv.Itoa(hit)+"\n")
+
+		lines := coverage.Lines(file)
+		hit = 0
+		for _, line := range sortedLines(lines) {
+			io.WriteString(output, "DA:"+strconv.Itoa(line)+","+strconv.FormatInt(lines[line], 10)+"\n")
+			if lines[line] > 0 {
+				hit++
+			}
+		}
+		io.WriteString(output, "LF:"+strconv.Itoa(len(lines))+"\nLH:"+strconv.Itoa(hit)+"\nend_of_record\n")
+	}
+}
+
+func pad(value string, width int) string {
+	if len(value) >= width {
+		return value
+	}
+	return strings.Repeat(" ", width-len(value)) + value
+}
+
+func percent(hit int, found int) string {
+	if found == 0 {
+		return "100.0%"
+	}
+	return strconv.FormatFloat(float64(hit)*100/float64(found), 'f', 1, 64) + "%"
+}
+
+// WriteAnnotated writes the source of every file with the execution count of each statement line,
+// lines that never ran are marked with '#####' and the arms of the branching statements follow them
+func (coverage *Coverage) WriteAnnotated(output io.Writer) {
+	for _, file := range coverage.Files {
+		lines := coverage.Lines(file)
+		branches := map[int][]ast.Statement{}
+		for _, statement := range file.Branches {
+			line := int(statement.GetPosition().Line)
+			branches[line] = append(branches[line], statement)
+		}
+
+		hit, arms_found, arms_hit := 0, 0, 0
+		for _, count := range lines {
+			if count > 0 {
+				hit++
+			}
+		}
+
+		io.WriteString(output, file.Path+"\n")
+		for i, source := range strings.Split(file.Content, "\n") {
+			line := i + 1
+			count, ok := lines[line]
+			marker := "-"
+			if ok && count == 0 {
+				marker = "#####"
+			} else if ok {
+				marker = strconv.FormatInt(count, 10)
+			}
+			io.WriteString(output, pad(marker, 9)+": "+pad(strconv.Itoa(line), 4)+": "+source+"\n")
+
+			for _, statement := range branches[line] {
+				for arm, count := range coverage.Arms(file, statement) {
+					io.WriteString(output, pad("", 17)+"arm "+strconv.Itoa(arm)+" taken "+strconv.FormatInt(count, 10)+"\n")
+					arms_found++
+					if count > 0 {
+						arms_hit++
+					}
+				}
+			}
+		}
+		io.WriteString(output, "lines "+percent(hit, len(lines))+" of "+strconv.Itoa(len(lines))+", arms "+percent(arms_hit, arms_found)+" of "+strconv.Itoa(arms_found)+"\n\n")
+	}
+}
@@ -0,0 +1,145 @@
+package coverage_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/canpacis/birlang/internal/testfiles"
+	"github.com/canpacis/birlang/src/coverage"
+	"github.com/canpacis/birlang/src/engine"
+)
+
+// covered runs main.bir of the files with a coverage and returns the directory the files are in
+func covered(t *testing.T, files map[string]string) (*coverage.Coverage, string) {
+	t.Helper()
+	directory := testfiles.Write(t, files)
+
+	recorder := coverage.New()
+	instance := engine.NewEngine(directory+"/main.bir", "", false, false, 0)
+	instance.Stdout, instance.Stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	instance.Tracer = recorder
+	if err := instance.Init(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := instance.Run(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	recorder.Collect(&instance)
+	return recorder, directory
+}
+
+var program = map[string]string{
+	"lib.bir": "export twice [n] {\n  return n * 2\n}\nexport unused [] {\n  return 0\n}\n",
+	"main.bir": `use "std:util"
+use "./lib.bir"
+let a = twice (2)
+for 3 as i {
+  a++
+}
+switch a {
+  case 7 { a = 0 }
+  case 8 { a = 1 }
+  default { a = 2 }
+}
+`,
+}
+
+func TestLCOV(t *testing.T) {
+	recorder, directory := covered(t, program)
+	if len(recorder.Files) != 2 {
+		t.Fatalf("got %d files, want main.bir and lib.bir without the standard library", len(recorder.Files))
+	}
+
+	output := &bytes.Buffer{}
+	recorder.WriteLCOV(output)
+	want := strings.Join([]string{
+		"TN:", "SF:" + directory + "/main.bir",
+		"BRDA:7,0,0,1", "BRDA:7,0,1,0", "BRDA:7,0,2,0", "BRF:3", "BRH:1",
+		"DA:3,1", "DA:4,1", "DA:5,3", "DA:7,1", "DA:8,1", "DA:9,0", "DA:10,0", "LF:7", "LH:5",
+		"end_of_record",
+		"TN:", "SF:" + directory + "/lib.bir",
+		"BRF:0", "BRH:0",
+		"DA:1,1", "DA:2,1", "DA:4,1", "DA:5,0", "LF:4", "LH:3",
+		"end_of_record", "",
+	}, "\n")
+	if output.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", output.String(), want)
+	}
+}
+
+func TestBranches(t *testing.T) {
+	recorder, _ := covered(t, map[string]string{"main.bir": `classify [n] {
+  if n < 0 { return 0 }
+  elif n == 0 { return 1 }
+  else { return 2 }
+}
+never [n] {
+  switch n {
+    case 1 { return 1 }
+  }
+}
+let x = classify (5)
+let y = classify (-1)
+`})
+
+	output := &bytes.Buffer{}
+	recorder.WriteLCOV(output)
+	lines := strings.Split(output.String(), "\n")
+	branches := []string{}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "BR") {
+			branches = append(branches, line)
+		}
+	}
+	// The arms of a switch that never ran are not taken rather than taken zero times
+	want := "BRDA:2,0,0,1 BRDA:2,0,1,0 BRDA:2,0,2,1 BRDA:7,1,0,- BRDA:7,1,1,- BRF:5 BRH:2"
+	if strings.Join(branches, " ") != want {
+		t.Errorf("got %q, want %q", strings.Join(branches, " "), want)
+	}
+
+	file := recorder.Files[0]
+	if arms := recorder.Arms(file, file.Branches[0]); len(arms) != 3 || arms[0] != 1 || arms[1] != 0 || arms[2] != 1 {
+		t.Errorf("got arms %v, want [1 0 1]", arms)
+	}
+}
+
+func TestAnnotated(t *testing.T) {
+	recorder, directory := covered(t, program)
+
+	output := &bytes.Buffer{}
+	recorder.WriteAnnotated(output)
+	want := strings.Join([]string{
+		directory + "/main.bir",
+		`        -:    1: use "std:util"`,
+		`        -:    2: use "./lib.bir"`,
+		"        1:    3: let a = twice (2)",
+		"        1:    4: for 3 as i {",
+		"        3:    5:   a++",
+		"        -:    6: }",
+		"        1:    7: switch a {",
+		"                 arm 0 taken 1",
+		"                 arm 1 taken 0",
+		"                 arm 2 taken 0",
+		"        1:    8:   case 7 { a = 0 }",
+		"    #####:    9:   case 8 { a = 1 }",
+		"    #####:   10:   default { a = 2 }",
+		"        -:   11: }",
+		"        -:   12: ",
+		"lines 71.4% of 7, arms 33.3% of 3",
+		"",
+		directory + "/lib.bir",
+		"        1:    1: export twice [n] {",
+		"        1:    2:   return n * 2",
+		"        -:    3: }",
+		"        1:    4: export unused [] {",
+		"    #####:    5:   return 0",
+		"        -:    6: }",
+		"        -:    7: ",
+		"lines 75.0% of 4, arms 100.0% of 0",
+		"", "",
+	}, "\n")
+	if output.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", output.String(), want)
+	}
+}
@@ -0,0 +1,530 @@
+// Package dap lets editors debug bir programs over the debug adapter protocol
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/config"
+	"github.com/canpacis/birlang/src/engine"
+	"github.com/canpacis/birlang/src/framing"
+	"github.com/canpacis/birlang/src/scope"
+	"github.com/canpacis/birlang/src/thrower"
+	"github.com/canpacis/birlang/src/util"
+	"github.com/canpacis/birlang/std"
+)
+
+type action int
+
+const (
+	actionContinue action = iota
+	actionStepIn
+	actionStepOver
+	actionStepOut
+	actionTerminate
+)
+
+// reference is what a variables reference handed to the client points to, the frame of a scope or
+// the cells of a scope
+type reference struct {
+	scope *scope.Scope
+	cells bool
+}
+
+// Session runs one program under the debugger, it is the engine's Debugger and pauses the engine's
+// goroutine while the client looks at the paused process
+type Session struct {
+	// Settings are applied to the engine of the program like the run command applies them
+	Settings *config.Config
+	// Program is run when the launch request does not name one
+	Program string
+
+	output   io.Writer
+	write    sync.Mutex
+	seq      int
+	lock     sync.Mutex
+	launched LaunchArguments
+	program  string
+
+	breakpoints map[string]map[int]bool
+	mode        action
+	pause       bool
+	entry       bool
+	depth       int
+	skip_path   string
+	skip_line   uint32
+	paused      *engine.BirEngine
+	references  []reference
+	paths       map[string]string
+	resume      chan action
+	done        chan struct{}
+}
+
+func NewSession(settings *config.Config, program string) *Session {
+	return &Session{
+		Settings:    settings,
+		Program:     program,
+		breakpoints: map[string]map[int]bool{},
+		paths:       map[string]string{},
+		resume:      make(chan action),
+	}
+}
+
+// Listen serves a single client that connects to the given address
+func (session *Session) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	connection, err := listener.Accept()
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+	return session.Serve(connection, connection)
+}
+
+// Serve answers requests until the client disconnects
+func (session *Session) Serve(input io.Reader, output io.Writer) error {
+	session.output = output
+	reader := bufio.NewReader(input)
+
+	for {
+		request := &Request{}
+		err := framing.Read(reader, request)
+		if err == io.EOF {
+			session.stop()
+			return nil
+		} else if err != nil {
+			session.stop()
+			return err
+		}
+
+		if !session.handle(request) {
+			return nil
+		}
+	}
+}
+
+func (session *Session) send(message interface{}) {
+	session.write.Lock()
+	defer session.write.Unlock()
+
+	session.seq++
+	switch message := message.(type) {
+	case *Response:
+		message.Seq = session.seq
+	case *Event:
+		message.Seq = session.seq
+	}
+	framing.Write(session.output, message)
+}
+
+func (session *Session) respond(request *Request, body interface{}) {
+	session.send(&Response{Type: "response", RequestSeq: request.Seq, Success: true, Command: request.Command, Body: body})
+}
+
+func (session *Session) fail(request *Request, message string) {
+	session.send(&Response{Type: "response", RequestSeq: request.Seq, Success: false, Command: request.Command, Message: message})
+}
+
+func (session *Session) event(name string, body interface{}) {
+	session.send(&Event{Type: "event", Event: name, Body: body})
+}
+
+// handle answers a request, it returns false once the client has disconnected
+func (session *Session) handle(request *Request) bool {
+	switch request.Command {
+	case "initialize":
+		session.respond(request, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsTerminateRequest":         true,
+		})
+		session.event("initialized", nil)
+	case "launch":
+		arguments := LaunchArguments{}
+		if err := json.Unmarshal(request.Arguments, &arguments); err != nil {
+			session.fail(request, err.Error())
+			break
+		}
+		if arguments.Program == "" {
+			arguments.Program = session.Program
+		}
+		if arguments.Program == "" {
+			session.fail(request, "Launch needs a program to debug")
+			break
+		}
+		session.lock.Lock()
+		session.launched = arguments
+		session.program = session.abs(arguments.Program)
+		session.entry = arguments.StopOnEntry
+		session.lock.Unlock()
+		session.respond(request, nil)
+	case "setBreakpoints":
+		arguments := SetBreakpointsArguments{}
+		if err := json.Unmarshal(request.Arguments, &arguments); err != nil {
+			session.fail(request, err.Error())
+			break
+		}
+		lines := arguments.Lines
+		if arguments.Breakpoints != nil {
+			lines = []int{}
+			for _, breakpoint := range arguments.Breakpoints {
+				lines = append(lines, breakpoint.Line)
+			}
+		}
+
+		session.lock.Lock()
+		file := session.abs(arguments.Source.Path)
+		session.breakpoints[file] = map[int]bool{}
+		breakpoints := []Breakpoint{}
+		for _, line := range lines {
+			session.breakpoints[file][line] = true
+			breakpoints = append(breakpoints, Breakpoint{Verified: true, Line: line, Source: arguments.Source})
+		}
+		session.lock.Unlock()
+		session.respond(request, map[string]interface{}{"breakpoints": breakpoints})
+	case "setExceptionBreakpoints":
+		session.respond(request, map[string]interface{}{"breakpoints": []Breakpoint{}})
+	case "configurationDone":
+		session.respond(request, nil)
+		session.start()
+	case "threads":
+		session.respond(request, map[string]interface{}{"threads": []Thread{{ID: 1, Name: "main"}}})
+	case "stackTrace":
+		frames := session.frames()
+		session.respond(request, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)})
+	case "scopes":
+		arguments := struct {
+			FrameID int `json:"frameId"`
+		}{}
+		json.Unmarshal(request.Arguments, &arguments)
+		session.respond(request, map[string]interface{}{"scopes": session.scopes(arguments.FrameID)})
+	case "variables":
+		arguments := struct {
+			VariablesReference int `json:"variablesReference"`
+		}{}
+		json.Unmarshal(request.Arguments, &arguments)
+		session.respond(request, map[string]interface{}{"variables": session.variables(arguments.VariablesReference)})
+	case "continue":
+		session.respond(request, map[string]interface{}{"allThreadsContinued": true})
+		session.proceed(actionContinue)
+	case "next":
+		session.respond(request, nil)
+		session.proceed(actionStepOver)
+	case "stepIn":
+		session.respond(request, nil)
+		session.proceed(actionStepIn)
+	case "stepOut":
+		session.respond(request, nil)
+		session.proceed(actionStepOut)
+	case "pause":
+		session.lock.Lock()
+		session.pause = true
+		session.lock.Unlock()
+		session.respond(request, nil)
+	case "terminate":
+		session.stop()
+		session.respond(request, nil)
+	case "disconnect":
+		session.stop()
+		session.respond(request, nil)
+		return false
+	default:
+		session.fail(request, "Request '"+request.Command+"' is not supported")
+	}
+	return true
+}
+
+// proceed resumes a paused process with the given action. The pause is claimed under the lock so that
+// two requests never both wait for the process to take their action.
+func (session *Session) proceed(next action) {
+	session.lock.Lock()
+	paused := session.paused != nil
+	session.paused = nil
+	session.lock.Unlock()
+
+	if paused {
+		session.resume <- next
+	}
+}
+
+// stop terminates the process and waits for it to end
+func (session *Session) stop() {
+	session.lock.Lock()
+	session.mode = actionTerminate
+	paused := session.paused != nil
+	session.paused = nil
+	done := session.done
+	session.lock.Unlock()
+
+	if paused {
+		session.resume <- actionTerminate
+	}
+	if done != nil {
+		<-done
+	}
+}
+
+type output struct {
+	session  *Session
+	category string
+}
+
+func (output output) Write(p []byte) (int, error) {
+	output.session.event("output", map[string]interface{}{"category": output.category, "output": string(p)})
+	return len(p), nil
+}
+
+// start runs the launched program on a goroutine of its own, the client keeps talking to the session
+// while the program runs
+func (session *Session) start() {
+	session.lock.Lock()
+	if session.done != nil || session.program == "" {
+		session.lock.Unlock()
+		return
+	}
+	session.done = make(chan struct{})
+	arguments := session.launched
+	session.lock.Unlock()
+
+	go func() {
+		defer close(session.done)
+
+		instance := engine.NewEngine(arguments.Program, "", false, false, 0)
+		var err error
+		if session.Settings != nil {
+			err = engine.ApplyConfig(session.Settings.Map(), &instance)
+		}
+		// The debug console is not a terminal, errors are written without colors
+		instance.ColoredOutput = false
+		if !arguments.NoDebug {
+			instance.Debugger = session
+		}
+		instance.Stdin = strings.NewReader("")
+		instance.Stdout = output{session: session, category: "stdout"}
+		instance.Stderr = output{session: session, category: "stderr"}
+
+		if err == nil {
+			err = instance.Init()
+		}
+		if err == nil {
+			err = instance.Run()
+		}
+
+		code := 0
+		if err != nil {
+			code = 1
+			session.lock.Lock()
+			terminated := session.mode == actionTerminate
+			session.lock.Unlock()
+
+			if bir_error, ok := err.(*thrower.BirError); ok && !terminated {
+				session.event("output", map[string]interface{}{"category": "stderr", "output": bir_error.Format(util.NewColor(false))})
+			} else if !terminated {
+				session.event("output", map[string]interface{}{"category": "stderr", "output": err.Error() + "\n"})
+			}
+		}
+		session.event("exited", map[string]interface{}{"exitCode": code})
+		session.event("terminated", nil)
+	}()
+}
+
+// abs returns the absolute path of a file, the embedded modules of the standard library are not on the
+// disk and keep their paths
+func (session *Session) abs(file_path string) string {
+	if std.Embedded(file_path) {
+		return file_path
+	}
+	if result, ok := session.paths[file_path]; ok {
+		return result
+	}
+
+	result, err := filepath.Abs(file_path)
+	if err != nil {
+		result = file_path
+	}
+	session.paths[file_path] = result
+	return result
+}
+
+// depth counts the block calls on a callstack, loops and conditions push entries of their own but
+// stepping over them should not skip their bodies
+func depth(callstack []engine.Callstack) int {
+	result := 0
+	for _, entry := range callstack {
+		if entry.Instance != nil {
+			result++
+		}
+	}
+	return result
+}
+
+// Statement decides whether the engine should pause before a statement and blocks until the client
+// resumes it
+func (session *Session) Statement(instance *engine.BirEngine, statement ast.Statement) error {
+	if _, ok := statement.(*ast.Comment); ok {
+		return nil
+	}
+
+	session.lock.Lock()
+	position := statement.GetPosition()
+	file := session.abs(instance.Path)
+	current := depth(instance.Callstack)
+
+	if session.skip_line != 0 && (file != session.skip_path || position.Line != session.skip_line) {
+		session.skip_line = 0
+	}
+
+	reason := ""
+	switch {
+	case session.mode == actionTerminate:
+		session.lock.Unlock()
+		return instance.Thrower.Throw(thrower.CancelledError, "Bir process has been terminated by the debugger", position)
+	case session.pause:
+		reason = "pause"
+	case session.entry && file == session.program:
+		reason = "entry"
+	case session.mode == actionStepIn:
+		reason = "step"
+	case session.mode == actionStepOver && current <= session.depth:
+		reason = "step"
+	case session.mode == actionStepOut && current < session.depth:
+		reason = "step"
+	case session.skip_line == 0 && session.breakpoints[file][int(position.Line)]:
+		reason = "breakpoint"
+	}
+
+	if reason == "" {
+		session.lock.Unlock()
+		return nil
+	}
+
+	session.pause = false
+	session.entry = false
+	session.paused = instance
+	session.references = nil
+	session.lock.Unlock()
+
+	session.event("stopped", map[string]interface{}{"reason": reason, "threadId": 1, "allThreadsStopped": true})
+	next := <-session.resume
+
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	session.paused = nil
+	if session.mode != actionTerminate {
+		session.mode = next
+	}
+	session.depth = current
+	session.skip_path = file
+	session.skip_line = position.Line
+
+	if session.mode == actionTerminate {
+		return instance.Thrower.Throw(thrower.CancelledError, "Bir process has been terminated by the debugger", position)
+	}
+	return nil
+}
+
+// frames builds the stack view of the paused process from its callstack, the innermost entry first
+func (session *Session) frames() []StackFrame {
+	session.lock.Lock()
+	defer session.lock.Unlock()
+
+	frames := []StackFrame{}
+	if session.paused == nil {
+		return frames
+	}
+
+	callstack := session.paused.Callstack
+	for i := len(callstack) - 1; i >= 0; i-- {
+		entry := callstack[i]
+		frame := StackFrame{ID: i + 1, Name: entry.Label, Line: int(entry.Position.Line), Column: int(entry.Position.Col)}
+		// The embedded modules of the standard library could not be opened by the editor
+		if entry.Path != "" && !std.Embedded(entry.Path) {
+			frame.Source = &Source{Name: filepath.Base(entry.Path), Path: session.abs(entry.Path)}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func (session *Session) reference(s *scope.Scope, cells bool) int {
+	session.references = append(session.references, reference{scope: s, cells: cells})
+	return len(session.references)
+}
+
+// scopes lists the scopes a frame could see, the innermost one first
+func (session *Session) scopes(frame int) []Scope {
+	session.lock.Lock()
+	defer session.lock.Unlock()
+
+	scopes := []Scope{}
+	if session.paused == nil || frame < 1 || frame > len(session.paused.Callstack) {
+		return scopes
+	}
+
+	entry := session.paused.Callstack[frame-1]
+	global := 0
+	for global < len(entry.Scopes)-1 && entry.Scopes[global].Foreign {
+		global++
+	}
+	for i := len(entry.Scopes) - 1; i >= 0; i-- {
+		s := entry.Scopes[i]
+		name := "Outer " + strconv.Itoa(len(entry.Scopes)-1-i)
+		switch {
+		case i == len(entry.Scopes)-1:
+			name = "Local"
+		case s == entry.Instance:
+			name = "Instance"
+		case s.Foreign:
+			name = "Import"
+		case i == global:
+			name = "Global"
+		}
+		scopes = append(scopes, Scope{Name: name, VariablesReference: session.reference(s, false)})
+	}
+	return scopes
+}
+
+// variables lists the frame of a scope followed by its cells, or the cells alone
+func (session *Session) variables(id int) []Variable {
+	session.lock.Lock()
+	defer session.lock.Unlock()
+
+	variables := []Variable{}
+	if session.paused == nil || id < 1 || id > len(session.references) {
+		return variables
+	}
+
+	target := session.references[id-1]
+	if target.cells {
+		indexes := []int64{}
+		for index := range target.scope.Cells {
+			indexes = append(indexes, index)
+		}
+		sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+		for _, index := range indexes {
+			variables = append(variables, Variable{Name: "[" + strconv.FormatInt(index, 10) + "]", Value: strconv.FormatInt(target.scope.Cells[index].Value, 10), Type: "cell"})
+		}
+		return variables
+	}
+
+	for _, value := range target.scope.Frame {
+		variables = append(variables, Variable{Name: value.Key.Value, Value: strconv.FormatInt(value.Value.Value, 10), Type: value.Kind})
+	}
+	if len(target.scope.Cells) > 0 {
+		variables = append(variables, Variable{Name: "cells", Value: strconv.Itoa(len(target.scope.Cells)) + " cell(s)", VariablesReference: session.reference(target.scope, true)})
+	}
+	return variables
+}
@@ -0,0 +1,212 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/canpacis/birlang/src/framing"
+)
+
+// message is a response or an event of the adapter
+type message struct {
+	Type    string          `json:"type"`
+	Command string          `json:"command"`
+	Event   string          `json:"event"`
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Body    json.RawMessage `json:"body"`
+}
+
+// client talks to a session over pipes the way an editor would
+type client struct {
+	t        *testing.T
+	seq      int
+	input    *io.PipeWriter
+	messages chan message
+	done     chan error
+}
+
+func connect(t *testing.T, program string) *client {
+	t.Helper()
+	input_reader, input_writer := io.Pipe()
+	output_reader, output_writer := io.Pipe()
+	c := &client{t: t, input: input_writer, messages: make(chan message, 64), done: make(chan error, 1)}
+
+	go func() {
+		c.done <- NewSession(nil, program).Serve(input_reader, output_writer)
+		output_writer.Close()
+	}()
+	go func() {
+		defer close(c.messages)
+		reader := bufio.NewReader(output_reader)
+		for {
+			m := message{}
+			if err := framing.Read(reader, &m); err != nil {
+				return
+			}
+			c.messages <- m
+		}
+	}()
+	return c
+}
+
+func (c *client) send(command string, arguments interface{}) {
+	c.seq++
+	if err := framing.Write(c.input, map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": arguments}); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// expect waits for a response to a command or for an event, the messages before it are dropped
+func (c *client) expect(kind string, name string) message {
+	c.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m, ok := <-c.messages:
+			if !ok {
+				c.t.Fatalf("the session ended before the %s '%s'", kind, name)
+			}
+			if m.Type == kind && (m.Command == name || m.Event == name) {
+				return m
+			}
+		case <-timeout:
+			c.t.Fatalf("timed out waiting for the %s '%s'", kind, name)
+		}
+	}
+}
+
+// request sends a command and decodes the body of its response
+func (c *client) request(command string, arguments interface{}, body interface{}) message {
+	c.t.Helper()
+	c.send(command, arguments)
+	response := c.expect("response", command)
+	if body != nil {
+		json.Unmarshal(response.Body, body)
+	}
+	return response
+}
+
+func TestSession(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "main.bir")
+	if err := os.WriteFile(program, []byte("let a = 1\nlet b = 2\nlet c = a + b\nlet d = c * 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := connect(t, "")
+	c.request("initialize", map[string]interface{}{}, nil)
+	c.expect("event", "initialized")
+
+	if response := c.request("launch", map[string]interface{}{}, nil); response.Success || response.Message != "Launch needs a program to debug" {
+		t.Errorf("got %v %q, want the launch to fail without a program", response.Success, response.Message)
+	}
+	c.request("launch", map[string]interface{}{"program": program}, nil)
+
+	breakpoints := struct{ Breakpoints []Breakpoint }{}
+	c.request("setBreakpoints", map[string]interface{}{"source": map[string]interface{}{"path": program}, "breakpoints": []map[string]int{{"line": 3}}}, &breakpoints)
+	if len(breakpoints.Breakpoints) != 1 || !breakpoints.Breakpoints[0].Verified || breakpoints.Breakpoints[0].Line != 3 {
+		t.Errorf("got breakpoints %+v", breakpoints.Breakpoints)
+	}
+
+	c.request("configurationDone", nil, nil)
+	stopped := struct{ Reason string }{}
+	json.Unmarshal(c.expect("event", "stopped").Body, &stopped)
+	if stopped.Reason != "breakpoint" {
+		t.Errorf("stopped for %q, want a breakpoint", stopped.Reason)
+	}
+
+	trace := struct{ StackFrames []StackFrame }{}
+	c.request("stackTrace", map[string]interface{}{"threadId": 1}, &trace)
+	if len(trace.StackFrames) == 0 || trace.StackFrames[0].Source == nil || trace.StackFrames[0].Source.Name != "main.bir" {
+		t.Fatalf("got stack frames %+v", trace.StackFrames)
+	}
+
+	scopes := struct{ Scopes []Scope }{}
+	c.request("scopes", map[string]interface{}{"frameId": trace.StackFrames[0].ID}, &scopes)
+	if len(scopes.Scopes) == 0 || scopes.Scopes[0].Name != "Local" {
+		t.Fatalf("got scopes %+v", scopes.Scopes)
+	}
+	variables := struct{ Variables []Variable }{}
+	c.request("variables", map[string]interface{}{"variablesReference": scopes.Scopes[0].VariablesReference}, &variables)
+	values := map[string]string{}
+	for _, variable := range variables.Variables {
+		values[variable.Name] = variable.Value
+	}
+	if len(values) != 2 || values["a"] != "1" || values["b"] != "2" {
+		t.Errorf("got variables %v before line 3, want a and b", values)
+	}
+
+	c.request("next", map[string]interface{}{"threadId": 1}, nil)
+	json.Unmarshal(c.expect("event", "stopped").Body, &stopped)
+	if stopped.Reason != "step" {
+		t.Errorf("stopped for %q, want a step", stopped.Reason)
+	}
+	c.request("variables", map[string]interface{}{"variablesReference": 999}, &variables)
+	if len(variables.Variables) != 0 {
+		t.Errorf("got variables %+v for an unknown reference", variables.Variables)
+	}
+
+	c.request("continue", map[string]interface{}{"threadId": 1}, nil)
+	exited := struct{ ExitCode int }{ExitCode: -1}
+	json.Unmarshal(c.expect("event", "exited").Body, &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("exited with %d, want 0", exited.ExitCode)
+	}
+	c.expect("event", "terminated")
+
+	if response := c.request("evaluate", nil, nil); response.Success {
+		t.Errorf("an unsupported request succeeded")
+	}
+	c.request("disconnect", nil, nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "main.bir")
+	if err := os.WriteFile(program, []byte("let n = 0\nwhile 1 == 1 {\n  n++\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := connect(t, program)
+	c.request("initialize", nil, nil)
+	c.request("launch", map[string]interface{}{"stopOnEntry": true}, nil)
+	c.request("configurationDone", nil, nil)
+
+	stopped := struct{ Reason string }{}
+	json.Unmarshal(c.expect("event", "stopped").Body, &stopped)
+	if stopped.Reason != "entry" {
+		t.Errorf("stopped for %q, want the entry", stopped.Reason)
+	}
+
+	c.request("continue", nil, nil)
+	// The process ends before the terminate request is answered
+	c.send("terminate", nil)
+	exited := struct{ ExitCode int }{}
+	json.Unmarshal(c.expect("event", "exited").Body, &exited)
+	if exited.ExitCode != 1 {
+		t.Errorf("exited with %d, want 1", exited.ExitCode)
+	}
+	c.expect("response", "terminate")
+
+	c.input.Close()
+	if err := <-c.done; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestAbs(t *testing.T) {
+	session := NewSession(nil, "")
+	if got := session.abs("[std]/util.bir"); got != "[std]/util.bir" {
+		t.Errorf("got %s, want the embedded path to be kept", got)
+	}
+	if got := session.abs("main.bir"); !filepath.IsAbs(got) {
+		t.Errorf("got %s, want an absolute path", got)
+	}
+}
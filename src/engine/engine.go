@@ -1,44 +1,151 @@
 package engine
 
 import (
-	"encoding/json"
+	"bufio"
+	"context"
+	"errors"
+	"io"
 	"math"
 	"os"
-	"os/exec"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/canpacis/birlang/src/ast"
 	"github.com/canpacis/birlang/src/implementor"
+	"github.com/canpacis/birlang/src/importer"
+	"github.com/canpacis/birlang/src/parser"
+	"github.com/canpacis/birlang/src/resolver"
 	"github.com/canpacis/birlang/src/scope"
 	"github.com/canpacis/birlang/src/thrower"
 	"github.com/canpacis/birlang/src/util"
+	"github.com/canpacis/birlang/std"
 	"github.com/mitchellh/mapstructure"
 )
 
-// TODO: Complete applying config
-func ApplyConfig(options map[string]interface{}, instance *BirEngine) {
-	var config map[string]interface{}
-	mapstructure.Decode(options, &config)
-
-	instance.ColoredOutput = config["ColoredOutput"].(bool)
-	instance.VerbosityLevel = config["VerbosityLevel"].(int)
+// ApplyConfig sets the settings of a config on an engine and on the engines it has imported, the keys
+// are the ones of bir.config.json. Permissions only reach the 'bir' block of engines that are not
+// initialized yet.
+func ApplyConfig(options map[string]interface{}, instance *BirEngine) error {
+	for key, value := range options {
+		var err error
+
+		switch key {
+		case "colored_output":
+			instance.ColoredOutput, err = configBool(key, value)
+		case "verbosity_level":
+			var level int64
+			level, err = configInt(key, value)
+			instance.VerbosityLevel = int(level)
+		case "maximum_callstack_size":
+			var size int64
+			size, err = configInt(key, value)
+			instance.MaximumCallstackSize = int(size)
+		case "std_path":
+			instance.StdPath, err = configString(key, value)
+		case "search_paths":
+			instance.SearchPaths, err = configStrings(key, value)
+		case "warnings_as_errors":
+			instance.WarningsAsErrors, err = configBool(key, value)
+		case "step_budget":
+			instance.StepBudget, err = configInt(key, value)
+		case "permissions":
+			instance.Permissions, err = configPermissions(key, value)
+		default:
+			err = errors.New("Unknown config key '" + key + "'")
+		}
 
-	if config["MaximumCallstackSize"] != 0 {
-		instance.MaximumCallstackSize = config["MaximumCallstackSize"].(int)
+		if err != nil {
+			return err
+		}
 	}
-	instance.Thrower = thrower.Thrower{Owner: instance, Color: util.NewColor(instance.ColoredOutput)}
+
+	instance.Config = options
+	instance.Thrower = thrower.Thrower{Owner: instance, Color: util.NewColor(instance.ColoredOutput), Output: instance.Stderr}
 
 	for _, use := range instance.Uses {
-		ApplyConfig(instance.Config, &use)
+		if err := ApplyConfig(options, use); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func configBool(key string, value interface{}) (bool, error) {
+	if result, ok := value.(bool); ok {
+		return result, nil
+	}
+	return false, errors.New("Config key '" + key + "' should be true or false")
+}
+
+func configInt(key string, value interface{}) (int64, error) {
+	switch value := value.(type) {
+	case int:
+		return int64(value), nil
+	case int64:
+		return value, nil
+	case float64:
+		if value == math.Trunc(value) {
+			return int64(value), nil
+		}
+	}
+	return 0, errors.New("Config key '" + key + "' should be a whole number")
+}
+
+func configString(key string, value interface{}) (string, error) {
+	if result, ok := value.(string); ok {
+		return result, nil
+	}
+	return "", errors.New("Config key '" + key + "' should be a string")
+}
+
+func configStrings(key string, value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case []string:
+		return value, nil
+	case []interface{}:
+		result := []string{}
+		for _, element := range value {
+			str, ok := element.(string)
+			if !ok {
+				return nil, errors.New("Config key '" + key + "' should be a list of strings")
+			}
+			result = append(result, str)
+		}
+		return result, nil
+	}
+	return nil, errors.New("Config key '" + key + "' should be a list of strings")
+}
+
+func configPermissions(key string, value interface{}) (*implementor.Permissions, error) {
+	options, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Config key '" + key + "' should be an object")
 	}
+
+	permissions := &implementor.Permissions{Read: true, Write: true}
+	for name, permission := range options {
+		allowed, err := configBool(key+"."+name, permission)
+		if err != nil {
+			return nil, err
+		}
+
+		switch name {
+		case "read":
+			permissions.Read = allowed
+		case "write":
+			permissions.Write = allowed
+		default:
+			return nil, errors.New("Unknown config key '" + key + "." + name + "'")
+		}
+	}
+	return permissions, nil
 }
 
 type BirEngine struct {
 	ID                   string                    `json:"id"`
 	Anonymous            bool                      `json:"anonymous"`
-	NamespaceAllowed     bool                      `json:"namespace_allowed"`
 	ScopeMutaterAllowed  bool                      `json:"scope_mutater_allowed"`
 	Path                 string                    `json:"path"`
 	URI                  string                    `json:"uri"`
@@ -46,22 +153,111 @@ type BirEngine struct {
 	Directory            string                    `json:"directory"`
 	Content              string                    `json:"content"`
 	VerbosityLevel       int                       `json:"verbosity_level"`
-	Parsed               map[string]interface{}    `json:"parsed"`
+	Parsed               *ast.Program              `json:"parsed"`
 	MaximumCallstackSize int                       `json:"maximum_callstack_size"`
 	Callstack            []Callstack               `json:"callstack"`
 	Scopestack           scope.Scopestack          `json:"scopestack"`
 	StdPath              string                    `json:"std_path"`
-	Uses                 []BirEngine               `json:"uses"`
+	Uses                 []*BirEngine              `json:"uses"`
+	Modules              *Modules                  `json:"-"`
 	Thrower              thrower.Thrower           `json:"thrower"`
 	ColoredOutput        bool                      `json:"colored_output"`
 	Implementors         []implementor.Implementor `json:"implementors"`
 	Config               map[string]interface{}    `json:"config"`
+	Context              context.Context           `json:"-"`
+	StepBudget           int64                     `json:"step_budget"`
+	steps                *int64
+	Stdin                io.Reader `json:"-"`
+	Stdout               io.Writer `json:"-"`
+	Stderr               io.Writer `json:"-"`
+	Debugger             Debugger  `json:"-"`
+	Tracer               Tracer    `json:"-"`
+	// SearchPaths are the directories 'module:' imports are looked up in when they are not next to the file
+	SearchPaths      []string                 `json:"search_paths"`
+	WarningsAsErrors bool                     `json:"warnings_as_errors"`
+	Permissions      *implementor.Permissions `json:"permissions"`
+	// Unwound is the callstack the last failing evaluation was on when it threw, it is empty when the
+	// input failed before it ran
+	Unwound []Callstack `json:"unwound"`
+	// imports are the use statements applied to the engine, one that is evaluated again is skipped
+	imports []string
+	// namespaces are the scopes of the namespaces being declared, their blocks run on top of them
+	namespaces []*scope.Scope
+}
+
+// Debugger is told about every statement before the engine runs it, it pauses the process by not
+// returning and aborts it by returning an error
+type Debugger interface {
+	Statement(engine *BirEngine, statement ast.Statement) error
+}
+
+// Tracer is told about every statement the engine has run and every block call it enters and leaves,
+// value is nil for statements that do not produce one. Branch reports the arm of an if or a switch
+// statement that is about to run, the else or the default arm comes last and is reported even when it
+// is not written.
+type Tracer interface {
+	Statement(engine *BirEngine, statement ast.Statement, value *ast.IntPrimitiveExpression, err error)
+	Branch(engine *BirEngine, statement ast.Statement, arm int)
+	Enter(engine *BirEngine, expression *ast.BlockCallExpression, label string, verbs []int64, arguments []int64)
+	Exit(engine *BirEngine, expression *ast.BlockCallExpression, label string, value ast.IntPrimitiveExpression, err error)
+}
+
+// Tracers passes every event to each of the tracers in order
+type Tracers []Tracer
+
+func (tracers Tracers) Statement(engine *BirEngine, statement ast.Statement, value *ast.IntPrimitiveExpression, err error) {
+	for _, tracer := range tracers {
+		tracer.Statement(engine, statement, value, err)
+	}
+}
+
+func (tracers Tracers) Branch(engine *BirEngine, statement ast.Statement, arm int) {
+	for _, tracer := range tracers {
+		tracer.Branch(engine, statement, arm)
+	}
+}
+
+func (tracers Tracers) Enter(engine *BirEngine, expression *ast.BlockCallExpression, label string, verbs []int64, arguments []int64) {
+	for _, tracer := range tracers {
+		tracer.Enter(engine, expression, label, verbs, arguments)
+	}
+}
+
+func (tracers Tracers) Exit(engine *BirEngine, expression *ast.BlockCallExpression, label string, value ast.IntPrimitiveExpression, err error) {
+	for _, tracer := range tracers {
+		tracer.Exit(engine, expression, label, value, err)
+	}
 }
 
 type Callstack struct {
-	Label      string        `json:"label"`
-	Identifier string        `json:"identifier"`
-	Stack      []interface{} `json:"stack"`
+	Label      string          `json:"label"`
+	Identifier string          `json:"identifier"`
+	Stack      []ast.Statement `json:"stack"`
+	Instance   *scope.Scope    `json:"-"`
+	// Position, Path and Scopes describe the statement the entry is running
+	Position ast.Position   `json:"position"`
+	Path     string         `json:"path"`
+	Scopes   []*scope.Scope `json:"-"`
+}
+
+// Source describes the file of the engine to its thrower
+func (engine *BirEngine) Source() thrower.Source {
+	return thrower.Source{
+		Filename:       engine.Filename,
+		URI:            engine.URI,
+		Content:        engine.Content,
+		Anonymous:      engine.Anonymous,
+		VerbosityLevel: engine.VerbosityLevel,
+	}
+}
+
+// Labels returns the labels of the callstack of the engine
+func (engine *BirEngine) Labels() []string {
+	labels := []string{}
+	for _, callstack := range engine.Callstack {
+		labels = append(labels, callstack.Label)
+	}
+	return labels
 }
 
 func (engine *BirEngine) PushCallstack(callstack Callstack) []Callstack {
@@ -78,288 +274,598 @@ func (engine *BirEngine) PopCallstack() []Callstack {
 	return result
 }
 
-func (engine *BirEngine) ReverseCallstack() []Callstack {
-	a := make([]Callstack, len(engine.Callstack))
-	copy(a, engine.Callstack)
-
-	for i := len(a)/2 - 1; i >= 0; i-- {
-		opp := len(a) - 1 - i
-		a[i], a[opp] = a[opp], a[i]
+func (engine BirEngine) HandleError(err error, position ast.Position) error {
+	if err != nil {
+		return engine.Thrower.Throw(thrower.InternalError, err.Error()+"\nThis error is caused by an engine bug", position)
 	}
-
-	return a
+	return nil
 }
 
-func (engine BirEngine) HandleError(err error, position ast.Position) {
+func (engine BirEngine) HandleAnonymousError(err error) error {
 	if err != nil {
-		engine.Thrower.Throw(err.Error()+"\nThis error is caused by an engine bug", position, engine.Callstack)
+		return engine.Thrower.ThrowAnonymous(thrower.InternalError, err.Error()+"\nThis error is caused by an engine bug")
 	}
+	return nil
 }
 
-func (engine BirEngine) HandleAnonymousError(err error) {
-	if err != nil {
-		engine.Thrower.ThrowAnonymous(err.Error() + "\nThis error is caused by an engine bug")
+// Register adds a native block next to the 'bir' block every engine has, implementors have to be
+// registered before Init
+func (engine *BirEngine) Register(i implementor.Implementor) {
+	engine.Implementors = append(engine.Implementors, i)
+}
+
+// Step counts a loop iteration or a block call, the process is aborted once it takes more steps than
+// its budget allows or its context is done
+func (engine *BirEngine) Step(position ast.Position) error {
+	*engine.steps++
+
+	if engine.StepBudget > 0 && *engine.steps > engine.StepBudget {
+		return engine.Thrower.Throw(thrower.BudgetError, "Bir process has exceeded its budget of "+strconv.FormatInt(engine.StepBudget, 10)+" steps", position)
 	}
+
+	if engine.Context != nil {
+		select {
+		case <-engine.Context.Done():
+			err := engine.Thrower.Throw(thrower.CancelledError, "Bir process has been cancelled, "+engine.Context.Err().Error(), position)
+			err.Cause = engine.Context.Err()
+			return err
+		default:
+		}
+	}
+	return nil
+}
+
+// ResetSteps gives the engine its whole step budget back
+func (engine *BirEngine) ResetSteps() {
+	*engine.steps = 0
 }
 
-func (engine *BirEngine) Init() {
+func (engine *BirEngine) Init() error {
 	engine.Path = strings.ReplaceAll(engine.Path, "\\", "/")
 	engine.URI = "file://" + engine.Path
 	engine.ID = util.UUID()
-	engine.MaximumCallstackSize = 8000
-	engine.Thrower = thrower.Thrower{Owner: engine, Color: util.NewColor(engine.ColoredOutput)}
-	engine.Scopestack.PushScope(scope.Scope{})
+	if engine.MaximumCallstackSize == 0 {
+		engine.MaximumCallstackSize = 8000
+	}
+	engine.Thrower = thrower.Thrower{Owner: engine, Color: util.NewColor(engine.ColoredOutput), Output: engine.Stderr}
+	engine.Scopestack.PushScope(&scope.Scope{})
+
+	if engine.steps == nil {
+		engine.steps = new(int64)
+	}
+	if engine.Stdin == nil {
+		engine.Stdin = os.Stdin
+	}
+	if _, ok := engine.Stdin.(*bufio.Reader); !ok {
+		engine.Stdin = bufio.NewReader(engine.Stdin)
+	}
 
+	engine.Scopestack.AddBlock(util.GenerateNativeFunction("bir", implementor.Dispatch(&implementor.Bir{Stdin: engine.Stdin, Stdout: engine.Stdout, Permissions: engine.Permissions})))
 	for _, i := range engine.Implementors {
-		engine.Scopestack.AddBlock(util.GenerateNativeFunction(i.Name, i.Interface))
+		if engine.Scopestack.BlockExists(i.Name()) {
+			return engine.Thrower.ThrowAnonymous(thrower.NativeError, "Could not register native block '"+i.Name()+"', a block with the same name exists")
+		}
+		engine.Scopestack.AddBlock(util.GenerateNativeFunction(i.Name(), implementor.Dispatch(i)))
 	}
 
 	if !engine.Anonymous {
 		dir, file := path.Split(engine.Path)
 		engine.Directory = dir
 		engine.Filename = file
-		raw, err := os.ReadFile(engine.Path)
 
-		engine.HandleAnonymousError(err)
+		// A program that does not come from a file, like one read from the standard input, is given as
+		// the content of the engine
+		if engine.Content == "" {
+			raw, err := std.ReadFile(engine.Path)
+			if err != nil {
+				return engine.Thrower.ThrowAnonymous(thrower.ImportError, "Could not read file '"+engine.Path+"'")
+			}
+			engine.Content = string(raw)
+		}
 
-		engine.Content = string(raw)
-		result := ast.ParserResult{}
-		out, err := exec.Command("node", "C:\\Users\\tmwwd\\go\\src\\birlang\\bin\\parser\\parser", string(engine.Content)).Output()
-		engine.HandleAnonymousError(err)
+		program, err := engine.Parse(engine.Content)
+		if err != nil {
+			return err
+		}
 
-		json.Unmarshal(out, &result)
-		if result.Error {
-			content := ast.ErrorContent{}
-			engine.HandleAnonymousError(mapstructure.Decode(result.Content, &content))
-			engine.Thrower.ThrowAnonymous(content.Message)
-		} else {
-			engine.HandleAnonymousError(mapstructure.Decode(result.Content, &engine.Parsed))
+		engine.Parsed = program
+		engine.Callstack = engine.PushCallstack(Callstack{Label: "main [" + engine.Filename + "]", Identifier: "main", Stack: engine.Parsed.Program})
 
-			if engine.Parsed["program"] != nil {
-				engine.Callstack = engine.PushCallstack(Callstack{Label: "main [" + engine.Filename + "]", Identifier: "main", Stack: engine.Parsed["program"].([]interface{})})
-			} else {
-				engine.Thrower.ThrowAnonymous("Syntax error ¯\\_(ツ)_/¯. I actually don't know what's wrong with this parser")
-			}
+		modules := engine.modules()
+		modules.loading = append(modules.loading, engine)
+		err = engine.AddImports(engine.Parsed.Imports)
+		modules.loading = modules.loading[:len(modules.loading)-1]
+		if err != nil {
+			engine.Callstack = engine.PopCallstack()
+			return err
+		}
+		if err := engine.Resolve(engine.Parsed.Program); err != nil {
+			engine.Callstack = engine.PopCallstack()
+			return err
+		}
+	}
+	return nil
+}
+
+// Resolve binds the names in the given statements to their places on the scopestack, the first
+// undefined name is returned before anything runs
+func (engine *BirEngine) Resolve(statements []ast.Statement) error {
+	errors := resolver.NewResolver(&engine.Scopestack).Resolve(statements)
 
-			engine.AddImports(engine.Parsed)
+	if len(errors) > 0 {
+		return engine.Thrower.Throw(thrower.ReferenceError, errors[0].Message, errors[0].Position)
+	}
+	return nil
+}
+
+// Parse runs the parser on the given input and decodes its output into a typed program
+func (engine *BirEngine) Parse(input string) (*ast.Program, error) {
+	result := parser.Parse(input)
+
+	if result.Error {
+		content := ast.ErrorContent{}
+		if err := engine.HandleAnonymousError(mapstructure.Decode(result.Content, &content)); err != nil {
+			return nil, err
 		}
+		return nil, engine.Thrower.Throw(thrower.SyntaxError, content.Message, content.Position)
 	}
+
+	program, err := ast.Decode(result.Content)
+	if err != nil {
+		decode_error := err.(ast.DecodeError)
+		return nil, engine.Thrower.Throw(thrower.SyntaxError, decode_error.Message, decode_error.Position)
+	}
+	return program, nil
 }
 
-func (engine *BirEngine) AddImports(stack map[string]interface{}) {
-	var is_standard bool
-	var should_continue bool
-	for _, use := range stack["imports"].([]interface{}) {
-		var statement ast.UseStatement
-		engine.HandleAnonymousError(mapstructure.Decode(use, &statement))
+// Modules holds the modules a process has loaded by their resolved path so that a module imported by
+// several files is loaded and run once, loading is the chain of modules that are being imported
+type Modules struct {
+	loaded  map[string]*BirEngine
+	loading []*BirEngine
+}
 
-		var use_path string
-		if strings.HasPrefix(statement.Source.Value, "std:") {
-			is_standard = true
-			should_continue = true
-			use_path = path.Join(engine.StdPath, strings.Split(statement.Source.Value, "std:")[1]+".bir")
-			if _, err := os.Stat(use_path); os.IsNotExist(err) {
-				engine.Thrower.Throw("Import '"+statement.Source.Value+"' is not included in the standard library", statement.Position, engine.Callstack)
-			}
-		} else if strings.HasPrefix(statement.Source.Value, "module:") {
-			is_standard = false
-			should_continue = true
-			use_path = path.Join(engine.Directory, strings.Split(statement.Source.Value, "module:")[1])
-			if _, err := os.Stat(use_path); os.IsNotExist(err) {
-				engine.Thrower.Throw("Import '"+statement.Source.Value+"' could not be found", statement.Position, engine.Callstack)
-			}
-		} else {
-			is_standard = false
-			should_continue = false
-			engine.Thrower.Throw("Uknown use prefix '"+strings.Split(statement.Source.Value, ":")[0]+"'", statement.Position, engine.Callstack)
+func (engine *BirEngine) modules() *Modules {
+	if engine.Modules == nil {
+		engine.Modules = &Modules{loaded: map[string]*BirEngine{}}
+	}
+	return engine.Modules
+}
+
+func (engine *BirEngine) AddImports(imports []*ast.UseStatement) error {
+	modules := engine.modules()
+	// The modules the names brought without an alias come from, two modules could not bring the same name
+	owners := map[string]*ast.UseStatement{}
+	engines := map[*ast.UseStatement]*BirEngine{}
+
+	for _, statement := range imports {
+		use_path, is_standard, err := importer.Importer{StdPath: engine.StdPath, SearchPaths: engine.SearchPaths}.Path(engine.Directory, statement.Source.Value)
+		if err != nil {
+			return engine.Thrower.Throw(thrower.ImportError, err.Error(), statement.Position)
+		}
+
+		chain := []string{}
+		for _, module := range modules.loading {
+			chain = append(chain, module.Path)
+		}
+		if err := importer.Cycle(chain, statement.Source.Value, use_path); err != nil {
+			return engine.Thrower.Throw(thrower.ImportError, err.Error(), statement.Position)
+		}
+
+		key := importer.Key(use_path)
+
+		alias := statement.Alias.Value
+		import_key := importKey(key, statement)
+		if engine.imported(import_key) {
+			continue
+		}
+		if alias != "" && engine.Scopestack.FindModule(alias) != nil {
+			return engine.Thrower.Throw(thrower.ImportError, "Could not import '"+statement.Source.Value+"' as '"+alias+"', another module is imported as '"+alias+"'", statement.Alias.Position)
 		}
 
-		if should_continue {
-			use_engine := NewEngine(use_path, engine.StdPath, engine.Anonymous, engine.ColoredOutput, engine.VerbosityLevel)
+		use_engine, loaded := modules.loaded[key]
+		if !loaded {
+			instance := NewEngine(use_path, engine.StdPath, false, engine.ColoredOutput, engine.VerbosityLevel)
+			use_engine = &instance
+			use_engine.Modules = modules
 			use_engine.Implementors = engine.Implementors
-			use_engine.Init()
+			use_engine.Context = engine.Context
+			use_engine.StepBudget = engine.StepBudget
+			use_engine.steps = engine.steps
+			use_engine.Stdin = engine.Stdin
+			use_engine.Stdout = engine.Stdout
+			use_engine.Stderr = engine.Stderr
+			use_engine.Debugger = engine.Debugger
+			use_engine.Tracer = engine.Tracer
+			use_engine.MaximumCallstackSize = engine.MaximumCallstackSize
+			use_engine.SearchPaths = engine.SearchPaths
+			use_engine.WarningsAsErrors = engine.WarningsAsErrors
+			use_engine.Permissions = engine.Permissions
+			use_engine.Config = engine.Config
+			if err := use_engine.Init(); err != nil {
+				return err
+			}
 			if is_standard {
-				use_engine.NamespaceAllowed = true
 				use_engine.ScopeMutaterAllowed = true
 			}
-			use_engine.Run()
+			if err := use_engine.Run(); err != nil {
+				return err
+			}
+			modules.loaded[key] = use_engine
+		}
+
+		visible, err := statement.Visible(use_engine.Parsed.Exports())
+		if err != nil {
+			import_error := err.(ast.ImportError)
+			return engine.Thrower.Throw(thrower.ImportError, import_error.Message, import_error.Position)
+		}
+
+		if alias == "" {
+			names := []string{}
+			for name := range visible {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				owner, ok := owners[name]
+				if ok && engines[owner] != use_engine {
+					return engine.Thrower.Throw(thrower.ImportError, "Could not import '"+name+"' from '"+statement.Source.Value+"', it is already imported from '"+owner.Source.Value+"'", statement.Position)
+				}
+				owners[name] = statement
+			}
+			engines[statement] = use_engine
+		}
+
+		s := use_engine.Scopestack.GetCurrentScope()
+		use_scope := &scope.Scope{}
+		use_scope.Blocks = s.Blocks
+		use_scope.Frame = s.Frame
+		use_scope.Foreign = true
+		use_scope.Immutable = true
+		use_scope.Alias = alias
+		use_scope.Exported = visible
+		engine.Scopestack.ShiftScope(use_scope)
+		// Only the visible namespaces the module declares itself are brought, behind the alias if there is one
+		for _, namespace := range use_engine.Scopestack.Namespaces {
+			if namespace.Foreign || !visible[strings.SplitN(namespace.Name, ".", 2)[0]] {
+				continue
+			}
+			if alias != "" {
+				namespace.Name = alias + "." + namespace.Name
+			}
+			namespace.Foreign = true
+			engine.Scopestack.Namespaces = append(engine.Scopestack.Namespaces, namespace)
+		}
+		engine.Uses = append(engine.Uses, use_engine)
+		engine.imports = append(engine.imports, import_key)
+	}
+	return nil
+}
+
+// importKey identifies a use statement by the module it reaches, its alias and the names it selects
+func importKey(key string, statement *ast.UseStatement) string {
+	names := []string{}
+	for _, name := range statement.Names {
+		names = append(names, name.Value)
+	}
+	sort.Strings(names)
+	return key + "\x00" + statement.Alias.Value + "\x00" + strings.Join(names, ",")
+}
 
-			s := use_engine.Scopestack.GetCurrentScope()
-			use_scope := scope.Scope{}
-			use_scope.Blocks = s.Blocks
-			use_scope.Frame = s.Frame
-			use_scope.Foreign = true
-			use_scope.Immutable = true
-			engine.Scopestack.ShiftScope(use_scope)
-			engine.Scopestack.Namespaces = append(engine.Scopestack.Namespaces, use_engine.Scopestack.Namespaces...)
-			engine.Uses = append(engine.Uses, use_engine)
+func (engine *BirEngine) imported(import_key string) bool {
+	for _, applied := range engine.imports {
+		if applied == import_key {
+			return true
 		}
 	}
+	return false
 }
 
-func (engine *BirEngine) Feed(input string) string {
-	result := ast.ParserResult{}
-	out, err := exec.Command("node", "C:\\Users\\tmwwd\\go\\src\\birlang\\bin\\parser\\parser.js", input).Output()
-	engine.HandleAnonymousError(err)
-	json.Unmarshal(out, &result)
+// warn reports a warning, the process fails with it instead when warnings are errors
+func (engine BirEngine) warn(message string, position ast.Position) error {
+	if engine.WarningsAsErrors {
+		return engine.Thrower.Throw(thrower.WarningError, message, position)
+	}
+	engine.Thrower.Warn(message, position)
+	return nil
+}
 
-	if result.Error {
-		content := ast.ErrorContent{}
-		engine.HandleAnonymousError(mapstructure.Decode(result.Content, &content))
-		return content.Message
-	} else {
-		var stack map[string]interface{}
-		engine.HandleAnonymousError(mapstructure.Decode(result.Content, &stack))
-		engine.Scopestack.PushScope(scope.Scope{})
+// Feed runs a piece of input on top of everything fed before and formats its value for the repl
+func (engine *BirEngine) Feed(input string) (string, error) {
+	value, err := engine.Eval(input)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(int(value.Value)), nil
+}
 
-		engine.AddImports(stack)
+// Eval runs a piece of input on top of everything evaluated before, its declarations go to the top
+// level scope the engine was initialized with and modules that are already imported are not imported
+// again. A failing input takes back what it declared and imported so that the next one can run.
+func (engine *BirEngine) Eval(input string) (ast.IntPrimitiveExpression, error) {
+	engine.Unwound = nil
+	program, err := engine.Parse(input)
+	if err != nil {
+		return util.GenerateIntPrimitive(-1), err
+	}
 
-		if stack["program"] != nil {
-			engine.Callstack = engine.PushCallstack(Callstack{Label: "main [" + engine.Filename + "]", Identifier: "main", Stack: stack["program"].([]interface{})})
-			result := engine.ResolveCallstack(engine.GetCurrentCallStack())
-			return strconv.Itoa(int(result.Value))
-		} else {
-			engine.Thrower.ThrowAnonymous("Syntax error ¯\\_(ツ)_/¯. I actually don't know what's wrong with this parser ಠ_ಠ")
-			return ""
-		}
+	rollback := engine.checkpoint()
+	if err := engine.AddImports(program.Imports); err != nil {
+		rollback()
+		return util.GenerateIntPrimitive(-1), err
+	}
+	if err := engine.Resolve(program.Program); err != nil {
+		rollback()
+		return util.GenerateIntPrimitive(-1), err
+	}
+
+	engine.Callstack = engine.PushCallstack(Callstack{Label: "main [" + engine.Filename + "]", Identifier: "main", Stack: program.Program})
+	value, err := engine.ResolveCallstack(engine.GetCurrentCallStack())
+	if err != nil {
+		engine.Unwound = engine.Callstack
+		rollback()
+		return util.GenerateIntPrimitive(-1), err
+	}
+	return value, nil
+}
+
+// checkpoint records the state an evaluation could change, the returned function restores it
+func (engine *BirEngine) checkpoint() func() {
+	callstack := engine.Callstack
+	scopes := engine.Scopestack.Scopes
+	namespaces := len(engine.Scopestack.Namespaces)
+	uses := len(engine.Uses)
+	imports := len(engine.imports)
+	top := engine.Scopestack.GetCurrentScope()
+	frame := len(top.Frame)
+	blocks := len(top.Blocks)
+
+	return func() {
+		engine.Callstack = callstack
+		engine.Scopestack.Scopes = scopes
+		engine.Scopestack.Namespaces = engine.Scopestack.Namespaces[:namespaces]
+		engine.Uses = engine.Uses[:uses]
+		engine.imports = engine.imports[:imports]
+		top.Frame = top.Frame[:frame]
+		top.Blocks = top.Blocks[:blocks]
+	}
+}
+
+// CallBlock calls a block that is visible from the current scope with the given verbs and arguments
+// as if the call was written at the top level
+func (engine *BirEngine) CallBlock(name string, verbs []int64, arguments []int64) (ast.IntPrimitiveExpression, error) {
+	expression := &ast.BlockCallExpression{Operation: "block_call", Name: util.GenerateIdentifier(name)}
+	for _, verb := range verbs {
+		expression.Verbs = append(expression.Verbs, &ast.IntPrimitiveExpression{Operation: "primitive", Type: "int", Value: verb})
+	}
+	for _, argument := range arguments {
+		expression.Arguments = append(expression.Arguments, &ast.IntPrimitiveExpression{Operation: "primitive", Type: "int", Value: argument})
 	}
+
+	if err := engine.Resolve([]ast.Statement{expression}); err != nil {
+		return util.GenerateIntPrimitive(-1), err
+	}
+
+	callstack := engine.Callstack
+	scopes := engine.Scopestack.Scopes
+	value, err := engine.ResolveBlockCall(expression)
+	if err != nil {
+		engine.Callstack = callstack
+		engine.Scopestack.Scopes = scopes
+	}
+	return value, err
 }
 
 func (engine BirEngine) GetCurrentCallStack() Callstack {
 	if len(engine.Callstack) > 0 {
 		return engine.Callstack[len(engine.Callstack)-1]
 	}
-	return Callstack{Label: "Root Stack", Identifier: "root_stack", Stack: []interface{}{}}
+	return Callstack{Label: "Root Stack", Identifier: "root_stack", Stack: []ast.Statement{}}
 }
 
 func (engine BirEngine) GetCurrentScope() scope.Scope {
 	return *engine.Scopestack.GetCurrentScope()
 }
 
-func (engine *BirEngine) Run() {
+func (engine *BirEngine) Run() error {
 	if len(engine.Callstack) > 0 {
-		engine.ResolveCallstack(engine.GetCurrentCallStack())
+		callstack := engine.Callstack
+		scopes := engine.Scopestack.Scopes
+
+		if _, err := engine.ResolveCallstack(engine.GetCurrentCallStack()); err != nil {
+			engine.Callstack = callstack
+			engine.Scopestack.Scopes = scopes
+			return err
+		}
 	}
+	return nil
 }
 
-func (engine *BirEngine) ResolveCallstack(callstack Callstack) ast.IntPrimitiveExpression {
+func (engine *BirEngine) ResolveCallstack(callstack Callstack) (ast.IntPrimitiveExpression, error) {
 	var value ast.IntPrimitiveExpression
+	var err error
 
 	for _, statement := range callstack.Stack {
-		operation := statement.(map[string]interface{})["operation"]
-		pos := statement.(map[string]interface{})["position"]
-		var statement_position ast.Position
-		engine.HandleAnonymousError(mapstructure.Decode(pos, &statement_position))
-		switch operation {
-		case "variable_declaration":
-			result := ast.VariableDeclarationStatement{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			engine.ResolveVariableDeclaration(result)
-		case "return_statement":
-			var result map[string]interface{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			value := engine.ResolveExpression(result["expression"].(map[string]interface{}))
-			var position ast.Position
-			engine.HandleError(mapstructure.Decode(result["position"], &position), statement_position)
+		if len(engine.Callstack) > 0 {
+			current := &engine.Callstack[len(engine.Callstack)-1]
+			current.Position = statement.GetPosition()
+			current.Path = engine.Path
+			current.Scopes = engine.Scopestack.Scopes
+		}
+		if engine.Debugger != nil {
+			if err := engine.Debugger.Statement(engine, statement); err != nil {
+				return util.GenerateIntPrimitive(-1), err
+			}
+		}
+
+		switch statement := statement.(type) {
+		case *ast.VariableDeclarationStatement:
+			err = engine.ResolveVariableDeclaration(statement)
+		case *ast.ReturnStatement:
+			value, err := engine.ResolveExpression(statement.Expression)
+			engine.trace(statement, value, err)
+			if err != nil {
+				return value, err
+			}
 
 			if engine.GetCurrentCallStack().Identifier == "main" {
-				engine.Thrower.Throw("Top level return statements are not allowed", position, engine.Callstack)
+				return value, engine.Thrower.Throw(thrower.RuntimeError, "Top level return statements are not allowed", statement.Position)
 			}
 			engine.Callstack = engine.PopCallstack()
-			return value
-		case "throw_statement":
-			var result map[string]interface{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			value := engine.ResolveExpression(result["expression"].(map[string]interface{}))
-			var position ast.Position
-			engine.HandleError(mapstructure.Decode(result["position"], &position), statement_position)
+			return value, nil
+		case *ast.ThrowStatement:
+			value, err := engine.ResolveExpression(statement.Expression)
+			engine.trace(statement, value, err)
+			if err != nil {
+				return value, err
+			}
 
 			if engine.GetCurrentCallStack().Identifier == "main" {
-				engine.Thrower.Throw("Top level throw statements are not allowed", position, engine.Callstack)
-			} else {
-				engine.Thrower.Throw("Bir process has thrown error with value '"+strconv.Itoa(int(value.Value))+"'", position, engine.Callstack)
+				return value, engine.Thrower.Throw(thrower.RuntimeError, "Top level throw statements are not allowed", statement.Position)
+			}
+			thrown := engine.Thrower.Throw(thrower.ThrowError, "Bir process has thrown error with value '"+strconv.Itoa(int(value.Value))+"'", statement.Position)
+			thrown.Value = value.Value
+			return value, thrown
+		case *ast.BlockDeclarationStatement:
+			err = engine.ResolveBlockDeclaration(*statement)
+		case *ast.NamespaceDeclarationStatement:
+			err = engine.ResolveNamespaceDeclaration(statement)
+		case *ast.NamespaceIndexerExpression:
+			_, err = engine.ResolveNamespaceIndexerExpression(statement)
+		case *ast.QuantityModifierStatement:
+			err = engine.ResolveQuantityModifierStatement(statement)
+		case *ast.AssignStatement:
+			err = engine.ResolveAssignStatement(statement)
+		case *ast.BlockCallExpression:
+			value, err = engine.ResolveBlockCall(statement)
+		case *ast.ScopeMutaterExpression:
+			_, err = engine.ResolveScopeMutaterExpression(statement)
+		case *ast.ForStatement:
+			err = engine.ResolveForStatement(statement)
+		case *ast.WhileStatement:
+			err = engine.ResolveWhileStatement(statement)
+		case *ast.IfStatement:
+			value, err := engine.ResolveIfStatement(statement)
+			engine.trace(statement, value, err)
+			if err != nil {
+				return value, err
 			}
 			engine.Callstack = engine.PopCallstack()
-			return value
-		case "block_declaration":
-			result := ast.BlockDeclarationStatement{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			engine.ResolveBlockDeclaration(result)
-		case "namespace_declaration":
-			result := ast.NamespaceDeclarationStatement{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			engine.ResolveNamespaceDeclaration(result)
-		case "namespace_indexer":
-			var result map[string]interface{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			engine.ResolveNamespaceIndexerExpression(result)
-		case "quantity_modifier_statement":
-			result := ast.QuantityModifierStatement{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			engine.ResolveQuantityModifierStatement(result)
-		case "assign_statement":
-			result := ast.AssignStatement{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			engine.ResolveAssignStatement(result)
-		case "block_call":
-			var result map[string]interface{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			value = engine.ResolveBlockCall(result, "")
-		case "scope_mutater_expression":
-			var result map[string]interface{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			engine.ResolveScopeMutaterExpression(result)
-		case "for_statement":
-			result := ast.ForStatement{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			engine.ResolveForStatement(result)
-		case "while_statement":
-			result := ast.WhileStatement{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			engine.ResolveWhileStatement(result)
-		case "if_statement":
-			result := ast.IfStatement{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			value := engine.ResolveIfStatement(result)
-			engine.Callstack = engine.PopCallstack()
-			return value
-		case "switch_statement":
-			result := ast.SwitchStatement{}
-			engine.HandleError(mapstructure.Decode(statement, &result), statement_position)
-			value := engine.ResolveSwitchStatement(result)
+			return value, nil
+		case *ast.SwitchStatement:
+			value, err := engine.ResolveSwitchStatement(statement)
+			engine.trace(statement, value, err)
+			if err != nil {
+				return value, err
+			}
 			engine.Callstack = engine.PopCallstack()
-			return value
+			return value, nil
 		default:
 		}
+
+		engine.trace(statement, value, err)
+		if err != nil {
+			return value, err
+		}
 	}
 
 	engine.Callstack = engine.PopCallstack()
 	if value.Type != "" {
-		return value
+		return value, nil
 	} else {
-		return util.GenerateIntPrimitive(-1)
+		return util.GenerateIntPrimitive(-1), nil
 	}
 }
 
-func (engine *BirEngine) ResolveAssignStatement(statement ast.AssignStatement) {
-	right := engine.ResolveExpression(statement.Right)
-	uptable_report := engine.Scopestack.IsVariableUpdatable(statement.Left.Value)
+// trace reports a statement to the tracer, value is what the statement evaluated to if it is a block
+// call, a return, a throw or a condition and the new value of the variable it declares or modifies
+func (engine *BirEngine) trace(statement ast.Statement, value ast.IntPrimitiveExpression, err error) {
+	if engine.Tracer == nil {
+		return
+	}
+
+	var result *ast.IntPrimitiveExpression
+	if err == nil {
+		switch statement := statement.(type) {
+		case *ast.Comment:
+			return
+		case *ast.BlockCallExpression, *ast.ReturnStatement, *ast.ThrowStatement, *ast.IfStatement, *ast.SwitchStatement:
+			result = &value
+		case *ast.VariableDeclarationStatement:
+			if variable := engine.Scopestack.FindVariable(statement.Left.Value); variable.Value != nil {
+				result = &variable.Value.Value
+			}
+		case *ast.AssignStatement:
+			if variable := engine.Scopestack.VariableAt(statement.Left.Value, statement.Binding); variable.Value != nil {
+				result = &variable.Value.Value
+			}
+		case *ast.QuantityModifierStatement:
+			if reference, ok := statement.Statement.(*ast.ReferenceExpression); ok {
+				if variable := engine.Scopestack.VariableAt(reference.Value, reference.Binding); variable.Value != nil {
+					result = &variable.Value.Value
+				}
+			}
+		}
+	}
+	engine.Tracer.Statement(engine, statement, result, err)
+}
+
+func (engine *BirEngine) branch(statement ast.Statement, arm int) {
+	if engine.Tracer != nil {
+		engine.Tracer.Branch(engine, statement, arm)
+	}
+}
+
+func values(expressions []ast.IntPrimitiveExpression) []int64 {
+	result := []int64{}
+	for _, expression := range expressions {
+		result = append(result, expression.Value)
+	}
+	return result
+}
+
+func frameValues(frame []scope.Value) []int64 {
+	result := []int64{}
+	for _, value := range frame {
+		result = append(result, value.Value.Value)
+	}
+	return result
+}
+
+func (engine *BirEngine) ResolveAssignStatement(statement *ast.AssignStatement) error {
+	right, err := engine.ResolveExpression(statement.Right)
+	if err != nil {
+		return err
+	}
+	uptable_report := engine.Scopestack.IsVariableUpdatable(statement.Left.Value, statement.Binding)
 
 	switch uptable_report {
 	case 0:
-		engine.Scopestack.UpdateVariable(statement.Left.Value, right)
+		engine.Scopestack.UpdateVariable(statement.Left.Value, statement.Binding, right)
 	case 1:
-		engine.Thrower.Throw("Could not assign to a variable that does not exist", statement.Position, engine.Callstack)
+		return engine.Thrower.Throw(thrower.ReferenceError, "Could not assign to a variable that does not exist", statement.Position)
 	case 2:
-		engine.Thrower.Throw("Could not assign to an immutable variable", statement.Position, engine.Callstack)
+		return engine.Thrower.Throw(thrower.RuntimeError, "Could not assign to an immutable variable", statement.Position)
 	case 3:
-		engine.Thrower.Throw("Could not assign to a foreign variable", statement.Position, engine.Callstack)
+		return engine.Thrower.Throw(thrower.RuntimeError, "Could not assign to a foreign variable", statement.Position)
 	}
+	return nil
 }
 
-func (engine *BirEngine) ResolveQuantityModifierStatement(statement ast.QuantityModifierStatement) {
+func (engine *BirEngine) ResolveQuantityModifierStatement(statement *ast.QuantityModifierStatement) error {
 	var new_value int64
-	reference := engine.ResolveExpression(statement.Statement)
+	reference, err := engine.ResolveExpression(statement.Statement)
+	if err != nil {
+		return err
+	}
+
+	var right ast.IntPrimitiveExpression
+	if statement.Right != nil {
+		right, err = engine.ResolveExpression(statement.Right)
+		if err != nil {
+			return err
+		}
+	}
 
 	switch statement.Type {
 	case "increment":
@@ -367,659 +873,629 @@ func (engine *BirEngine) ResolveQuantityModifierStatement(statement ast.Quantity
 	case "decrement":
 		new_value = reference.Value - 1
 	case "add":
-		right := engine.ResolveExpression(statement.Right)
 		new_value = reference.Value + right.Value
 	case "subtract":
-		right := engine.ResolveExpression(statement.Right)
 		new_value = reference.Value - right.Value
 	case "multiply":
-		right := engine.ResolveExpression(statement.Right)
 		new_value = reference.Value * right.Value
 	case "divide":
-		right := engine.ResolveExpression(statement.Right)
+		if right.Value == 0 {
+			return engine.Thrower.Throw(thrower.RuntimeError, "Division by zero", statement.Right.GetPosition())
+		}
 		new_value = reference.Value / right.Value
 	}
 
-	if statement.Statement["operation"] == "reference" {
-		uptable_report := engine.Scopestack.IsVariableUpdatable(statement.Statement["value"].(string))
+	if target, ok := statement.Statement.(*ast.ReferenceExpression); ok {
+		uptable_report := engine.Scopestack.IsVariableUpdatable(target.Value, target.Binding)
 
 		switch uptable_report {
 		case 0:
-			engine.Scopestack.UpdateVariable(statement.Statement["value"].(string), util.GenerateIntPrimitive(new_value))
+			engine.Scopestack.UpdateVariable(target.Value, target.Binding, util.GenerateIntPrimitive(new_value))
 		case 1:
-			engine.Thrower.Throw("Could not modify a variable that does not exist", statement.Position, engine.Callstack)
+			return engine.Thrower.Throw(thrower.ReferenceError, "Could not modify a variable that does not exist", statement.Position)
 		case 2:
-			engine.Thrower.Throw("Could not modify an immutable variable", statement.Position, engine.Callstack)
+			return engine.Thrower.Throw(thrower.RuntimeError, "Could not modify an immutable variable", statement.Position)
 		case 3:
-			engine.Thrower.Throw("Could not modify a foreign variable", statement.Position, engine.Callstack)
+			return engine.Thrower.Throw(thrower.RuntimeError, "Could not modify a foreign variable", statement.Position)
 		}
 	}
+	return nil
 }
 
-func (engine *BirEngine) ResolveWhileStatement(statement ast.WhileStatement) {
-	condition := engine.ResolveExpression(statement.Statement)
+func (engine *BirEngine) ResolveWhileStatement(statement *ast.WhileStatement) error {
+	condition, err := engine.ResolveExpression(statement.Statement)
+	if err != nil {
+		return err
+	}
 
 	for condition.Value == 1 {
+		if err := engine.Step(statement.Position); err != nil {
+			return err
+		}
 		engine.Callstack = engine.PushCallstack(Callstack{
 			Label:      "while-block " + engine.GetAnonymousIndex(statement.Position),
 			Identifier: "while-block",
 			Stack:      statement.Body,
 		})
 
-		engine.Scopestack.PushScope(scope.Scope{})
-		engine.ResolveCallstack(engine.GetCurrentCallStack())
+		engine.Scopestack.PushScope(&scope.Scope{})
+		if _, err := engine.ResolveCallstack(engine.GetCurrentCallStack()); err != nil {
+			return err
+		}
 		engine.Scopestack.PopScope()
-		condition = engine.ResolveExpression(statement.Statement)
+		condition, err = engine.ResolveExpression(statement.Statement)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (engine *BirEngine) ResolveForStatement(statement ast.ForStatement) {
-	iterator := engine.ResolveExpression(statement.Statement)
+func (engine *BirEngine) ResolveForStatement(statement *ast.ForStatement) error {
+	iterator, err := engine.ResolveExpression(statement.Statement)
+	if err != nil {
+		return err
+	}
 
 	for i := 0; i < int(iterator.Value); i++ {
-		_scope := scope.Scope{}
-		engine.Scopestack.PushScope(_scope)
+		if err := engine.Step(statement.Position); err != nil {
+			return err
+		}
+		engine.Scopestack.PushScope(&scope.Scope{})
 		engine.Scopestack.AddVariable(scope.Value{Key: util.GenerateIdentifier(statement.Placeholder), Value: util.GenerateIntPrimitive(int64(i)), Kind: "const"})
 		engine.Callstack = engine.PushCallstack(Callstack{
 			Label:      "for-block " + engine.GetAnonymousIndex(statement.Position),
 			Identifier: "for-block",
 			Stack:      statement.Body,
 		})
-		engine.ResolveCallstack(engine.GetCurrentCallStack())
+		if _, err := engine.ResolveCallstack(engine.GetCurrentCallStack()); err != nil {
+			return err
+		}
 		engine.Scopestack.PopScope()
 	}
+	return nil
 }
 
-func (engine *BirEngine) ResolveIfStatement(statement ast.IfStatement) ast.IntPrimitiveExpression {
-	condition := engine.ResolveExpression(statement.Condition)
+func (engine *BirEngine) ResolveIfStatement(statement *ast.IfStatement) (ast.IntPrimitiveExpression, error) {
+	condition, err := engine.ResolveExpression(statement.Condition)
+	if err != nil {
+		return condition, err
+	}
 
-	runBlock := func(name string, block []interface{}) ast.IntPrimitiveExpression {
+	runBlock := func(name string, block []ast.Statement) (ast.IntPrimitiveExpression, error) {
+		engine.Scopestack.PushScope(&scope.Scope{})
 		engine.Callstack = engine.PushCallstack(Callstack{
 			Label:      name + "-block " + engine.GetAnonymousIndex(statement.Position),
 			Identifier: name + "-block",
 			Stack:      block,
 		})
 
-		result := engine.ResolveCallstack(engine.GetCurrentCallStack())
+		result, err := engine.ResolveCallstack(engine.GetCurrentCallStack())
+		if err != nil {
+			return result, err
+		}
 		engine.Scopestack.PopScope()
-		return result
+		return result, nil
 	}
 
-	engine.Scopestack.PushScope(scope.Scope{})
 	if condition.Value == 1 {
+		engine.branch(statement, 0)
 		return runBlock("if", statement.Body)
-	} else {
-		if statement.Elifs != nil {
-			var selectedElif ast.Elif
-
-			for _, elif := range statement.Elifs {
-				elifCondition := engine.ResolveExpression(elif.Condition)
-				if elifCondition.Value == 1 {
-					selectedElif = elif
-				}
+	} else if statement.Elifs != nil {
+		var selectedElif ast.Elif
+		selected := 0
+
+		for i, elif := range statement.Elifs {
+			elifCondition, err := engine.ResolveExpression(elif.Condition)
+			if err != nil {
+				return elifCondition, err
 			}
-
-			if selectedElif.Body != nil {
-				return runBlock("elif", selectedElif.Body)
-			} else {
-				if statement.Else != nil {
-					return runBlock("else", statement.Else)
-				}
-				result := util.GenerateIntPrimitive(-1)
-				engine.Scopestack.PopScope()
-				return result
-
+			if elifCondition.Value == 1 {
+				selectedElif = elif
+				selected = i
 			}
 		}
-		result := util.GenerateIntPrimitive(-1)
-		engine.Scopestack.PopScope()
-		return result
+
+		if selectedElif.Body != nil {
+			engine.branch(statement, selected+1)
+			return runBlock("elif", selectedElif.Body)
+		} else if statement.Else != nil {
+			engine.branch(statement, len(statement.Elifs)+1)
+			return runBlock("else", statement.Else)
+		}
 	}
+	engine.branch(statement, len(statement.Elifs)+1)
+	return util.GenerateIntPrimitive(-1), nil
 }
 
-func (engine *BirEngine) ResolveSwitchStatement(statement ast.SwitchStatement) ast.IntPrimitiveExpression {
-	condition := engine.ResolveExpression(statement.Condition)
-	var body []interface{}
+func (engine *BirEngine) ResolveSwitchStatement(statement *ast.SwitchStatement) (ast.IntPrimitiveExpression, error) {
+	condition, err := engine.ResolveExpression(statement.Condition)
+	if err != nil {
+		return condition, err
+	}
+	var body []ast.Statement
+	selected := len(statement.Cases)
 
-	for _, _c := range statement.Cases {
-		_case := engine.ResolveExpression(_c.Case)
+	for i, _c := range statement.Cases {
+		_case, err := engine.ResolveExpression(_c.Case)
+		if err != nil {
+			return _case, err
+		}
 
 		if _case.Value == condition.Value {
 			body = _c.Body
+			selected = i
 		}
 	}
+	engine.branch(statement, selected)
 
-	if body != nil {
+	runBlock := func(name string, block []ast.Statement) (ast.IntPrimitiveExpression, error) {
 		engine.Callstack = engine.PushCallstack(Callstack{
-			Label:      "switch-case-block " + engine.GetAnonymousIndex(statement.Position),
-			Identifier: "switch-case-block",
-			Stack:      body,
+			Label:      name + "-block " + engine.GetAnonymousIndex(statement.Position),
+			Identifier: name + "-block",
+			Stack:      block,
 		})
 
-		engine.Scopestack.PushScope(scope.Scope{})
-		result := engine.ResolveCallstack(engine.GetCurrentCallStack())
+		engine.Scopestack.PushScope(&scope.Scope{})
+		result, err := engine.ResolveCallstack(engine.GetCurrentCallStack())
+		if err != nil {
+			return result, err
+		}
 		engine.Scopestack.PopScope()
-		return result
-	} else {
-		if statement.Default.Body != nil {
-			engine.Callstack = engine.PushCallstack(Callstack{
-				Label:      "switch-default-block " + engine.GetAnonymousIndex(statement.Position),
-				Identifier: "switch-default-block",
-				Stack:      statement.Default.Body,
-			})
+		return result, nil
+	}
 
-			engine.Scopestack.PushScope(scope.Scope{})
-			result := engine.ResolveCallstack(engine.GetCurrentCallStack())
-			engine.Scopestack.PopScope()
-			return result
-		} else {
-			return util.GenerateIntPrimitive(-1)
-		}
+	if body != nil {
+		return runBlock("switch-case", body)
+	} else if statement.Default.Body != nil {
+		return runBlock("switch-default", statement.Default.Body)
 	}
+	return util.GenerateIntPrimitive(-1), nil
 }
 
-func (engine *BirEngine) ResolveBlockDeclaration(statement ast.BlockDeclarationStatement) {
+func (engine *BirEngine) ResolveBlockDeclaration(statement ast.BlockDeclarationStatement) error {
 	statement.Owner = engine.ID
 
 	if engine.Scopestack.BlockExists(statement.Name.Value) {
-		engine.Thrower.Throw("Could not redeclare an existing block", statement.Position, engine.Callstack)
-	} else {
-		if statement.Implementing {
-			if engine.Scopestack.BlockExists(statement.Implements.Value) {
-				implemented := engine.Scopestack.FindBlock(statement.Implements.Value)
-				statement.Instance = implemented.Block.Instance
-
-				calculate_index_buffer := func(j int) int {
-					buffer := 0
-
-					if j > 0 {
-						previous_type := statement.Populate[j-1].Value.(map[string]interface{})["type"]
-						switch previous_type {
-						case "string":
-							var previous_populate ast.StringPrimitiveExpression
-							engine.HandleAnonymousError(mapstructure.Decode(statement.Populate[j-1].Value, &previous_populate))
-							buffer = len(previous_populate.Value)
-						case "array":
-							var previous_populate ast.ArrayPrimitiveExpression
-							engine.HandleAnonymousError(mapstructure.Decode(statement.Populate[j-1].Value, &previous_populate))
-							buffer = len(previous_populate.Values)
-						}
-					}
+		return engine.Thrower.Throw(thrower.ReferenceError, "Could not redeclare an existing block", statement.Position)
+	}
+
+	if statement.Implementing {
+		implemented := engine.Scopestack.FindBlock(statement.Implements.Value)
+
+		if implemented.Block == nil {
+			return engine.Thrower.Throw(thrower.ReferenceError, "Could not implement '"+statement.Implements.Value+"', block is non-existant", statement.Implements.Position)
+		}
+
+		if implemented.Block.Native {
+			return engine.Thrower.Throw(thrower.ReferenceError, "Could not implement '"+statement.Implements.Value+"', native blocks could not be implemented", statement.Implements.Position)
+		}
+
+		statement.Implemented = implemented.Block
+		instance := implemented.Block.Instance.(*scope.Scope).Copy()
+
+		calculate_index_buffer := func(j int) int {
+			buffer := 0
+
+			if j > 0 {
+				switch previous_populate := statement.Populate[j-1].Value.(type) {
+				case *ast.StringPrimitiveExpression:
+					buffer = len(previous_populate.Value)
+				case *ast.ArrayPrimitiveExpression:
+					buffer = len(previous_populate.Values)
+				}
+			}
+
+			return buffer
+		}
+
+		label_population := func(population ast.Population, length int) error {
+			index := instance.IndexOfVariable(population.Key)
+
+			if index >= 0 && instance.Frame[index].Kind == "local" {
+				instance.Frame[index].Value = util.GenerateIntPrimitive(int64(length))
+				return nil
+			}
+			return engine.Thrower.Throw(thrower.ReferenceError, "Could not find a local variable '"+population.Key+"' from population label. Labelled populations must have a local variable counterpart.", population.Position)
+		}
 
-					return buffer
+		for j, population := range statement.Populate {
+			buffer := calculate_index_buffer(j)
+
+			switch populate := population.Value.(type) {
+			case *ast.StringPrimitiveExpression:
+				for i, value := range populate.Value {
+					instance.WriteCell(int64(i+buffer), util.GenerateIntPrimitive(int64(value)))
 				}
 
-				throw_population_label_error := func(population ast.Population) {
-					engine.Thrower.Throw("Could not find a local variable '"+population.Key+"' from population label. Labelled populations must have a local variable counterpart.", population.Position, engine.Callstack)
+				if population.Key != "" {
+					if err := label_population(population, len(populate.Value)); err != nil {
+						return err
+					}
+				}
+			case *ast.ArrayPrimitiveExpression:
+				for i, value := range populate.Values {
+					cell, err := engine.ResolveExpression(value)
+					if err != nil {
+						return err
+					}
+					instance.WriteCell(int64(i+buffer), cell)
 				}
 
-				engine.Scopestack.PushScope(*statement.Instance.(*scope.Scope))
-				for j, population := range statement.Populate {
-					_type := population.Value.(map[string]interface{})["type"]
-
-					switch _type {
-					case "string":
-						var populate ast.StringPrimitiveExpression
-						engine.HandleAnonymousError(mapstructure.Decode(population.Value, &populate))
-
-						buffer := calculate_index_buffer(j)
-
-						for i, value := range populate.Value {
-							engine.Scopestack.AddVariable(scope.Value{
-								Key:   util.GenerateIdentifier("value_" + strconv.Itoa(i+buffer)),
-								Value: util.GenerateIntPrimitive(int64(value)),
-								Kind:  "const",
-							})
-						}
-
-						if population.Key != "" {
-							if engine.Scopestack.VariableExists(population.Key) {
-								local_variable := engine.Scopestack.FindVariable(population.Key)
-
-								if !local_variable.OuterScope && !local_variable.Immutable && local_variable.Value.Kind == "local" {
-									engine.Scopestack.UpdateVariable(population.Key, util.GenerateIntPrimitive(int64(len(populate.Value))))
-								} else {
-									throw_population_label_error(population)
-								}
-							} else {
-								throw_population_label_error(population)
-							}
-						}
-					case "array":
-						var populate ast.ArrayPrimitiveExpression
-						engine.HandleAnonymousError(mapstructure.Decode(population.Value, &populate))
-
-						buffer := calculate_index_buffer(j)
-
-						for i, value := range populate.Values {
-							v := engine.ResolveExpression(value)
-							engine.Scopestack.AddVariable(scope.Value{
-								Key:   util.GenerateIdentifier("value_" + strconv.Itoa(i+buffer)),
-								Value: v,
-								Kind:  "const",
-							})
-						}
-
-						if population.Key != "" {
-							if engine.Scopestack.VariableExists(population.Key) {
-								local_variable := engine.Scopestack.FindVariable(population.Key)
-
-								if !local_variable.OuterScope && !local_variable.Immutable && local_variable.Value.Kind == "local" {
-									engine.Scopestack.UpdateVariable(population.Key, util.GenerateIntPrimitive(int64(len(populate.Values))))
-								} else {
-									throw_population_label_error(population)
-								}
-							} else {
-								throw_population_label_error(population)
-							}
-						}
+				if population.Key != "" {
+					if err := label_population(population, len(populate.Values)); err != nil {
+						return err
 					}
 				}
-				statement.Instance = engine.Scopestack.PopScope()
-			} else {
-				engine.Thrower.Throw("Could not implement '"+statement.Implements.Value+"', block is non-existant", statement.Implements.Position, engine.Callstack)
 			}
-		} else {
-			var body ast.BlockBody
-			engine.HandleAnonymousError(mapstructure.Decode(statement.Body, &body))
-			if body.Init != nil {
-				engine.Scopestack.PushScope(scope.Scope{})
-				engine.Callstack = engine.PushCallstack(Callstack{
-					Identifier: "$" + statement.Name.Value,
-					Label:      statement.Name.Value + ":init",
-					Stack:      body.Init,
-				})
-				engine.ResolveCallstack(engine.GetCurrentCallStack())
-				statement.Instance = engine.Scopestack.PopScope()
-			} else {
-				statement.Instance = &scope.Scope{}
+		}
+		statement.Instance = instance
+	} else {
+		instance := &scope.Scope{}
+
+		if statement.Body.Init != nil {
+			outer := engine.Scopestack.Scopes
+			engine.Scopestack.PushScope(instance)
+			engine.Callstack = engine.PushCallstack(Callstack{
+				Identifier: "$" + statement.Name.Value,
+				Label:      statement.Name.Value + ":init",
+				Stack:      statement.Body.Init,
+				Instance:   instance,
+			})
+			_, err := engine.ResolveCallstack(engine.GetCurrentCallStack())
+			engine.Scopestack.Scopes = outer
+			if err != nil {
+				return err
 			}
 		}
-		engine.Scopestack.AddBlock(statement)
+		statement.Namespaces = append([]*scope.Scope{}, engine.namespaces...)
+		statement.Instance = instance
 	}
+	engine.Scopestack.AddBlock(statement)
+	return nil
 }
 
-func (engine *BirEngine) ResolveVariableDeclaration(statement ast.VariableDeclarationStatement) {
+func (engine *BirEngine) ResolveVariableDeclaration(statement *ast.VariableDeclarationStatement) error {
 	key := statement.Left
-	value := engine.ResolveExpression(statement.Right)
+	value, err := engine.ResolveExpression(statement.Right)
+	if err != nil {
+		return err
+	}
 
-	variable := engine.Scopestack.FindVariable(key.Value)
-	if engine.Scopestack.VariableExists(key.Value) && !variable.OuterScope {
-		engine.Thrower.Throw("Could not redeclare an existing variable", statement.Position, engine.Callstack)
-	} else {
-		engine.Scopestack.AddVariable(scope.Value{Key: key, Value: value, Kind: statement.Kind})
-	}
-}
-
-func (engine *BirEngine) ResolveExpression(raw map[string]interface{}) ast.IntPrimitiveExpression {
-	var position ast.Position
-	engine.HandleAnonymousError(mapstructure.Decode(raw["position"], &position))
-	switch raw["operation"] {
-	case "primitive":
-		expression := ast.IntPrimitiveExpression{}
-		engine.HandleError(mapstructure.Decode(raw, &expression), position)
-		result := ast.IntPrimitiveExpression{}
-		engine.HandleError(mapstructure.Decode(expression, &result), position)
-		return result
-	case "block_call":
-		var result map[string]interface{}
-		engine.HandleError(mapstructure.Decode(raw, &result), position)
-		return engine.ResolveBlockCall(result, "")
-	case "namespace_indexer":
-		var result map[string]interface{}
-		engine.HandleError(mapstructure.Decode(raw, &result), position)
-		return engine.ResolveNamespaceIndexerExpression(result)
-	case "scope_mutater_expression":
-		var result map[string]interface{}
-		engine.HandleError(mapstructure.Decode(raw, &result), position)
-		return engine.ResolveScopeMutaterExpression(result)
-	case "arithmetic":
-		return engine.ResolveArithmeticExpression(raw)
-	case "condition":
-		return engine.ResolveConditionExpression(raw)
-	case "reference":
-		return engine.ResolveReferenceExpression(raw)
+	if engine.Scopestack.GetCurrentScope().IndexOfVariable(key.Value) >= 0 {
+		return engine.Thrower.Throw(thrower.ReferenceError, "Could not redeclare an existing variable", statement.Position)
+	}
+	engine.Scopestack.AddVariable(scope.Value{Key: key, Value: value, Kind: statement.Kind})
+	return nil
+}
+
+func (engine *BirEngine) ResolveExpression(expression ast.Expression) (ast.IntPrimitiveExpression, error) {
+	switch expression := expression.(type) {
+	case *ast.IntPrimitiveExpression:
+		return *expression, nil
+	case *ast.BlockCallExpression:
+		return engine.ResolveBlockCall(expression)
+	case *ast.NamespaceIndexerExpression:
+		return engine.ResolveNamespaceIndexerExpression(expression)
+	case *ast.ScopeMutaterExpression:
+		return engine.ResolveScopeMutaterExpression(expression)
+	case *ast.ArithmeticExpression:
+		return engine.ResolveArithmeticExpression(expression)
+	case *ast.ConditionExpression:
+		return engine.ResolveConditionExpression(expression)
+	case *ast.ReferenceExpression:
+		return engine.ResolveReferenceExpression(expression)
+	case *ast.StringPrimitiveExpression, *ast.ArrayPrimitiveExpression:
+		return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.RuntimeError, "Strings and arrays could only be used in populations", expression.GetPosition())
 	default:
-		return util.GenerateIntPrimitive(-1)
+		return util.GenerateIntPrimitive(-1), nil
 	}
 }
 
-func (engine BirEngine) PushArguments(expression ast.BlockCallExpression, block ast.BlockDeclarationStatement, incoming string) []scope.Value {
+func (engine BirEngine) PushArguments(expression *ast.BlockCallExpression, block ast.BlockDeclarationStatement) ([]scope.Value, error) {
 	result := []scope.Value{}
 
 	if len(expression.Arguments) == len(block.Arguments) {
 		for i, argument := range block.Arguments {
-			value := engine.ResolveExpression(expression.Arguments[i])
+			value, err := engine.ResolveExpression(expression.Arguments[i])
+			if err != nil {
+				return result, err
+			}
 			result = append(result, scope.Value{Key: argument, Value: value, Kind: "const"})
 		}
 	} else {
-		engine.Thrower.Warn("Expected "+strconv.Itoa(len(block.Arguments))+" argument(s), found "+strconv.Itoa(len(expression.Arguments))+" while calling '"+expression.Name.Value+"'", expression.Position, engine.Callstack)
+		if err := engine.warn("Expected "+strconv.Itoa(len(block.Arguments))+" argument(s), found "+strconv.Itoa(len(expression.Arguments))+" while calling '"+expression.Name.Value+"'", expression.Position); err != nil {
+			return result, err
+		}
 		for _, argument := range block.Arguments {
 			result = append(result, scope.Value{Key: argument, Value: util.GenerateIntPrimitive(-1), Kind: "const"})
 		}
 	}
 
-	return result
+	return result, nil
 }
 
-func (engine BirEngine) PushVerbs(expression ast.BlockCallExpression, block ast.BlockDeclarationStatement, incoming string) []scope.Value {
+func (engine BirEngine) PushVerbs(expression *ast.BlockCallExpression, block ast.BlockDeclarationStatement) ([]scope.Value, error) {
 	result := []scope.Value{}
 
 	if len(expression.Verbs) == len(block.Verbs) {
 		for i, verb := range block.Verbs {
-			value := engine.ResolveExpression(expression.Verbs[i])
+			value, err := engine.ResolveExpression(expression.Verbs[i])
+			if err != nil {
+				return result, err
+			}
 			result = append(result, scope.Value{Key: verb, Value: value, Kind: "const"})
 		}
 	} else {
-		engine.Thrower.Warn("Expected "+strconv.Itoa(len(block.Verbs))+" verb(s), found "+strconv.Itoa(len(expression.Verbs))+" while calling '"+expression.Name.Value+"'", expression.Position, engine.Callstack)
+		if err := engine.warn("Expected "+strconv.Itoa(len(block.Verbs))+" verb(s), found "+strconv.Itoa(len(expression.Verbs))+" while calling '"+expression.Name.Value+"'", expression.Position); err != nil {
+			return result, err
+		}
 		for _, verb := range block.Verbs {
 			result = append(result, scope.Value{Key: verb, Value: util.GenerateIntPrimitive(-1), Kind: "const"})
 		}
 	}
 
-	return result
+	return result, nil
 }
 
-func (engine *BirEngine) ResolveBlockCall(raw map[string]interface{}, incoming string) ast.IntPrimitiveExpression {
-	expression := ast.BlockCallExpression{}
-	engine.HandleError(mapstructure.Decode(raw, &expression), expression.Position)
-
-	if engine.Scopestack.BlockExists(expression.Name.Value) {
-		if len(engine.Callstack) <= engine.MaximumCallstackSize {
-			result := engine.Scopestack.FindBlock(expression.Name.Value)
-
-			if result.Foreign {
-				owner := engine.FindOwner(result.Block.Owner, expression)
-				instance := result.Block.Instance.(*scope.Scope)
-				owner.Scopestack.PushScope(engine.GetCurrentScope())
-				owner.Scopestack.PushScope(*instance)
-				old_stack := owner.Callstack
-				owner.Callstack = append(owner.Callstack, engine.Callstack...)
-
-				local_scope := []scope.Value{}
-
-				local_scope = append(local_scope, engine.PushArguments(expression, *result.Block, incoming)...)
-				local_scope = append(local_scope, engine.PushVerbs(expression, *result.Block, incoming)...)
-
-				for _, value := range local_scope {
-					owner.Scopestack.AddVariable(value)
-				}
-
-				value := owner.ResolveBlockCall(raw, owner.ID)
-				owner.Scopestack.PopScope()
-				owner.Scopestack.PopScope()
-				owner.Callstack = old_stack
-				return value
-			} else {
-				if result.Block.Native {
-					var body ast.NativeFunction
-					engine.HandleAnonymousError(mapstructure.Decode(result.Block.Body, &body))
-
-					arguments := []ast.IntPrimitiveExpression{}
-					verbs := []ast.IntPrimitiveExpression{}
-
-					for _, argument := range expression.Arguments {
-						arguments = append(arguments, engine.ResolveExpression(argument))
-					}
-					for _, verb := range expression.Verbs {
-						verbs = append(verbs, engine.ResolveExpression(verb))
-					}
-
-					engine.Callstack = engine.PushCallstack(Callstack{
-						Label:      expression.Name.Value,
-						Identifier: "$" + expression.Name.Value,
-						Stack:      []interface{}{},
-					})
-
-					native_function_return := body(verbs, arguments)
-					if native_function_return.Error {
-						engine.Thrower.Throw(native_function_return.Message, expression.Position, engine.Callstack)
-						engine.Callstack = engine.PopCallstack()
-						return native_function_return.Value
-					} else if native_function_return.Warn {
-						engine.Thrower.Warn(native_function_return.Message, expression.Position, engine.Callstack)
-						engine.Callstack = engine.PopCallstack()
-						return native_function_return.Value
-					} else {
-						engine.Callstack = engine.PopCallstack()
-						return native_function_return.Value
-					}
+func (engine *BirEngine) ResolveBlockCall(expression *ast.BlockCallExpression) (ast.IntPrimitiveExpression, error) {
+	result := engine.Scopestack.BlockAt(expression.Name.Value, expression.Binding)
+	// Blocks of namespaces live outside the scopestack, they are found by their names
+	if expression.Namespace.Value != "" && engine.Scopestack.NamespaceExists(expression.Namespace.Value) {
+		result = engine.Scopestack.FindInNamespaceBlock(expression.Namespace.Value, expression.Name.Value)
+	} else if expression.Namespace.Value != "" && expression.Binding.Dynamic {
+		result = scope.ScopeBlock{}
+		if module := engine.Scopestack.FindModule(expression.Namespace.Value); module != nil && module.Visible(expression.Name.Value) {
+			for i := range module.Blocks {
+				if module.Blocks[i].Name.Value == expression.Name.Value {
+					result = scope.ScopeBlock{Block: &module.Blocks[i], Foreign: true, Immutable: true, OuterScope: true}
 				}
-				if result.Block.Implementing {
-					implemented := engine.Scopestack.FindBlock(result.Block.Implements.Value)
-					instance := result.Block.Instance.(*scope.Scope)
+			}
+		}
+	}
 
-					if implemented.Foreign {
-						owner := engine.FindOwner(implemented.Block.Owner, expression)
-						owner.Scopestack.PushScope(engine.GetCurrentScope())
-						owner.Scopestack.PushScope(*instance)
-						old_stack := owner.Callstack
-						owner.Callstack = append(owner.Callstack, engine.Callstack...)
+	if result.Block == nil || (result.Block.Implementing && result.Block.Implemented == nil) {
+		return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.ReferenceError, "Could not find block '"+expression.Name.Value+"'", expression.Position)
+	}
 
-						raw["name"].(map[string]interface{})["value"] = implemented.Block.Name.Value
+	if len(engine.Callstack) > engine.MaximumCallstackSize {
+		err := engine.Thrower.Throw(thrower.OverflowError, "Bir process has overflown the maximum callstack size", expression.Position)
+		if len(err.Callstack) > 10 {
+			err.Callstack = err.Callstack[:10]
+		}
+		return util.GenerateIntPrimitive(-1), err
+	}
 
-						local_scope := []scope.Value{}
+	if err := engine.Step(expression.Position); err != nil {
+		return util.GenerateIntPrimitive(-1), err
+	}
 
-						local_scope = append(local_scope, engine.PushArguments(expression, *implemented.Block, incoming)...)
-						local_scope = append(local_scope, engine.PushVerbs(expression, *implemented.Block, incoming)...)
+	block := result.Block
 
-						for _, value := range local_scope {
-							owner.Scopestack.AddVariable(value)
-						}
+	if block.Native {
+		arguments := []ast.IntPrimitiveExpression{}
+		verbs := []ast.IntPrimitiveExpression{}
 
-						value := owner.ResolveBlockCall(raw, owner.ID)
-						owner.Scopestack.PopScope()
-						owner.Scopestack.PopScope()
-						owner.Callstack = old_stack
-						return value
-					}
+		for _, argument := range expression.Arguments {
+			value, err := engine.ResolveExpression(argument)
+			if err != nil {
+				return value, err
+			}
+			arguments = append(arguments, value)
+		}
+		for _, verb := range expression.Verbs {
+			value, err := engine.ResolveExpression(verb)
+			if err != nil {
+				return value, err
+			}
+			verbs = append(verbs, value)
+		}
 
-					engine.Scopestack.PushScope(*instance)
-					local_scope := []scope.Value{}
+		engine.Callstack = engine.PushCallstack(Callstack{
+			Label:      expression.Name.Value,
+			Identifier: "$" + expression.Name.Value,
+			Stack:      []ast.Statement{},
+		})
 
-					local_scope = append(local_scope, engine.PushArguments(expression, *implemented.Block, incoming)...)
-					local_scope = append(local_scope, engine.PushVerbs(expression, *implemented.Block, incoming)...)
+		if engine.Tracer != nil {
+			engine.Tracer.Enter(engine, expression, expression.Name.Value, values(verbs), values(arguments))
+		}
+		native_function_return := block.Function(verbs, arguments)
+		var err error
+		if native_function_return.Error {
+			err = engine.Thrower.Throw(thrower.NativeError, native_function_return.Message, expression.Position)
+		} else if native_function_return.Warn {
+			err = engine.warn(native_function_return.Message, expression.Position)
+		}
+		if err != nil {
+			if engine.Tracer != nil {
+				engine.Tracer.Exit(engine, expression, expression.Name.Value, native_function_return.Value, err)
+			}
+			return native_function_return.Value, err
+		}
+		engine.Callstack = engine.PopCallstack()
+		if engine.Tracer != nil {
+			engine.Tracer.Exit(engine, expression, expression.Name.Value, native_function_return.Value, nil)
+		}
+		return native_function_return.Value, nil
+	}
 
-					for _, value := range local_scope {
-						engine.Scopestack.AddVariable(value)
-					}
+	label := expression.Name.Value
+	target := block
+	if block.Implementing {
+		label = block.Name.Value + "->" + block.Implemented.Name.Value
+		for target.Implementing {
+			target = target.Implemented
+		}
+	}
 
-					var body map[string][]interface{}
-					engine.HandleError(mapstructure.Decode(implemented.Block.Body, &body), expression.Position)
-					engine.Callstack = engine.PushCallstack(Callstack{
-						Label:      result.Block.Name.Value + "->" + implemented.Block.Name.Value,
-						Identifier: "$" + result.Block.Name.Value,
-						Stack:      body["program"],
-					})
-
-					value := engine.ResolveCallstack(engine.GetCurrentCallStack())
-					engine.Scopestack.PopScope()
-					return value
-				} else {
-					var body ast.BlockBody
-					engine.HandleAnonymousError(mapstructure.Decode(result.Block.Body, &body))
-					instance := result.Block.Instance.(*scope.Scope)
-
-					if incoming == "" {
-						engine.Scopestack.PushScope(*instance)
-						local_scope := []scope.Value{}
-
-						local_scope = append(local_scope, engine.PushArguments(expression, *result.Block, incoming)...)
-						local_scope = append(local_scope, engine.PushVerbs(expression, *result.Block, incoming)...)
-
-						for _, value := range local_scope {
-							engine.Scopestack.AddVariable(value)
-						}
-					}
+	arguments, err := engine.PushArguments(expression, *target)
+	if err != nil {
+		return util.GenerateIntPrimitive(-1), err
+	}
+	verbs, err := engine.PushVerbs(expression, *target)
+	if err != nil {
+		return util.GenerateIntPrimitive(-1), err
+	}
 
-					engine.Callstack = engine.PushCallstack(Callstack{
-						Label:      expression.Name.Value,
-						Identifier: "$" + expression.Name.Value,
-						Stack:      body.Program,
-					})
-					value := engine.ResolveCallstack(engine.GetCurrentCallStack())
+	local_scope := &scope.Scope{}
+	local_scope.Frame = append(local_scope.Frame, arguments...)
+	local_scope.Frame = append(local_scope.Frame, verbs...)
 
-					if incoming == "" {
-						engine.Scopestack.PopScope()
-					}
-					return value
-				}
-			}
-		} else {
-			var callstack []Callstack
+	callstack := Callstack{
+		Label:      label,
+		Identifier: "$" + block.Name.Value,
+		Stack:      target.Body.Program,
+		Instance:   block.Instance.(*scope.Scope),
+	}
 
-			if len(engine.Callstack) >= 10 {
-				callstack = engine.Callstack[:10]
-			} else {
-				callstack = engine.Callstack
-			}
+	if engine.Tracer != nil {
+		engine.Tracer.Enter(engine, expression, label, frameValues(verbs), frameValues(arguments))
+	}
 
-			engine.Thrower.Throw("Bir process has overflown the maximum callstack size", expression.Position, callstack)
-			return util.GenerateIntPrimitive(-1)
+	var value ast.IntPrimitiveExpression
+	if target.Owner != engine.ID {
+		owner, owner_err := engine.FindOwner(target.Owner, expression)
+		if owner_err != nil {
+			return util.GenerateIntPrimitive(-1), owner_err
 		}
+
+		old_stack := owner.Callstack
+		owner.Callstack = append(owner.Callstack, engine.Callstack...)
+		owner.Context = engine.Context
+		owner.StepBudget = engine.StepBudget
+		value, err = owner.RunBlock(target, local_scope, callstack)
+		owner.Callstack = old_stack
 	} else {
-		engine.Thrower.Throw("Could not find block '"+expression.Name.Value+"'", expression.Position, engine.Callstack)
-		return util.GenerateIntPrimitive(-1)
+		value, err = engine.RunBlock(target, local_scope, callstack)
 	}
-}
 
-func (engine *BirEngine) ResolveReferenceExpression(raw map[string]interface{}) ast.IntPrimitiveExpression {
-	result := engine.Scopestack.FindVariable(raw["value"].(string))
-	expression := ast.ReferenceExpression{}
-	engine.HandleError(mapstructure.Decode(raw, &expression), expression.Position)
-
-	if result.Value != nil {
-		if raw["negative"].(bool) {
-			return util.GenerateIntPrimitive(-result.Value.Value.Value)
-		}
-		return result.Value.Value
-	} else {
-		engine.Thrower.Throw("Could not find variable '"+expression.Value+"' in the frame", expression.Position, engine.Callstack)
-		return util.GenerateIntPrimitive(-1)
+	if engine.Tracer != nil {
+		engine.Tracer.Exit(engine, expression, label, value, err)
 	}
+	return value, err
 }
 
-func (engine BirEngine) FindUpperBlockScope() (*scope.Scope, int, *ast.BlockDeclarationStatement) {
-	selected_stack_index := -1
+// RunBlock runs the body of a block on top of the scopestack of the engine, the scopes of the namespaces
+// the block is declared in, the instance of the called block and the scope that holds the arguments and
+// the verbs of the call
+func (engine *BirEngine) RunBlock(block *ast.BlockDeclarationStatement, local_scope *scope.Scope, callstack Callstack) (ast.IntPrimitiveExpression, error) {
+	outer := engine.Scopestack.Scopes
+
+	namespaces, _ := block.Namespaces.([]*scope.Scope)
+	engine.Scopestack.Scopes = append(outer[:len(outer):len(outer)], namespaces...)
+	engine.Scopestack.PushScope(callstack.Instance)
+	engine.Scopestack.PushScope(local_scope)
+	engine.Callstack = engine.PushCallstack(callstack)
+	value, err := engine.ResolveCallstack(engine.GetCurrentCallStack())
+	engine.Scopestack.Scopes = outer
+
+	return value, err
+}
 
-	for i, cs := range engine.ReverseCallstack() {
-		if strings.HasPrefix(cs.Identifier, "$") {
-			selected_stack_index = i
-			break
-		}
-	}
+func (engine *BirEngine) ResolveReferenceExpression(expression *ast.ReferenceExpression) (ast.IntPrimitiveExpression, error) {
+	result := engine.Scopestack.VariableAt(expression.Value, expression.Binding)
 
-	block := engine.Scopestack.FindBlock(engine.ReverseCallstack()[selected_stack_index].Identifier[1:]).Block
+	if result.Value == nil {
+		return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.ReferenceError, "Could not find variable '"+expression.Value+"' in the frame", expression.Position)
+	}
 
-	if selected_stack_index < 0 {
-		return &scope.Scope{}, -1, block
-	} else {
-		selected_scope := (engine.Scopestack.Reverse())[selected_stack_index]
-		return &selected_scope, selected_stack_index, block
+	if expression.Negative {
+		return util.GenerateIntPrimitive(-result.Value.Value.Value), nil
 	}
+	return result.Value.Value, nil
 }
 
-func (engine *BirEngine) ResolveScopeMutaterExpression(raw map[string]interface{}) ast.IntPrimitiveExpression {
-	expression := ast.ScopeMutaterExpression{}
-	engine.HandleAnonymousError(mapstructure.Decode(raw, &expression))
+// FindUpperBlockScope returns the instance of the closest block call on the callstack
+func (engine BirEngine) FindUpperBlockScope() *scope.Scope {
+	for i := len(engine.Callstack) - 1; i >= 0; i-- {
+		if engine.Callstack[i].Instance != nil {
+			return engine.Callstack[i].Instance
+		}
+	}
+
+	return nil
+}
 
+func (engine *BirEngine) ResolveScopeMutaterExpression(expression *ast.ScopeMutaterExpression) (ast.IntPrimitiveExpression, error) {
 	if engine.GetCurrentCallStack().Identifier == "main" {
-		engine.Thrower.Throw("Top level scope mutations are not allowed", expression.Position, engine.Callstack)
-		return util.GenerateIntPrimitive(-1)
+		return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.RuntimeError, "Top level scope mutations are not allowed", expression.Position)
 	}
 
-	WriteToScope := func() ast.IntPrimitiveExpression {
-		if len(expression.Arguments) < 2 {
-			engine.Thrower.Throw("Scope mutation with 'Write' operation needs at least 2 arguments but '"+strconv.Itoa(len(expression.Arguments))+"' is given", expression.Position, engine.Callstack)
-			return util.GenerateIntPrimitive(-1)
-		}
+	ResolveArguments := func() ([]ast.IntPrimitiveExpression, error) {
 		arguments := []ast.IntPrimitiveExpression{}
 
 		for _, value := range expression.Arguments {
-			arguments = append(arguments, engine.ResolveExpression(value))
+			argument, err := engine.ResolveExpression(value)
+			if err != nil {
+				return arguments, err
+			}
+			arguments = append(arguments, argument)
 		}
+		return arguments, nil
+	}
 
-		selected_scope, index, b := engine.FindUpperBlockScope()
-
-		if index < 0 {
-			engine.Thrower.Throw("Could not find an upper scope to write to", expression.Position, engine.Callstack)
+	WriteToScope := func() (ast.IntPrimitiveExpression, error) {
+		if len(expression.Arguments) < 2 {
+			return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.RuntimeError, "Scope mutation with 'Write' operation needs at least 2 arguments but '"+strconv.Itoa(len(expression.Arguments))+"' is given", expression.Position)
+		}
+		arguments, err := ResolveArguments()
+		if err != nil {
+			return util.GenerateIntPrimitive(-1), err
 		}
 
-		selected_scope.AddVariable(scope.Value{
-			Key:   util.GenerateIdentifier("value_" + strconv.Itoa(int(arguments[0].Value))),
-			Value: arguments[1],
-			Kind:  "const",
-		})
-		engine.Scopestack.SwapAtIndex(index, *selected_scope)
-		if b != nil {
-			b.Instance = selected_scope
+		selected_scope := engine.FindUpperBlockScope()
+
+		if selected_scope == nil {
+			return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.RuntimeError, "Could not find an upper scope to write to", expression.Position)
 		}
 
-		return arguments[1]
+		selected_scope.WriteCell(arguments[0].Value, arguments[1])
+
+		return arguments[1], nil
 	}
 
-	ReadFromScope := func() ast.IntPrimitiveExpression {
+	ReadFromScope := func() (ast.IntPrimitiveExpression, error) {
 		if len(expression.Arguments) < 1 {
-			engine.Thrower.Throw("Scope mutation with 'Read' operation needs at least 1 argument but '"+strconv.Itoa(len(expression.Arguments))+"' is given", expression.Position, engine.Callstack)
-			return util.GenerateIntPrimitive(-1)
+			return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.RuntimeError, "Scope mutation with 'Read' operation needs at least 1 argument but '"+strconv.Itoa(len(expression.Arguments))+"' is given", expression.Position)
 		}
-		arguments := []ast.IntPrimitiveExpression{}
-
-		for _, value := range expression.Arguments {
-			arguments = append(arguments, engine.ResolveExpression(value))
+		arguments, err := ResolveArguments()
+		if err != nil {
+			return util.GenerateIntPrimitive(-1), err
 		}
 
-		selected_scope, index, _ := engine.FindUpperBlockScope()
-		var selected_value ast.IntPrimitiveExpression
+		selected_scope := engine.FindUpperBlockScope()
 
-		if index < 0 {
-			engine.Thrower.Throw("Could not find an upper scope to read from", expression.Position, engine.Callstack)
+		if selected_scope == nil {
+			return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.RuntimeError, "Could not find an upper scope to read from", expression.Position)
 		}
 
-		for _, value := range selected_scope.Frame {
-			if value.Key.Value == "value_"+strconv.Itoa(int(arguments[0].Value)) {
-				selected_value = value.Value
-			}
-		}
+		selected_value, ok := selected_scope.ReadCell(arguments[0].Value)
 
-		if selected_value.Type == "" {
-			engine.Thrower.Throw("Could not read index '"+strconv.Itoa(int(arguments[0].Value))+"', the value is non-existant", expression.Position, engine.Callstack)
-			return util.GenerateIntPrimitive(-1)
+		if !ok {
+			return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.RuntimeError, "Could not read index '"+strconv.Itoa(int(arguments[0].Value))+"', the value is non-existant", expression.Position)
 		}
-		return selected_value
+		return selected_value, nil
 	}
 
-	DeleteFromScope := func() ast.IntPrimitiveExpression {
+	DeleteFromScope := func() (ast.IntPrimitiveExpression, error) {
 		if len(expression.Arguments) < 1 {
-			engine.Thrower.Throw("Scope mutation with 'Delete' operation needs at least 1 argument but '"+strconv.Itoa(len(expression.Arguments))+"' is given", expression.Position, engine.Callstack)
-			return util.GenerateIntPrimitive(-1)
+			return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.RuntimeError, "Scope mutation with 'Delete' operation needs at least 1 argument but '"+strconv.Itoa(len(expression.Arguments))+"' is given", expression.Position)
 		}
-		arguments := []ast.IntPrimitiveExpression{}
-
-		for _, value := range expression.Arguments {
-			arguments = append(arguments, engine.ResolveExpression(value))
+		arguments, err := ResolveArguments()
+		if err != nil {
+			return util.GenerateIntPrimitive(-1), err
 		}
 
-		selected_scope, index, b := engine.FindUpperBlockScope()
-		var selected_value_index int
+		selected_scope := engine.FindUpperBlockScope()
 
-		if index < 0 {
-			engine.Thrower.Throw("Could not find an upper scope to delete from", expression.Position, engine.Callstack)
+		if selected_scope == nil {
+			return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.RuntimeError, "Could not find an upper scope to delete from", expression.Position)
 		}
 
-		for i, value := range selected_scope.Frame {
-			if value.Key.Value == "value_"+strconv.Itoa(int(arguments[0].Value)) {
-				selected_value_index = i
-			}
-		}
-
-		selected_scope.DeleteVariable(selected_value_index)
-		engine.Scopestack.SwapAtIndex(index, *selected_scope)
-		if b != nil {
-			b.Instance = selected_scope
-		}
+		selected_scope.DeleteCell(arguments[0].Value)
 
-		return util.GenerateIntPrimitive(-1)
+		return util.GenerateIntPrimitive(-1), nil
 	}
 
 	if engine.ScopeMutaterAllowed {
@@ -1031,99 +1507,135 @@ func (engine *BirEngine) ResolveScopeMutaterExpression(raw map[string]interface{
 		case "Delete":
 			return DeleteFromScope()
 		default:
-			engine.Thrower.Throw("Unknown mutater '"+expression.Mutater.Value+"'", expression.Mutater.Position, engine.Callstack)
-			return util.GenerateIntPrimitive(1)
+			return util.GenerateIntPrimitive(1), engine.Thrower.Throw(thrower.RuntimeError, "Unknown mutater '"+expression.Mutater.Value+"'", expression.Mutater.Position)
 		}
 	} else {
-		engine.Thrower.Throw("Scope mutations are not allowed in this file", expression.Position, engine.Callstack)
-		return util.GenerateIntPrimitive(-1)
+		return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.RuntimeError, "Scope mutations are not allowed in this file", expression.Position)
 	}
 }
 
-func (engine *BirEngine) ResolveNamespaceDeclaration(statement ast.NamespaceDeclarationStatement) {
-	if engine.NamespaceAllowed {
-		engine.Scopestack.PushScope(scope.Scope{})
-		for _, raw := range statement.Body {
-			var sub_statement ast.VariableDeclarationStatement
-			engine.HandleError(mapstructure.Decode(raw, &sub_statement), statement.Position)
-			engine.ResolveVariableDeclaration(sub_statement)
+func (engine *BirEngine) ResolveNamespaceDeclaration(statement *ast.NamespaceDeclarationStatement) error {
+	return engine.declareNamespace(statement, statement.Name.Value)
+}
+
+// declareNamespace runs the declarations of a namespace in a scope of its own, its blocks keep that
+// scope and nested namespaces are registered with their qualified names as in 'codes.http'
+func (engine *BirEngine) declareNamespace(statement *ast.NamespaceDeclarationStatement, name string) error {
+	namespace_scope := &scope.Scope{}
+	engine.Scopestack.PushScope(namespace_scope)
+	engine.namespaces = append(engine.namespaces, namespace_scope)
+	defer func() { engine.namespaces = engine.namespaces[:len(engine.namespaces)-1] }()
+	for _, sub_statement := range statement.Body {
+		var err error
+		switch sub_statement := sub_statement.(type) {
+		case *ast.VariableDeclarationStatement:
+			err = engine.ResolveVariableDeclaration(sub_statement)
+		case *ast.BlockDeclarationStatement:
+			err = engine.ResolveBlockDeclaration(*sub_statement)
+		case *ast.NamespaceDeclarationStatement:
+			err = engine.declareNamespace(sub_statement, name+"."+sub_statement.Name.Value)
+		case *ast.Comment:
+		default:
+			err = engine.Thrower.Throw(thrower.SyntaxError, "Namespaces can only contain variable, block and namespace declarations", sub_statement.GetPosition())
+		}
+		if err != nil {
+			return err
 		}
-		namespace_scope := engine.Scopestack.PopScope()
-		engine.Scopestack.PushNamespace(statement.Name.Value, *namespace_scope)
-	} else {
-		engine.Thrower.Throw("Namespaces are not allowed in this file", statement.Position, engine.Callstack)
 	}
+	engine.Scopestack.PopScope()
+	engine.Scopestack.PushNamespace(name, *namespace_scope)
+	return nil
 }
 
-func (engine *BirEngine) ResolveNamespaceIndexerExpression(raw map[string]interface{}) ast.IntPrimitiveExpression {
-	expression := ast.NamespaceIndexerExpression{}
-	engine.HandleAnonymousError(mapstructure.Decode(raw, &expression))
+func (engine *BirEngine) ResolveNamespaceIndexerExpression(expression *ast.NamespaceIndexerExpression) (ast.IntPrimitiveExpression, error) {
 	namespace_exists := engine.Scopestack.NamespaceExists(expression.Namespace.Value)
 
 	if namespace_exists {
 		value := engine.Scopestack.FindInNamespace(expression.Namespace.Value, expression.Index.Value)
 
 		if value.Value.Type != "" {
-			return value.Value
+			return value.Value, nil
 		}
 
-		engine.Thrower.Throw("Could not find variable '"+expression.Index.Value+"' in the namespace '"+expression.Namespace.Value+"'", expression.Position, engine.Callstack)
-		return util.GenerateIntPrimitive(-1)
+		return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.ReferenceError, "Could not find variable '"+expression.Index.Value+"' in the namespace '"+expression.Namespace.Value+"'", expression.Position)
+	}
+
+	// Variables of an aliased module are read like the members of a namespace
+	if module := engine.Scopestack.FindModule(expression.Namespace.Value); module != nil {
+		if index := module.IndexOfVariable(expression.Index.Value); index >= 0 && module.Visible(expression.Index.Value) {
+			return module.Frame[index].Value, nil
+		}
+		return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.ReferenceError, "Could not find variable '"+expression.Index.Value+"' in module '"+expression.Namespace.Value+"'", expression.Position)
 	}
 
-	engine.Thrower.Throw("Could not find namespace '"+expression.Namespace.Value+"'", expression.Position, engine.Callstack)
-	return util.GenerateIntPrimitive(-1)
+	return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.ReferenceError, "Could not find namespace '"+expression.Namespace.Value+"'", expression.Position)
 }
 
-func (engine *BirEngine) ResolveConditionExpression(raw map[string]interface{}) ast.IntPrimitiveExpression {
-	left := engine.ResolveExpression(raw["left"].(map[string]interface{}))
-	right := engine.ResolveExpression(raw["right"].(map[string]interface{}))
+func (engine *BirEngine) ResolveConditionExpression(expression *ast.ConditionExpression) (ast.IntPrimitiveExpression, error) {
+	left, err := engine.ResolveExpression(expression.Left)
+	if err != nil {
+		return left, err
+	}
+	right, err := engine.ResolveExpression(expression.Right)
+	if err != nil {
+		return right, err
+	}
 
-	switch raw["type"] {
+	switch expression.Type {
 	case "equals":
-		return util.GenerateIntFromBool(left.Value == right.Value)
+		return util.GenerateIntFromBool(left.Value == right.Value), nil
 	case "not_equals":
-		return util.GenerateIntFromBool(left.Value != right.Value)
+		return util.GenerateIntFromBool(left.Value != right.Value), nil
 	case "less_than":
-		return util.GenerateIntFromBool(left.Value < right.Value)
+		return util.GenerateIntFromBool(left.Value < right.Value), nil
 	case "less_than_equals":
-		return util.GenerateIntFromBool(left.Value <= right.Value)
+		return util.GenerateIntFromBool(left.Value <= right.Value), nil
 	case "not_less_than":
-		return util.GenerateIntFromBool(!(left.Value < right.Value))
+		return util.GenerateIntFromBool(!(left.Value < right.Value)), nil
 	case "not_less_than_equals":
-		return util.GenerateIntFromBool(!(left.Value <= right.Value))
+		return util.GenerateIntFromBool(!(left.Value <= right.Value)), nil
 	case "greater_than":
-		return util.GenerateIntFromBool(left.Value > right.Value)
+		return util.GenerateIntFromBool(left.Value > right.Value), nil
 	case "greater_than_equals":
-		return util.GenerateIntFromBool(left.Value >= right.Value)
+		return util.GenerateIntFromBool(left.Value >= right.Value), nil
 	case "not_greater_than":
-		return util.GenerateIntFromBool(!(left.Value > right.Value))
+		return util.GenerateIntFromBool(!(left.Value > right.Value)), nil
 	case "not_greater_than_equals":
-		return util.GenerateIntFromBool(!(left.Value >= right.Value))
+		return util.GenerateIntFromBool(!(left.Value >= right.Value)), nil
 	default:
-		return util.GenerateIntPrimitive(-1)
+		return util.GenerateIntPrimitive(-1), nil
 	}
 }
 
-func (engine *BirEngine) ResolveArithmeticExpression(raw map[string]interface{}) ast.IntPrimitiveExpression {
-	left := engine.ResolveExpression(raw["left"].(map[string]interface{}))
-	right := engine.ResolveExpression(raw["right"].(map[string]interface{}))
+func (engine *BirEngine) ResolveArithmeticExpression(expression *ast.ArithmeticExpression) (ast.IntPrimitiveExpression, error) {
+	left, err := engine.ResolveExpression(expression.Left)
+	if err != nil {
+		return left, err
+	}
+	right, err := engine.ResolveExpression(expression.Right)
+	if err != nil {
+		return right, err
+	}
+
+	if right.Value == 0 && (expression.Type == "division" || expression.Type == "modulus" || expression.Type == "root") {
+		return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.RuntimeError, "Division by zero", expression.Position)
+	}
 
-	switch raw["type"] {
+	switch expression.Type {
 	case "addition":
-		return util.GenerateIntPrimitive(left.Value + right.Value)
+		return util.GenerateIntPrimitive(left.Value + right.Value), nil
 	case "subtraction":
-		return util.GenerateIntPrimitive(left.Value - right.Value)
+		return util.GenerateIntPrimitive(left.Value - right.Value), nil
 	case "multiplication":
-		return util.GenerateIntPrimitive(left.Value * right.Value)
+		return util.GenerateIntPrimitive(left.Value * right.Value), nil
 	case "division":
-		return util.GenerateIntPrimitive(left.Value / right.Value)
+		return util.GenerateIntPrimitive(left.Value / right.Value), nil
 	case "exponent":
-		return util.GenerateIntPrimitive(int64(math.Pow(float64(left.Value), float64(right.Value))))
+		return util.GenerateIntPrimitive(int64(math.Pow(float64(left.Value), float64(right.Value)))), nil
 	case "modulus":
-		return util.GenerateIntPrimitive(left.Value % right.Value)
+		return util.GenerateIntPrimitive(left.Value % right.Value), nil
 	case "root":
-		return util.GenerateIntPrimitive(int64(math.Pow(float64(left.Value), float64(1/right.Value))))
+		return util.GenerateIntPrimitive(int64(math.Pow(float64(left.Value), float64(1/right.Value)))), nil
 	case "log10":
 		var value int64
 		if left.Value == 0 || left.Value == 1 {
@@ -1133,10 +1645,9 @@ func (engine *BirEngine) ResolveArithmeticExpression(raw map[string]interface{})
 		} else {
 			value = int64(math.Ceil(math.Log10(float64(left.Value))))
 		}
-		return util.GenerateIntPrimitive(value)
+		return util.GenerateIntPrimitive(value), nil
 	default:
-		engine.Thrower.Throw("Unknown arithmetic operation '"+raw["type"].(string)+"'", raw["position"].(ast.Position), engine.Callstack)
-		return util.GenerateIntPrimitive(-1)
+		return util.GenerateIntPrimitive(-1), engine.Thrower.Throw(thrower.RuntimeError, "Unknown arithmetic operation '"+expression.Type+"'", expression.Position)
 	}
 }
 
@@ -1144,34 +1655,36 @@ func (engine BirEngine) GetAnonymousIndex(position ast.Position) string {
 	return "[" + engine.Filename + " " + strconv.Itoa(int(position.Line)) + ":" + strconv.Itoa(int(position.Col)) + "]"
 }
 
-func (engine BirEngine) FindOwner(id string, expression ast.BlockCallExpression) *BirEngine {
-	var owner *BirEngine
+func (engine BirEngine) FindOwner(id string, expression *ast.BlockCallExpression) (*BirEngine, error) {
+	if owner := engine.findUse(id); owner != nil {
+		return owner, nil
+	}
 
+	return nil, engine.Thrower.Throw(thrower.ReferenceError, "Could not find block '"+expression.Name.Value+"'", expression.Position)
+}
+
+// findUse searches the imported engines and the engines they import, blocks of namespaces reach the
+// importer from the imports of its imports
+func (engine BirEngine) findUse(id string) *BirEngine {
 	for _, use := range engine.Uses {
 		if use.ID == id {
-			owner = &use
-			break
+			return use
+		}
+		if owner := use.findUse(id); owner != nil {
+			return owner
 		}
 	}
-
-	if owner != nil {
-		return owner
-	} else {
-		engine.Thrower.Throw("Could not find block '"+expression.Name.Value+"'", expression.Position, engine.Callstack)
-		return owner
-	}
+	return nil
 }
 
 func NewEngine(path string, std_path string, anonymous bool, colored_output bool, verbosity_level int) BirEngine {
 	engine := BirEngine{
 		Path:                path,
-		NamespaceAllowed:    false,
 		ScopeMutaterAllowed: true,
 		StdPath:             std_path,
 		Anonymous:           anonymous,
 		ColoredOutput:       colored_output,
 		VerbosityLevel:      verbosity_level,
-		Implementors:        []implementor.Implementor{{Name: "bir"}},
 	}
 	return engine
 }
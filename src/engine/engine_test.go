@@ -0,0 +1,331 @@
+package engine_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/canpacis/birlang/internal/testfiles"
+	"github.com/canpacis/birlang/src/engine"
+	"github.com/canpacis/birlang/src/thrower"
+)
+
+// program writes the files of a test in a directory of their own and creates an engine for main.bir
+func program(t *testing.T, files map[string]string) *engine.BirEngine {
+	t.Helper()
+	instance := engine.NewEngine(testfiles.Write(t, files)+"/main.bir", "", false, false, 0)
+	instance.Stdout = &bytes.Buffer{}
+	instance.Stderr = &bytes.Buffer{}
+	return &instance
+}
+
+func run(instance *engine.BirEngine) error {
+	if err := instance.Init(); err != nil {
+		return err
+	}
+	return instance.Run()
+}
+
+func TestStreams(t *testing.T) {
+	instance := program(t, map[string]string{"main.bir": `use "std:util"
+bir:util.read (util.out)
+let first = bir:util.pull ()
+let second = bir:util.pull ()
+bir:util.read (util.out)
+bir:util.push (second)
+bir:util.push (first)
+bir:util.write (util.out)
+`})
+	instance.Stdin = strings.NewReader("ab\ncd\n")
+	output := &bytes.Buffer{}
+	instance.Stdout = output
+
+	if err := run(instance); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if output.String() != "cdba" {
+		t.Errorf("got %q, want %q", output.String(), "cdba")
+	}
+}
+
+func TestSeparateBuffers(t *testing.T) {
+	first := program(t, map[string]string{"main.bir": "use \"std:util\"\nbir:util.push (97)\n"})
+	second := program(t, map[string]string{"main.bir": "use \"std:util\"\nbir:util.push (98)\nbir:util.write (util.out)\n"})
+	first_output, second_output := &bytes.Buffer{}, &bytes.Buffer{}
+	first.Stdout, second.Stdout = first_output, second_output
+
+	if err := run(first); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := run(second); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if first_output.String() != "" || second_output.String() != "b" {
+		t.Errorf("got %q and %q, want %q and %q, engines should not share their buffers", first_output.String(), second_output.String(), "", "b")
+	}
+}
+
+func TestStepBudget(t *testing.T) {
+	files := map[string]string{
+		"lib.bir":  "let a = 0\nfor 60 as i {\n  a++\n}\n",
+		"main.bir": "use \"./lib.bir\"\nlet b = 0\nfor 60 as i {\n  b++\n}\n",
+	}
+
+	within := program(t, files)
+	within.StepBudget = 200
+	if err := run(within); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	exceeded := program(t, files)
+	exceeded.StepBudget = 100
+	err := run(exceeded)
+	var bir_error *thrower.BirError
+	if !errors.As(err, &bir_error) || bir_error.Kind != thrower.BudgetError {
+		t.Fatalf("got %v, want the budget to be exceeded, imports share the budget of the importer", err)
+	}
+	if bir_error.Message != "Bir process has exceeded its budget of 100 steps" || bir_error.File != "main.bir" {
+		t.Errorf("got %q in %s", bir_error.Message, bir_error.File)
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	instance := program(t, map[string]string{"main.bir": "let n = 0\nwhile 1 == 1 {\n  n++\n}\n"})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	instance.Context = ctx
+
+	err := run(instance)
+	var bir_error *thrower.BirError
+	if !errors.As(err, &bir_error) || bir_error.Kind != thrower.CancelledError {
+		t.Fatalf("got %v, want the process to be cancelled", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("the error does not wrap the error of the context")
+	}
+}
+
+func TestEmbeddedStd(t *testing.T) {
+	files := map[string]string{"main.bir": "use \"std:util\"\nbir:util.push (util.size - 999960)\nbir:util.write (util.out)\n"}
+
+	embedded := program(t, files)
+	output := &bytes.Buffer{}
+	embedded.Stdout = output
+	if err := run(embedded); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if output.String() != "0" {
+		t.Errorf("got %q, want %q from the embedded library", output.String(), "0")
+	}
+
+	// A standard library directory replaces the embedded one
+	std_path := filepath.ToSlash(t.TempDir())
+	if err := os.WriteFile(std_path+"/util.bir", []byte("namespace util {\n  const push = 1000000\n  const write = 1000003\n  const out = 1000004\n  const size = 1000009\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	own := program(t, files)
+	own.StdPath = std_path
+	output = &bytes.Buffer{}
+	own.Stdout = output
+	if err := run(own); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if output.String() != "1" {
+		t.Errorf("got %q, want %q from the library of the directory", output.String(), "1")
+	}
+
+	missing := program(t, map[string]string{"main.bir": "use \"std:missing\"\n"})
+	err := run(missing)
+	var bir_error *thrower.BirError
+	if !errors.As(err, &bir_error) || bir_error.Kind != thrower.ImportError || bir_error.Message != "Import 'std:missing' is not included in the standard library" {
+		t.Errorf("got %v, want the import to fail", err)
+	}
+}
+
+func TestModules(t *testing.T) {
+	files := map[string]string{
+		"lib/shared.bir": "use \"std:util\"\nbir:util.push (115)\nbir:util.write (util.out)\nexport let shared = 7\n",
+		"lib/a.bir":      "use \"./shared.bir\"\nexport a [] { return shared + 1 }\n",
+		"mods/b.bir":     "use \"../lib/shared.bir\"\nexport b [] { return shared + 2 }\n",
+		"mods/c.bir":     "export let c = 1\n",
+		"main.bir":       "use \"std:util\"\nuse \"./lib/a.bir\"\nuse \"./mods/b.bir\" as m\nuse \"module:c.bir\" as c\nbir:util.push (a () + m.b () + c.c + 48)\nbir:util.write (util.out)\n",
+	}
+
+	instance := program(t, files)
+	instance.SearchPaths = []string{filepath.ToSlash(filepath.Join(filepath.Dir(instance.Path), "mods"))}
+	output := &bytes.Buffer{}
+	instance.Stdout = output
+	if err := run(instance); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// The shared module is imported from two paths but it is loaded and run once
+	if output.String() != "sB" {
+		t.Errorf("got %q, want %q", output.String(), "sB")
+	}
+
+	missing := program(t, files)
+	err := run(missing)
+	var bir_error *thrower.BirError
+	if !errors.As(err, &bir_error) || bir_error.Message != "Import 'module:c.bir' could not be found" {
+		t.Errorf("got %v, want the module to be missing without a search path", err)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		message string
+		file    string
+	}{
+		{"cycle", map[string]string{
+			"main.bir": "use \"./x.bir\"\n",
+			"x.bir":    "use \"./y.bir\"\n",
+			"y.bir":    "use \"./x.bir\"\n",
+		}, "Import './x.bir' forms a cycle, x.bir -> y.bir -> x.bir", "y.bir"},
+		{"self", map[string]string{"main.bir": "use \"./main.bir\"\n"}, "Import './main.bir' forms a cycle, main.bir -> main.bir", "main.bir"},
+		{"alias", map[string]string{
+			"main.bir": "use \"./x.bir\" as m\nuse \"./y.bir\" as m\n",
+			"x.bir":    "export let a = 1\n",
+			"y.bir":    "export let b = 1\n",
+		}, "Could not import './y.bir' as 'm', another module is imported as 'm'", "main.bir"},
+		{"prefix", map[string]string{"main.bir": "use \"web:x\"\n"}, "Unknown use prefix 'web'", "main.bir"},
+		{"missing", map[string]string{"main.bir": "use \"./x.bir\"\n"}, "Import './x.bir' could not be found", "main.bir"},
+	}
+
+	for _, test := range tests {
+		instance := program(t, test.files)
+		err := run(instance)
+		var bir_error *thrower.BirError
+		if !errors.As(err, &bir_error) || bir_error.Kind != thrower.ImportError {
+			t.Errorf("%s: got %v, want an import error", test.name, err)
+			continue
+		}
+		// Cycles are reported with the full paths of the files
+		message := strings.ReplaceAll(bir_error.Message, filepath.Dir(instance.Path)+"/", "")
+		if message != test.message || bir_error.File != test.file {
+			t.Errorf("%s: got %q in %s, want %q in %s", test.name, message, bir_error.File, test.message, test.file)
+		}
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	libraries := map[string]string{
+		"lib.bir":  "namespace codes {\n  const base = 40\n  namespace http {\n    const ok = 200\n  }\n  offset [n] {\n    return n + base\n  }\n}\n",
+		"lib2.bir": "const y = 1\nnamespace codes {\n  const base = 40\n}\n",
+		"exp.bir":  "export namespace pub {\n  const a = 7\n}\nnamespace priv {\n  const b = 8\n}\nexport let c = 1\nlet d = 2\nexport f [] { return 1 }\ng [] { return 2 }\n",
+		"via.bir":  "use \"./lib.bir\"\nexport const x = 1\n",
+	}
+
+	tests := []struct {
+		name    string
+		main    string
+		message string
+	}{
+		{"namespace", "use \"./lib.bir\"\nlet a = codes.http.ok + codes.offset (1)\n", ""},
+		{"aliased namespace", "use \"./lib.bir\" as l\nlet a = l.codes.http.ok + l.codes.offset (1)\n", ""},
+		{"namespace behind an alias", "use \"./lib.bir\" as l\nlet a = codes.http.ok\n", "Could not find namespace 'codes.http'"},
+		{"selected namespace", "use \"./lib.bir\" { codes }\nlet a = codes.base\n", ""},
+		{"namespace left out", "use \"./lib2.bir\" { y }\nlet a = codes.base\n", "Could not find namespace 'codes'"},
+		{"transitive namespace", "use \"./via.bir\"\nlet a = codes.base\n", "Could not find namespace 'codes'"},
+		{"exported namespace", "use \"./exp.bir\"\nlet a = pub.a\n", ""},
+		{"private namespace", "use \"./exp.bir\"\nlet a = priv.b\n", "Could not find namespace 'priv'"},
+		{"selected private namespace", "use \"./exp.bir\" { priv }\n", "Could not import 'priv', it is not exported by './exp.bir'"},
+		{"private variable", "use \"./exp.bir\"\nlet a = d\n", "Could not find variable 'd' in the frame"},
+		{"private block", "use \"./exp.bir\"\nlet a = g ()\n", "Could not find block 'g'"},
+		{"selected name", "use \"./exp.bir\" { f }\nlet a = f () + c\n", "Could not find variable 'c' in the frame"},
+		{"missing name", "use \"./exp.bir\" { h }\n", "Could not find 'h' in './exp.bir'"},
+	}
+
+	for _, test := range tests {
+		files := map[string]string{"main.bir": test.main}
+		for name, content := range libraries {
+			files[name] = content
+		}
+		err := run(program(t, files))
+		if test.message == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+		} else if err == nil || err.Error() != test.message {
+			t.Errorf("%s: got %v, want %q", test.name, err, test.message)
+		}
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	instance := engine.NewEngine("", "", true, false, 0)
+	instance.Stderr = &bytes.Buffer{}
+	if err := instance.Init(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := instance.Eval(`namespace counter {
+  let count = 5
+  const step = 2
+  bump [] {
+    count += step
+    return count
+  }
+  namespace limits {
+    const high = 100
+    clamp [n] {
+      if n > high {
+        return high
+      } else {
+        return n
+      }
+    }
+  }
+  scaled:by [] {
+    return counter.limits.clamp (count * by)
+  }
+}
+identity [n] {
+  return n
+}`); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	tests := []struct {
+		expression string
+		value      int64
+	}{
+		{"counter.count", 5},
+		{"counter.bump ()", 7},
+		{"counter.bump ()", 9},
+		{"counter.count", 9},
+		{"counter.limits.high", 100},
+		{"counter.limits.clamp (150)", 100},
+		{"counter.scaled:3 ()", 27},
+		{"counter.scaled:20 ()", 100},
+	}
+	for _, test := range tests {
+		// A block call evaluates to the value it returns, a namespace indexer alone is not a statement
+		value, err := instance.Eval("identity (" + test.expression + ")")
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.expression, err)
+		} else if value.Value != test.value {
+			t.Errorf("%s: got %d, want %d", test.expression, value.Value, test.value)
+		}
+	}
+
+	failures := []struct {
+		source  string
+		message string
+	}{
+		{"let a = counter.missing", "Could not find variable 'missing' in the namespace 'counter'"},
+		{"nowhere.x (1)", "Could not find namespace or module 'nowhere'"},
+		{"f [] {\n  namespace inner {\n    let a = 1\n  }\n}", "Namespaces are only allowed at the top level or in namespaces"},
+		{"namespace broken {\n  a = 1\n}", "Namespaces can only contain variable, block and namespace declarations"},
+	}
+	for _, test := range failures {
+		if _, err := instance.Eval(test.source); err == nil || err.Error() != test.message {
+			t.Errorf("%s: got %v, want %q", test.source, err, test.message)
+		}
+	}
+}
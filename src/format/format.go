@@ -0,0 +1,452 @@
+// Package format prints bir programs in their canonical layout
+package format
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/parser"
+)
+
+const indentation = "  "
+
+var conditions = map[string]string{
+	"equals":                  "==",
+	"not_equals":              "!=",
+	"less_than":               "<",
+	"less_than_equals":        "<=",
+	"not_less_than":           "!<",
+	"not_less_than_equals":    "!<=",
+	"greater_than":            ">",
+	"greater_than_equals":     ">=",
+	"not_greater_than":        "!>",
+	"not_greater_than_equals": "!>=",
+}
+
+var arithmetics = map[string]string{
+	"addition":       "+",
+	"subtraction":    "-",
+	"multiplication": "*",
+	"division":       "/",
+	"modulus":        "%",
+	"exponent":       "^",
+	"root":           "root",
+}
+
+var modifiers = map[string]string{
+	"increment": "++",
+	"decrement": "--",
+	"add":       "+=",
+	"subtract":  "-=",
+	"multiply":  "*=",
+	"divide":    "/=",
+}
+
+// Precedences of the expressions, an operand that binds looser than its place allows is wrapped in
+// curly braces
+const (
+	precedenceCondition = iota + 1
+	precedenceAdditive
+	precedenceMultiplicative
+	precedenceExponent
+	precedencePostfix
+	precedencePrimary
+)
+
+// Formatter prints a parsed program, the source is used to keep the blank lines between statements
+type Formatter struct {
+	lines   []string
+	builder strings.Builder
+	depth   int
+}
+
+// Format parses a program and prints it back in the canonical layout. Comments are kept as long as they
+// stand between statements, a program with a comment inside an expression is not formatted since the
+// comment would be lost.
+func Format(content string) (string, error) {
+	result := parser.Parse(content)
+	if result.Error {
+		message := "Could not parse the program"
+		if raw, ok := result.Content.(map[string]interface{}); ok {
+			position := raw["position"].(ast.Position)
+			message = raw["message"].(string) + " at " + strconv.Itoa(int(position.Line)) + ":" + strconv.Itoa(int(position.Col))
+		}
+		return "", errors.New(message)
+	}
+
+	program, err := ast.Decode(result.Content)
+	if err != nil {
+		return "", err
+	}
+
+	tokens, _ := parser.NewLexer(content).Tokenize()
+	kept := map[ast.Position]bool{}
+	collectComments(program.Program, kept)
+	for _, token := range tokens {
+		if token.Kind == parser.TokenComment && !kept[token.Position] {
+			return "", errors.New("Could not format the program, the comment at " + strconv.Itoa(int(token.Position.Line)) + ":" + strconv.Itoa(int(token.Position.Col)) + " does not stand between statements")
+		}
+	}
+
+	formatter := &Formatter{lines: strings.Split(content, "\n")}
+	formatter.Program(program)
+	return formatter.builder.String(), nil
+}
+
+func collectComments(statements []ast.Statement, kept map[ast.Position]bool) {
+	for _, statement := range statements {
+		switch statement := statement.(type) {
+		case *ast.Comment:
+			kept[statement.Position] = true
+		case *ast.NamespaceDeclarationStatement:
+			collectComments(statement.Body, kept)
+		case *ast.BlockDeclarationStatement:
+			if statement.Body != nil {
+				collectComments(statement.Body.Init, kept)
+				collectComments(statement.Body.Program, kept)
+			}
+		case *ast.ForStatement:
+			collectComments(statement.Body, kept)
+		case *ast.WhileStatement:
+			collectComments(statement.Body, kept)
+		case *ast.IfStatement:
+			collectComments(statement.Body, kept)
+			for _, elif := range statement.Elifs {
+				collectComments(elif.Body, kept)
+			}
+			collectComments(statement.Else, kept)
+		case *ast.SwitchStatement:
+			for _, _case := range statement.Cases {
+				collectComments(_case.Body, kept)
+			}
+			collectComments(statement.Default.Body, kept)
+		}
+	}
+}
+
+func (formatter *Formatter) write(value string) {
+	formatter.builder.WriteString(value)
+}
+
+func (formatter *Formatter) indent() {
+	formatter.write(strings.Repeat(indentation, formatter.depth))
+}
+
+// blankBefore tells if the source has an empty line right above the given line
+func (formatter *Formatter) blankBefore(line uint32) bool {
+	index := int(line) - 2
+	return index >= 0 && index < len(formatter.lines) && strings.TrimSpace(formatter.lines[index]) == ""
+}
+
+// Program prints the imports and the statements of a program in the order they are written
+func (formatter *Formatter) Program(program *ast.Program) {
+	statements := []ast.Statement{}
+	for _, statement := range program.Imports {
+		statements = append(statements, statement)
+	}
+	statements = append(statements, program.Program...)
+	sort.SliceStable(statements, func(i, j int) bool {
+		a, b := statements[i].GetPosition(), statements[j].GetPosition()
+		return a.Line < b.Line || (a.Line == b.Line && a.Col < b.Col)
+	})
+	formatter.Statements(statements)
+}
+
+// compound tells if a statement has a body, comments on the line of such a statement belong to its body
+func compound(statement ast.Statement) bool {
+	switch statement := statement.(type) {
+	case *ast.BlockDeclarationStatement:
+		return statement.Body != nil
+	case *ast.NamespaceDeclarationStatement, *ast.ForStatement, *ast.WhileStatement, *ast.IfStatement, *ast.SwitchStatement:
+		return true
+	}
+	return false
+}
+
+// Statements prints a list of statements, each on its own line
+func (formatter *Formatter) Statements(statements []ast.Statement) {
+	var previous ast.Statement
+	for i, statement := range statements {
+		if comment, ok := statement.(*ast.Comment); ok && previous != nil && !compound(previous) && comment.Position.Line == previous.GetPosition().Line && !strings.Contains(comment.Value, "\n") {
+			formatter.write(" ")
+			formatter.Comment(comment)
+			previous = statement
+			continue
+		}
+
+		if previous != nil {
+			formatter.write("\n")
+		}
+		if i > 0 && formatter.blankBefore(statement.GetPosition().Line) {
+			formatter.write("\n")
+		}
+		formatter.indent()
+		formatter.Statement(statement)
+		previous = statement
+	}
+	if previous != nil {
+		formatter.write("\n")
+	}
+}
+
+// Body prints a list of statements between curly braces
+func (formatter *Formatter) Body(statements []ast.Statement) {
+	if len(statements) == 0 {
+		formatter.write("{}")
+		return
+	}
+	formatter.write("{\n")
+	formatter.depth++
+	formatter.Statements(statements)
+	formatter.depth--
+	formatter.indent()
+	formatter.write("}")
+}
+
+func (formatter *Formatter) Comment(comment *ast.Comment) {
+	if strings.Contains(comment.Value, "\n") {
+		formatter.write("/* " + comment.Value + " */")
+	} else {
+		formatter.write("// " + comment.Value)
+	}
+}
+
+func (formatter *Formatter) Statement(statement ast.Statement) {
+	switch statement := statement.(type) {
+	case *ast.Comment:
+		formatter.Comment(statement)
+	case *ast.UseStatement:
+		formatter.write("use " + quote(statement.Source.Value))
+		if statement.Alias.Value != "" {
+			formatter.write(" as " + statement.Alias.Value)
+		}
+		if len(statement.Names) > 0 {
+			names := []string{}
+			for _, name := range statement.Names {
+				names = append(names, name.Value)
+			}
+			formatter.write(" { " + strings.Join(names, ", ") + " }")
+		}
+	case *ast.VariableDeclarationStatement:
+		if statement.Exported {
+			formatter.write("export ")
+		}
+		formatter.write(statement.Kind + " " + statement.Left.Value + " = " + Expression(statement.Right))
+	case *ast.AssignStatement:
+		formatter.write(statement.Left.Value + " = " + Expression(statement.Right))
+	case *ast.QuantityModifierStatement:
+		if statement.Right != nil {
+			formatter.write(Expression(statement.Statement) + " " + modifiers[statement.Type] + " " + Expression(statement.Right))
+		} else {
+			formatter.write(Expression(statement.Statement) + modifiers[statement.Type])
+		}
+	case *ast.ReturnStatement:
+		formatter.write("return " + Expression(statement.Expression))
+	case *ast.ThrowStatement:
+		formatter.write("throw " + Expression(statement.Expression))
+	case *ast.NamespaceDeclarationStatement:
+		if statement.Exported {
+			formatter.write("export ")
+		}
+		formatter.write("namespace " + statement.Name.Value + " ")
+		formatter.Body(statement.Body)
+	case *ast.BlockDeclarationStatement:
+		formatter.BlockDeclaration(statement)
+	case *ast.ForStatement:
+		formatter.write("for " + Expression(statement.Statement) + " ")
+		if statement.Placeholder != "" {
+			formatter.write("as " + statement.Placeholder + " ")
+		}
+		formatter.Body(statement.Body)
+	case *ast.WhileStatement:
+		formatter.write("while " + Expression(statement.Statement) + " ")
+		formatter.Body(statement.Body)
+	case *ast.IfStatement:
+		formatter.write("if " + Expression(statement.Condition) + " ")
+		formatter.Body(statement.Body)
+		for _, elif := range statement.Elifs {
+			formatter.write(" elif " + Expression(elif.Condition) + " ")
+			formatter.Body(elif.Body)
+		}
+		if statement.Else != nil {
+			formatter.write(" else ")
+			formatter.Body(statement.Else)
+		}
+	case *ast.SwitchStatement:
+		formatter.write("switch " + Expression(statement.Condition) + " {\n")
+		formatter.depth++
+		for _, _case := range statement.Cases {
+			formatter.indent()
+			formatter.write("case " + Expression(_case.Case) + " ")
+			formatter.Body(_case.Body)
+			formatter.write("\n")
+		}
+		if statement.Default.Body != nil {
+			formatter.indent()
+			formatter.write("default ")
+			formatter.Body(statement.Default.Body)
+			formatter.write("\n")
+		}
+		formatter.depth--
+		formatter.indent()
+		formatter.write("}")
+	case ast.Expression:
+		formatter.write(Expression(statement))
+	}
+}
+
+func (formatter *Formatter) BlockDeclaration(statement *ast.BlockDeclarationStatement) {
+	if statement.Exported {
+		formatter.write("export ")
+	}
+	formatter.write(statement.Name.Value)
+
+	if statement.Implementing {
+		formatter.write(" implements " + statement.Implements.Value)
+		if len(statement.Populate) == 1 && statement.Populate[0].Key == "" {
+			formatter.write(" " + Expression(statement.Populate[0].Value))
+		} else if len(statement.Populate) > 0 {
+			populations := []string{}
+			for _, population := range statement.Populate {
+				value := Expression(population.Value)
+				if population.Key != "" {
+					value = population.Key + ": " + value
+				}
+				populations = append(populations, value)
+			}
+			formatter.write(" {" + strings.Join(populations, ", ") + "}")
+		}
+		return
+	}
+
+	for _, verb := range statement.Verbs {
+		formatter.write(":" + verb.Value)
+	}
+	arguments := []string{}
+	for _, argument := range statement.Arguments {
+		arguments = append(arguments, argument.Value)
+	}
+	formatter.write(" [" + strings.Join(arguments, ", ") + "] ")
+
+	if statement.Body.Init == nil {
+		formatter.Body(statement.Body.Program)
+		return
+	}
+
+	formatter.write("{\n")
+	formatter.depth++
+	formatter.indent()
+	formatter.write("init ")
+	formatter.Body(statement.Body.Init)
+	formatter.write("\n")
+	if len(statement.Body.Program) > 0 {
+		formatter.write("\n")
+		formatter.Statements(statement.Body.Program)
+	}
+	formatter.depth--
+	formatter.indent()
+	formatter.write("}")
+}
+
+func precedence(expression ast.Expression) int {
+	switch expression := expression.(type) {
+	case *ast.ConditionExpression:
+		return precedenceCondition
+	case *ast.ArithmeticExpression:
+		switch expression.Type {
+		case "addition", "subtraction":
+			return precedenceAdditive
+		case "multiplication", "division", "modulus":
+			return precedenceMultiplicative
+		case "exponent", "root":
+			return precedenceExponent
+		case "log10":
+			return precedencePostfix
+		}
+	}
+	return precedencePrimary
+}
+
+// operand prints an expression that has to bind at least as tight as the given precedence
+func operand(expression ast.Expression, minimum int) string {
+	if precedence(expression) < minimum {
+		return "{" + Expression(expression) + "}"
+	}
+	return Expression(expression)
+}
+
+// verb prints a verb of a block call, verbs are parsed without binary operators and block calls
+func verb(expression ast.Expression) string {
+	if _, ok := expression.(*ast.BlockCallExpression); ok {
+		return "{" + Expression(expression) + "}"
+	}
+	return operand(expression, precedencePrimary)
+}
+
+func list(expressions []ast.Expression) string {
+	result := []string{}
+	for _, expression := range expressions {
+		result = append(result, Expression(expression))
+	}
+	return strings.Join(result, ", ")
+}
+
+func negative(value bool) string {
+	if value {
+		return "-"
+	}
+	return ""
+}
+
+// Expression prints an expression with the fewest curly braces that keep its meaning
+func Expression(expression ast.Expression) string {
+	switch expression := expression.(type) {
+	case *ast.IntPrimitiveExpression:
+		return strconv.FormatInt(expression.Value, 10)
+	case *ast.StringPrimitiveExpression:
+		return quote(expression.Value)
+	case *ast.ArrayPrimitiveExpression:
+		return "[" + list(expression.Values) + "]"
+	case *ast.ReferenceExpression:
+		return negative(expression.Negative) + expression.Value
+	case *ast.NamespaceIndexerExpression:
+		return expression.Namespace.Value + "." + expression.Index.Value
+	case *ast.ScopeMutaterExpression:
+		result := "[" + negative(expression.Mutater.Negative) + expression.Mutater.Value
+		if len(expression.Arguments) > 0 {
+			result += " " + list(expression.Arguments)
+		}
+		return result + "]"
+	case *ast.BlockCallExpression:
+		result := expression.Name.Value
+		if expression.Namespace.Value != "" {
+			result = expression.Namespace.Value + "." + result
+		}
+		for _, v := range expression.Verbs {
+			result += ":" + verb(v)
+		}
+		return result + " (" + list(expression.Arguments) + ")"
+	case *ast.ConditionExpression:
+		return operand(expression.Left, precedenceAdditive) + " " + conditions[expression.Type] + " " + operand(expression.Right, precedenceAdditive)
+	case *ast.ArithmeticExpression:
+		switch precedence(expression) {
+		case precedenceAdditive:
+			return operand(expression.Left, precedenceAdditive) + " " + arithmetics[expression.Type] + " " + operand(expression.Right, precedenceMultiplicative)
+		case precedenceMultiplicative:
+			return operand(expression.Left, precedenceMultiplicative) + " " + arithmetics[expression.Type] + " " + operand(expression.Right, precedenceExponent)
+		case precedenceExponent:
+			return operand(expression.Left, precedencePostfix) + " " + arithmetics[expression.Type] + " " + operand(expression.Right, precedenceExponent)
+		case precedencePostfix:
+			return operand(expression.Left, precedencePostfix) + " log"
+		}
+	}
+	return ""
+}
+
+func quote(value string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t", "\r", "\\r", "\x00", "\\0")
+	return "\"" + replacer.Replace(value) + "\""
+}
@@ -0,0 +1,58 @@
+package format
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"imports", "use \"std:util\"   as u\nuse \"./lib.bir\" {a,b}\n", "use \"std:util\" as u\nuse \"./lib.bir\" { a, b }\n"},
+		{"spacing", "let a=1+2*3\nconst   b = {a+1}*2\n", "let a = 1 + 2 * 3\nconst b = {a + 1} * 2\n"},
+		{"precedence", "let a = {1 * 2} + 3\nlet b = 1 - {2 - 3}\n", "let a = 1 * 2 + 3\nlet b = 1 - {2 - 3}\n"},
+		{"blank lines", "let a = 1\n\n\n\nlet b = 2\n", "let a = 1\n\nlet b = 2\n"},
+		{"comments", "// note\nlet a = 1 // trailing\n", "// note\nlet a = 1 // trailing\n"},
+		{"blocks", "f:v [x,y] {\ninit { let c = 1 }\nreturn x+y+c\n}\n", "f:v [x, y] {\n  init {\n    let c = 1\n  }\n\n  return x + y + c\n}\n"},
+		{"implements", "g   implements   f\n", "g implements f\n"},
+		{"conditions", "if a==7{a++}elif a>3 {a--} else {a=0}\n", "if a == 7 {\n  a++\n} elif a > 3 {\n  a--\n} else {\n  a = 0\n}\n"},
+		{"loops", "for 3 as i { a++ }\nwhile a < 3 { a += 1 }\n", "for 3 as i {\n  a++\n}\nwhile a < 3 {\n  a += 1\n}\n"},
+		{"switch", "switch a { case 1 { a = 2 } default { a = 3 } }\n", "switch a {\n  case 1 {\n    a = 2\n  }\n  default {\n    a = 3\n  }\n}\n"},
+		{"namespaces", "export namespace n { let q = -a\n b [] { return bir:util.pull () } }\n", "export namespace n {\n  let q = -a\n  b [] {\n    return bir:util.pull ()\n  }\n}\n"},
+		{"calls", "let a = f:1:{n + 1} (2,x)\nlet b = codes.http.ok\n", "let a = f:1:{n + 1} (2, x)\nlet b = codes.http.ok\n"},
+	}
+
+	for _, test := range tests {
+		got, err := Format(test.source)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+		// A formatted program is already in its canonical layout
+		if again, err := Format(got); err != nil || again != got {
+			t.Errorf("%s: formatting twice gave %q %v", test.name, again, err)
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{"let a = 1 + // x\n2\n", "Could not format the program, the comment at 1:13 does not stand between statements"},
+		{"let a = \n", ""},
+	}
+
+	for _, test := range tests {
+		_, err := Format(test.source)
+		if err == nil {
+			t.Errorf("%q: formatted a program that should not be", test.source)
+		} else if test.message != "" && err.Error() != test.message {
+			t.Errorf("%q: got %q, want %q", test.source, err.Error(), test.message)
+		}
+	}
+}
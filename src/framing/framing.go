@@ -0,0 +1,47 @@
+// Package framing reads and writes json messages framed by a Content-Length header, the framing the
+// language server and the debug adapter share
+package framing
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// Read reads a message and decodes its body into a value, io.EOF is returned when the input ends before
+// a message starts
+func Read(reader *bufio.Reader, value interface{}) error {
+	header, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil {
+		return err
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return errors.New("Invalid Content-Length header")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return err
+	}
+	return json.Unmarshal(body, value)
+}
+
+// Write frames a value with a Content-Length header
+func Write(writer io.Writer, value interface{}) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(writer, "Content-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"); err != nil {
+		return err
+	}
+	_, err = writer.Write(body)
+	return err
+}
@@ -0,0 +1,49 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+type message struct {
+	Method string `json:"method"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	for _, method := range []string{"initialize", "shutdown"} {
+		if err := Write(buffer, message{Method: method}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !strings.HasPrefix(buffer.String(), "Content-Length: 23\r\n\r\n{\"method\":\"initialize\"}") {
+		t.Errorf("got %q", buffer.String())
+	}
+
+	reader := bufio.NewReader(buffer)
+	for _, method := range []string{"initialize", "shutdown"} {
+		read := message{}
+		if err := Read(reader, &read); err != nil || read.Method != method {
+			t.Errorf("got %q %v, want %q", read.Method, err, method)
+		}
+	}
+	if err := Read(reader, &message{}); err != io.EOF {
+		t.Errorf("got %v at the end of the input, want io.EOF", err)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	inputs := map[string]string{
+		"missing length": "Content-Type: json\r\n\r\n{}",
+		"short body":     "Content-Length: 10\r\n\r\n{}",
+		"invalid json":   "Content-Length: 2\r\n\r\n{]",
+	}
+	for name, input := range inputs {
+		if err := Read(bufio.NewReader(strings.NewReader(input)), &message{}); err == nil || err == io.EOF {
+			t.Errorf("%s: got %v, want an error", name, err)
+		}
+	}
+}
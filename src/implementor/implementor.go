@@ -2,16 +2,56 @@ package implementor
 
 import (
 	"bufio"
+	"bytes"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/canpacis/birlang/src/ast"
 	"github.com/canpacis/birlang/src/util"
 )
 
-var io_buffer []byte
+// Implementor is a native block that host code registers on an engine, the block is declared with the
+// implementor's name and its first verb selects which entry of the verb table is called
+type Implementor interface {
+	Name() string
+	Verbs() map[int64]Verb
+}
+
+// Verb is an entry of an implementor's verb table, Arguments is the minimum number of arguments the
+// function needs and Function receives the verbs that follow the selecting one
+type Verb struct {
+	Name      string
+	Arguments int
+	Function  func(verbs []ast.IntPrimitiveExpression, arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn
+}
+
+// Dispatch turns an implementor into the native function of its block
+func Dispatch(implementor Implementor) ast.NativeFunction {
+	name := implementor.Name()
+	verbs := implementor.Verbs()
+
+	return func(called_verbs []ast.IntPrimitiveExpression, arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
+		if len(called_verbs) == 0 {
+			return util.GenerateNativeFunctionReturn(true, false, "Native '"+name+"' block needs at least 1 verb", -1)
+		}
 
-type Implementor struct {
-	Name string `json:"name"`
+		verb, ok := verbs[called_verbs[0].Value]
+		if !ok {
+			return util.GenerateNativeFunctionReturn(false, false, "", -1)
+		}
+
+		if len(arguments) < verb.Arguments {
+			noun := "argument"
+			if verb.Arguments > 1 {
+				noun = "arguments"
+			}
+			return util.GenerateNativeFunctionReturn(true, false, "Native '"+name+"' block's '"+verb.Name+"' verb needs at least "+strconv.Itoa(verb.Arguments)+" "+noun, -1)
+		}
+
+		return verb.Function(called_verbs[1:], arguments)
+	}
 }
 
 const (
@@ -25,74 +65,171 @@ const (
 	UtilIn
 	UtilSize
 	UtilUnknown
+	UtilOpen
+	UtilAppend
+	UtilTruncate
 )
 
-func (implementor Implementor) Interface(verbs []ast.IntPrimitiveExpression, arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
-	if len(verbs) > 0 {
-		switch verbs[0].Value {
-		case UtilPush:
-			return implementor.Push(arguments)
-		case UtilPull:
-			return implementor.Pull()
-		case UtilRead:
-			return implementor.Read(arguments)
-		case UtilWrite:
-			return implementor.Write(arguments)
-		}
-		return util.GenerateNativeFunctionReturn(false, false, "", -1)
-	} else {
-		return util.GenerateNativeFunctionReturn(true, false, "Native 'bir' block needs at least 1 verb", -1)
+// Permissions are what a program may do with the files of the host, the standard streams are always
+// available
+type Permissions struct {
+	Read  bool `json:"read"`
+	Write bool `json:"write"`
+}
+
+// Bir is the implementor every engine has, std uses it to talk to the outside world. Each engine
+// creates its own so that the buffer values are pushed to and pulled from is never shared.
+type Bir struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Buffer []byte
+	// Permissions limit the file access of the program, nil permits everything
+	Permissions *Permissions
+}
+
+func (implementor *Bir) Name() string {
+	return "bir"
+}
+
+func (implementor *Bir) Verbs() map[int64]Verb {
+	return map[int64]Verb{
+		UtilPush:  {Name: "push", Arguments: 1, Function: implementor.Push},
+		UtilPull:  {Name: "pull", Arguments: 0, Function: implementor.Pull},
+		UtilRead:  {Name: "read", Arguments: 1, Function: implementor.Read},
+		UtilWrite: {Name: "write", Arguments: 1, Function: implementor.Write},
 	}
 }
 
-func (implementor Implementor) Push(arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
-	if len(arguments) > 0 {
-		io_buffer = append(io_buffer, byte(arguments[0].Value))
-		return util.GenerateNativeFunctionReturn(false, false, "", -1)
+func (implementor *Bir) stdin() *bufio.Reader {
+	if reader, ok := implementor.Stdin.(*bufio.Reader); ok {
+		return reader
+	}
+	if implementor.Stdin == nil {
+		implementor.Stdin = bufio.NewReader(os.Stdin)
 	} else {
-		return util.GenerateNativeFunctionReturn(true, false, "Native 'bir' block's 'push' verb needs at least 1 argument", -1)
+		implementor.Stdin = bufio.NewReader(implementor.Stdin)
+	}
+	return implementor.Stdin.(*bufio.Reader)
+}
+
+func (implementor *Bir) stdout() io.Writer {
+	if implementor.Stdout == nil {
+		return os.Stdout
 	}
+	return implementor.Stdout
 }
 
-func (implementor Implementor) Pull() ast.NativeFunctionReturn {
+func (implementor *Bir) Push(verbs []ast.IntPrimitiveExpression, arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
+	implementor.Buffer = append(implementor.Buffer, byte(arguments[0].Value))
+	return util.GenerateNativeFunctionReturn(false, false, "", -1)
+}
+
+func (implementor *Bir) Pull(verbs []ast.IntPrimitiveExpression, arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
 	var element int64
 
-	if len(io_buffer) > 0 {
-		element = int64(io_buffer[0])
-		io_buffer = io_buffer[1:]
+	if len(implementor.Buffer) > 0 {
+		element = int64(implementor.Buffer[0])
+		implementor.Buffer = implementor.Buffer[1:]
 	} else {
 		element = UtilDone
 	}
 	return util.GenerateNativeFunctionReturn(false, false, "", element)
 }
 
-func (implementor Implementor) Read(arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
-	if len(arguments) > 0 {
-		switch arguments[0].Value {
-		case UtilOut:
-			scanner := bufio.NewScanner(os.Stdin)
-			scanner.Scan()
-			text := scanner.Text()
-			io_buffer = append(io_buffer, []byte(text)...)
-		case UtilFile:
+// file splits the buffer into the path of a file and the bytes that follow it, the path is as long as
+// the given length or ends at the first zero byte of the buffer
+func (implementor *Bir) file(arguments []ast.IntPrimitiveExpression) (string, []byte) {
+	length := len(implementor.Buffer)
+
+	if len(arguments) > 1 && arguments[1].Value >= 0 && int(arguments[1].Value) <= len(implementor.Buffer) {
+		length = int(arguments[1].Value)
+	} else if index := bytes.IndexByte(implementor.Buffer, 0); index >= 0 {
+		return string(implementor.Buffer[:index]), implementor.Buffer[index+1:]
+	}
+
+	return string(implementor.Buffer[:length]), implementor.Buffer[length:]
+}
+
+func (implementor *Bir) fileError(verb string, file_path string, err error) ast.NativeFunctionReturn {
+	implementor.Buffer = []byte{}
+
+	if os.IsNotExist(err) {
+		return util.GenerateNativeFunctionReturn(true, false, "Could not "+verb+" file '"+file_path+"', the file does not exist", -1)
+	} else if os.IsPermission(err) {
+		return util.GenerateNativeFunctionReturn(true, false, "Could not "+verb+" file '"+file_path+"', permission denied", -1)
+	}
+	return util.GenerateNativeFunctionReturn(true, false, "Could not "+verb+" file '"+file_path+"'", -1)
+}
+
+func (implementor *Bir) denied(verb string, file_path string) ast.NativeFunctionReturn {
+	implementor.Buffer = []byte{}
+	return util.GenerateNativeFunctionReturn(true, false, "Could not "+verb+" file '"+file_path+"', the program is not permitted to "+verb+" files", -1)
+}
+
+// Read fills the buffer, from a line of the standard input or from the contents of a file whose path is
+// in the buffer. The buffer is pulled until it signals 'util.done'.
+func (implementor *Bir) Read(verbs []ast.IntPrimitiveExpression, arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
+	switch arguments[0].Value {
+	case UtilOut:
+		line, _ := implementor.stdin().ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		implementor.Buffer = append(implementor.Buffer, []byte(line)...)
+	case UtilFile:
+		file_path, rest := implementor.file(arguments)
+		if implementor.Permissions != nil && !implementor.Permissions.Read {
+			return implementor.denied("read", file_path)
 		}
-		io_buffer = []byte{}
-		return util.GenerateNativeFunctionReturn(false, false, "", -1)
-	} else {
-		return util.GenerateNativeFunctionReturn(true, false, "Native 'bir' block's 'read' verb needs at least 1 argument", -1)
+		content, err := os.ReadFile(file_path)
+		if err != nil {
+			return implementor.fileError("read", file_path, err)
+		}
+		implementor.Buffer = append(append([]byte{}, rest...), content...)
 	}
+	return util.GenerateNativeFunctionReturn(false, false, "", -1)
 }
 
-func (implementor Implementor) Write(arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
-	if len(arguments) > 0 {
-		switch arguments[0].Value {
-		case UtilOut:
-			os.Stdout.WriteString(string(io_buffer))
-		case UtilFile:
+// Write empties the buffer to the standard output or to a file, when writing to a file the buffer holds
+// its path followed by the contents and the third argument is one of 'util.truncate' (default),
+// 'util.append' or 'util.open' which writes over a file that has to exist
+func (implementor *Bir) Write(verbs []ast.IntPrimitiveExpression, arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
+	switch arguments[0].Value {
+	case UtilOut:
+		if _, err := implementor.stdout().Write(implementor.Buffer); err != nil {
+			implementor.Buffer = []byte{}
+			return util.GenerateNativeFunctionReturn(true, false, "Could not write to the standard output", -1)
+		}
+	case UtilFile:
+		file_path, content := implementor.file(arguments)
+		if implementor.Permissions != nil && !implementor.Permissions.Write {
+			return implementor.denied("write", file_path)
+		}
+
+		flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if len(arguments) > 2 {
+			switch arguments[2].Value {
+			case UtilTruncate:
+			case UtilAppend:
+				flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			case UtilOpen:
+				flag = os.O_WRONLY
+			default:
+				implementor.Buffer = []byte{}
+				return util.GenerateNativeFunctionReturn(true, false, "Unknown file mode '"+strconv.Itoa(int(arguments[2].Value))+"'", -1)
+			}
+		}
+
+		file, err := os.OpenFile(file_path, flag, 0644)
+		if err != nil {
+			return implementor.fileError("open", file_path, err)
+		}
+		_, err = file.Write(content)
+		if close_err := file.Close(); err == nil {
+			err = close_err
+		}
+		if err != nil {
+			return implementor.fileError("write", file_path, err)
 		}
-		io_buffer = []byte{}
-		return util.GenerateNativeFunctionReturn(false, false, "", -1)
-	} else {
-		return util.GenerateNativeFunctionReturn(true, false, "Native 'bir' block's 'write' verb needs at least 1 argument", -1)
 	}
+	implementor.Buffer = []byte{}
+	return util.GenerateNativeFunctionReturn(false, false, "", -1)
 }
@@ -0,0 +1,217 @@
+package implementor_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/engine"
+	"github.com/canpacis/birlang/src/implementor"
+	"github.com/canpacis/birlang/src/util"
+)
+
+// math is an implementor with a verb that adds its arguments and one that scales them by its verbs
+type math struct{}
+
+func (math) Name() string {
+	return "math"
+}
+
+func (math) Verbs() map[int64]implementor.Verb {
+	return map[int64]implementor.Verb{
+		1: {Name: "add", Arguments: 2, Function: func(verbs []ast.IntPrimitiveExpression, arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
+			return util.GenerateNativeFunctionReturn(false, false, "", arguments[0].Value+arguments[1].Value)
+		}},
+		2: {Name: "scale", Arguments: 1, Function: func(verbs []ast.IntPrimitiveExpression, arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
+			value := arguments[0].Value
+			for _, verb := range verbs {
+				value *= verb.Value
+			}
+			return util.GenerateNativeFunctionReturn(false, false, "", value)
+		}},
+	}
+}
+
+func values(values ...int64) []ast.IntPrimitiveExpression {
+	result := []ast.IntPrimitiveExpression{}
+	for _, value := range values {
+		result = append(result, util.GenerateIntPrimitive(value))
+	}
+	return result
+}
+
+func TestDispatch(t *testing.T) {
+	tests := []struct {
+		verbs     []int64
+		arguments []int64
+		value     int64
+		message   string
+	}{
+		{[]int64{1}, []int64{2, 3}, 5, ""},
+		{[]int64{2, 3, 4}, []int64{5}, 60, ""},
+		{[]int64{2}, []int64{5}, 5, ""},
+		{[]int64{9}, []int64{5}, -1, ""},
+		{[]int64{}, []int64{5}, -1, "Native 'math' block needs at least 1 verb"},
+		{[]int64{1}, []int64{2}, -1, "Native 'math' block's 'add' verb needs at least 2 arguments"},
+		{[]int64{2}, []int64{}, -1, "Native 'math' block's 'scale' verb needs at least 1 argument"},
+	}
+
+	function := implementor.Dispatch(math{})
+	for _, test := range tests {
+		result := function(values(test.verbs...), values(test.arguments...))
+		if result.Value.Value != test.value || result.Message != test.message || result.Error != (test.message != "") {
+			t.Errorf("verbs %v, arguments %v: got %d %q, want %d %q", test.verbs, test.arguments, result.Value.Value, result.Message, test.value, test.message)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	instance := engine.NewEngine("", "", true, false, 0)
+	instance.Register(math{})
+	instance.Stderr = &bytes.Buffer{}
+	if err := instance.Init(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	value, err := instance.Eval("math:2:10 (math:1 (2, 3))")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if value.Value != 50 {
+		t.Errorf("got %d, want 50", value.Value)
+	}
+
+	if _, err := instance.Eval("math:1 (2)"); err == nil || err.Error() != "Native 'math' block's 'add' verb needs at least 2 arguments" {
+		t.Errorf("got %v, want the error of the verb", err)
+	}
+	if _, err := instance.Eval("m implements math"); err == nil {
+		t.Errorf("implemented a native block")
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	instance := engine.NewEngine("", "", true, false, 0)
+	instance.Register(math{})
+	instance.Register(math{})
+	err := instance.Init()
+	if err == nil || err.Error() != "Could not register native block 'math', a block with the same name exists" {
+		t.Errorf("got %v, want the duplicate to be rejected", err)
+	}
+}
+
+// file calls a verb of the bir implementor with a buffer holding a path, a zero byte and the content, a
+// length of -1 leaves the path to end at the zero byte
+func file(bir *implementor.Bir, verb func([]ast.IntPrimitiveExpression, []ast.IntPrimitiveExpression) ast.NativeFunctionReturn, file_path string, content string, arguments ...int64) ast.NativeFunctionReturn {
+	bir.Buffer = append([]byte(file_path+"\x00"), content...)
+	return verb(nil, values(append([]int64{implementor.UtilFile}, arguments...)...))
+}
+
+func TestFiles(t *testing.T) {
+	file_path := filepath.ToSlash(filepath.Join(t.TempDir(), "data.txt"))
+	bir := &implementor.Bir{}
+
+	if result := file(bir, bir.Write, file_path, "hello"); result.Error {
+		t.Fatalf("unexpected error %q", result.Message)
+	}
+	if result := file(bir, bir.Write, file_path, " world", -1, implementor.UtilAppend); result.Error {
+		t.Fatalf("unexpected error %q", result.Message)
+	}
+	if result := file(bir, bir.Read, file_path, ""); result.Error {
+		t.Fatalf("unexpected error %q", result.Message)
+	}
+	if string(bir.Buffer) != "hello world" {
+		t.Errorf("read %q, want %q", bir.Buffer, "hello world")
+	}
+
+	if result := file(bir, bir.Write, file_path, "J", -1, implementor.UtilOpen); result.Error {
+		t.Fatalf("unexpected error %q", result.Message)
+	}
+	content, _ := os.ReadFile(file_path)
+	if string(content) != "Jello world" {
+		t.Errorf("got %q in the file, want %q", content, "Jello world")
+	}
+	if result := file(bir, bir.Write, file_path, "bye", -1, implementor.UtilTruncate); result.Error {
+		t.Fatalf("unexpected error %q", result.Message)
+	}
+	content, _ = os.ReadFile(file_path)
+	if string(content) != "bye" {
+		t.Errorf("got %q in the file, want %q", content, "bye")
+	}
+
+	// The length argument splits the path from the content when there is no zero byte
+	bir.Buffer = []byte(file_path + "xyz")
+	if result := bir.Write(nil, values(implementor.UtilFile, int64(len(file_path)))); result.Error {
+		t.Fatalf("unexpected error %q", result.Message)
+	}
+	content, _ = os.ReadFile(file_path)
+	if string(content) != "xyz" {
+		t.Errorf("got %q in the file, want %q", content, "xyz")
+	}
+}
+
+func TestFileErrors(t *testing.T) {
+	directory := filepath.ToSlash(t.TempDir())
+	missing := directory + "/missing.txt"
+	existing := directory + "/existing.txt"
+	if err := os.WriteFile(existing, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		permissions *implementor.Permissions
+		read        bool
+		file_path   string
+		arguments   []int64
+		message     string
+	}{
+		{"missing file", nil, true, missing, nil, "Could not read file '" + missing + "', the file does not exist"},
+		{"open missing file", nil, false, missing, []int64{-1, implementor.UtilOpen}, "Could not open file '" + missing + "', the file does not exist"},
+		{"unknown mode", nil, false, existing, []int64{-1, 42}, "Unknown file mode '42'"},
+		{"read denied", &implementor.Permissions{Read: false, Write: true}, true, existing, nil, "Could not read file '" + existing + "', the program is not permitted to read files"},
+		{"write denied", &implementor.Permissions{Read: true, Write: false}, false, existing, nil, "Could not write file '" + existing + "', the program is not permitted to write files"},
+	}
+
+	for _, test := range tests {
+		bir := &implementor.Bir{Permissions: test.permissions}
+		verb := bir.Write
+		if test.read {
+			verb = bir.Read
+		}
+		result := file(bir, verb, test.file_path, "y", test.arguments...)
+		if !result.Error || result.Message != test.message {
+			t.Errorf("%s: got %v %q, want %q", test.name, result.Error, result.Message, test.message)
+		}
+		if len(bir.Buffer) != 0 {
+			t.Errorf("%s: the buffer is not emptied after an error", test.name)
+		}
+	}
+
+	content, _ := os.ReadFile(existing)
+	if string(content) != "x" {
+		t.Errorf("a denied write changed the file to %q", content)
+	}
+}
+
+// closed is a standard output that could not be written to
+type closed struct{}
+
+func (closed) Write(p []byte) (int, error) {
+	return 0, errors.New("closed")
+}
+
+func TestStdoutError(t *testing.T) {
+	bir := &implementor.Bir{Stdout: closed{}}
+	bir.Push(nil, values('x'))
+
+	result := bir.Write(nil, values(implementor.UtilOut))
+	if !result.Error || result.Message != "Could not write to the standard output" {
+		t.Errorf("got %v %q, want the write error", result.Error, result.Message)
+	}
+	if len(bir.Buffer) != 0 {
+		t.Errorf("the buffer is not emptied after an error")
+	}
+}
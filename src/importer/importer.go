@@ -0,0 +1,76 @@
+// Package importer finds the files use statements import, the engine, the virtual machine and the
+// language server share it so that they reach the same files and report the same errors
+package importer
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/canpacis/birlang/std"
+)
+
+// Importer finds modules in the standard library at StdPath, the embedded one when it is empty, and
+// 'module:' imports next to the importing file and then in the SearchPaths
+type Importer struct {
+	StdPath     string
+	SearchPaths []string
+}
+
+// Path finds the file a use statement of a file in a directory imports and tells if it is a module of
+// the standard library. 'std:' modules come from the standard library, 'module:' modules from the
+// directory or the search paths and paths starting with './', '../' or '/' are files relative to the
+// directory.
+func (importer Importer) Path(directory string, source string) (string, bool, error) {
+	switch {
+	case strings.HasPrefix(source, "std:"):
+		use_path := std.Locate(importer.StdPath, strings.TrimPrefix(source, "std:"))
+		if use_path == "" {
+			return "", false, errors.New("Import '" + source + "' is not included in the standard library")
+		}
+		return use_path, true, nil
+	case strings.HasPrefix(source, "module:"):
+		for _, search_path := range append([]string{directory}, importer.SearchPaths...) {
+			use_path := path.Join(search_path, strings.TrimPrefix(source, "module:"))
+			if _, err := os.Stat(use_path); err == nil {
+				return use_path, false, nil
+			}
+		}
+		return "", false, errors.New("Import '" + source + "' could not be found")
+	case strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") || path.IsAbs(source):
+		use_path := source
+		if !path.IsAbs(source) {
+			use_path = path.Join(directory, source)
+		}
+		if info, err := os.Stat(use_path); err != nil || info.IsDir() {
+			return "", false, errors.New("Import '" + source + "' could not be found")
+		}
+		return use_path, false, nil
+	}
+	return "", false, errors.New("Unknown use prefix '" + strings.Split(source, ":")[0] + "'")
+}
+
+// Key identifies the file of a module however it was reached
+func Key(file_path string) string {
+	if std.Embedded(file_path) {
+		return file_path
+	}
+	if absolute, err := filepath.Abs(file_path); err == nil {
+		return absolute
+	}
+	return path.Clean(file_path)
+}
+
+// Cycle returns an error when a use statement imports one of the files in the chain of files that are
+// being loaded, the first file of the chain imports the second one and so on
+func Cycle(chain []string, source string, use_path string) error {
+	key := Key(use_path)
+	for i, loading := range chain {
+		if Key(loading) == key {
+			return errors.New("Import '" + source + "' forms a cycle, " + strings.Join(append(chain[i:len(chain):len(chain)], use_path), " -> "))
+		}
+	}
+	return nil
+}
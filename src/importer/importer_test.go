@@ -0,0 +1,63 @@
+package importer_test
+
+import (
+	"testing"
+
+	"github.com/canpacis/birlang/internal/testfiles"
+	"github.com/canpacis/birlang/src/importer"
+	"github.com/canpacis/birlang/std"
+)
+
+func TestPath(t *testing.T) {
+	directory := testfiles.Write(t, map[string]string{
+		"main.bir":          "",
+		"lib/local.bir":     "",
+		"vendor/shared.bir": "",
+	})
+	finder := importer.Importer{SearchPaths: []string{directory + "/vendor"}}
+
+	tests := []struct {
+		source   string
+		path     string
+		standard bool
+		message  string
+	}{
+		{"std:util", std.Root + "/util.bir", true, ""},
+		{"./lib/local.bir", directory + "/lib/local.bir", false, ""},
+		{"module:lib/local.bir", directory + "/lib/local.bir", false, ""},
+		{"module:shared.bir", directory + "/vendor/shared.bir", false, ""},
+		{directory + "/main.bir", directory + "/main.bir", false, ""},
+		{"std:missing", "", false, "Import 'std:missing' is not included in the standard library"},
+		{"module:missing.bir", "", false, "Import 'module:missing.bir' could not be found"},
+		{"./lib", "", false, "Import './lib' could not be found"},
+		{"web:lib", "", false, "Unknown use prefix 'web'"},
+	}
+
+	for _, test := range tests {
+		use_path, standard, err := finder.Path(directory, test.source)
+		message := ""
+		if err != nil {
+			message = err.Error()
+		}
+		if use_path != test.path || standard != test.standard || message != test.message {
+			t.Errorf("%s: got %q %v %q, want %q %v %q", test.source, use_path, standard, message, test.path, test.standard, test.message)
+		}
+	}
+}
+
+func TestCycle(t *testing.T) {
+	directory := testfiles.Write(t, map[string]string{"a.bir": "", "b.bir": ""})
+	chain := []string{directory + "/main.bir", directory + "/a.bir", directory + "/b.bir"}
+
+	if err := importer.Cycle(chain, "./c.bir", directory+"/c.bir"); err != nil {
+		t.Errorf("got %v for a file out of the chain", err)
+	}
+	err := importer.Cycle(chain, "./a.bir", directory+"/lib/../a.bir")
+	want := "Import './a.bir' forms a cycle, " + directory + "/a.bir -> " + directory + "/b.bir -> " + directory + "/lib/../a.bir"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+	if importer.Key(directory+"/lib/../a.bir") != importer.Key(directory+"/a.bir") {
+		t.Errorf("a module reached by two paths has two keys")
+	}
+}
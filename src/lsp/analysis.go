@@ -0,0 +1,625 @@
+package lsp
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/importer"
+	"github.com/canpacis/birlang/src/parser"
+	"github.com/canpacis/birlang/src/resolver"
+	"github.com/canpacis/birlang/std"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Symbol is a name in a document that points to a declaration, the declaration may live in another file
+type Symbol struct {
+	Range  Range
+	URI    string
+	Target Range
+	Node   ast.Node
+}
+
+type Block struct {
+	Name        string
+	URI         string
+	Declaration *ast.BlockDeclarationStatement
+}
+
+// Namespace is a namespace of the document or of the files it uses, nested namespaces are kept by their
+// qualified names like 'codes.http'
+type Namespace struct {
+	Name        string
+	URI         string
+	Declaration *ast.NamespaceDeclarationStatement
+	Members     map[string]*ast.VariableDeclarationStatement
+	Blocks      map[string]*ast.BlockDeclarationStatement
+}
+
+// Document is the result of analyzing a file without running it
+type Document struct {
+	URI         string
+	Path        string
+	Text        string
+	Program     *ast.Program
+	Diagnostics []Diagnostic
+	Symbols     []Symbol
+	Blocks      []Block
+	Namespaces  map[string]*Namespace
+	// implementing blocks of the imported files, they are not resolved so their targets are found by name
+	imported map[string][]*ast.BlockDeclarationStatement
+	// aliased imports by their alias, their variables are read as 'alias.name'
+	modules map[string]module
+}
+
+type module struct {
+	uri   string
+	scope *resolver.Scope
+}
+
+// Analyzer reports what the engine would find wrong with a file before it runs, imports are parsed
+// but never executed
+type Analyzer struct {
+	// StdPath is the directory 'std:' imports are read from, the embedded library when it is empty
+	StdPath string
+	// SearchPaths are the directories 'module:' imports are looked up in when they are not next to the file
+	SearchPaths []string
+	// Read returns the contents of a file, open documents are read from the editor instead of the disk
+	Read func(file_path string) (string, error)
+}
+
+// StdScheme is the scheme of the uris of the embedded modules of the standard library, they are not files
+// on the disk
+const StdScheme = "bir-std"
+
+func URIToPath(uri string) string {
+	if strings.HasPrefix(uri, StdScheme+":") {
+		return std.Root + "/" + strings.TrimPrefix(uri, StdScheme+":")
+	}
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return strings.TrimPrefix(uri, "file://")
+	}
+	return parsed.Path
+}
+
+func PathToURI(file_path string) string {
+	if std.Embedded(file_path) {
+		return StdScheme + ":" + strings.TrimPrefix(file_path, std.Root+"/")
+	}
+	return (&url.URL{Scheme: "file", Path: file_path}).String()
+}
+
+func toPosition(position ast.Position) Position {
+	result := Position{Line: int(position.Line) - 1, Character: int(position.Col) - 1}
+	if result.Line < 0 {
+		result.Line = 0
+	}
+	if result.Character < 0 {
+		result.Character = 0
+	}
+	return result
+}
+
+func nameRange(position ast.Position, name string) Range {
+	start := toPosition(position)
+	return Range{Start: start, End: Position{Line: start.Line, Character: start.Character + len([]rune(name))}}
+}
+
+func contains(r Range, position Position) bool {
+	if position.Line != r.Start.Line {
+		return false
+	}
+	return position.Character >= r.Start.Character && position.Character <= r.End.Character
+}
+
+// wordRange covers the identifier that starts at a position, diagnostics use it to underline a name
+func wordRange(lines []string, position ast.Position) Range {
+	start := toPosition(position)
+	end := Position{Line: start.Line, Character: start.Character + 1}
+
+	if start.Line < len(lines) {
+		line := []rune(lines[start.Line])
+		character := start.Character
+		for character < len(line) && isIdentifier(line[character]) {
+			character++
+		}
+		if character > start.Character {
+			end.Character = character
+		}
+	}
+	return Range{Start: start, End: end}
+}
+
+func isIdentifier(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+func parse(content string) (*ast.Program, *ast.ErrorContent) {
+	result := parser.Parse(content)
+
+	if result.Error {
+		error_content := ast.ErrorContent{}
+		mapstructure.Decode(result.Content, &error_content)
+		return nil, &error_content
+	}
+
+	program, err := ast.Decode(result.Content)
+	if err != nil {
+		decode_error := err.(ast.DecodeError)
+		return nil, &ast.ErrorContent{Message: decode_error.Message, Position: decode_error.Position}
+	}
+	return program, nil
+}
+
+func (analyzer Analyzer) read(file_path string) (string, error) {
+	if std.Embedded(file_path) {
+		raw, err := std.ReadFile(file_path)
+		return string(raw), err
+	}
+	if analyzer.Read != nil {
+		return analyzer.Read(file_path)
+	}
+	raw, err := os.ReadFile(file_path)
+	return string(raw), err
+}
+
+// importPath finds the file of a use statement the way the engine does
+func (analyzer Analyzer) importPath(directory string, source string) (string, error) {
+	use_path, _, err := importer.Importer{StdPath: analyzer.StdPath, SearchPaths: analyzer.SearchPaths}.Path(directory, source)
+	return use_path, err
+}
+
+func (document *Document) report(severity int, message string, r Range) {
+	document.Diagnostics = append(document.Diagnostics, Diagnostic{Range: r, Severity: severity, Source: "bir", Message: message})
+}
+
+func (document *Document) symbol(r Range, uri string, target Range, node ast.Node) {
+	document.Symbols = append(document.Symbols, Symbol{Range: r, URI: uri, Target: target, Node: node})
+}
+
+// Analyze parses a document and the files it uses, then resolves it against them
+func (analyzer Analyzer) Analyze(uri string, text string) *Document {
+	document := &Document{
+		URI:        uri,
+		Path:       URIToPath(uri),
+		Text:       text,
+		Namespaces: map[string]*Namespace{},
+		imported:   map[string][]*ast.BlockDeclarationStatement{},
+		modules:    map[string]module{},
+	}
+	lines := strings.Split(text, "\n")
+
+	program, parse_error := parse(text)
+	if parse_error != nil {
+		document.report(SeverityError, parse_error.Message, wordRange(lines, parse_error.Position))
+		return document
+	}
+	document.Program = program
+
+	locations := map[ast.Node]string{}
+	scopes := []*resolver.Scope{}
+	visited := map[string]bool{}
+	// The imports the names brought without an alias come from, two files could not bring the same name
+	owners := map[string]*ast.UseStatement{}
+	owner_paths := map[string]string{}
+	directory, _ := path.Split(document.Path)
+
+	for _, statement := range program.Imports {
+		source_range := nameRange(statement.Source.Position, "\""+statement.Source.Value+"\"")
+		use_path, err := analyzer.importPath(directory, statement.Source.Value)
+		if err != nil {
+			document.report(SeverityError, err.Error(), source_range)
+			continue
+		}
+
+		use_uri := PathToURI(use_path)
+		document.symbol(source_range, use_uri, Range{}, nil)
+
+		if err := importer.Cycle([]string{document.Path}, statement.Source.Value, use_path); err != nil {
+			document.report(SeverityError, err.Error(), source_range)
+			continue
+		}
+		imported, message := analyzer.load(document, use_path, []string{document.Path}, visited)
+		if message != "" {
+			document.report(SeverityError, message, source_range)
+		}
+		if imported == nil {
+			continue
+		}
+
+		alias := statement.Alias.Value
+		if _, ok := document.modules[alias]; ok && alias != "" {
+			document.report(SeverityError, "Could not import '"+statement.Source.Value+"' as '"+alias+"', another module is imported as '"+alias+"'", nameRange(statement.Alias.Position, alias))
+			continue
+		}
+
+		visible, err := statement.Visible(imported.Exports())
+		if err != nil {
+			import_error := err.(ast.ImportError)
+			document.report(SeverityError, import_error.Message, wordRange(lines, import_error.Position))
+			continue
+		}
+
+		if alias == "" {
+			names := []string{}
+			for name := range visible {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			conflict := ""
+			for _, name := range names {
+				if owner, ok := owners[name]; ok && owner_paths[name] != use_path && conflict == "" {
+					conflict = "Could not import '" + name + "' from '" + statement.Source.Value + "', it is already imported from '" + owner.Source.Value + "'"
+				}
+			}
+			if conflict != "" {
+				document.report(SeverityError, conflict, source_range)
+				continue
+			}
+			for _, name := range names {
+				owners[name] = statement
+				owner_paths[name] = use_path
+			}
+		}
+
+		use_scope := &resolver.Scope{Alias: alias, Exported: visible}
+		use_scope.DeclareNative("bir")
+		for _, statement := range imported.Program {
+			switch statement := statement.(type) {
+			case *ast.BlockDeclarationStatement:
+				use_scope.DeclareBlock(statement.Name.Value, statement)
+				locations[statement] = use_uri
+				if alias == "" && visible[statement.Name.Value] {
+					document.Blocks = append(document.Blocks, Block{Name: statement.Name.Value, URI: use_uri, Declaration: statement})
+				}
+			case *ast.VariableDeclarationStatement:
+				use_scope.DeclareVariable(statement.Left.Value, statement)
+				locations[statement] = use_uri
+			case *ast.NamespaceDeclarationStatement:
+				if !visible[statement.Name.Value] {
+					continue
+				}
+				if alias != "" {
+					document.namespace(statement, use_uri, alias+".")
+				} else {
+					document.namespace(statement, use_uri, "")
+				}
+			}
+		}
+		if alias != "" {
+			document.modules[alias] = module{uri: use_uri, scope: use_scope}
+		}
+		// Imports are shifted below the scopes that are already there, the last one ends up at the bottom
+		scopes = append([]*resolver.Scope{use_scope}, scopes...)
+	}
+
+	root := &resolver.Scope{}
+	root.DeclareNative("bir")
+	document.Blocks = append(document.Blocks, Block{Name: "bir"})
+	// bir test registers the assert block on the engines of test files
+	if strings.HasSuffix(uri, "_test.bir") {
+		root.DeclareNative("assert")
+		document.Blocks = append(document.Blocks, Block{Name: "assert"})
+	}
+	for _, statement := range program.Program {
+		switch statement := statement.(type) {
+		case *ast.BlockDeclarationStatement:
+			document.Blocks = append(document.Blocks, Block{Name: statement.Name.Value, URI: uri, Declaration: statement})
+			document.symbol(nameRange(statement.Name.Position, statement.Name.Value), uri, nameRange(statement.Name.Position, statement.Name.Value), statement)
+		}
+	}
+
+	r := &resolver.Resolver{Scopes: append(scopes, root)}
+	// Namespaces of the imported files are known before the document is resolved, its own namespaces
+	// are declared by the resolver as it reaches them
+	for name, namespace := range document.Namespaces {
+		s := &resolver.Scope{}
+		for member_name, member := range namespace.Members {
+			s.DeclareVariable(member_name, member)
+			locations[member] = namespace.URI
+		}
+		for block_name, block := range namespace.Blocks {
+			s.DeclareBlock(block_name, block)
+			locations[block] = namespace.URI
+		}
+		locations[namespace.Declaration] = namespace.URI
+		r.DeclareNamespace(name, &resolver.Namespace{Scope: s, Declaration: namespace.Declaration})
+	}
+	for _, statement := range program.Program {
+		if statement, ok := statement.(*ast.NamespaceDeclarationStatement); ok {
+			document.namespace(statement, uri, "")
+		}
+	}
+	for _, err := range r.Resolve(program.Program) {
+		document.report(SeverityError, err.Message, wordRange(lines, err.Position))
+	}
+
+	implemented := map[*ast.BlockDeclarationStatement]*ast.BlockDeclarationStatement{}
+	for _, reference := range r.References {
+		if declaration, ok := reference.Node.(*ast.BlockDeclarationStatement); ok {
+			if target, ok := reference.Declaration.(*ast.BlockDeclarationStatement); ok {
+				implemented[declaration] = target
+			}
+		}
+	}
+
+	for _, reference := range r.References {
+		declaration_uri, ok := locations[reference.Declaration]
+		if !ok {
+			declaration_uri = uri
+		}
+
+		name := reference.Name
+		if expression, ok := reference.Node.(*ast.ReferenceExpression); ok && expression.Negative {
+			name = "-" + name
+		}
+		if reference.Declaration != nil {
+			document.symbol(nameRange(reference.Position, name), declaration_uri, target(reference.Declaration), reference.Declaration)
+		}
+
+		expression, ok := reference.Node.(*ast.BlockCallExpression)
+		if !ok {
+			continue
+		}
+		block, ok := reference.Declaration.(*ast.BlockDeclarationStatement)
+		if !ok {
+			continue
+		}
+		document.arity(expression, document.implementing(block, implemented, declaration_uri), lines)
+	}
+
+	return document
+}
+
+// load parses an imported file and the files it uses, the chain holds the files that are being loaded
+// and an import back into it is reported as a cycle.
+func (analyzer Analyzer) load(document *Document, use_path string, chain []string, visited map[string]bool) (*ast.Program, string) {
+	content, err := analyzer.read(use_path)
+	if err != nil {
+		return nil, "Could not read file '" + use_path + "'"
+	}
+
+	program, parse_error := parse(content)
+	if parse_error != nil {
+		return nil, parse_error.Message + " at " + strconv.Itoa(int(parse_error.Position.Line)) + ":" + strconv.Itoa(int(parse_error.Position.Col)) + " in '" + use_path + "'"
+	}
+
+	use_uri := PathToURI(use_path)
+	for _, statement := range program.Program {
+		if statement, ok := statement.(*ast.BlockDeclarationStatement); ok {
+			document.imported[use_uri] = append(document.imported[use_uri], statement)
+		}
+	}
+
+	if visited[use_path] {
+		return program, ""
+	}
+
+	chain = append(chain, use_path)
+	directory, _ := path.Split(use_path)
+	for _, statement := range program.Imports {
+		nested_path, err := analyzer.importPath(directory, statement.Source.Value)
+		if err != nil {
+			continue
+		}
+		if err := importer.Cycle(chain, statement.Source.Value, nested_path); err != nil {
+			return program, err.Error()
+		}
+		if _, message := analyzer.load(document, nested_path, chain, visited); message != "" {
+			return program, message
+		}
+	}
+	visited[use_path] = true
+	return program, ""
+}
+
+func (document *Document) namespace(statement *ast.NamespaceDeclarationStatement, uri string, prefix string) {
+	name := prefix + statement.Name.Value
+	namespace := &Namespace{
+		Name:        name,
+		URI:         uri,
+		Declaration: statement,
+		Members:     map[string]*ast.VariableDeclarationStatement{},
+		Blocks:      map[string]*ast.BlockDeclarationStatement{},
+	}
+	for _, sub_statement := range statement.Body {
+		switch declaration := sub_statement.(type) {
+		case *ast.VariableDeclarationStatement:
+			namespace.Members[declaration.Left.Value] = declaration
+		case *ast.BlockDeclarationStatement:
+			namespace.Blocks[declaration.Name.Value] = declaration
+		case *ast.NamespaceDeclarationStatement:
+			document.namespace(declaration, uri, name+".")
+		}
+	}
+	document.Namespaces[name] = namespace
+}
+
+// implementing follows a block to the block it implements, which holds the verbs and the arguments
+func (document *Document) implementing(block *ast.BlockDeclarationStatement, implemented map[*ast.BlockDeclarationStatement]*ast.BlockDeclarationStatement, uri string) *ast.BlockDeclarationStatement {
+	seen := map[*ast.BlockDeclarationStatement]bool{}
+
+	for block != nil && block.Implementing && !seen[block] {
+		seen[block] = true
+		next, ok := implemented[block]
+		if !ok {
+			next = nil
+			for _, candidate := range document.imported[uri] {
+				if candidate.Name.Value == block.Implements.Value {
+					next = candidate
+				}
+			}
+		}
+		block = next
+	}
+	if block != nil && block.Implementing {
+		return nil
+	}
+	return block
+}
+
+// arity reports the calls PushArguments and PushVerbs would warn about
+func (document *Document) arity(expression *ast.BlockCallExpression, block *ast.BlockDeclarationStatement, lines []string) {
+	if block == nil || block.Native {
+		return
+	}
+
+	position := wordRange(lines, expression.Position)
+	if len(expression.Arguments) != len(block.Arguments) {
+		document.report(SeverityWarning, "Expected "+strconv.Itoa(len(block.Arguments))+" argument(s), found "+strconv.Itoa(len(expression.Arguments))+" while calling '"+expression.Name.Value+"'", position)
+	}
+	if len(expression.Verbs) != len(block.Verbs) {
+		document.report(SeverityWarning, "Expected "+strconv.Itoa(len(block.Verbs))+" verb(s), found "+strconv.Itoa(len(expression.Verbs))+" while calling '"+expression.Name.Value+"'", position)
+	}
+}
+
+// target is the range of the name a declaration introduces
+func target(node ast.Node) Range {
+	switch node := node.(type) {
+	case *ast.BlockDeclarationStatement:
+		return nameRange(node.Name.Position, node.Name.Value)
+	case *ast.VariableDeclarationStatement:
+		return nameRange(node.Left.Position, node.Left.Value)
+	case *ast.NamespaceDeclarationStatement:
+		return nameRange(node.Name.Position, node.Name.Value)
+	case *ast.Identifier:
+		return nameRange(node.Position, node.Value)
+	case *ast.ForStatement:
+		return nameRange(node.Position, "for")
+	}
+	return Range{}
+}
+
+// SymbolAt finds the symbol under a position
+func (document *Document) SymbolAt(position Position) *Symbol {
+	for i := range document.Symbols {
+		if contains(document.Symbols[i].Range, position) {
+			return &document.Symbols[i]
+		}
+	}
+	return nil
+}
+
+// Describe renders the declaration of a symbol for hovers, blocks show their verbs, their arguments
+// and the locals of their init body
+func Describe(node ast.Node) string {
+	switch node := node.(type) {
+	case *ast.BlockDeclarationStatement:
+		if node.Implementing {
+			return node.Name.Value + " implements " + node.Implements.Value
+		}
+
+		result := node.Name.Value
+		for _, verb := range node.Verbs {
+			result += ":" + verb.Value
+		}
+		arguments := []string{}
+		for _, argument := range node.Arguments {
+			arguments = append(arguments, argument.Value)
+		}
+		result += " [" + strings.Join(arguments, ", ") + "]"
+
+		if node.Body != nil && len(node.Body.Init) > 0 {
+			locals := []string{}
+			for _, statement := range node.Body.Init {
+				if declaration, ok := statement.(*ast.VariableDeclarationStatement); ok {
+					locals = append(locals, "  "+Describe(declaration))
+				}
+			}
+			result += "\n\ninit {\n" + strings.Join(locals, "\n") + "\n}"
+		}
+		return result
+	case *ast.VariableDeclarationStatement:
+		return node.Kind + " " + node.Left.Value + " = " + format(node.Right)
+	case *ast.NamespaceDeclarationStatement:
+		return "namespace " + node.Name.Value
+	case *ast.Identifier:
+		return node.Value
+	case *ast.ForStatement:
+		return "for ... as " + node.Placeholder
+	}
+	return ""
+}
+
+func format(expression ast.Expression) string {
+	switch expression := expression.(type) {
+	case *ast.IntPrimitiveExpression:
+		return strconv.Itoa(int(expression.Value))
+	case *ast.ReferenceExpression:
+		if expression.Negative {
+			return "-" + expression.Value
+		}
+		return expression.Value
+	case *ast.NamespaceIndexerExpression:
+		return expression.Namespace.Value + "." + expression.Index.Value
+	case *ast.BlockCallExpression:
+		return expression.Name.Value + " (...)"
+	}
+	return "..."
+}
+
+var member_prefix = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*)\.[A-Za-z0-9_]*$`)
+
+// Complete lists the names that can be written at a position, members, blocks and nested namespaces of
+// a namespace after 'ns.' and the blocks and the top level namespaces of the document otherwise
+func (document *Document) Complete(position Position) []CompletionItem {
+	items := []CompletionItem{}
+	lines := strings.Split(document.Text, "\n")
+
+	prefix := ""
+	if position.Line < len(lines) {
+		line := []rune(lines[position.Line])
+		if position.Character <= len(line) {
+			prefix = string(line[:position.Character])
+		}
+	}
+
+	if match := member_prefix.FindStringSubmatch(prefix); match != nil {
+		if namespace, ok := document.Namespaces[match[1]]; ok {
+			for name, member := range namespace.Members {
+				items = append(items, CompletionItem{Label: name, Kind: CompletionConstant, Detail: Describe(member)})
+			}
+			for name, block := range namespace.Blocks {
+				items = append(items, CompletionItem{Label: name, Kind: CompletionFunction, Detail: strings.Split(Describe(block), "\n")[0]})
+			}
+			for name := range document.Namespaces {
+				if strings.HasPrefix(name, match[1]+".") && !strings.Contains(name[len(match[1])+1:], ".") {
+					items = append(items, CompletionItem{Label: name[len(match[1])+1:], Kind: CompletionModule, Detail: "namespace " + name})
+				}
+			}
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+		return items
+	}
+
+	seen := map[string]bool{}
+	for _, block := range document.Blocks {
+		if seen[block.Name] {
+			continue
+		}
+		seen[block.Name] = true
+
+		detail := "native block"
+		if block.Declaration != nil {
+			detail = strings.Split(Describe(block.Declaration), "\n")[0]
+		}
+		items = append(items, CompletionItem{Label: block.Name, Kind: CompletionFunction, Detail: detail})
+	}
+	namespaces := []string{}
+	for name := range document.Namespaces {
+		if !strings.Contains(name, ".") {
+			namespaces = append(namespaces, name)
+		}
+	}
+	sort.Strings(namespaces)
+	for _, name := range namespaces {
+		items = append(items, CompletionItem{Label: name, Kind: CompletionModule, Detail: "namespace " + name})
+	}
+	return items
+}
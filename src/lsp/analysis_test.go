@@ -0,0 +1,164 @@
+package lsp
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/canpacis/birlang/internal/testfiles"
+)
+
+// analyze writes the files of a test in a directory of their own and analyzes main.bir
+func analyze(t *testing.T, files map[string]string) *Document {
+	t.Helper()
+	directory := testfiles.Write(t, files)
+	return Analyzer{}.Analyze(PathToURI(directory+"/main.bir"), files["main.bir"])
+}
+
+func messages(document *Document) []string {
+	result := []string{}
+	for _, diagnostic := range document.Diagnostics {
+		result = append(result, diagnostic.Message)
+	}
+	return result
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		messages []string
+	}{
+		{"clean", map[string]string{"main.bir": "let a = 1\nf [n] { return n + a }\nf (2)\n"}, []string{}},
+		{"parse error", map[string]string{"main.bir": "let a = \n"}, nil},
+		{"undefined variable", map[string]string{"main.bir": "let a = b\n"}, []string{"Could not find variable 'b' in the frame"}},
+		{"missing import", map[string]string{"main.bir": "use \"./lib.bir\"\n"}, []string{"Import './lib.bir' could not be found"}},
+		{"unknown prefix", map[string]string{"main.bir": "use \"web:lib\"\n"}, []string{"Unknown use prefix 'web'"}},
+		{"arity", map[string]string{"main.bir": "f:v [n] { return n }\nf (1, 2)\n"}, []string{
+			"Expected 1 argument(s), found 2 while calling 'f'",
+			"Expected 1 verb(s), found 0 while calling 'f'",
+		}},
+		{"hidden name", map[string]string{
+			"lib.bir":  "export a [] { return 1 }\nb [] { return 2 }\n",
+			"main.bir": "use \"./lib.bir\"\nb ()\n",
+		}, []string{"Could not find block 'b'"}},
+		{"cycle", map[string]string{
+			"lib.bir":  "use \"./main.bir\"\n",
+			"main.bir": "use \"./lib.bir\"\n",
+		}, nil},
+	}
+
+	for _, test := range tests {
+		document := analyze(t, test.files)
+		got := messages(document)
+		if test.messages == nil {
+			if len(got) != 1 {
+				t.Errorf("%s: got %q, want a single error", test.name, got)
+			}
+			continue
+		}
+		if strings.Join(got, "\n") != strings.Join(test.messages, "\n") {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.messages)
+		}
+	}
+}
+
+func TestImportedNamespaces(t *testing.T) {
+	lib := "export namespace codes {\n  let ok = 200\n  namespace http {\n    let found = 302\n  }\n}\nnamespace hidden {\n  let a = 1\n}\nexport square [n] { return n * n }\n"
+	tests := []struct {
+		name       string
+		main       string
+		namespaces []string
+	}{
+		{"plain", "use \"./lib.bir\"\n", []string{"codes", "codes.http"}},
+		{"alias", "use \"./lib.bir\" as m\n", []string{"m.codes", "m.codes.http"}},
+		{"selective", "use \"./lib.bir\" { square }\n", []string{}},
+	}
+
+	for _, test := range tests {
+		document := analyze(t, map[string]string{"lib.bir": lib, "main.bir": test.main})
+		if len(document.Diagnostics) != 0 {
+			t.Errorf("%s: unexpected diagnostics %q", test.name, messages(document))
+		}
+		got := []string{}
+		for name := range document.Namespaces {
+			got = append(got, name)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(test.namespaces, ",") {
+			t.Errorf("%s: got namespaces %q, want %q", test.name, got, test.namespaces)
+		}
+	}
+
+	document := analyze(t, map[string]string{"lib.bir": lib, "main.bir": "use \"./lib.bir\" as m\nlet a = m.codes.http.found\nlet b = m.hidden.a\n"})
+	if got := messages(document); len(got) != 1 || !strings.Contains(got[0], "hidden") {
+		t.Errorf("got %q, want the private namespace to be unknown", got)
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	text := "let limit = 10\ndouble [n] {\n  return n * 2\n}\nlet a = double (limit)\n"
+	document := analyze(t, map[string]string{"main.bir": text})
+
+	tests := []struct {
+		position    Position
+		description string
+		target      Range
+	}{
+		{Position{Line: 4, Character: 9}, "double [n]", Range{Start: Position{Line: 1, Character: 0}, End: Position{Line: 1, Character: 6}}},
+		{Position{Line: 4, Character: 17}, "let limit = 10", Range{Start: Position{Line: 0, Character: 4}, End: Position{Line: 0, Character: 9}}},
+		{Position{Line: 2, Character: 9}, "n", Range{Start: Position{Line: 1, Character: 8}, End: Position{Line: 1, Character: 9}}},
+	}
+	for _, test := range tests {
+		symbol := document.SymbolAt(test.position)
+		if symbol == nil {
+			t.Errorf("%v: no symbol", test.position)
+			continue
+		}
+		if description := Describe(symbol.Node); description != test.description {
+			t.Errorf("%v: got %q, want %q", test.position, description, test.description)
+		}
+		if symbol.URI != document.URI || symbol.Target != test.target {
+			t.Errorf("%v: got %s %v, want %v", test.position, symbol.URI, symbol.Target, test.target)
+		}
+	}
+	if symbol := document.SymbolAt(Position{Line: 3, Character: 0}); symbol != nil {
+		t.Errorf("got a symbol on a closing brace")
+	}
+}
+
+func TestStdURI(t *testing.T) {
+	document := analyze(t, map[string]string{"main.bir": "use \"std:util\"\n"})
+	if len(document.Diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics %q", messages(document))
+	}
+	symbol := document.SymbolAt(Position{Line: 0, Character: 6})
+	if symbol == nil {
+		t.Fatalf("no symbol on the use statement")
+	}
+	if symbol.URI != "bir-std:util.bir" {
+		t.Errorf("got %s, want bir-std:util.bir", symbol.URI)
+	}
+	if file_path := URIToPath(symbol.URI); file_path != "[std]/util.bir" {
+		t.Errorf("got %s, want [std]/util.bir", file_path)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	text := "namespace codes {\n  let ok = 200\n  namespace http {\n    let found = 302\n  }\n  check [n] { return n }\n}\nsquare [n] { return n * n }\nlet a = codes.ok\n"
+	document := analyze(t, map[string]string{"main.bir": text})
+
+	labels := func(items []CompletionItem) string {
+		result := []string{}
+		for _, item := range items {
+			result = append(result, item.Label)
+		}
+		return strings.Join(result, ",")
+	}
+	if got := labels(document.Complete(Position{Line: 8, Character: 14})); got != "check,http,ok" {
+		t.Errorf("got %q after 'codes.', want %q", got, "check,http,ok")
+	}
+	if got := labels(document.Complete(Position{Line: 8, Character: 8})); got != "bir,square,codes" {
+		t.Errorf("got %q, want %q", got, "bir,square,codes")
+	}
+}
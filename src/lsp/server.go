@@ -0,0 +1,194 @@
+// Package lsp serves bir files to editors over the language server protocol
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/canpacis/birlang/src/config"
+	"github.com/canpacis/birlang/src/framing"
+)
+
+// Server keeps the documents an editor has opened and answers its requests about them
+type Server struct {
+	Analyzer  Analyzer
+	documents map[string]*Document
+	shutdown  bool
+	output    io.Writer
+	lock      sync.Mutex
+}
+
+// NewServer creates a server whose analyzer follows the settings of a config, a nil config leaves the
+// defaults
+func NewServer(settings *config.Config) *Server {
+	server := &Server{documents: map[string]*Document{}}
+	server.Analyzer = Analyzer{Read: server.read}
+	if settings != nil {
+		if settings.StdPath != nil {
+			server.Analyzer.StdPath = *settings.StdPath
+		}
+		server.Analyzer.SearchPaths = settings.SearchPaths
+	}
+	return server
+}
+
+// read prefers the text of an open document over the file on the disk
+func (server *Server) read(file_path string) (string, error) {
+	if document, ok := server.documents[PathToURI(file_path)]; ok {
+		return document.Text, nil
+	}
+	raw, err := os.ReadFile(file_path)
+	return string(raw), err
+}
+
+// Serve answers messages until the client sends 'exit', the returned error is nil only when the client
+// asked for a shutdown first
+func (server *Server) Serve(input io.Reader, output io.Writer) error {
+	server.output = output
+	reader := bufio.NewReader(input)
+
+	for {
+		message := &Message{}
+		err := framing.Read(reader, message)
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			server.respondError(nil, ParseError, err.Error())
+			return err
+		}
+
+		if message.Method == "exit" {
+			if server.shutdown {
+				return nil
+			}
+			return io.ErrUnexpectedEOF
+		}
+		server.handle(message)
+	}
+}
+
+func (server *Server) send(value interface{}) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	framing.Write(server.output, value)
+}
+
+func (server *Server) respond(id json.RawMessage, result interface{}) {
+	server.send(map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": result})
+}
+
+func (server *Server) respondError(id json.RawMessage, code int, message string) {
+	server.send(map[string]interface{}{"jsonrpc": "2.0", "id": id, "error": ResponseError{Code: code, Message: message}})
+}
+
+func (server *Server) notify(method string, params interface{}) {
+	server.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (server *Server) handle(message *Message) {
+	switch message.Method {
+	case "initialize":
+		server.respond(message.ID, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   TextDocumentSyncAll,
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{"."}},
+			},
+			"serverInfo": map[string]interface{}{"name": "bir"},
+		})
+	case "initialized", "$/cancelRequest", "$/setTrace":
+	case "shutdown":
+		server.shutdown = true
+		server.respond(message.ID, nil)
+	case "textDocument/didOpen":
+		params := DidOpenTextDocumentParams{}
+		if json.Unmarshal(message.Params, &params) == nil {
+			server.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		params := DidChangeTextDocumentParams{}
+		if json.Unmarshal(message.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			server.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		params := DidCloseTextDocumentParams{}
+		if json.Unmarshal(message.Params, &params) == nil {
+			delete(server.documents, params.TextDocument.URI)
+			server.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		}
+	case "textDocument/hover":
+		document, params, ok := server.document(message)
+		if !ok {
+			return
+		}
+		symbol := document.SymbolAt(params.Position)
+		if symbol == nil || symbol.Node == nil {
+			server.respond(message.ID, nil)
+			return
+		}
+		server.respond(message.ID, Hover{
+			Contents: MarkupContent{Kind: "markdown", Value: "```bir\n" + Describe(symbol.Node) + "\n```"},
+			Range:    &symbol.Range,
+		})
+	case "textDocument/definition":
+		document, params, ok := server.document(message)
+		if !ok {
+			return
+		}
+		symbol := document.SymbolAt(params.Position)
+		if symbol == nil || symbol.URI == "" {
+			server.respond(message.ID, nil)
+			return
+		}
+		server.respond(message.ID, Location{URI: symbol.URI, Range: symbol.Target})
+	case "textDocument/completion":
+		document, params, ok := server.document(message)
+		if !ok {
+			return
+		}
+		server.respond(message.ID, document.Complete(params.Position))
+	default:
+		if message.ID != nil {
+			server.respondError(message.ID, MethodNotFound, "Method '"+message.Method+"' is not supported")
+		}
+	}
+}
+
+// document finds the document a positional request is about, the request is answered with an error
+// when it could not be
+func (server *Server) document(message *Message) (*Document, TextDocumentPositionParams, bool) {
+	params := TextDocumentPositionParams{}
+	if err := json.Unmarshal(message.Params, &params); err != nil {
+		server.respondError(message.ID, InvalidParams, err.Error())
+		return nil, params, false
+	}
+
+	document, ok := server.documents[params.TextDocument.URI]
+	if !ok {
+		server.respond(message.ID, nil)
+		return nil, params, false
+	}
+	return document, params, true
+}
+
+// update analyzes a new version of a document and publishes its diagnostics. A document that does not
+// parse keeps the names of its last version so that completion still works while it is being typed.
+func (server *Server) update(uri string, text string) {
+	document := server.Analyzer.Analyze(uri, text)
+
+	if previous, ok := server.documents[uri]; ok && document.Program == nil {
+		document.Blocks = previous.Blocks
+		document.Namespaces = previous.Namespaces
+	}
+	server.documents[uri] = document
+
+	diagnostics := document.Diagnostics
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	server.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
@@ -0,0 +1,123 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/canpacis/birlang/src/config"
+	"github.com/canpacis/birlang/src/framing"
+)
+
+// reply is a message of the server, a response or a notification
+type reply struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *ResponseError  `json:"error"`
+}
+
+// serve frames the messages of a client, serves them and reads back every message of the server
+func serve(t *testing.T, requests ...map[string]interface{}) ([]reply, error) {
+	t.Helper()
+	input := &bytes.Buffer{}
+	for _, request := range requests {
+		request["jsonrpc"] = "2.0"
+		if err := framing.Write(input, request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output := &bytes.Buffer{}
+	err := NewServer(nil).Serve(input, output)
+
+	replies := []reply{}
+	reader := bufio.NewReader(output)
+	for {
+		message := reply{}
+		read_error := framing.Read(reader, &message)
+		if read_error == io.EOF {
+			break
+		} else if read_error != nil {
+			t.Fatal(read_error)
+		}
+		replies = append(replies, message)
+	}
+	return replies, err
+}
+
+func TestServe(t *testing.T) {
+	uri := "file:///tmp/bir-lsp-test/main.bir"
+	position := func(id int, method string, line int, character int) map[string]interface{} {
+		return map[string]interface{}{"id": id, "method": method, "params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri},
+			"position":     map[string]interface{}{"line": line, "character": character},
+		}}
+	}
+
+	replies, err := serve(t,
+		map[string]interface{}{"id": 1, "method": "initialize", "params": map[string]interface{}{}},
+		map[string]interface{}{"method": "initialized"},
+		map[string]interface{}{"method": "textDocument/didOpen", "params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "text": "double [n] {\n  return n * 2\n}\nlet a = double (b)\n"},
+		}},
+		position(2, "textDocument/hover", 3, 9),
+		position(3, "textDocument/definition", 3, 9),
+		position(4, "textDocument/hover", 3, 4),
+		map[string]interface{}{"id": 5, "method": "workspace/symbol"},
+		map[string]interface{}{"id": 6, "method": "shutdown"},
+		map[string]interface{}{"method": "exit"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(replies) != 7 {
+		t.Fatalf("got %d replies, want 7", len(replies))
+	}
+
+	diagnostics := PublishDiagnosticsParams{}
+	json.Unmarshal(replies[1].Params, &diagnostics)
+	if replies[1].Method != "textDocument/publishDiagnostics" || len(diagnostics.Diagnostics) != 1 || diagnostics.Diagnostics[0].Message != "Could not find variable 'b' in the frame" {
+		t.Errorf("got %s %s, want the undefined variable to be reported", replies[1].Method, replies[1].Params)
+	}
+
+	hover := Hover{}
+	json.Unmarshal(replies[2].Result, &hover)
+	if hover.Contents.Value != "```bir\ndouble [n]\n```" {
+		t.Errorf("got hover %q", hover.Contents.Value)
+	}
+	location := Location{}
+	json.Unmarshal(replies[3].Result, &location)
+	if location.URI != uri || location.Range.Start != (Position{Line: 0, Character: 0}) {
+		t.Errorf("got definition %s", replies[3].Result)
+	}
+	if string(replies[4].Result) != "null" {
+		t.Errorf("got hover %s on a name that declares nothing", replies[4].Result)
+	}
+	if replies[5].Error == nil || replies[5].Error.Code != MethodNotFound {
+		t.Errorf("got %s, want an unsupported method", replies[5].Result)
+	}
+}
+
+func TestServeExit(t *testing.T) {
+	if _, err := serve(t, map[string]interface{}{"method": "exit"}); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, an exit without a shutdown should fail", err)
+	}
+	if _, err := serve(t, map[string]interface{}{"id": 1, "method": "shutdown"}); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, a closed input should fail", err)
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	std_path := "/opt/std"
+	server := NewServer(&config.Config{StdPath: &std_path, SearchPaths: []string{"/opt/modules"}})
+	if server.Analyzer.StdPath != std_path || len(server.Analyzer.SearchPaths) != 1 || server.Analyzer.SearchPaths[0] != "/opt/modules" {
+		t.Errorf("got %+v, want the analyzer to follow the config", server.Analyzer)
+	}
+	if server := NewServer(nil); server.Analyzer.StdPath != "" || server.Analyzer.Read == nil {
+		t.Errorf("got %+v, want the defaults", server.Analyzer)
+	}
+}
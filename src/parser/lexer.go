@@ -0,0 +1,224 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/canpacis/birlang/src/ast"
+)
+
+type TokenKind int
+
+const (
+	TokenEOF TokenKind = iota
+	TokenIdentifier
+	TokenNumber
+	TokenString
+	TokenPunctuation
+	TokenComment
+)
+
+type Token struct {
+	Kind     TokenKind    `json:"kind"`
+	Value    string       `json:"value"`
+	Position ast.Position `json:"position"`
+	Newline  bool         `json:"newline"`
+}
+
+type LexErrorKind int
+
+const (
+	LexUnexpectedCharacter LexErrorKind = iota
+	LexUnterminatedComment
+	LexUnterminatedString
+	LexUnknownEscape
+)
+
+type LexError struct {
+	Kind     LexErrorKind
+	Message  string
+	Position ast.Position
+}
+
+func (err LexError) Error() string {
+	return err.Message
+}
+
+// Longest operators come first so that the lexer always picks the longest match
+var punctuations = []string{
+	"!==", "!<=", "!>=",
+	"==", "!=", "<=", ">=", "!<", "!>", "++", "--", "+=", "-=", "*=", "/=",
+	"+", "-", "*", "/", "%", "^", "<", ">", "=",
+	"{", "}", "[", "]", "(", ")", ":", ",", ".",
+}
+
+type Lexer struct {
+	input   []rune
+	offset  int
+	line    uint32
+	col     uint32
+	newline bool
+}
+
+func NewLexer(input string) *Lexer {
+	return &Lexer{input: []rune(input), line: 1, col: 1, newline: true}
+}
+
+func (lexer *Lexer) peek(n int) rune {
+	if lexer.offset+n < len(lexer.input) {
+		return lexer.input[lexer.offset+n]
+	}
+	return 0
+}
+
+func (lexer *Lexer) advance() rune {
+	r := lexer.input[lexer.offset]
+	lexer.offset++
+	if r == '\n' {
+		lexer.line++
+		lexer.col = 1
+		lexer.newline = true
+	} else {
+		lexer.col++
+	}
+	return r
+}
+
+func (lexer *Lexer) position() ast.Position {
+	return ast.Position{Line: lexer.line, Col: lexer.col}
+}
+
+func (lexer *Lexer) Tokenize() ([]Token, error) {
+	tokens := []Token{}
+
+	for {
+		token, err := lexer.Next()
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+		if token.Kind == TokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (lexer *Lexer) Next() (Token, error) {
+	for lexer.offset < len(lexer.input) && unicode.IsSpace(lexer.peek(0)) {
+		lexer.advance()
+	}
+
+	newline := lexer.newline
+	lexer.newline = false
+	position := lexer.position()
+	token := Token{Position: position, Newline: newline}
+
+	if lexer.offset >= len(lexer.input) {
+		token.Kind = TokenEOF
+		return token, nil
+	}
+
+	r := lexer.peek(0)
+	switch {
+	case r == '/' && lexer.peek(1) == '/':
+		start := lexer.offset
+		for lexer.offset < len(lexer.input) && lexer.peek(0) != '\n' {
+			lexer.advance()
+		}
+		token.Kind = TokenComment
+		token.Value = strings.TrimSpace(string(lexer.input[start+2 : lexer.offset]))
+		return token, nil
+	case r == '/' && lexer.peek(1) == '*':
+		lexer.advance()
+		lexer.advance()
+		start := lexer.offset
+		for !(lexer.peek(0) == '*' && lexer.peek(1) == '/') {
+			if lexer.offset >= len(lexer.input) {
+				return token, LexError{Kind: LexUnterminatedComment, Message: "Unterminated comment", Position: position}
+			}
+			lexer.advance()
+		}
+		token.Kind = TokenComment
+		token.Value = strings.TrimSpace(string(lexer.input[start:lexer.offset]))
+		lexer.advance()
+		lexer.advance()
+		// A block comment keeps the newline flag of the line it started on
+		lexer.newline = newline
+		return token, nil
+	case r == '_' || unicode.IsLetter(r):
+		start := lexer.offset
+		for lexer.offset < len(lexer.input) && (lexer.peek(0) == '_' || unicode.IsLetter(lexer.peek(0)) || unicode.IsDigit(lexer.peek(0))) {
+			lexer.advance()
+		}
+		token.Kind = TokenIdentifier
+		token.Value = string(lexer.input[start:lexer.offset])
+		return token, nil
+	case unicode.IsDigit(r):
+		start := lexer.offset
+		for lexer.offset < len(lexer.input) && unicode.IsDigit(lexer.peek(0)) {
+			lexer.advance()
+		}
+		token.Kind = TokenNumber
+		token.Value = string(lexer.input[start:lexer.offset])
+		return token, nil
+	case r == '"':
+		lexer.advance()
+		var builder strings.Builder
+		for {
+			if lexer.offset >= len(lexer.input) || lexer.peek(0) == '\n' {
+				return token, LexError{Kind: LexUnterminatedString, Message: "Unterminated string", Position: position}
+			}
+			c := lexer.advance()
+			if c == '"' {
+				break
+			}
+			if c == '\\' {
+				if lexer.offset >= len(lexer.input) {
+					return token, LexError{Kind: LexUnterminatedString, Message: "Unterminated string", Position: position}
+				}
+				escaped := lexer.advance()
+				switch escaped {
+				case 'n':
+					builder.WriteRune('\n')
+				case 't':
+					builder.WriteRune('\t')
+				case 'r':
+					builder.WriteRune('\r')
+				case '0':
+					builder.WriteRune(0)
+				case '"', '\\':
+					builder.WriteRune(escaped)
+				default:
+					return token, LexError{Kind: LexUnknownEscape, Message: "Unknown escape sequence '\\" + string(escaped) + "'", Position: position}
+				}
+				continue
+			}
+			builder.WriteRune(c)
+		}
+		token.Kind = TokenString
+		token.Value = builder.String()
+		return token, nil
+	}
+
+	for _, punctuation := range punctuations {
+		if lexer.matches(punctuation) {
+			for range punctuation {
+				lexer.advance()
+			}
+			token.Kind = TokenPunctuation
+			token.Value = punctuation
+			return token, nil
+		}
+	}
+
+	return token, LexError{Kind: LexUnexpectedCharacter, Message: "Unexpected character '" + string(r) + "'", Position: position}
+}
+
+func (lexer *Lexer) matches(value string) bool {
+	for i, r := range []rune(value) {
+		if lexer.peek(i) != r {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,942 @@
+package parser
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/canpacis/birlang/src/ast"
+)
+
+var keywords = map[string]bool{
+	"use":        true,
+	"export":     true,
+	"let":        true,
+	"const":      true,
+	"local":      true,
+	"namespace":  true,
+	"implements": true,
+	"init":       true,
+	"if":         true,
+	"elif":       true,
+	"else":       true,
+	"for":        true,
+	"as":         true,
+	"while":      true,
+	"switch":     true,
+	"case":       true,
+	"default":    true,
+	"return":     true,
+	"throw":      true,
+	"log":        true,
+	"root":       true,
+}
+
+var conditions = map[string]string{
+	"==":  "equals",
+	"!=":  "not_equals",
+	"!==": "not_equals",
+	"<":   "less_than",
+	"<=":  "less_than_equals",
+	"!<":  "not_less_than",
+	"!<=": "not_less_than_equals",
+	">":   "greater_than",
+	">=":  "greater_than_equals",
+	"!>":  "not_greater_than",
+	"!>=": "not_greater_than_equals",
+}
+
+var modifiers = map[string]string{
+	"++": "increment",
+	"--": "decrement",
+	"+=": "add",
+	"-=": "subtract",
+	"*=": "multiply",
+	"/=": "divide",
+}
+
+type Parser struct {
+	tokens []Token
+	index  int
+}
+
+// A parse error unwinds the whole recursive descent, Parse recovers it and reports it as a result
+type bailout struct {
+	message  string
+	position ast.Position
+}
+
+// Incomplete tells if the input stops inside a brace, a parenthesis, a bracket or a block comment so
+// that the repl keeps reading lines before running it. Other mistakes are left for the parser to report.
+func Incomplete(content string) bool {
+	tokens, err := NewLexer(content).Tokenize()
+	if err != nil {
+		var lex_error LexError
+		return errors.As(err, &lex_error) && lex_error.Kind == LexUnterminatedComment
+	}
+
+	depth := 0
+	for _, token := range tokens {
+		if token.Kind != TokenPunctuation {
+			continue
+		}
+		switch token.Value {
+		case "{", "(", "[":
+			depth++
+		case "}", ")", "]":
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// Parse produces the same result the javascript parser used to print, a program with its imports
+// or an error with the position it occured at
+func Parse(content string) (result ast.ParserResult) {
+	tokens, err := NewLexer(content).Tokenize()
+	if err != nil {
+		lex_error := err.(LexError)
+		return errorResult(lex_error.Message, lex_error.Position)
+	}
+
+	parser := Parser{tokens: tokens}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if b, ok := r.(bailout); ok {
+				result = errorResult(b.message, b.position)
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	return ast.ParserResult{Error: false, Content: parser.ParseProgram()}
+}
+
+func errorResult(message string, position ast.Position) ast.ParserResult {
+	return ast.ParserResult{
+		Error: true,
+		Content: map[string]interface{}{
+			"message":  message,
+			"position": position,
+		},
+	}
+}
+
+func (parser *Parser) fail(message string, position ast.Position) {
+	panic(bailout{message: message, position: position})
+}
+
+// current returns the raw token under the cursor, comments included
+func (parser *Parser) current() Token {
+	return parser.tokens[parser.index]
+}
+
+// significant returns the index of the first token from the cursor on that is not a comment, peeking
+// does not move the cursor so that a comment following a statement is still there to be collected
+func (parser *Parser) significant() int {
+	i := parser.index
+	for parser.tokens[i].Kind == TokenComment {
+		i++
+	}
+	return i
+}
+
+func (parser *Parser) peek() Token {
+	return parser.tokens[parser.significant()]
+}
+
+func (parser *Parser) peekAt(n int) Token {
+	i := parser.significant()
+	for n > 0 && parser.tokens[i].Kind != TokenEOF {
+		i++
+		if parser.tokens[i].Kind != TokenComment {
+			n--
+		}
+	}
+	return parser.tokens[i]
+}
+
+func (parser *Parser) next() Token {
+	parser.index = parser.significant()
+	token := parser.current()
+	if token.Kind != TokenEOF {
+		parser.index++
+	}
+	return token
+}
+
+func (parser *Parser) is(value string) bool {
+	token := parser.peek()
+	return (token.Kind == TokenPunctuation || token.Kind == TokenIdentifier) && token.Value == value
+}
+
+func (parser *Parser) accept(value string) bool {
+	if parser.is(value) {
+		parser.next()
+		return true
+	}
+	return false
+}
+
+func (parser *Parser) expect(value string) Token {
+	if !parser.is(value) {
+		parser.unexpected("'" + value + "'")
+	}
+	return parser.next()
+}
+
+func (parser *Parser) unexpected(expected string) {
+	token := parser.peek()
+	if token.Kind == TokenEOF {
+		parser.fail("Unexpected end of input, expected "+expected, token.Position)
+	}
+	parser.fail("Unexpected token '"+token.Value+"', expected "+expected, token.Position)
+}
+
+func (parser *Parser) expectIdentifier() Token {
+	token := parser.peek()
+	if token.Kind != TokenIdentifier {
+		parser.unexpected("an identifier")
+	}
+	if keywords[token.Value] {
+		parser.fail("Unexpected keyword '"+token.Value+"', expected an identifier", token.Position)
+	}
+	return parser.next()
+}
+
+func node(operation string, position ast.Position) map[string]interface{} {
+	return map[string]interface{}{
+		"operation": operation,
+		"position":  position,
+	}
+}
+
+func identifier(token Token) map[string]interface{} {
+	result := node("identifier", token.Position)
+	result["negative"] = false
+	result["value"] = token.Value
+	return result
+}
+
+func intPrimitive(value int64, position ast.Position) map[string]interface{} {
+	result := node("primitive", position)
+	result["type"] = "int"
+	result["value"] = value
+	return result
+}
+
+func (parser *Parser) ParseProgram() map[string]interface{} {
+	imports := []interface{}{}
+	program := []interface{}{}
+
+	for parser.current().Kind != TokenEOF {
+		if parser.current().Kind == TokenComment {
+			program = append(program, parser.parseComment())
+			continue
+		}
+		if parser.is("use") {
+			imports = append(imports, parser.parseUse())
+			continue
+		}
+		if parser.is("export") {
+			program = append(program, parser.parseExport())
+			continue
+		}
+		if parser.is("namespace") {
+			program = append(program, parser.parseNamespaceDeclaration())
+			continue
+		}
+		program = append(program, parser.parseStatement())
+	}
+
+	return map[string]interface{}{
+		"imports": imports,
+		"program": program,
+	}
+}
+
+func (parser *Parser) parseComment() map[string]interface{} {
+	token := parser.current()
+	parser.index++
+	result := node("comment", token.Position)
+	result["value"] = token.Value
+	return result
+}
+
+func (parser *Parser) parseUse() map[string]interface{} {
+	keyword := parser.next()
+	source := parser.peek()
+	if source.Kind != TokenString {
+		parser.unexpected("an import source string")
+	}
+	parser.next()
+
+	result := node("use_statement", keyword.Position)
+	result["source"] = parser.stringPrimitive(source)
+	result["alias"] = nil
+	result["names"] = []interface{}{}
+	if parser.accept("as") {
+		result["alias"] = identifier(parser.expectIdentifier())
+		return result
+	}
+
+	if parser.accept("{") {
+		names := []interface{}{}
+		for !parser.is("}") {
+			names = append(names, identifier(parser.expectIdentifier()))
+			if !parser.accept(",") {
+				break
+			}
+		}
+		parser.expect("}")
+		if len(names) == 0 {
+			parser.fail("Expected at least one name to import", source.Position)
+		}
+		result["names"] = names
+	}
+	return result
+}
+
+// parseExport parses a top level declaration that is visible to the files importing it
+func (parser *Parser) parseExport() map[string]interface{} {
+	keyword := parser.next()
+	token := parser.peek()
+	if token.Kind != TokenIdentifier || (keywords[token.Value] && token.Value != "let" && token.Value != "const" && token.Value != "local" && token.Value != "namespace") {
+		parser.unexpected("a variable, a block or a namespace declaration to export")
+	}
+
+	var result map[string]interface{}
+	if token.Value == "namespace" {
+		result = parser.parseNamespaceDeclaration()
+	} else {
+		result = parser.parseStatement()
+	}
+	if result["operation"] != "variable_declaration" && result["operation"] != "block_declaration" && result["operation"] != "namespace_declaration" {
+		parser.fail("Only variable, block and namespace declarations could be exported", keyword.Position)
+	}
+	result["exported"] = true
+	return result
+}
+
+func (parser *Parser) stringPrimitive(token Token) map[string]interface{} {
+	result := node("primitive", token.Position)
+	result["type"] = "string"
+	result["value"] = token.Value
+	return result
+}
+
+// parseBody parses a list of statements between curly braces
+func (parser *Parser) parseBody() []interface{} {
+	parser.expect("{")
+	body := []interface{}{}
+
+	for {
+		parser.skipUntilStatement(&body)
+		if parser.accept("}") {
+			return body
+		}
+		if parser.peek().Kind == TokenEOF {
+			parser.unexpected("'}'")
+		}
+		body = append(body, parser.parseStatement())
+	}
+}
+
+// skipUntilStatement collects comments standing between statements
+func (parser *Parser) skipUntilStatement(body *[]interface{}) {
+	for parser.current().Kind == TokenComment {
+		*body = append(*body, parser.parseComment())
+	}
+}
+
+func (parser *Parser) parseStatement() map[string]interface{} {
+	token := parser.peek()
+
+	if token.Kind == TokenPunctuation && token.Value == "[" {
+		return parser.parseScopeMutater()
+	}
+
+	if token.Kind != TokenIdentifier {
+		parser.unexpected("a statement")
+	}
+
+	switch token.Value {
+	case "let", "const", "local":
+		return parser.parseVariableDeclaration()
+	case "namespace":
+		parser.fail("Namespaces are only allowed at the top level or in namespaces", token.Position)
+	case "if":
+		return parser.parseIfStatement()
+	case "for":
+		return parser.parseForStatement()
+	case "while":
+		return parser.parseWhileStatement()
+	case "switch":
+		return parser.parseSwitchStatement()
+	case "return", "throw":
+		parser.next()
+		result := node(token.Value+"_statement", token.Position)
+		result["expression"] = parser.parseExpression()
+		return result
+	case "use":
+		parser.fail("Use statements are only allowed at the top level", token.Position)
+	case "export":
+		parser.fail("Exports are only allowed at the top level", token.Position)
+	}
+
+	if keywords[token.Value] {
+		parser.fail("Unexpected keyword '"+token.Value+"'", token.Position)
+	}
+
+	return parser.parseIdentifierStatement()
+}
+
+func (parser *Parser) parseVariableDeclaration() map[string]interface{} {
+	kind := parser.next()
+	name := parser.expectIdentifier()
+	parser.expect("=")
+
+	result := node("variable_declaration", kind.Position)
+	result["kind"] = kind.Value
+	result["left"] = identifier(name)
+	result["right"] = parser.parseExpression()
+	return result
+}
+
+func (parser *Parser) parseNamespaceDeclaration() map[string]interface{} {
+	keyword := parser.next()
+	name := parser.expectIdentifier()
+
+	result := node("namespace_declaration", keyword.Position)
+	result["name"] = identifier(name)
+
+	// Namespaces hold declarations only, nested namespaces are reached as 'outer.inner.name'
+	parser.expect("{")
+	body := []interface{}{}
+	for {
+		parser.skipUntilStatement(&body)
+		if parser.accept("}") {
+			break
+		}
+		if parser.peek().Kind == TokenEOF {
+			parser.unexpected("'}'")
+		}
+		if parser.is("namespace") {
+			body = append(body, parser.parseNamespaceDeclaration())
+			continue
+		}
+		position := parser.peek().Position
+		statement := parser.parseStatement()
+		if statement["operation"] != "variable_declaration" && statement["operation"] != "block_declaration" {
+			parser.fail("Namespaces can only contain variable, block and namespace declarations", position)
+		}
+		body = append(body, statement)
+	}
+	result["body"] = body
+	return result
+}
+
+func (parser *Parser) parseIfStatement() map[string]interface{} {
+	keyword := parser.next()
+	result := node("if_statement", keyword.Position)
+	result["condition"] = parser.parseExpression()
+	result["body"] = parser.parseBody()
+
+	elifs := []interface{}{}
+	for parser.accept("elif") {
+		elifs = append(elifs, map[string]interface{}{
+			"condition": parser.parseExpression(),
+			"body":      parser.parseBody(),
+		})
+	}
+	result["elifs"] = elifs
+
+	if parser.accept("else") {
+		result["else"] = parser.parseBody()
+	} else {
+		result["else"] = nil
+	}
+	return result
+}
+
+func (parser *Parser) parseForStatement() map[string]interface{} {
+	keyword := parser.next()
+	result := node("for_statement", keyword.Position)
+	result["statement"] = parser.parseExpression()
+	result["placeholder"] = ""
+	if parser.accept("as") {
+		result["placeholder"] = parser.expectIdentifier().Value
+	}
+	result["body"] = parser.parseBody()
+	return result
+}
+
+func (parser *Parser) parseWhileStatement() map[string]interface{} {
+	keyword := parser.next()
+	result := node("while_statement", keyword.Position)
+	result["statement"] = parser.parseExpression()
+	result["body"] = parser.parseBody()
+	return result
+}
+
+func (parser *Parser) parseSwitchStatement() map[string]interface{} {
+	keyword := parser.next()
+	result := node("switch_statement", keyword.Position)
+	result["condition"] = parser.parseExpression()
+
+	cases := []interface{}{}
+	_default := map[string]interface{}{"case": nil, "body": nil}
+
+	parser.expect("{")
+	for !parser.accept("}") {
+		switch {
+		case parser.accept("case"):
+			cases = append(cases, map[string]interface{}{
+				"case": parser.parseExpression(),
+				"body": parser.parseBody(),
+			})
+		case parser.is("default"):
+			token := parser.next()
+			if _default["body"] != nil {
+				parser.fail("Switch statements may only have one default case", token.Position)
+			}
+			_default["body"] = parser.parseBody()
+		default:
+			parser.unexpected("'case', 'default' or '}'")
+		}
+	}
+
+	result["cases"] = cases
+	result["default"] = _default
+	return result
+}
+
+func (parser *Parser) parseScopeMutater() map[string]interface{} {
+	open := parser.expect("[")
+	mutater := parser.expectIdentifier()
+
+	keyword := node("mutater_keyword", mutater.Position)
+	keyword["negative"] = false
+	keyword["value"] = mutater.Value
+
+	arguments := []interface{}{}
+	for !parser.is("]") {
+		arguments = append(arguments, parser.parseExpression())
+		if !parser.accept(",") {
+			break
+		}
+	}
+	parser.expect("]")
+
+	result := node("scope_mutater_expression", open.Position)
+	result["mutater"] = keyword
+	result["arguments"] = arguments
+	return result
+}
+
+func (parser *Parser) parseIdentifierStatement() map[string]interface{} {
+	name := parser.next()
+	operator := parser.peek()
+
+	if operator.Kind == TokenIdentifier && operator.Value == "implements" {
+		return parser.parseImplementingDeclaration(name)
+	}
+
+	if operator.Kind == TokenPunctuation {
+		switch operator.Value {
+		case "=":
+			parser.next()
+			result := node("assign_statement", name.Position)
+			result["left"] = identifier(name)
+			result["right"] = parser.parseExpression()
+			return result
+		case "++", "--", "+=", "-=", "*=", "/=":
+			parser.next()
+			reference := node("reference", name.Position)
+			reference["negative"] = false
+			reference["value"] = name.Value
+
+			result := node("quantity_modifier_statement", name.Position)
+			result["type"] = modifiers[operator.Value]
+			result["statement"] = reference
+			if operator.Value == "++" || operator.Value == "--" {
+				result["right"] = nil
+			} else {
+				result["right"] = parser.parseExpression()
+			}
+			return result
+		case ".":
+			return parser.parseNamespaceIndexer(name, true)
+		case ":", "(", "[":
+			return parser.parseBlock(name)
+		}
+	}
+
+	parser.unexpected("a statement")
+	return nil
+}
+
+// parseBlock parses either a block call or a block declaration, they share the same prefix
+// until the argument list, which is wrapped in parentheses for calls and brackets for declarations
+func (parser *Parser) parseBlock(name Token) map[string]interface{} {
+	verbs := []interface{}{}
+	for parser.accept(":") {
+		verbs = append(verbs, parser.parseUnary(false))
+	}
+
+	if parser.is("[") {
+		return parser.parseBlockDeclaration(name, verbs)
+	}
+	return parser.parseBlockCall(name, verbs)
+}
+
+func (parser *Parser) parseBlockCall(name Token, verbs []interface{}) map[string]interface{} {
+	parser.expect("(")
+	arguments := []interface{}{}
+	for !parser.is(")") {
+		arguments = append(arguments, parser.parseExpression())
+		if !parser.accept(",") {
+			break
+		}
+	}
+	parser.expect(")")
+
+	result := node("block_call", name.Position)
+	result["namespace"] = nil
+	result["name"] = identifier(name)
+	result["verbs"] = verbs
+	result["arguments"] = arguments
+	return result
+}
+
+func (parser *Parser) parseBlockDeclaration(name Token, raw_verbs []interface{}) map[string]interface{} {
+	if keywords[name.Value] {
+		parser.fail("Could not use keyword '"+name.Value+"' as a block name", name.Position)
+	}
+
+	verbs := []interface{}{}
+	for _, raw := range raw_verbs {
+		verb := raw.(map[string]interface{})
+		if verb["operation"] != "reference" || verb["negative"].(bool) {
+			parser.fail("Block verbs must be identifiers", verb["position"].(ast.Position))
+		}
+		verbs = append(verbs, identifier(Token{Value: verb["value"].(string), Position: verb["position"].(ast.Position)}))
+	}
+
+	parser.expect("[")
+	arguments := []interface{}{}
+	for !parser.is("]") {
+		arguments = append(arguments, identifier(parser.expectIdentifier()))
+		if !parser.accept(",") {
+			break
+		}
+	}
+	parser.expect("]")
+
+	result := node("block_declaration", name.Position)
+	result["owner"] = ""
+	result["name"] = identifier(name)
+	result["verbs"] = verbs
+	result["arguments"] = arguments
+	result["body"] = parser.parseBlockBody()
+	result["implementing"] = false
+	result["implements"] = nil
+	result["populate"] = []interface{}{}
+	result["instance"] = nil
+	result["native"] = false
+	return result
+}
+
+func (parser *Parser) parseBlockBody() map[string]interface{} {
+	parser.expect("{")
+	body := map[string]interface{}{"init": nil, "program": nil}
+	program := []interface{}{}
+
+	parser.skipUntilStatement(&program)
+	if parser.is("init") {
+		parser.next()
+		body["init"] = parser.parseBody()
+	}
+
+	for {
+		parser.skipUntilStatement(&program)
+		if parser.accept("}") {
+			break
+		}
+		if parser.peek().Kind == TokenEOF {
+			parser.unexpected("'}'")
+		}
+		if parser.is("init") {
+			parser.fail("Init blocks must come first in a block body", parser.peek().Position)
+		}
+		program = append(program, parser.parseStatement())
+	}
+
+	body["program"] = program
+	return body
+}
+
+func (parser *Parser) parseImplementingDeclaration(name Token) map[string]interface{} {
+	if keywords[name.Value] {
+		parser.fail("Could not use keyword '"+name.Value+"' as a block name", name.Position)
+	}
+
+	parser.expect("implements")
+	implements := parser.expectIdentifier()
+
+	populate := []interface{}{}
+	// Populations must start on the same line, otherwise they would be confused with the next statement
+	if next := parser.peek(); !next.Newline {
+		switch {
+		case next.Kind == TokenString || parser.is("["):
+			populate = append(populate, parser.parsePopulation(""))
+		case parser.is("{"):
+			parser.next()
+			for !parser.is("}") {
+				key := ""
+				if parser.peek().Kind == TokenIdentifier && parser.peekAt(1).Value == ":" {
+					key = parser.expectIdentifier().Value
+					parser.expect(":")
+				}
+				populate = append(populate, parser.parsePopulation(key))
+				if !parser.accept(",") {
+					break
+				}
+			}
+			parser.expect("}")
+		}
+	}
+
+	result := node("block_declaration", name.Position)
+	result["owner"] = ""
+	result["name"] = identifier(name)
+	result["verbs"] = []interface{}{}
+	result["arguments"] = []interface{}{}
+	result["body"] = nil
+	result["implementing"] = true
+	result["implements"] = identifier(implements)
+	result["populate"] = populate
+	result["instance"] = nil
+	result["native"] = false
+	return result
+}
+
+func (parser *Parser) parsePopulation(key string) map[string]interface{} {
+	token := parser.peek()
+	result := node("population", token.Position)
+	result["key"] = key
+
+	switch {
+	case token.Kind == TokenString:
+		parser.next()
+		result["value"] = parser.stringPrimitive(token)
+	case parser.is("["):
+		parser.next()
+		values := []interface{}{}
+		for !parser.is("]") {
+			values = append(values, parser.parseExpression())
+			if !parser.accept(",") {
+				break
+			}
+		}
+		parser.expect("]")
+
+		array := node("primitive", token.Position)
+		array["type"] = "array"
+		array["values"] = values
+		result["value"] = array
+	default:
+		parser.unexpected("a string or an array")
+	}
+
+	return result
+}
+
+// parseNamespaceIndexer parses a name that is qualified by a namespace or a module alias, the names of
+// nested namespaces are joined as in 'codes.http'. A qualified name followed by verbs or arguments is a
+// call of a block of the namespace or the module.
+func (parser *Parser) parseNamespaceIndexer(namespace Token, allow_call bool) map[string]interface{} {
+	parser.expect(".")
+	index := parser.expectIdentifier()
+	for parser.accept(".") {
+		namespace.Value += "." + index.Value
+		index = parser.expectIdentifier()
+	}
+
+	if allow_call && (parser.is(":") || parser.is("(")) {
+		verbs := []interface{}{}
+		for parser.accept(":") {
+			verbs = append(verbs, parser.parseUnary(false))
+		}
+		result := parser.parseBlockCall(index, verbs)
+		result["namespace"] = identifier(namespace)
+		result["position"] = namespace.Position
+		return result
+	}
+
+	result := node("namespace_indexer", namespace.Position)
+	result["namespace"] = identifier(namespace)
+	result["index"] = identifier(index)
+	return result
+}
+
+func (parser *Parser) parseExpression() map[string]interface{} {
+	left := parser.parseAdditive()
+
+	token := parser.peek()
+	if _type, ok := conditions[token.Value]; ok && token.Kind == TokenPunctuation {
+		parser.next()
+		result := node("condition", token.Position)
+		result["type"] = _type
+		result["left"] = left
+		result["right"] = parser.parseAdditive()
+		return result
+	}
+
+	return left
+}
+
+func arithmetic(_type string, left map[string]interface{}, right map[string]interface{}, position ast.Position) map[string]interface{} {
+	result := node("arithmetic", position)
+	result["type"] = _type
+	result["left"] = left
+	result["right"] = right
+	return result
+}
+
+func (parser *Parser) parseAdditive() map[string]interface{} {
+	left := parser.parseMultiplicative()
+
+	for {
+		token := parser.peek()
+		switch {
+		case parser.accept("+"):
+			left = arithmetic("addition", left, parser.parseMultiplicative(), token.Position)
+		case parser.accept("-"):
+			left = arithmetic("subtraction", left, parser.parseMultiplicative(), token.Position)
+		default:
+			return left
+		}
+	}
+}
+
+func (parser *Parser) parseMultiplicative() map[string]interface{} {
+	left := parser.parseExponent()
+
+	for {
+		token := parser.peek()
+		switch {
+		case parser.accept("*"):
+			left = arithmetic("multiplication", left, parser.parseExponent(), token.Position)
+		case parser.accept("/"):
+			left = arithmetic("division", left, parser.parseExponent(), token.Position)
+		case parser.accept("%"):
+			left = arithmetic("modulus", left, parser.parseExponent(), token.Position)
+		default:
+			return left
+		}
+	}
+}
+
+func (parser *Parser) parseExponent() map[string]interface{} {
+	left := parser.parsePostfix()
+	token := parser.peek()
+
+	switch {
+	case parser.accept("^"):
+		return arithmetic("exponent", left, parser.parseExponent(), token.Position)
+	case parser.accept("root"):
+		return arithmetic("root", left, parser.parseExponent(), token.Position)
+	}
+	return left
+}
+
+func (parser *Parser) parsePostfix() map[string]interface{} {
+	left := parser.parseUnary(true)
+
+	for parser.is("log") {
+		token := parser.next()
+		left = arithmetic("log10", left, intPrimitive(0, token.Position), token.Position)
+	}
+	return left
+}
+
+func (parser *Parser) parseUnary(allow_call bool) map[string]interface{} {
+	if parser.is("-") {
+		token := parser.next()
+		operand := parser.parseUnary(allow_call)
+
+		switch operand["operation"] {
+		case "reference":
+			operand["negative"] = !operand["negative"].(bool)
+			operand["position"] = token.Position
+			return operand
+		case "primitive":
+			operand["value"] = -operand["value"].(int64)
+			operand["position"] = token.Position
+			return operand
+		default:
+			return arithmetic("subtraction", intPrimitive(0, token.Position), operand, token.Position)
+		}
+	}
+
+	return parser.parsePrimary(allow_call)
+}
+
+// parsePrimary parses the smallest unit of an expression, block calls are not allowed
+// while parsing verbs since a verb followed by a colon would otherwise be read as a call
+func (parser *Parser) parsePrimary(allow_call bool) map[string]interface{} {
+	token := parser.peek()
+
+	switch token.Kind {
+	case TokenNumber:
+		parser.next()
+		value, err := strconv.ParseInt(token.Value, 10, 64)
+		if err != nil {
+			parser.fail("Integer literal '"+token.Value+"' is out of range", token.Position)
+		}
+		return intPrimitive(value, token.Position)
+	case TokenString:
+		parser.fail("String literals are only allowed in populations", token.Position)
+	case TokenPunctuation:
+		switch token.Value {
+		case "{":
+			parser.next()
+			expression := parser.parseExpression()
+			parser.expect("}")
+			return expression
+		case "[":
+			return parser.parseScopeMutater()
+		}
+	case TokenIdentifier:
+		if keywords[token.Value] {
+			parser.fail("Unexpected keyword '"+token.Value+"', expected an expression", token.Position)
+		}
+		parser.next()
+
+		next := parser.peek()
+		if next.Kind == TokenPunctuation {
+			switch next.Value {
+			case ".":
+				return parser.parseNamespaceIndexer(token, allow_call)
+			case ":", "(":
+				if allow_call {
+					verbs := []interface{}{}
+					for parser.accept(":") {
+						verbs = append(verbs, parser.parseUnary(false))
+					}
+					return parser.parseBlockCall(token, verbs)
+				}
+			}
+		}
+
+		result := node("reference", token.Position)
+		result["negative"] = false
+		result["value"] = token.Value
+		return result
+	}
+
+	parser.unexpected("an expression")
+	return nil
+}
@@ -0,0 +1,203 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/canpacis/birlang/src/ast"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		input  string
+		tokens []string
+	}{
+		{"let a = 1", []string{"let", "a", "=", "1"}},
+		{"a !== b", []string{"a", "!==", "b"}},
+		{"a !<= b !< c", []string{"a", "!<=", "b", "!<", "c"}},
+		{"count++ count += 2", []string{"count", "++", "count", "+=", "2"}},
+		{"bir:util.push (1, 2)", []string{"bir", ":", "util", ".", "push", "(", "1", ",", "2", ")"}},
+		{"// line\nx", []string{"line", "x"}},
+		{"/* block */ x", []string{"block", "x"}},
+		{`"a\nb"`, []string{"a\nb"}},
+	}
+
+	for _, test := range tests {
+		tokens, err := NewLexer(test.input).Tokenize()
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.input, err)
+			continue
+		}
+		values := []string{}
+		for _, token := range tokens {
+			if token.Kind != TokenEOF {
+				values = append(values, token.Value)
+			}
+		}
+		if strings.Join(values, " ") != strings.Join(test.tokens, " ") {
+			t.Errorf("%q: got %q, want %q", test.input, values, test.tokens)
+		}
+		if tokens[len(tokens)-1].Kind != TokenEOF {
+			t.Errorf("%q: the last token is not the end of input", test.input)
+		}
+	}
+}
+
+func TestTokenizeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		kind     LexErrorKind
+		message  string
+		position ast.Position
+	}{
+		{"let a = 1 /* open", LexUnterminatedComment, "Unterminated comment", ast.Position{Line: 1, Col: 11}},
+		{"\"open", LexUnterminatedString, "Unterminated string", ast.Position{Line: 1, Col: 1}},
+		{"\"a\\q\"", LexUnknownEscape, "Unknown escape sequence '\\q'", ast.Position{Line: 1, Col: 1}},
+		{"let a = 1\nlet b = #", LexUnexpectedCharacter, "Unexpected character '#'", ast.Position{Line: 2, Col: 9}},
+	}
+
+	for _, test := range tests {
+		_, err := NewLexer(test.input).Tokenize()
+		var lex_error LexError
+		if !errors.As(err, &lex_error) {
+			t.Errorf("%q: got %v, want a lexer error", test.input, err)
+			continue
+		}
+		if lex_error.Kind != test.kind || lex_error.Message != test.message || lex_error.Position != test.position {
+			t.Errorf("%q: got %d %q at %v, want %d %q at %v", test.input, lex_error.Kind, lex_error.Message, lex_error.Position, test.kind, test.message, test.position)
+		}
+	}
+}
+
+// parse returns the top level statements of a program that has to parse
+func parse(t *testing.T, input string) []interface{} {
+	t.Helper()
+	result := Parse(input)
+	if result.Error {
+		t.Fatalf("%q: unexpected error %v", input, result.Content)
+	}
+	return result.Content.(map[string]interface{})["program"].([]interface{})
+}
+
+func TestParseStatements(t *testing.T) {
+	tests := []struct {
+		input     string
+		operation string
+	}{
+		{"let a = 1", "variable_declaration"},
+		{"const a = 1", "variable_declaration"},
+		{"export let a = 1", "variable_declaration"},
+		{"a = 2", "assign_statement"},
+		{"a++", "quantity_modifier_statement"},
+		{"add [x, y] { return x + y }", "block_declaration"},
+		{"pick:verb [] { return verb }", "block_declaration"},
+		{"sum implements add", "block_declaration"},
+		{"add (1, 2)", "block_call"},
+		{"bir:util.push (1)", "block_call"},
+		{"if a == 1 { a = 2 } else { a = 3 }", "if_statement"},
+		{"for 10 as i { a++ }", "for_statement"},
+		{"while a < 10 { a++ }", "while_statement"},
+		{"switch a { case 1 { a++ } default { a-- } }", "switch_statement"},
+		{"namespace codes { const ok = 200 }", "namespace_declaration"},
+		{"export namespace codes { const ok = 200 }", "namespace_declaration"},
+		{"[Write 1, 2]", "scope_mutater_expression"},
+		{"// comment", "comment"},
+	}
+
+	for _, test := range tests {
+		program := parse(t, test.input)
+		if len(program) != 1 {
+			t.Errorf("%q: got %d statements, want 1", test.input, len(program))
+			continue
+		}
+		operation := program[0].(map[string]interface{})["operation"]
+		if operation != test.operation {
+			t.Errorf("%q: got %v, want %s", test.input, operation, test.operation)
+		}
+	}
+}
+
+func TestParsePrecedence(t *testing.T) {
+	program := parse(t, "let a = 1 + 2 * 3")
+	right := program[0].(map[string]interface{})["right"].(map[string]interface{})
+	if right["type"] != "addition" {
+		t.Fatalf("got %v at the top, want addition", right["type"])
+	}
+	if right["right"].(map[string]interface{})["type"] != "multiplication" {
+		t.Errorf("got %v on the right, want multiplication", right["right"].(map[string]interface{})["type"])
+	}
+}
+
+func TestParseImports(t *testing.T) {
+	result := Parse("use \"std:util\" as u\nuse \"./lib.bir\" { a, b }\n")
+	if result.Error {
+		t.Fatalf("unexpected error %v", result.Content)
+	}
+	imports := result.Content.(map[string]interface{})["imports"].([]interface{})
+	if len(imports) != 2 {
+		t.Fatalf("got %d imports, want 2", len(imports))
+	}
+	aliased := imports[0].(map[string]interface{})
+	if aliased["alias"].(map[string]interface{})["value"] != "u" {
+		t.Errorf("got alias %v, want u", aliased["alias"])
+	}
+	selective := imports[1].(map[string]interface{})
+	if names := selective["names"].([]interface{}); len(names) != 2 {
+		t.Errorf("got %d names, want 2", len(names))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		message  string
+		position ast.Position
+	}{
+		{"let = 1", "Unexpected token '=', expected an identifier", ast.Position{Line: 1, Col: 5}},
+		{"let a =", "Unexpected end of input, expected an expression", ast.Position{Line: 1, Col: 8}},
+		{"add (1, 2", "Unexpected end of input, expected ')'", ast.Position{Line: 1, Col: 10}},
+		{"if a { use \"std:util\" }", "Use statements are only allowed at the top level", ast.Position{Line: 1, Col: 8}},
+		{"if a { export let b = 1 }", "Exports are only allowed at the top level", ast.Position{Line: 1, Col: 8}},
+		{"export a = 1", "Only variable, block and namespace declarations could be exported", ast.Position{Line: 1, Col: 1}},
+		{"namespace x { a = 1 }", "Namespaces can only contain variable, block and namespace declarations", ast.Position{Line: 1, Col: 15}},
+		{"switch a { default { a++ } default { a-- } }", "Switch statements may only have one default case", ast.Position{Line: 1, Col: 28}},
+		{"let a = 99999999999999999999", "Integer literal '99999999999999999999' is out of range", ast.Position{Line: 1, Col: 9}},
+		{"use \"std:util\" {}", "Expected at least one name to import", ast.Position{Line: 1, Col: 5}},
+	}
+
+	for _, test := range tests {
+		result := Parse(test.input)
+		if !result.Error {
+			t.Errorf("%q: parsed, want an error", test.input)
+			continue
+		}
+		content := result.Content.(map[string]interface{})
+		if content["message"] != test.message || content["position"] != test.position {
+			t.Errorf("%q: got %q at %v, want %q at %v", test.input, content["message"], content["position"], test.message, test.position)
+		}
+	}
+}
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input      string
+		incomplete bool
+	}{
+		{"let a = 1", false},
+		{"add [x] {", true},
+		{"add [x] {\n return x\n}", false},
+		{"add (1,", true},
+		{"[Write 1,", true},
+		{"/* open", true},
+		{"/* open */", false},
+		{"\"open", false},
+		{"}", false},
+	}
+
+	for _, test := range tests {
+		if incomplete := Incomplete(test.input); incomplete != test.incomplete {
+			t.Errorf("%q: got %v, want %v", test.input, incomplete, test.incomplete)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// encoder writes the protocol buffer wire format, the profile format is small enough to be written
+// by hand instead of pulling in a protobuf library
+type encoder struct {
+	data []byte
+}
+
+func (e *encoder) varint(value uint64) {
+	for value >= 0x80 {
+		e.data = append(e.data, byte(value)|0x80)
+		value >>= 7
+	}
+	e.data = append(e.data, byte(value))
+}
+
+func (e *encoder) uint64(field int, value uint64) {
+	e.varint(uint64(field) << 3)
+	e.varint(value)
+}
+
+func (e *encoder) int64(field int, value int64) {
+	e.uint64(field, uint64(value))
+}
+
+func (e *encoder) bytes(field int, value []byte) {
+	e.varint(uint64(field)<<3 | 2)
+	e.varint(uint64(len(value)))
+	e.data = append(e.data, value...)
+}
+
+func (e *encoder) string(field int, value string) {
+	e.bytes(field, []byte(value))
+}
+
+func (e *encoder) message(field int, build func(*encoder)) {
+	inner := &encoder{}
+	build(inner)
+	e.bytes(field, inner.data)
+}
+
+func (e *encoder) packed(field int, values []uint64) {
+	inner := &encoder{}
+	for _, value := range values {
+		inner.varint(value)
+	}
+	e.bytes(field, inner.data)
+}
+
+// strings is the string table of a profile, every string is referred to by its index and the first
+// one has to be empty
+type stringTable struct {
+	table   []string
+	indexes map[string]int64
+}
+
+func (s *stringTable) index(value string) int64 {
+	if s.indexes == nil {
+		s.indexes = map[string]int64{"": 0}
+		s.table = []string{""}
+	}
+	if index, ok := s.indexes[value]; ok {
+		return index
+	}
+	s.indexes[value] = int64(len(s.table))
+	s.table = append(s.table, value)
+	return int64(len(s.table) - 1)
+}
+
+// WritePprof writes the profile in the gzipped protocol buffer format 'go tool pprof' reads, every
+// sample has the number of calls and the time its stack spent
+func (profile *Profile) WritePprof(output io.Writer) error {
+	table := &stringTable{}
+	table.index("")
+	e := &encoder{}
+
+	value_types := [][2]string{{"calls", "count"}, {"time", "nanoseconds"}}
+	for _, value_type := range value_types {
+		kind, unit := table.index(value_type[0]), table.index(value_type[1])
+		e.message(1, func(e *encoder) {
+			e.int64(1, kind)
+			e.int64(2, unit)
+		})
+	}
+
+	for _, sample := range profile.Samples {
+		locations := []uint64{}
+		for i := len(sample.Stack) - 1; i >= 0; i-- {
+			locations = append(locations, uint64(sample.Stack[i]))
+		}
+		e.message(2, func(e *encoder) {
+			e.packed(1, locations)
+			e.packed(2, []uint64{uint64(sample.Calls), uint64(sample.Time)})
+		})
+	}
+
+	for i, location := range profile.Locations {
+		function := uint64(profile.functions[location.Function])
+		line := location.Line
+		e.message(4, func(e *encoder) {
+			e.uint64(1, uint64(i+1))
+			e.message(4, func(e *encoder) {
+				e.uint64(1, function)
+				e.int64(2, line)
+			})
+		})
+	}
+
+	for i, function := range profile.Functions {
+		name, file := table.index(function.Name), table.index(function.File)
+		e.message(5, func(e *encoder) {
+			e.uint64(1, uint64(i+1))
+			e.int64(2, name)
+			e.int64(3, name)
+			e.int64(4, file)
+		})
+	}
+
+	period_kind, period_unit := table.index("time"), table.index("nanoseconds")
+	for _, value := range table.table {
+		e.string(6, value)
+	}
+	e.int64(9, profile.Start.UnixNano())
+	e.int64(10, int64(profile.Duration))
+	e.message(11, func(e *encoder) {
+		e.int64(1, period_kind)
+		e.int64(2, period_unit)
+	})
+	e.int64(12, 1)
+
+	writer := gzip.NewWriter(output)
+	if _, err := writer.Write(e.data); err != nil {
+		return err
+	}
+	return writer.Close()
+}
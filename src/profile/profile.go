@@ -0,0 +1,228 @@
+// Package profile measures where a bir process spends its time, per block call and per loop
+package profile
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/engine"
+	"github.com/canpacis/birlang/src/scope"
+)
+
+type Function struct {
+	Name string
+	File string
+}
+
+type Location struct {
+	Function Function
+	Line     int64
+}
+
+// Sample is the time spent with a stack of locations, root first, and the number of times the last
+// one was entered
+type Sample struct {
+	Stack []int
+	Calls int64
+	Time  time.Duration
+}
+
+// frame identifies a callstack entry, entries of the same loop have the same label but every iteration
+// runs in a new scope
+type frame struct {
+	label string
+	path  string
+	line  int64
+	scope *scope.Scope
+}
+
+// Profile is an engine tracer that attributes the time between two events to the callstack the engine
+// had, the callstack holds block calls as well as loop iterations
+type Profile struct {
+	Start     time.Time
+	Duration  time.Duration
+	Functions []Function
+	Locations []Location
+	Samples   []*Sample
+
+	functions map[Function]int
+	locations map[Location]int
+	samples   map[string]*Sample
+	previous  []frame
+	last      time.Time
+}
+
+func New() *Profile {
+	now := time.Now()
+	return &Profile{
+		Start:     now,
+		last:      now,
+		functions: map[Function]int{},
+		locations: map[Location]int{},
+		samples:   map[string]*Sample{},
+	}
+}
+
+// Stop ends the profile, the time after the last event belongs to the last callstack
+func (profile *Profile) Stop() {
+	profile.add(profile.previous, time.Since(profile.last), 0)
+	profile.Duration = time.Since(profile.Start)
+}
+
+func (profile *Profile) Statement(instance *engine.BirEngine, statement ast.Statement, value *ast.IntPrimitiveExpression, err error) {
+	profile.record(instance)
+}
+
+func (profile *Profile) Branch(instance *engine.BirEngine, statement ast.Statement, arm int) {
+	profile.record(instance)
+}
+
+func (profile *Profile) Enter(instance *engine.BirEngine, expression *ast.BlockCallExpression, label string, verbs []int64, arguments []int64) {
+	profile.record(instance)
+}
+
+func (profile *Profile) Exit(instance *engine.BirEngine, expression *ast.BlockCallExpression, label string, value ast.IntPrimitiveExpression, err error) {
+	profile.record(instance)
+}
+
+func frames(callstack []engine.Callstack) []frame {
+	result := make([]frame, 0, len(callstack))
+	for _, entry := range callstack {
+		var top *scope.Scope
+		if len(entry.Scopes) > 0 {
+			top = entry.Scopes[len(entry.Scopes)-1]
+		}
+		result = append(result, frame{label: entry.Label, path: entry.Path, line: int64(entry.Position.Line), scope: top})
+	}
+	return result
+}
+
+func (profile *Profile) record(instance *engine.BirEngine) {
+	now := time.Now()
+	elapsed := now.Sub(profile.last)
+	profile.last = now
+
+	current := frames(instance.Callstack)
+	common := 0
+	for common < len(current) && common < len(profile.previous) && current[common].label == profile.previous[common].label && current[common].scope == profile.previous[common].scope {
+		common++
+	}
+
+	// When one of the callstacks contains the other, the time was spent in the deeper one. It is the
+	// previous one when a call has just returned and the current one when a call has just started.
+	stack := current
+	if common == len(current) && len(profile.previous) > len(current) {
+		stack = profile.previous
+	}
+	profile.add(stack, elapsed, 0)
+
+	for i := common; i < len(current); i++ {
+		profile.add(current[:i+1], 0, 1)
+	}
+	profile.previous = current
+}
+
+func (profile *Profile) location(f frame) int {
+	function := Function{Name: f.label, File: f.path}
+	if _, ok := profile.functions[function]; !ok {
+		profile.Functions = append(profile.Functions, function)
+		profile.functions[function] = len(profile.Functions)
+	}
+
+	location := Location{Function: function, Line: f.line}
+	if id, ok := profile.locations[location]; ok {
+		return id
+	}
+	profile.Locations = append(profile.Locations, location)
+	profile.locations[location] = len(profile.Locations)
+	return len(profile.Locations)
+}
+
+func (profile *Profile) add(stack []frame, elapsed time.Duration, calls int64) {
+	if len(stack) == 0 {
+		return
+	}
+
+	ids := []int{}
+	key := ""
+	for _, f := range stack {
+		id := profile.location(f)
+		ids = append(ids, id)
+		key += strconv.Itoa(id) + ","
+	}
+
+	sample, ok := profile.samples[key]
+	if !ok {
+		sample = &Sample{Stack: ids}
+		profile.samples[key] = sample
+		profile.Samples = append(profile.Samples, sample)
+	}
+	sample.Time += elapsed
+	sample.Calls += calls
+}
+
+// Entry is a line of the summary
+type Entry struct {
+	Name       string
+	Calls      int64
+	Self       time.Duration
+	Cumulative time.Duration
+}
+
+// Summary sums the samples per block and loop, the slowest first
+func (profile *Profile) Summary() []Entry {
+	entries := map[string]*Entry{}
+	get := func(name string) *Entry {
+		if _, ok := entries[name]; !ok {
+			entries[name] = &Entry{Name: name}
+		}
+		return entries[name]
+	}
+
+	for _, sample := range profile.Samples {
+		leaf := get(profile.Locations[sample.Stack[len(sample.Stack)-1]-1].Function.Name)
+		leaf.Calls += sample.Calls
+		leaf.Self += sample.Time
+
+		// Recursive blocks appear more than once in a stack, their time is only counted once
+		seen := map[string]bool{}
+		for _, id := range sample.Stack {
+			name := profile.Locations[id-1].Function.Name
+			if !seen[name] {
+				seen[name] = true
+				get(name).Cumulative += sample.Time
+			}
+		}
+	}
+
+	result := []Entry{}
+	for _, entry := range entries {
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Cumulative != result[j].Cumulative {
+			return result[i].Cumulative > result[j].Cumulative
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func pad(value string, width int) string {
+	if len(value) >= width {
+		return value
+	}
+	return strings.Repeat(" ", width-len(value)) + value
+}
+
+// WriteSummary writes the summary as a table
+func (profile *Profile) WriteSummary(output io.Writer) {
+	io.WriteString(output, pad("calls", 10)+pad("self", 14)+pad("cumulative", 14)+"  block\n")
+	for _, entry := range profile.Summary() {
+		io.WriteString(output, pad(strconv.FormatInt(entry.Calls, 10), 10)+pad(entry.Self.String(), 14)+pad(entry.Cumulative.String(), 14)+"  "+entry.Name+"\n")
+	}
+}
@@ -0,0 +1,194 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/canpacis/birlang/src/engine"
+)
+
+// profiled runs a program with a profile and stops it
+func profiled(t *testing.T, content string) *Profile {
+	t.Helper()
+	file_path := filepath.Join(t.TempDir(), "main.bir")
+	if err := os.WriteFile(file_path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	profile := New()
+	instance := engine.NewEngine(filepath.ToSlash(file_path), "", false, false, 0)
+	instance.Stdout, instance.Stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	instance.Tracer = profile
+	if err := instance.Init(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := instance.Run(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	profile.Stop()
+	return profile
+}
+
+const program = `fact [n] {
+  if n < 2 { return 1 }
+  else { return n * fact (n - 1) }
+}
+let a = fact (4)
+for 3 as i {
+  a++
+}
+`
+
+func TestSummary(t *testing.T) {
+	profile := profiled(t, program)
+
+	calls := map[string]int64{}
+	for _, entry := range profile.Summary() {
+		calls[entry.Name] = entry.Calls
+		if entry.Self > entry.Cumulative {
+			t.Errorf("%s: self time %s is more than the cumulative time %s", entry.Name, entry.Self, entry.Cumulative)
+		}
+	}
+	want := map[string]int64{
+		"main [main.bir]":           1,
+		"fact":                      4,
+		"if-block [main.bir 2:3]":   1,
+		"else-block [main.bir 2:3]": 3,
+		"for-block [main.bir 6:1]":  3,
+	}
+	if len(calls) != len(want) {
+		t.Errorf("got %v, want %v", calls, want)
+	}
+	for name, count := range want {
+		if calls[name] != count {
+			t.Errorf("%s: got %d calls, want %d", name, calls[name], count)
+		}
+	}
+
+	summary := profile.Summary()
+	if summary[0].Name != "main [main.bir]" || summary[0].Cumulative > profile.Duration {
+		t.Errorf("got %+v first, want the main block to hold the whole run", summary[0])
+	}
+	// A recursive block is counted once per stack, its cumulative time is not more than the run
+	for _, entry := range summary {
+		if entry.Name == "fact" && entry.Cumulative > summary[0].Cumulative {
+			t.Errorf("fact took %s, more than the %s of the whole program", entry.Cumulative, summary[0].Cumulative)
+		}
+	}
+
+	output := &bytes.Buffer{}
+	profile.WriteSummary(output)
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 6 || lines[0] != "     calls          self    cumulative  block" || !strings.HasSuffix(lines[1], "  main [main.bir]") {
+		t.Errorf("got summary\n%s", output.String())
+	}
+}
+
+// field is a field of a protocol buffer message, varints are kept in value and the rest in data
+type field struct {
+	number int
+	value  uint64
+	data   []byte
+}
+
+func varint(data []byte) (uint64, int) {
+	value, shift := uint64(0), uint(0)
+	for i, b := range data {
+		value |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return value, i + 1
+		}
+		shift += 7
+	}
+	return 0, 0
+}
+
+func fields(t *testing.T, data []byte) []field {
+	t.Helper()
+	result := []field{}
+	for len(data) > 0 {
+		key, n := varint(data)
+		if n == 0 {
+			t.Fatalf("truncated key")
+		}
+		data = data[n:]
+		f := field{number: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			f.value, n = varint(data)
+			data = data[n:]
+		case 2:
+			length, n := varint(data)
+			data = data[n:]
+			f.data = data[:length]
+			data = data[length:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+func TestPprof(t *testing.T) {
+	profile := profiled(t, program)
+
+	output := &bytes.Buffer{}
+	if err := profile.WritePprof(output); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	reader, err := gzip.NewReader(output)
+	if err != nil {
+		t.Fatalf("the profile is not gzipped: %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[int]int{}
+	table := []string{}
+	for _, f := range fields(t, data) {
+		counts[f.number]++
+		if f.number == 6 {
+			table = append(table, string(f.data))
+		}
+	}
+	if counts[1] != 2 || counts[2] != len(profile.Samples) || counts[4] != len(profile.Locations) || counts[5] != len(profile.Functions) {
+		t.Errorf("got fields %v for %d samples, %d locations and %d functions", counts, len(profile.Samples), len(profile.Locations), len(profile.Functions))
+	}
+	if len(table) == 0 || table[0] != "" {
+		t.Fatalf("got string table %q, the first string should be empty", table)
+	}
+	joined := strings.Join(table, ",")
+	for _, value := range []string{"calls", "count", "time", "nanoseconds", "fact", "main [main.bir]"} {
+		if !strings.Contains(","+joined+",", ","+value+",") {
+			t.Errorf("%q is not in the string table %q", value, table)
+		}
+	}
+}
+
+func TestVarint(t *testing.T) {
+	tests := []struct {
+		value uint64
+		want  []byte
+	}{
+		{0, []byte{0}},
+		{1, []byte{1}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{300, []byte{0xac, 0x02}},
+	}
+	for _, test := range tests {
+		e := &encoder{}
+		e.varint(test.value)
+		if !bytes.Equal(e.data, test.want) {
+			t.Errorf("%d: got %x, want %x", test.value, e.data, test.want)
+		}
+	}
+}
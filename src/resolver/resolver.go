@@ -0,0 +1,567 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/scope"
+)
+
+type ResolveError struct {
+	Message  string       `json:"message"`
+	Position ast.Position `json:"position"`
+}
+
+func (err ResolveError) Error() string {
+	return err.Message
+}
+
+// Scope mirrors a scope of the engine's scopestack, it only keeps the names in the order the engine
+// adds their values so that a name's position is its index in the runtime scope
+type Scope struct {
+	Variables []string `json:"variables"`
+	Blocks    []string `json:"blocks"`
+	// Alias is the name of an aliased module, its names are only found when they are qualified with it
+	Alias string `json:"alias"`
+	// Exported holds the names of an imported module that are visible, every name is when it is nil
+	Exported map[string]bool `json:"exported"`
+	// Native holds the names of the blocks that are implemented in go, they have no declaration
+	Native map[string]bool `json:"native"`
+	// Declarations of the names in the same order, nil for names whose declaration is not known
+	VariableNodes []ast.Node                       `json:"-"`
+	BlockNodes    []*ast.BlockDeclarationStatement `json:"-"`
+}
+
+func (s *Scope) DeclareVariable(name string, node ast.Node) {
+	s.Variables = append(s.Variables, name)
+	s.VariableNodes = append(s.VariableNodes, node)
+}
+
+func (s *Scope) DeclareBlock(name string, node *ast.BlockDeclarationStatement) {
+	s.Blocks = append(s.Blocks, name)
+	s.BlockNodes = append(s.BlockNodes, node)
+}
+
+// DeclareNative declares a block that is implemented in go, it could be called but not implemented
+func (s *Scope) DeclareNative(name string) {
+	if s.Native == nil {
+		s.Native = map[string]bool{}
+	}
+	s.Native[name] = true
+	s.DeclareBlock(name, nil)
+}
+
+func (s *Scope) indexOf(names []string, name string) int {
+	if s.Exported != nil && !s.Exported[name] {
+		return -1
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		if names[i] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Reference is a name the resolver has bound, tooling uses them to go from a name to its declaration
+type Reference struct {
+	Name        string       `json:"name"`
+	Position    ast.Position `json:"position"`
+	Node        ast.Node     `json:"-"`
+	Declaration ast.Node     `json:"-"`
+}
+
+// Namespace mirrors a namespace of the engine, nested namespaces are kept by their qualified names
+type Namespace struct {
+	Scope       *Scope                             `json:"scope"`
+	Declaration *ast.NamespaceDeclarationStatement `json:"-"`
+}
+
+// Resolver walks a program before it is executed and binds every reference, assignment and block call
+// to the scope and the index its value will live in at runtime. Names qualified with a namespace are
+// only checked, the engine finds them by their names. A block runs on top of the scopes of its caller,
+// the names its body does not declare itself are bound as dynamic and they are only missing if the
+// program declares them nowhere.
+type Resolver struct {
+	Scopes     []*Scope              `json:"scopes"`
+	Namespaces map[string]*Namespace `json:"namespaces"`
+	Errors     []ResolveError        `json:"errors"`
+	References []Reference           `json:"references"`
+	deferred   []func()
+	// namespace is the qualified name of the namespace being declared
+	namespace string
+	// frame is the index of the first scope the block body being resolved has of its own, it is 0 outside
+	// of block bodies
+	frame int
+	// variables and blocks hold every name the program declares, anywhere in it
+	variables map[string]bool
+	blocks    map[string]bool
+}
+
+// NewResolver creates a resolver whose scopes mirror the given scopestack, names that already exist
+// at runtime (natives, imports, earlier repl inputs) are resolved against it
+func NewResolver(scopestack *scope.Scopestack) *Resolver {
+	resolver := &Resolver{}
+
+	for _, runtime_scope := range scopestack.Scopes {
+		s := &Scope{Alias: runtime_scope.Alias, Exported: runtime_scope.Exported}
+		for _, value := range runtime_scope.Frame {
+			s.DeclareVariable(value.Key.Value, nil)
+		}
+		for i := range runtime_scope.Blocks {
+			s.DeclareBlock(runtime_scope.Blocks[i].Name.Value, &runtime_scope.Blocks[i])
+		}
+		resolver.Scopes = append(resolver.Scopes, s)
+	}
+
+	for _, runtime_namespace := range scopestack.Namespaces {
+		s := &Scope{}
+		for _, value := range runtime_namespace.Scope.Frame {
+			s.DeclareVariable(value.Key.Value, nil)
+		}
+		for i := range runtime_namespace.Scope.Blocks {
+			s.DeclareBlock(runtime_namespace.Scope.Blocks[i].Name.Value, &runtime_namespace.Scope.Blocks[i])
+		}
+		resolver.DeclareNamespace(runtime_namespace.Name, &Namespace{Scope: s})
+	}
+
+	return resolver
+}
+
+// Resolve binds the names of a program that runs in the current scope of the resolver
+func (resolver *Resolver) Resolve(statements []ast.Statement) []ResolveError {
+	resolver.declare(statements)
+	resolver.ResolveStatements(statements)
+	return resolver.Errors
+}
+
+// declare collects the names the statements declare anywhere in them, a block body that does not declare
+// a name itself could find it on the scopes of a caller that does
+func (resolver *Resolver) declare(statements []ast.Statement) {
+	if resolver.variables == nil {
+		resolver.variables = map[string]bool{}
+		resolver.blocks = map[string]bool{}
+	}
+
+	for _, statement := range statements {
+		switch statement := statement.(type) {
+		case *ast.VariableDeclarationStatement:
+			resolver.variables[statement.Left.Value] = true
+		case *ast.BlockDeclarationStatement:
+			resolver.blocks[statement.Name.Value] = true
+			for _, argument := range statement.Arguments {
+				resolver.variables[argument.Value] = true
+			}
+			for _, verb := range statement.Verbs {
+				resolver.variables[verb.Value] = true
+			}
+			if statement.Body != nil {
+				resolver.declare(statement.Body.Init)
+				resolver.declare(statement.Body.Program)
+			}
+		case *ast.NamespaceDeclarationStatement:
+			resolver.declare(statement.Body)
+		case *ast.ForStatement:
+			resolver.variables[statement.Placeholder] = true
+			resolver.declare(statement.Body)
+		case *ast.WhileStatement:
+			resolver.declare(statement.Body)
+		case *ast.IfStatement:
+			resolver.declare(statement.Body)
+			for _, elif := range statement.Elifs {
+				resolver.declare(elif.Body)
+			}
+			resolver.declare(statement.Else)
+		case *ast.SwitchStatement:
+			for _, _case := range statement.Cases {
+				resolver.declare(_case.Body)
+			}
+			resolver.declare(statement.Default.Body)
+		}
+	}
+}
+
+// bind turns the binding of a name in the scopes of the resolver into the binding the engine uses, a
+// name that is not in the scopes of the block body being resolved is dynamic
+func (resolver *Resolver) bind(binding ast.Binding, found bool, declared map[string]bool, name string) (ast.Binding, bool) {
+	if resolver.frame == 0 || (found && len(resolver.Scopes)-1-binding.Depth >= resolver.frame) {
+		return binding, found
+	}
+	return ast.Binding{Dynamic: true}, found || declared[name]
+}
+
+func (resolver *Resolver) DeclareNamespace(name string, namespace *Namespace) {
+	if resolver.Namespaces == nil {
+		resolver.Namespaces = map[string]*Namespace{}
+	}
+	resolver.Namespaces[name] = namespace
+}
+
+func (resolver *Resolver) Throw(message string, position ast.Position) {
+	resolver.Errors = append(resolver.Errors, ResolveError{Message: message, Position: position})
+}
+
+func (resolver *Resolver) current() *Scope {
+	return resolver.Scopes[len(resolver.Scopes)-1]
+}
+
+func (resolver *Resolver) push(s *Scope) {
+	resolver.Scopes = append(resolver.Scopes, s)
+}
+
+func (resolver *Resolver) pop() {
+	resolver.Scopes = resolver.Scopes[:len(resolver.Scopes)-1]
+}
+
+func (resolver *Resolver) reference(name string, position ast.Position, node ast.Node, declaration ast.Node) {
+	resolver.References = append(resolver.References, Reference{Name: name, Position: position, Node: node, Declaration: declaration})
+}
+
+// declaration returns the node that declared the name a binding points to, names that are only found
+// on the scopes of a caller have none
+func (resolver *Resolver) declaration(binding ast.Binding, found bool, block bool) ast.Node {
+	if !found {
+		return nil
+	}
+	s := resolver.Scopes[len(resolver.Scopes)-1-binding.Depth]
+	if block {
+		if binding.Index < len(s.BlockNodes) && s.BlockNodes[binding.Index] != nil {
+			return s.BlockNodes[binding.Index]
+		}
+		return nil
+	}
+	if binding.Index < len(s.VariableNodes) {
+		return s.VariableNodes[binding.Index]
+	}
+	return nil
+}
+
+// native tells if a bound block is implemented in go
+func (resolver *Resolver) native(binding ast.Binding) bool {
+	s := resolver.Scopes[len(resolver.Scopes)-1-binding.Depth]
+	if binding.Index >= len(s.Blocks) {
+		return false
+	}
+	node := s.BlockNodes[binding.Index]
+	return s.Native[s.Blocks[binding.Index]] || (node != nil && node.Native)
+}
+
+func (resolver *Resolver) FindVariable(name string) (ast.Binding, bool) {
+	for depth := 0; depth < len(resolver.Scopes); depth++ {
+		s := resolver.Scopes[len(resolver.Scopes)-1-depth]
+		if s.Alias != "" {
+			continue
+		}
+		if index := s.indexOf(s.Variables, name); index >= 0 {
+			return ast.Binding{Depth: depth, Index: index}, true
+		}
+	}
+	return ast.Binding{}, false
+}
+
+func (resolver *Resolver) FindBlock(name string) (ast.Binding, bool) {
+	for depth := 0; depth < len(resolver.Scopes); depth++ {
+		s := resolver.Scopes[len(resolver.Scopes)-1-depth]
+		if s.Alias != "" {
+			continue
+		}
+		if index := s.indexOf(s.Blocks, name); index >= 0 {
+			return ast.Binding{Depth: depth, Index: index}, true
+		}
+	}
+	return ast.Binding{}, false
+}
+
+// FindModule returns the depth of the scope of an aliased module
+func (resolver *Resolver) FindModule(alias string) (int, bool) {
+	for depth := 0; depth < len(resolver.Scopes); depth++ {
+		if resolver.Scopes[len(resolver.Scopes)-1-depth].Alias == alias {
+			return depth, true
+		}
+	}
+	return 0, false
+}
+
+// ResolveStatements resolves a statement list that runs in the current scope. Blocks declared in the
+// list are known from its beginning so that they can call each other, their bodies are resolved at the
+// end of the list because they only run once the list has declared what they could refer to.
+func (resolver *Resolver) ResolveStatements(statements []ast.Statement) {
+	previous := resolver.deferred
+	resolver.deferred = nil
+
+	for _, statement := range statements {
+		if declaration, ok := statement.(*ast.BlockDeclarationStatement); ok {
+			if _, exists := resolver.FindBlock(declaration.Name.Value); exists {
+				resolver.Throw("Could not redeclare an existing block", declaration.Position)
+				continue
+			}
+			resolver.current().DeclareBlock(declaration.Name.Value, declaration)
+		}
+	}
+
+	for _, statement := range statements {
+		resolver.ResolveStatement(statement)
+	}
+
+	for len(resolver.deferred) > 0 {
+		deferred := resolver.deferred[0]
+		resolver.deferred = resolver.deferred[1:]
+		deferred()
+	}
+	resolver.deferred = previous
+}
+
+// ResolveBody resolves a statement list that runs in a scope of its own
+func (resolver *Resolver) ResolveBody(statements []ast.Statement) {
+	resolver.push(&Scope{})
+	resolver.ResolveStatements(statements)
+	resolver.pop()
+}
+
+func (resolver *Resolver) ResolveStatement(statement ast.Statement) {
+	switch statement := statement.(type) {
+	case *ast.VariableDeclarationStatement:
+		resolver.ResolveVariableDeclaration(statement)
+	case *ast.ReturnStatement:
+		resolver.ResolveExpression(statement.Expression)
+	case *ast.ThrowStatement:
+		resolver.ResolveExpression(statement.Expression)
+	case *ast.BlockDeclarationStatement:
+		resolver.ResolveBlockDeclaration(statement)
+	case *ast.NamespaceDeclarationStatement:
+		previous := resolver.namespace
+		resolver.namespace = statement.Name.Value
+		if previous != "" {
+			resolver.namespace = previous + "." + statement.Name.Value
+		}
+		s := &Scope{}
+		resolver.DeclareNamespace(resolver.namespace, &Namespace{Scope: s, Declaration: statement})
+		resolver.push(s)
+		resolver.ResolveStatements(statement.Body)
+		resolver.pop()
+		resolver.namespace = previous
+	case *ast.QuantityModifierStatement:
+		resolver.ResolveExpression(statement.Statement)
+		if statement.Right != nil {
+			resolver.ResolveExpression(statement.Right)
+		}
+	case *ast.AssignStatement:
+		resolver.ResolveExpression(statement.Right)
+		lexical, found := resolver.FindVariable(statement.Left.Value)
+		binding, ok := resolver.bind(lexical, found, resolver.variables, statement.Left.Value)
+		if !ok {
+			resolver.Throw("Could not assign to a variable that does not exist", statement.Position)
+		} else {
+			resolver.reference(statement.Left.Value, statement.Left.Position, statement, resolver.declaration(lexical, found, false))
+		}
+		statement.Binding = binding
+	case *ast.BlockCallExpression, *ast.ScopeMutaterExpression, *ast.NamespaceIndexerExpression:
+		resolver.ResolveExpression(statement.(ast.Expression))
+	case *ast.ForStatement:
+		resolver.ResolveExpression(statement.Statement)
+		placeholder := &Scope{}
+		placeholder.DeclareVariable(statement.Placeholder, statement)
+		resolver.push(placeholder)
+		resolver.ResolveStatements(statement.Body)
+		resolver.pop()
+	case *ast.WhileStatement:
+		resolver.ResolveExpression(statement.Statement)
+		resolver.ResolveBody(statement.Body)
+	case *ast.IfStatement:
+		resolver.ResolveExpression(statement.Condition)
+		resolver.ResolveBody(statement.Body)
+		for _, elif := range statement.Elifs {
+			resolver.ResolveExpression(elif.Condition)
+			resolver.ResolveBody(elif.Body)
+		}
+		if statement.Else != nil {
+			resolver.ResolveBody(statement.Else)
+		}
+	case *ast.SwitchStatement:
+		resolver.ResolveExpression(statement.Condition)
+		for _, _case := range statement.Cases {
+			resolver.ResolveExpression(_case.Case)
+			resolver.ResolveBody(_case.Body)
+		}
+		if statement.Default.Body != nil {
+			resolver.ResolveBody(statement.Default.Body)
+		}
+	}
+}
+
+func (resolver *Resolver) ResolveVariableDeclaration(statement *ast.VariableDeclarationStatement) {
+	resolver.ResolveExpression(statement.Right)
+
+	s := resolver.current()
+	if s.indexOf(s.Variables, statement.Left.Value) >= 0 {
+		resolver.Throw("Could not redeclare an existing variable", statement.Position)
+		return
+	}
+	s.DeclareVariable(statement.Left.Value, statement)
+}
+
+func (resolver *Resolver) ResolveBlockDeclaration(statement *ast.BlockDeclarationStatement) {
+	if statement.Implementing {
+		binding, found := resolver.FindBlock(statement.Implements.Value)
+		if _, ok := resolver.bind(binding, found, resolver.blocks, statement.Implements.Value); !ok {
+			resolver.Throw("Could not implement '"+statement.Implements.Value+"', block is non-existant", statement.Implements.Position)
+		} else if found && resolver.native(binding) {
+			resolver.Throw("Could not implement '"+statement.Implements.Value+"', native blocks could not be implemented", statement.Implements.Position)
+		} else {
+			resolver.reference(statement.Implements.Value, statement.Implements.Position, statement, resolver.declaration(binding, found, true))
+		}
+		for _, population := range statement.Populate {
+			resolver.ResolveExpression(population.Value)
+		}
+		return
+	}
+
+	environment := make([]*Scope, len(resolver.Scopes))
+	copy(environment, resolver.Scopes)
+	// The scopes of the namespaces the block is declared in are pushed under its instance when it runs
+	frame := len(environment)
+	if resolver.namespace != "" && resolver.current() == resolver.Namespaces[resolver.namespace].Scope {
+		frame -= strings.Count(resolver.namespace, ".") + 1
+	}
+
+	instance := &Scope{}
+	if statement.Body.Init != nil {
+		outer := resolver.Scopes
+		resolver.Scopes = append(environment[:len(environment):len(environment)], instance)
+		resolver.ResolveStatements(statement.Body.Init)
+		resolver.Scopes = outer
+	}
+
+	resolver.deferred = append(resolver.deferred, func() {
+		local := &Scope{}
+		for i := range statement.Arguments {
+			local.DeclareVariable(statement.Arguments[i].Value, &statement.Arguments[i])
+		}
+		for i := range statement.Verbs {
+			local.DeclareVariable(statement.Verbs[i].Value, &statement.Verbs[i])
+		}
+
+		outer, outer_frame := resolver.Scopes, resolver.frame
+		resolver.Scopes = append(environment[:len(environment):len(environment)], instance, local)
+		resolver.frame = frame
+		resolver.ResolveStatements(statement.Body.Program)
+		resolver.Scopes, resolver.frame = outer, outer_frame
+	})
+}
+
+func (resolver *Resolver) ResolveExpression(expression ast.Expression) {
+	switch expression := expression.(type) {
+	case *ast.ReferenceExpression:
+		lexical, found := resolver.FindVariable(expression.Value)
+		binding, ok := resolver.bind(lexical, found, resolver.variables, expression.Value)
+		if !ok {
+			resolver.Throw("Could not find variable '"+expression.Value+"' in the frame", expression.Position)
+		} else {
+			resolver.reference(expression.Value, expression.Position, expression, resolver.declaration(lexical, found, false))
+		}
+		expression.Binding = binding
+	case *ast.BlockCallExpression:
+		if expression.Namespace.Value != "" {
+			resolver.resolveQualifiedBlock(expression)
+		} else {
+			lexical, found := resolver.FindBlock(expression.Name.Value)
+			binding, ok := resolver.bind(lexical, found, resolver.blocks, expression.Name.Value)
+			if !ok {
+				resolver.Throw("Could not find block '"+expression.Name.Value+"'", expression.Position)
+			} else {
+				resolver.reference(expression.Name.Value, expression.Name.Position, expression, resolver.declaration(lexical, found, true))
+			}
+			expression.Binding = binding
+		}
+		for _, argument := range expression.Arguments {
+			resolver.ResolveExpression(argument)
+		}
+		for _, verb := range expression.Verbs {
+			resolver.ResolveExpression(verb)
+		}
+	case *ast.NamespaceIndexerExpression:
+		resolver.resolveIndexer(expression)
+	case *ast.ScopeMutaterExpression:
+		for _, argument := range expression.Arguments {
+			resolver.ResolveExpression(argument)
+		}
+	case *ast.ArithmeticExpression:
+		resolver.ResolveExpression(expression.Left)
+		resolver.ResolveExpression(expression.Right)
+	case *ast.ConditionExpression:
+		resolver.ResolveExpression(expression.Left)
+		resolver.ResolveExpression(expression.Right)
+	case *ast.ArrayPrimitiveExpression:
+		for _, value := range expression.Values {
+			resolver.ResolveExpression(value)
+		}
+	}
+}
+
+// resolveQualifiedBlock checks a call like 'ns.block (x)' against the blocks of the namespace and binds
+// a call like 'enc.block (x)' to a block of the module imported as 'enc'
+func (resolver *Resolver) resolveQualifiedBlock(expression *ast.BlockCallExpression) {
+	if namespace, ok := resolver.Namespaces[expression.Namespace.Value]; ok {
+		if namespace.Declaration != nil {
+			resolver.reference(expression.Namespace.Value, expression.Namespace.Position, expression, namespace.Declaration)
+		}
+		s := namespace.Scope
+		index := s.indexOf(s.Blocks, expression.Name.Value)
+		if index < 0 {
+			resolver.Throw("Could not find block '"+expression.Name.Value+"' in the namespace '"+expression.Namespace.Value+"'", expression.Name.Position)
+			return
+		}
+		if s.BlockNodes[index] != nil {
+			resolver.reference(expression.Name.Value, expression.Name.Position, expression, s.BlockNodes[index])
+		}
+		return
+	}
+
+	depth, ok := resolver.FindModule(expression.Namespace.Value)
+	if !ok {
+		resolver.Throw("Could not find namespace or module '"+expression.Namespace.Value+"'", expression.Namespace.Position)
+		return
+	}
+
+	s := resolver.Scopes[len(resolver.Scopes)-1-depth]
+	index := s.indexOf(s.Blocks, expression.Name.Value)
+	if index < 0 {
+		resolver.Throw("Could not find block '"+expression.Name.Value+"' in module '"+expression.Namespace.Value+"'", expression.Name.Position)
+		return
+	}
+	binding := ast.Binding{Depth: depth, Index: index}
+	resolver.reference(expression.Name.Value, expression.Name.Position, expression, resolver.declaration(binding, true, true))
+	// The module is below the scopes of the callers of a block body, it is found by its alias
+	expression.Binding = ast.Binding{Depth: depth, Index: index, Dynamic: resolver.frame > 0}
+}
+
+// resolveIndexer checks that a name like 'ns.name' or 'enc.name' exists in the namespace or the module
+func (resolver *Resolver) resolveIndexer(expression *ast.NamespaceIndexerExpression) {
+	if namespace, ok := resolver.Namespaces[expression.Namespace.Value]; ok {
+		if namespace.Declaration != nil {
+			resolver.reference(expression.Namespace.Value, expression.Namespace.Position, expression, namespace.Declaration)
+		}
+		s := namespace.Scope
+		index := s.indexOf(s.Variables, expression.Index.Value)
+		if index < 0 {
+			resolver.Throw("Could not find variable '"+expression.Index.Value+"' in the namespace '"+expression.Namespace.Value+"'", expression.Index.Position)
+			return
+		}
+		resolver.reference(expression.Index.Value, expression.Index.Position, expression, s.VariableNodes[index])
+		return
+	}
+
+	depth, ok := resolver.FindModule(expression.Namespace.Value)
+	if !ok {
+		resolver.Throw("Could not find namespace '"+expression.Namespace.Value+"'", expression.Namespace.Position)
+		return
+	}
+
+	s := resolver.Scopes[len(resolver.Scopes)-1-depth]
+	index := s.indexOf(s.Variables, expression.Index.Value)
+	if index < 0 {
+		resolver.Throw("Could not find variable '"+expression.Index.Value+"' in module '"+expression.Namespace.Value+"'", expression.Index.Position)
+		return
+	}
+	resolver.reference(expression.Index.Value, expression.Index.Position, expression, s.VariableNodes[index])
+}
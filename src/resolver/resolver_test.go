@@ -0,0 +1,149 @@
+package resolver_test
+
+import (
+	"testing"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/parser"
+	"github.com/canpacis/birlang/src/resolver"
+)
+
+func decode(t *testing.T, source string) *ast.Program {
+	t.Helper()
+	result := parser.Parse(source)
+	if result.Error {
+		t.Fatalf("%q: unexpected error %v", source, result.Content)
+	}
+	program, err := ast.Decode(result.Content)
+	if err != nil {
+		t.Fatalf("%q: unexpected error %v", source, err)
+	}
+	return program
+}
+
+// binding returns the binding of the last reference to a name
+func binding(r *resolver.Resolver, name string) (ast.Binding, bool) {
+	for i := len(r.References) - 1; i >= 0; i-- {
+		if r.References[i].Name != name {
+			continue
+		}
+		switch node := r.References[i].Node.(type) {
+		case *ast.ReferenceExpression:
+			return node.Binding, true
+		case *ast.BlockCallExpression:
+			return node.Binding, true
+		case *ast.AssignStatement:
+			return node.Binding, true
+		}
+	}
+	return ast.Binding{}, false
+}
+
+func TestResolveSlots(t *testing.T) {
+	tests := []struct {
+		source  string
+		name    string
+		binding ast.Binding
+	}{
+		{"let a = 1\nlet b = 2\nlet c = b", "b", ast.Binding{Depth: 0, Index: 1}},
+		{"let a = 1\nlet b = 2\nb = a", "b", ast.Binding{Depth: 0, Index: 1}},
+		{"let a = 1\nf [x] { return a + x }", "x", ast.Binding{Depth: 0, Index: 0}},
+		{"let a = 1\nf [x] { return a + x }", "a", ast.Binding{Dynamic: true}},
+		{"f:v [x, y] { return v }", "v", ast.Binding{Depth: 0, Index: 2}},
+		{"f [] {\n  init {\n    local n = 0\n  }\n  return n\n}", "n", ast.Binding{Depth: 1, Index: 0}},
+		{"for 3 as i {\n  let x = i\n}", "i", ast.Binding{Depth: 0, Index: 0}},
+		{"let a = 1\nwhile a < 3 {\n  let b = a\n}", "a", ast.Binding{Depth: 1, Index: 0}},
+		{"f [] { return 1 }\ng [] { return 2 }\ng ()", "g", ast.Binding{Depth: 0, Index: 1}},
+		{"f [] { return g () }\ng [] { return 1 }", "g", ast.Binding{Dynamic: true}},
+		{"g [] { return v }\nf [] {\n  let v = 1\n  return g ()\n}", "v", ast.Binding{Dynamic: true}},
+		{"f [] {\n  let a = 1\n  g [] { return a }\n  return g ()\n}", "a", ast.Binding{Dynamic: true}},
+		{"f [] {\n  init {\n    local n = 0\n  }\n  n = 1\n}", "n", ast.Binding{Depth: 1, Index: 0}},
+		{"namespace ns {\n  const a = 1\n  f [] { return a }\n}", "a", ast.Binding{Depth: 2, Index: 0}},
+		{"namespace ns {\n  const a = 1\n  f [] {\n    g [] { return a }\n    return g ()\n  }\n}", "a", ast.Binding{Dynamic: true}},
+	}
+
+	for _, test := range tests {
+		r := &resolver.Resolver{Scopes: []*resolver.Scope{{}}}
+		if errors := r.Resolve(decode(t, test.source).Program); len(errors) > 0 {
+			t.Errorf("%q: unexpected errors %v", test.source, errors)
+			continue
+		}
+		got, ok := binding(r, test.name)
+		if !ok {
+			t.Errorf("%q: '%s' is not referenced", test.source, test.name)
+			continue
+		}
+		if got != test.binding {
+			t.Errorf("%q: '%s' is bound to %+v, want %+v", test.source, test.name, got, test.binding)
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		source   string
+		message  string
+		position ast.Position
+	}{
+		{"let x = y", "Could not find variable 'y' in the frame", ast.Position{Line: 1, Col: 9}},
+		{"x = 1", "Could not assign to a variable that does not exist", ast.Position{Line: 1, Col: 1}},
+		{"foo (1)", "Could not find block 'foo'", ast.Position{Line: 1, Col: 1}},
+		{"let x = 1\nlet x = 2", "Could not redeclare an existing variable", ast.Position{Line: 2, Col: 1}},
+		{"f [] { return 1 }\nf [] { return 2 }", "Could not redeclare an existing block", ast.Position{Line: 2, Col: 1}},
+		{"e implements nothing", "Could not implement 'nothing', block is non-existant", ast.Position{Line: 1, Col: 14}},
+		{"e implements bir", "Could not implement 'bir', native blocks could not be implemented", ast.Position{Line: 1, Col: 14}},
+		{"f [x] { return x }\nlet y = x", "Could not find variable 'x' in the frame", ast.Position{Line: 2, Col: 9}},
+		{"f [] { return nowhere }", "Could not find variable 'nowhere' in the frame", ast.Position{Line: 1, Col: 15}},
+		{"f [] { return g () }", "Could not find block 'g'", ast.Position{Line: 1, Col: 15}},
+		{"let x = ns.a", "Could not find namespace 'ns'", ast.Position{Line: 1, Col: 9}},
+		{"namespace ns {\n  const a = 1\n}\nlet x = ns.b", "Could not find variable 'b' in the namespace 'ns'", ast.Position{Line: 4, Col: 12}},
+		{"namespace ns {\n  f [] { return 1 }\n}\nns.g ()", "Could not find block 'g' in the namespace 'ns'", ast.Position{Line: 4, Col: 4}},
+	}
+
+	for _, test := range tests {
+		root := &resolver.Scope{}
+		root.DeclareNative("bir")
+		r := &resolver.Resolver{Scopes: []*resolver.Scope{root}}
+		errors := r.Resolve(decode(t, test.source).Program)
+		if len(errors) == 0 {
+			t.Errorf("%q: resolved, want an error", test.source)
+			continue
+		}
+		if errors[0].Message != test.message || errors[0].Position != test.position {
+			t.Errorf("%q: got %q at %v, want %q at %v", test.source, errors[0].Message, errors[0].Position, test.message, test.position)
+		}
+	}
+}
+
+func TestResolveImports(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{"let x = a", ""},
+		{"let x = b", "Could not find variable 'b' in the frame"},
+		{"let x = m.c", ""},
+		{"let x = c", "Could not find variable 'c' in the frame"},
+		{"let x = m.d", "Could not find variable 'd' in module 'm'"},
+		{"m.f ()", ""},
+		{"let x = n.c", "Could not find namespace 'n'"},
+	}
+
+	for _, test := range tests {
+		selective := &resolver.Scope{Exported: map[string]bool{"a": true}}
+		selective.DeclareVariable("a", nil)
+		selective.DeclareVariable("b", nil)
+		aliased := &resolver.Scope{Alias: "m"}
+		aliased.DeclareVariable("c", nil)
+		aliased.DeclareBlock("f", nil)
+		r := &resolver.Resolver{Scopes: []*resolver.Scope{aliased, selective, {}}}
+
+		message := ""
+		if errors := r.Resolve(decode(t, test.source).Program); len(errors) > 0 {
+			message = errors[0].Message
+		}
+		if message != test.message {
+			t.Errorf("%q: got %q, want %q", test.source, message, test.message)
+		}
+	}
+}
@@ -5,27 +5,15 @@ import (
 )
 
 type Scopestack struct {
-	Scopes     []Scope     `json:"scopes"`
+	Scopes     []*Scope    `json:"scopes"`
 	Namespaces []Namespace `json:"namespaces"`
 }
 
-func (scopestack *Scopestack) Reverse() []Scope {
-	a := make([]Scope, len(scopestack.Scopes))
-	copy(a, scopestack.Scopes)
-
-	for i := len(a)/2 - 1; i >= 0; i-- {
-		opp := len(a) - 1 - i
-		a[i], a[opp] = a[opp], a[i]
-	}
-
-	return a
-}
-
-func (scopestack *Scopestack) ShiftScope(scope Scope) {
-	scopestack.Scopes = append([]Scope{scope}, scopestack.Scopes...)
+func (scopestack *Scopestack) ShiftScope(scope *Scope) {
+	scopestack.Scopes = append([]*Scope{scope}, scopestack.Scopes...)
 }
 
-func (scopestack *Scopestack) PushScope(scope Scope) {
+func (scopestack *Scopestack) PushScope(scope *Scope) {
 	scopestack.Scopes = append(scopestack.Scopes, scope)
 }
 
@@ -33,31 +21,68 @@ func (scopestack *Scopestack) PushNamespace(name string, scope Scope) {
 	scopestack.Namespaces = append(scopestack.Namespaces, Namespace{Name: name, Scope: scope})
 }
 
-func (scopestack *Scopestack) UnshiftScope() {
-	result := Scopestack{}
-	result.Scopes = append(result.Scopes, scopestack.Scopes[:len(scopestack.Scopes)-1]...)
+func (scopestack *Scopestack) PopScope() *Scope {
+	scope := scopestack.Scopes[len(scopestack.Scopes)-1]
+	scopestack.Scopes = scopestack.Scopes[:len(scopestack.Scopes)-1]
+	return scope
+}
 
-	scopestack.Scopes = result.Scopes
+func (scopestack *Scopestack) AddVariable(value Value) {
+	scopestack.GetCurrentScope().AddVariable(value)
 }
 
-func (scopestack *Scopestack) PopScope() *Scope {
-	result := Scopestack{}
-	scope := scopestack.Scopes[len(scopestack.Scopes)-1]
-	result.Scopes = append(result.Scopes, scopestack.Scopes[:len(scopestack.Scopes)-1]...)
+// At returns the scope that is depth scopes below the current one, or nil if there is no such scope
+func (scopestack *Scopestack) At(depth int) *Scope {
+	index := len(scopestack.Scopes) - 1 - depth
+	if depth < 0 || index < 0 {
+		return nil
+	}
+	return scopestack.Scopes[index]
+}
+
+// VariableAt returns the value a binding points to, dynamic bindings are found by the key
+func (scopestack *Scopestack) VariableAt(key string, binding ast.Binding) ScopeValue {
+	if binding.Dynamic {
+		return scopestack.FindVariable(key)
+	}
+	scope := scopestack.At(binding.Depth)
 
-	scopestack.Scopes = result.Scopes
-	return &scope
+	if scope == nil || binding.Index < 0 || binding.Index >= len(scope.Frame) {
+		return ScopeValue{}
+	}
+
+	return ScopeValue{
+		Value:      &scope.Frame[binding.Index],
+		Foreign:    scope.Foreign,
+		Immutable:  scope.Immutable,
+		OuterScope: binding.Depth != 0,
+	}
 }
 
-func (scopestack *Scopestack) AddVariable(value Value) {
-	scopestack.GetCurrentScope().Frame = append(scopestack.GetCurrentScope().Frame, value)
+func (scopestack *Scopestack) BlockAt(key string, binding ast.Binding) ScopeBlock {
+	if binding.Dynamic {
+		return scopestack.FindBlock(key)
+	}
+	scope := scopestack.At(binding.Depth)
+
+	if scope == nil || binding.Index < 0 || binding.Index >= len(scope.Blocks) {
+		return ScopeBlock{}
+	}
+
+	return ScopeBlock{
+		Block:      &scope.Blocks[binding.Index],
+		Foreign:    scope.Foreign,
+		Immutable:  scope.Immutable,
+		OuterScope: binding.Depth != 0,
+	}
 }
 
-func (scopestack *Scopestack) IsVariableUpdatable(key string) UpdateReport {
-	if !scopestack.VariableExists(key) {
+func (scopestack *Scopestack) IsVariableUpdatable(key string, binding ast.Binding) UpdateReport {
+	scope_value := scopestack.VariableAt(key, binding)
+
+	if scope_value.Value == nil {
 		return 1
 	} else {
-		scope_value := scopestack.FindVariable(key)
 		if scope_value.Immutable || scope_value.Value.Kind == "const" {
 			return 2
 		} else {
@@ -73,43 +98,30 @@ func (scopestack *Scopestack) IsVariableUpdatable(key string) UpdateReport {
 	}
 }
 
-func (scopestack *Scopestack) UpdateVariable(key string, value ast.IntPrimitiveExpression) {
-	var i int
-	var j int
-	for k, scope := range scopestack.Reverse() {
-		for v, value := range scope.Frame {
-			if value.Key.Value == key {
-				i = k
-				j = v
-			}
-		}
-	}
+func (scopestack *Scopestack) UpdateVariable(key string, binding ast.Binding, value ast.IntPrimitiveExpression) {
+	scope_value := scopestack.VariableAt(key, binding)
 
-	scopestack.Reverse()[i].Frame[j].Value = value
+	if scope_value.Value != nil {
+		scope_value.Value.Value = value
+	}
 }
 
 func (scopestack *Scopestack) VariableExists(key string) bool {
-	for _, scope := range scopestack.Reverse() {
-		for _, value := range scope.Frame {
-			if value.Key.Value == key {
-				return true
-			}
-		}
-	}
-
-	return false
+	return scopestack.FindVariable(key).Value != nil
 }
 
 func (scopestack *Scopestack) FindVariable(key string) ScopeValue {
-	for i, scope := range scopestack.Reverse() {
-		for _, value := range scope.Frame {
-			if value.Key.Value == key {
-				return ScopeValue{
-					Value:      &value,
-					Foreign:    scope.Foreign,
-					Immutable:  scope.Immutable,
-					OuterScope: i != 0,
-				}
+	for i := len(scopestack.Scopes) - 1; i >= 0; i-- {
+		scope := scopestack.Scopes[i]
+		if scope.Alias != "" {
+			continue
+		}
+		if index := scope.IndexOfVariable(key); index >= 0 && scope.Visible(key) {
+			return ScopeValue{
+				Value:      &scope.Frame[index],
+				Foreign:    scope.Foreign,
+				Immutable:  scope.Immutable,
+				OuterScope: i != len(scopestack.Scopes)-1,
 			}
 		}
 	}
@@ -130,31 +142,23 @@ func (scopestack *Scopestack) AddNativeBlock(block ast.BlockDeclarationStatement
 	scopestack.GetCurrentScope().Blocks = append(scopestack.GetCurrentScope().Blocks, block)
 }
 
-func (scopestack *Scopestack) SwapAtIndex(index int, scope Scope) {
-	scopestack.Scopes[len(scopestack.Scopes)-1-index] = scope
-}
-
 func (scopestack *Scopestack) BlockExists(key string) bool {
-	for _, scope := range scopestack.Reverse() {
-		for _, value := range scope.Blocks {
-			if value.Name.Value == key {
-				return true
-			}
-		}
-	}
-
-	return false
+	return scopestack.FindBlock(key).Block != nil
 }
 
 func (scopestack *Scopestack) FindBlock(key string) ScopeBlock {
-	for i, scope := range scopestack.Reverse() {
-		for _, value := range scope.Blocks {
-			if value.Name.Value == key {
+	for i := len(scopestack.Scopes) - 1; i >= 0; i-- {
+		scope := scopestack.Scopes[i]
+		if scope.Alias != "" {
+			continue
+		}
+		for j := range scope.Blocks {
+			if scope.Blocks[j].Name.Value == key && scope.Visible(key) {
 				return ScopeBlock{
-					Block:      &value,
+					Block:      &scope.Blocks[j],
 					Foreign:    scope.Foreign,
 					Immutable:  scope.Immutable,
-					OuterScope: i != 0,
+					OuterScope: i != len(scopestack.Scopes)-1,
 				}
 			}
 		}
@@ -168,8 +172,18 @@ func (scopestack *Scopestack) FindBlock(key string) ScopeBlock {
 	}
 }
 
+// FindModule returns the scope of the module imported with an alias, or nil if there is none
+func (scopestack *Scopestack) FindModule(alias string) *Scope {
+	for _, scope := range scopestack.Scopes {
+		if scope.Alias == alias {
+			return scope
+		}
+	}
+	return nil
+}
+
 func (scopestack *Scopestack) GetCurrentScope() *Scope {
-	return &scopestack.Scopes[len(scopestack.Scopes)-1]
+	return scopestack.Scopes[len(scopestack.Scopes)-1]
 }
 
 func (scopestack *Scopestack) NamespaceExists(name string) bool {
@@ -204,9 +218,32 @@ func (scopestack *Scopestack) FindInNamespace(name string, index string) *Value
 	return &selected_value
 }
 
+// FindInNamespaceBlock returns a block declared in a namespace, the block is nil if there is none
+func (scopestack *Scopestack) FindInNamespaceBlock(name string, block string) ScopeBlock {
+	var selected_namespace *Namespace
+
+	for i := range scopestack.Namespaces {
+		if scopestack.Namespaces[i].Name == name {
+			selected_namespace = &scopestack.Namespaces[i]
+		}
+	}
+
+	result := ScopeBlock{Foreign: true, OuterScope: true}
+	if selected_namespace == nil {
+		return result
+	}
+	for i := range selected_namespace.Scope.Blocks {
+		if selected_namespace.Scope.Blocks[i].Name.Value == block {
+			result.Block = &selected_namespace.Scope.Blocks[i]
+		}
+	}
+	return result
+}
+
 type Namespace struct {
-	Name  string `json:"name"`
-	Scope Scope  `json:"scope"`
+	Name    string `json:"name"`
+	Scope   Scope  `json:"scope"`
+	Foreign bool   `json:"foreign"`
 }
 
 type ScopeBlock struct {
@@ -230,10 +267,20 @@ type Value struct {
 }
 
 type Scope struct {
-	Immutable bool                            `json:"immutable"`
-	Foreign   bool                            `json:"foreign"`
-	Frame     []Value                         `json:"frame"`
-	Blocks    []ast.BlockDeclarationStatement `json:"blocks"`
+	Immutable bool `json:"immutable"`
+	Foreign   bool `json:"foreign"`
+	// Alias is the name a module is imported as, the names of an aliased scope are only found through it
+	Alias string `json:"alias"`
+	// Exported holds the names of an imported module that are visible, every name is when it is nil
+	Exported map[string]bool                      `json:"exported"`
+	Frame    []Value                              `json:"frame"`
+	Blocks   []ast.BlockDeclarationStatement      `json:"blocks"`
+	Cells    map[int64]ast.IntPrimitiveExpression `json:"cells"`
+}
+
+// Visible tells if a name of the scope is found by lookups, imported modules only show their exports
+func (scope *Scope) Visible(name string) bool {
+	return scope.Exported == nil || scope.Exported[name]
 }
 
 func (scope *Scope) AddVariable(value Value) {
@@ -244,4 +291,43 @@ func (scope *Scope) DeleteVariable(index int) {
 	scope.Frame = append(scope.Frame[:index], scope.Frame[index+1:]...)
 }
 
+func (scope *Scope) IndexOfVariable(key string) int {
+	for i := range scope.Frame {
+		if scope.Frame[i].Key.Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Copy returns a scope that shares no storage with the original one, implementing blocks start
+// with a copy of the instance they implement
+func (scope *Scope) Copy() *Scope {
+	result := &Scope{Immutable: scope.Immutable, Foreign: scope.Foreign}
+	result.Frame = append(result.Frame, scope.Frame...)
+	result.Blocks = append(result.Blocks, scope.Blocks...)
+	for index, value := range scope.Cells {
+		result.WriteCell(index, value)
+	}
+	return result
+}
+
+// WriteCell stores a value in the cells of the scope, cells are the indexed storage scope mutaters and
+// populations work on and are kept apart from the named variables in the frame
+func (scope *Scope) WriteCell(index int64, value ast.IntPrimitiveExpression) {
+	if scope.Cells == nil {
+		scope.Cells = map[int64]ast.IntPrimitiveExpression{}
+	}
+	scope.Cells[index] = value
+}
+
+func (scope *Scope) ReadCell(index int64) (ast.IntPrimitiveExpression, bool) {
+	value, ok := scope.Cells[index]
+	return value, ok
+}
+
+func (scope *Scope) DeleteCell(index int64) {
+	delete(scope.Cells, index)
+}
+
 type UpdateReport int
@@ -0,0 +1,71 @@
+package scope
+
+import (
+	"testing"
+
+	"github.com/canpacis/birlang/src/ast"
+)
+
+func value(v int64) ast.IntPrimitiveExpression {
+	return ast.IntPrimitiveExpression{Operation: "primitive", Type: "int", Value: v}
+}
+
+func TestCells(t *testing.T) {
+	s := &Scope{}
+
+	if _, ok := s.ReadCell(0); ok {
+		t.Fatalf("read a cell of an empty scope")
+	}
+	s.DeleteCell(0)
+
+	indices := []int64{0, 7, -3, 1 << 40}
+	for _, index := range indices {
+		s.WriteCell(index, value(index+1))
+	}
+	for _, index := range indices {
+		got, ok := s.ReadCell(index)
+		if !ok || got.Value != index+1 {
+			t.Errorf("cell %d: got %d %v, want %d", index, got.Value, ok, index+1)
+		}
+	}
+	if len(s.Cells) != len(indices) {
+		t.Errorf("got %d cells, want %d, sparse indices should not allocate the ones between them", len(s.Cells), len(indices))
+	}
+
+	s.WriteCell(7, value(70))
+	if got, _ := s.ReadCell(7); got.Value != 70 {
+		t.Errorf("got %d after overwriting, want 70", got.Value)
+	}
+
+	s.DeleteCell(7)
+	if _, ok := s.ReadCell(7); ok {
+		t.Errorf("read a deleted cell")
+	}
+	if got, ok := s.ReadCell(0); !ok || got.Value != 1 {
+		t.Errorf("deleting a cell changed another one")
+	}
+}
+
+func TestCopyCells(t *testing.T) {
+	original := &Scope{}
+	original.WriteCell(1, value(10))
+	original.AddVariable(Value{Key: ast.Identifier{Value: "a"}, Value: value(5)})
+
+	copied := original.Copy()
+	copied.WriteCell(1, value(20))
+	copied.WriteCell(2, value(30))
+	copied.Frame[0].Value = value(6)
+
+	if got, _ := original.ReadCell(1); got.Value != 10 {
+		t.Errorf("writing to a copy changed the original cell to %d", got.Value)
+	}
+	if _, ok := original.ReadCell(2); ok {
+		t.Errorf("writing to a copy added a cell to the original")
+	}
+	if original.Frame[0].Value.Value != 5 {
+		t.Errorf("assigning in a copy changed the original variable to %d", original.Frame[0].Value.Value)
+	}
+	if got, _ := copied.ReadCell(1); got.Value != 20 {
+		t.Errorf("got %d in the copy, want 20", got.Value)
+	}
+}
@@ -0,0 +1,73 @@
+package tester
+
+import (
+	"strconv"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/implementor"
+	"github.com/canpacis/birlang/src/util"
+)
+
+const (
+	ExpectEqual = iota + 2000000
+	ExpectNotEqual
+	ExpectTrue
+	ExpectThrows
+)
+
+// Assert is the implementor test engines have, a failing assertion throws a native error that ends the
+// test. 'std:assert' declares its verbs in the 'expect' namespace.
+type Assert struct {
+	// Throws is the value the test is expected to throw, set by 'assert:expect.throws'
+	Throws *int64
+}
+
+func (assert *Assert) Name() string {
+	return "assert"
+}
+
+func (assert *Assert) Verbs() map[int64]implementor.Verb {
+	return map[int64]implementor.Verb{
+		ExpectEqual:    {Name: "equal", Arguments: 2, Function: assert.Equal},
+		ExpectNotEqual: {Name: "not_equal", Arguments: 2, Function: assert.NotEqual},
+		ExpectTrue:     {Name: "true", Arguments: 1, Function: assert.True},
+		ExpectThrows:   {Name: "throws", Arguments: 1, Function: assert.ExpectThrows},
+	}
+}
+
+func pass() ast.NativeFunctionReturn {
+	return util.GenerateNativeFunctionReturn(false, false, "", -1)
+}
+
+func fail(message string) ast.NativeFunctionReturn {
+	return util.GenerateNativeFunctionReturn(true, false, "Assertion failed, "+message, -1)
+}
+
+func (assert *Assert) Equal(verbs []ast.IntPrimitiveExpression, arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
+	if arguments[0].Value != arguments[1].Value {
+		return fail("expected " + strconv.FormatInt(arguments[0].Value, 10) + " to equal " + strconv.FormatInt(arguments[1].Value, 10))
+	}
+	return pass()
+}
+
+func (assert *Assert) NotEqual(verbs []ast.IntPrimitiveExpression, arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
+	if arguments[0].Value == arguments[1].Value {
+		return fail("expected " + strconv.FormatInt(arguments[0].Value, 10) + " not to equal " + strconv.FormatInt(arguments[1].Value, 10))
+	}
+	return pass()
+}
+
+// True passes for every value but 0, which is what conditions evaluate to when they do not hold
+func (assert *Assert) True(verbs []ast.IntPrimitiveExpression, arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
+	if arguments[0].Value == 0 {
+		return fail("expected a true value, found 0")
+	}
+	return pass()
+}
+
+// ExpectThrows makes the test pass only if it ends by throwing the given value
+func (assert *Assert) ExpectThrows(verbs []ast.IntPrimitiveExpression, arguments []ast.IntPrimitiveExpression) ast.NativeFunctionReturn {
+	value := arguments[0].Value
+	assert.Throws = &value
+	return pass()
+}
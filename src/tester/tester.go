@@ -0,0 +1,213 @@
+// Package tester finds the tests of bir programs and runs each of them in an engine of its own
+package tester
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/engine"
+	"github.com/canpacis/birlang/src/parser"
+	"github.com/canpacis/birlang/src/thrower"
+	"github.com/canpacis/birlang/src/util"
+)
+
+// Result is the outcome of a test, a test whose file could not be loaded has no name
+type Result struct {
+	File     string
+	Name     string
+	Error    error
+	Duration time.Duration
+}
+
+func (result Result) Passed() bool {
+	return result.Error == nil
+}
+
+// Tester runs the tests of files, every engine it creates is kept so that coverage can be collected
+// from them afterwards
+type Tester struct {
+	StdPath string
+	Tracer  engine.Tracer
+	// Configure is called on every engine before it is initialized, an error fails the engine
+	Configure func(instance *engine.BirEngine) error
+	Engines   []*engine.BirEngine
+	Results   []Result
+}
+
+func New(std_path string) *Tester {
+	return &Tester{StdPath: std_path}
+}
+
+// Discover returns the test files among the given paths, directories are searched recursively for
+// files ending with '_test.bir'
+func Discover(paths []string) ([]string, error) {
+	files := []string{}
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, root)
+			continue
+		}
+
+		err = filepath.Walk(root, func(file_path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(info.Name(), "_test.bir") {
+				files = append(files, file_path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Tests returns the names of the top level blocks of a program that start with 'test'
+func Tests(program *ast.Program) []string {
+	names := []string{}
+	for _, statement := range program.Program {
+		if block, ok := statement.(*ast.BlockDeclarationStatement); ok && strings.HasPrefix(block.Name.Value, "test") {
+			names = append(names, block.Name.Value)
+		}
+	}
+	return names
+}
+
+// engine creates a configured engine for a test file
+func (tester *Tester) engine(file string, assert *Assert) (*engine.BirEngine, error) {
+	instance := engine.NewEngine(filepath.ToSlash(file), tester.StdPath, false, false, 0)
+	instance.Tracer = tester.Tracer
+	instance.Register(assert)
+	if tester.Configure != nil {
+		if err := tester.Configure(&instance); err != nil {
+			return &instance, err
+		}
+	}
+	return &instance, nil
+}
+
+// load creates an engine for a test file and runs its top level
+func (tester *Tester) load(file string, assert *Assert) (*engine.BirEngine, error) {
+	instance, err := tester.engine(file, assert)
+	if err != nil {
+		return instance, err
+	}
+	tester.Engines = append(tester.Engines, instance)
+
+	if err := instance.Init(); err != nil {
+		return instance, err
+	}
+	return instance, instance.Run()
+}
+
+// RunFile runs every test of a file, each in a fresh engine, and returns their results. The tests are
+// found in the syntax tree so that the top level only runs once for each test.
+func (tester *Tester) RunFile(file string) []Result {
+	start := time.Now()
+	program, err := tester.parse(file)
+	if err != nil {
+		return []Result{tester.add(Result{File: file, Error: err, Duration: time.Since(start)})}
+	}
+
+	results := []Result{}
+	for _, name := range Tests(program) {
+		results = append(results, tester.Run(file, name))
+	}
+	return results
+}
+
+// parse reads the syntax tree of a test file, a file that could not be read or parsed is reported by an
+// engine that is not kept since it runs nothing
+func (tester *Tester) parse(file string) (*ast.Program, error) {
+	raw, err := os.ReadFile(file)
+	if err == nil {
+		result := parser.Parse(string(raw))
+		if !result.Error {
+			if program, err := ast.Decode(result.Content); err == nil {
+				return program, nil
+			}
+		}
+	}
+
+	instance, err := tester.engine(file, &Assert{})
+	if err == nil {
+		err = instance.Init()
+	}
+	return nil, err
+}
+
+// Run runs a single test in a fresh engine
+func (tester *Tester) Run(file string, name string) Result {
+	start := time.Now()
+	assert := &Assert{}
+	instance, err := tester.load(file, assert)
+	if err == nil {
+		_, err = instance.CallBlock(name, []int64{}, []int64{})
+	}
+
+	if assert.Throws != nil {
+		bir_error, ok := err.(*thrower.BirError)
+		if err == nil {
+			err = instance.Thrower.ThrowAnonymous(thrower.NativeError, "Assertion failed, expected the test to throw "+strconv.FormatInt(*assert.Throws, 10))
+		} else if ok && bir_error.Kind == thrower.ThrowError && bir_error.Value == *assert.Throws {
+			err = nil
+		} else if ok && bir_error.Kind == thrower.ThrowError {
+			err = instance.Thrower.ThrowAnonymous(thrower.NativeError, "Assertion failed, expected the test to throw "+strconv.FormatInt(*assert.Throws, 10)+", it threw "+strconv.FormatInt(bir_error.Value, 10))
+		}
+	}
+	return tester.add(Result{File: file, Name: name, Error: err, Duration: time.Since(start)})
+}
+
+func (tester *Tester) add(result Result) Result {
+	tester.Results = append(tester.Results, result)
+	return result
+}
+
+// Failed counts the results that did not pass
+func (tester *Tester) Failed() int {
+	failed := 0
+	for _, result := range tester.Results {
+		if !result.Passed() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// WriteResult writes a line for a result, followed by the error of a failing one
+func WriteResult(output io.Writer, result Result, color util.Color) {
+	name := result.File
+	if result.Name != "" {
+		name += " " + result.Name
+	}
+
+	if result.Passed() {
+		io.WriteString(output, "ok    "+name+" ("+result.Duration.String()+")\n")
+		return
+	}
+	io.WriteString(output, "FAIL  "+name+" ("+result.Duration.String()+")\n")
+	if bir_error, ok := result.Error.(*thrower.BirError); ok {
+		io.WriteString(output, bir_error.Format(color))
+	} else {
+		io.WriteString(output, result.Error.Error()+"\n")
+	}
+}
+
+// WriteSummary writes how many tests passed and failed
+func (tester *Tester) WriteSummary(output io.Writer) {
+	failed := tester.Failed()
+	io.WriteString(output, "\n"+strconv.Itoa(len(tester.Results)-failed)+" passed, "+strconv.Itoa(failed)+" failed\n")
+}
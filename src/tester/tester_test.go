@@ -0,0 +1,190 @@
+package tester_test
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/canpacis/birlang/internal/testfiles"
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/engine"
+	"github.com/canpacis/birlang/src/parser"
+	"github.com/canpacis/birlang/src/tester"
+	"github.com/canpacis/birlang/src/thrower"
+	"github.com/canpacis/birlang/src/util"
+)
+
+const math = `add [a, b] {
+  return a + b
+}
+check [a] {
+  if a < 0 {
+    throw 42
+  } else {
+    return a
+  }
+}
+`
+
+const math_test = `use "std:assert"
+use "./math.bir"
+
+test_add [] {
+  assert:expect.equal (add (1, 2), 3)
+  assert:expect.not_equal (add (1, 2), 4)
+  assert:expect.true (add (1, 2) > 2)
+}
+test_throws [] {
+  assert:expect.throws (42)
+  check (-1)
+}
+test_bad [] {
+  assert:expect.equal (add (1, 2), 5)
+}
+test_no_throw [] {
+  assert:expect.throws (42)
+  check (1)
+}
+test_other_throw [] {
+  assert:expect.throws (7)
+  check (-1)
+}
+helper [] {
+  return 1
+}
+`
+
+func TestDiscover(t *testing.T) {
+	directory := testfiles.Write(t, map[string]string{
+		"a_test.bir":     "",
+		"b.bir":          "",
+		"sub/c_test.bir": "",
+		"other/d.bir":    "",
+	})
+
+	files, err := tester.Discover([]string{directory, directory + "/other/d.bir"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := []string{directory + "/a_test.bir", directory + "/other/d.bir", directory + "/sub/c_test.bir"}
+	for i := range files {
+		files[i] = filepath.ToSlash(files[i])
+	}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Errorf("got %q, want %q", files, want)
+	}
+
+	if _, err := tester.Discover([]string{directory + "/missing"}); err == nil {
+		t.Errorf("discovered tests in a path that does not exist")
+	}
+}
+
+func TestTests(t *testing.T) {
+	result := parser.Parse(math_test)
+	if result.Error {
+		t.Fatalf("could not parse the test file")
+	}
+	program, err := ast.Decode(result.Content)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	names := tester.Tests(program)
+	if strings.Join(names, ",") != "test_add,test_throws,test_bad,test_no_throw,test_other_throw" {
+		t.Errorf("got %q", names)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	directory := testfiles.Write(t, map[string]string{"math.bir": math, "math_test.bir": math_test})
+
+	runner := tester.New("")
+	results := runner.RunFile(directory + "/math_test.bir")
+	want := []struct {
+		name    string
+		message string
+	}{
+		{"test_add", ""},
+		{"test_throws", ""},
+		{"test_bad", "Assertion failed, expected 3 to equal 5"},
+		{"test_no_throw", "Assertion failed, expected the test to throw 42"},
+		{"test_other_throw", "Assertion failed, expected the test to throw 7, it threw 42"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, result := range results {
+		message := ""
+		if result.Error != nil {
+			message = result.Error.Error()
+		}
+		if result.Name != want[i].name || message != want[i].message || result.Passed() != (want[i].message == "") {
+			t.Errorf("got %s %q, want %s %q", result.Name, message, want[i].name, want[i].message)
+		}
+	}
+
+	// Every test has an engine of its own and the file is not run once more to find the tests
+	if len(runner.Engines) != len(want) {
+		t.Errorf("got %d engines, want %d", len(runner.Engines), len(want))
+	}
+	if runner.Failed() != 3 || len(runner.Results) != 5 {
+		t.Errorf("got %d failures of %d results, want 3 of 5", runner.Failed(), len(runner.Results))
+	}
+}
+
+func TestRunFileErrors(t *testing.T) {
+	directory := testfiles.Write(t, map[string]string{
+		"parse_test.bir":  "test_a [] {\n",
+		"import_test.bir": "use \"./missing.bir\"\ntest_a [] {\n  return 1\n}\n",
+	})
+
+	runner := tester.New("")
+	results := runner.RunFile(directory + "/parse_test.bir")
+	if len(results) != 1 || results[0].Name != "" || results[0].Passed() {
+		t.Errorf("got %+v, want a single failure without a name", results)
+	}
+	if len(runner.Engines) != 0 {
+		t.Errorf("kept the engine of a file that did not parse")
+	}
+
+	results = runner.RunFile(directory + "/import_test.bir")
+	var bir_error *thrower.BirError
+	if len(results) != 1 || results[0].Name != "test_a" || !errors.As(results[0].Error, &bir_error) || bir_error.Kind != thrower.ImportError {
+		t.Errorf("got %+v, want the test to fail with the import error", results)
+	}
+
+	runner.Configure = func(instance *engine.BirEngine) error {
+		return errors.New("bad configuration")
+	}
+	results = runner.RunFile(directory + "/import_test.bir")
+	if len(results) != 1 || results[0].Error == nil || results[0].Error.Error() != "bad configuration" {
+		t.Errorf("got %+v, want the configuration to fail the test", results)
+	}
+}
+
+func TestWriteResult(t *testing.T) {
+	tests := []struct {
+		result tester.Result
+		want   string
+	}{
+		{tester.Result{File: "a_test.bir", Name: "test_a", Duration: time.Millisecond}, "ok    a_test.bir test_a (1ms)\n"},
+		{tester.Result{File: "a_test.bir", Error: errors.New("Could not read file")}, "FAIL  a_test.bir (0s)\nCould not read file\n"},
+	}
+	for _, test := range tests {
+		output := &bytes.Buffer{}
+		tester.WriteResult(output, test.result, util.NewColor(false))
+		if output.String() != test.want {
+			t.Errorf("got %q, want %q", output.String(), test.want)
+		}
+	}
+
+	runner := &tester.Tester{Results: []tester.Result{{Name: "a"}, {Name: "b", Error: errors.New("x")}, {Name: "c"}}}
+	output := &bytes.Buffer{}
+	runner.WriteSummary(output)
+	if output.String() != "\n2 passed, 1 failed\n" {
+		t.Errorf("got %q", output.String())
+	}
+}
@@ -1,93 +1,175 @@
 package thrower
 
 import (
+	"io"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/canpacis/birlang/src/ast"
 	"github.com/canpacis/birlang/src/util"
-	"github.com/mitchellh/mapstructure"
 )
 
-type Thrower struct {
-	Owner interface{} `json:"owner"`
-	Color util.Color  `json:"color"`
+type ErrorKind string
+
+const (
+	SyntaxError    ErrorKind = "syntax"
+	ReferenceError ErrorKind = "reference"
+	RuntimeError   ErrorKind = "runtime"
+	ThrowError     ErrorKind = "throw"
+	OverflowError  ErrorKind = "overflow"
+	NativeError    ErrorKind = "native"
+	ImportError    ErrorKind = "import"
+	BudgetError    ErrorKind = "budget"
+	CancelledError ErrorKind = "cancelled"
+	WarningError   ErrorKind = "warning"
+	InternalError  ErrorKind = "internal"
+)
+
+// BirError is the error every failing bir program produces, it carries everything needed to
+// report the failure without going back to the engine that produced it
+type BirError struct {
+	Kind      ErrorKind    `json:"kind"`
+	Message   string       `json:"message"`
+	Position  ast.Position `json:"position"`
+	File      string       `json:"file"`
+	URI       string       `json:"uri"`
+	Callstack []string     `json:"callstack"`
+	Snippet   string       `json:"snippet"`
+	Anonymous bool         `json:"anonymous"`
+	Located   bool         `json:"located"`
+	Value     int64        `json:"value"`
+	Cause     error        `json:"-"`
+}
+
+func (err *BirError) Error() string {
+	return err.Message
 }
 
-func (thrower *Thrower) Throw(message string, position ast.Position, callstack interface{}) {
-	var engine map[string]interface{}
-	mapstructure.Decode(thrower.Owner, &engine)
+// Unwrap returns the go error that caused the bir error, like the error of a cancelled context
+func (err *BirError) Unwrap() error {
+	return err.Cause
+}
 
-	if !engine["Anonymous"].(bool) {
-		os.Stdout.WriteString(thrower.Color.OutputRed("[ERROR]") + " " + message + " at " + thrower.Color.OutputCyan(strconv.Itoa(int(position.Line))+":"+strconv.Itoa(int(position.Col))) + " in " + thrower.Color.OutputYellow(engine["Filename"].(string)) + "\n")
-		os.Stdout.WriteString("\n" + thrower.GetSnippet(position) + "\n")
-		os.Stdout.WriteString("\nCallstack:\n\t" + thrower.GetCallstack(callstack) + "\n")
-		os.Stdout.WriteString("\nFile:\n\t" + thrower.Color.OutputRed(engine["URI"].(string)) + "\n")
-		os.Exit(1)
-	} else {
-		os.Stdout.WriteString(thrower.Color.OutputRed("[ERROR]") + " " + message + " in " + thrower.Color.OutputYellow("[REPL]") + "\n")
+// Format renders the error the way the command line reports it
+func (err *BirError) Format(color util.Color) string {
+	if !err.Located {
+		return color.OutputRed("[ERROR]") + " " + err.Message + "\n"
+	}
+	if err.Anonymous {
+		return color.OutputRed("[ERROR]") + " " + err.Message + " in " + color.OutputYellow("[REPL]") + "\n"
 	}
+
+	callstack := []string{}
+	for _, label := range err.Callstack {
+		callstack = append(callstack, color.OutputCyan(label)+color.OutputGrey(" ()"))
+	}
+
+	result := color.OutputRed("[ERROR]") + " " + err.Message + " at " + color.OutputCyan(strconv.Itoa(int(err.Position.Line))+":"+strconv.Itoa(int(err.Position.Col))) + " in " + color.OutputYellow(err.File) + "\n"
+	result += "\n" + err.Snippet + "\n"
+	result += "\nCallstack:\n\t" + strings.Join(callstack, "\n\t") + "\n"
+	result += "\nFile:\n\t" + color.OutputRed(err.URI) + "\n"
+	return result
+}
+
+// Owner is what a thrower reports for, an engine or a module of the virtual machine
+type Owner interface {
+	// Source describes the file errors and warnings point to
+	Source() Source
+	// Labels are the labels of the callstack of the owner from its bottom
+	Labels() []string
+}
+
+type Source struct {
+	Filename       string
+	URI            string
+	Content        string
+	Anonymous      bool
+	VerbosityLevel int
 }
 
-func (thrower *Thrower) ThrowAnonymous(message string) {
-	var engine map[string]interface{}
-	mapstructure.Decode(thrower.Owner, &engine)
+type Thrower struct {
+	Owner  Owner      `json:"-"`
+	Color  util.Color `json:"color"`
+	Output io.Writer  `json:"-"`
+}
 
-	os.Stdout.WriteString(thrower.Color.OutputRed("[ERROR]") + " " + message + "\n")
+// writer is where warnings go, the standard error unless the owner gave another one
+func (thrower *Thrower) writer() io.Writer {
+	if thrower.Output == nil {
+		return os.Stderr
+	}
+	return thrower.Output
+}
 
-	if !engine["Anonymous"].(bool) {
-		os.Exit(1)
+// Throw creates an error located in the owner's file
+func (thrower *Thrower) Throw(kind ErrorKind, message string, position ast.Position) *BirError {
+	source := thrower.Owner.Source()
+
+	return &BirError{
+		Kind:      kind,
+		Message:   message,
+		Position:  position,
+		File:      source.Filename,
+		URI:       source.URI,
+		Callstack: thrower.Owner.Labels(),
+		Snippet:   thrower.GetSnippet(position),
+		Anonymous: source.Anonymous,
+		Located:   true,
 	}
 }
 
-func (thrower *Thrower) GetSnippet(position ast.Position) string {
-	var engine map[string]interface{}
-	mapstructure.Decode(thrower.Owner, &engine)
-	lines := strings.Split(engine["Content"].(string), "\n")
+// ThrowAnonymous creates an error that does not point to a place in the owner's file
+func (thrower *Thrower) ThrowAnonymous(kind ErrorKind, message string) *BirError {
+	source := thrower.Owner.Source()
 
-	dummy := make([]string, position.Col)
-	result := lines[position.Line-1] + "\n" + strings.Join(dummy, " ") + "^"
-	return result
+	return &BirError{
+		Kind:      kind,
+		Message:   message,
+		File:      source.Filename,
+		URI:       source.URI,
+		Anonymous: source.Anonymous,
+	}
 }
 
-func (thrower *Thrower) GetCallstack(c interface{}) string {
-	var callstack []map[string]interface{}
-	mapstructure.Decode(c, &callstack)
+func (thrower *Thrower) GetSnippet(position ast.Position) string {
+	lines := strings.Split(thrower.Owner.Source().Content, "\n")
 
-	result := []string{}
-	for _, stack := range callstack {
-		result = append(result, thrower.Color.OutputCyan(stack["Label"].(string))+thrower.Color.OutputGrey(" ()"))
+	if position.Line == 0 || int(position.Line) > len(lines) {
+		return ""
 	}
 
-	return strings.Join(result, "\n\t")
+	dummy := make([]string, position.Col)
+	result := lines[position.Line-1] + "\n" + strings.Join(dummy, " ") + "^"
+	return result
 }
 
-func (thrower *Thrower) Warn(message string, position ast.Position, callstack interface{}) {
-	var engine map[string]interface{}
-	mapstructure.Decode(thrower.Owner, &engine)
-
-	if engine["VerbosityLevel"].(int) == 1 || engine["VerbosityLevel"].(int) == 2 {
-		if !engine["Anonymous"].(bool) {
-			os.Stdout.WriteString(thrower.Color.OutputYellow("[WARNING]") + " " + message + " at " + thrower.Color.OutputCyan(strconv.Itoa(int(position.Line))+":"+strconv.Itoa(int(position.Col))) + " in " + thrower.Color.OutputYellow(engine["Filename"].(string)) + "\n")
-			if engine["VerbosityLevel"].(int) == 2 {
-				os.Stdout.WriteString("\n" + thrower.GetSnippet(position) + "\n")
-				os.Stdout.WriteString("\nCallstack:\n\t" + thrower.GetCallstack(callstack) + "\n")
-				os.Stdout.WriteString("\nFile:\n\t" + thrower.Color.OutputRed(engine["URI"].(string)) + "\n")
+func (thrower *Thrower) Warn(message string, position ast.Position) {
+	source := thrower.Owner.Source()
+
+	if source.VerbosityLevel == 1 || source.VerbosityLevel == 2 {
+		if !source.Anonymous {
+			io.WriteString(thrower.writer(), thrower.Color.OutputYellow("[WARNING]")+" "+message+" at "+thrower.Color.OutputCyan(strconv.Itoa(int(position.Line))+":"+strconv.Itoa(int(position.Col)))+" in "+thrower.Color.OutputYellow(source.Filename)+"\n")
+			if source.VerbosityLevel == 2 {
+				labels := []string{}
+				for _, label := range thrower.Owner.Labels() {
+					labels = append(labels, thrower.Color.OutputCyan(label)+thrower.Color.OutputGrey(" ()"))
+				}
+
+				io.WriteString(thrower.writer(), "\n"+thrower.GetSnippet(position)+"\n")
+				io.WriteString(thrower.writer(), "\nCallstack:\n\t"+strings.Join(labels, "\n\t")+"\n")
+				io.WriteString(thrower.writer(), "\nFile:\n\t"+thrower.Color.OutputRed(source.URI)+"\n")
 			}
 		} else {
-			os.Stdout.WriteString(thrower.Color.OutputYellow("[WARNING]") + " " + message + " in " + thrower.Color.OutputYellow("[REPL]") + "\n")
+			io.WriteString(thrower.writer(), thrower.Color.OutputYellow("[WARNING]")+" "+message+" in "+thrower.Color.OutputYellow("[REPL]")+"\n")
 		}
 	}
 }
 
 func (thrower *Thrower) WarnAnonymous(message string) {
-	var engine map[string]interface{}
-	mapstructure.Decode(thrower.Owner, &engine)
-
-	if !engine["Anonymous"].(bool) {
-		os.Stdout.WriteString(thrower.Color.OutputYellow("[WARNING]") + " " + message + "\n")
+	if !thrower.Owner.Source().Anonymous {
+		io.WriteString(thrower.writer(), thrower.Color.OutputYellow("[WARNING]")+" "+message+"\n")
 	} else {
-		os.Stdout.WriteString(thrower.Color.OutputYellow("[WARNING]") + " " + message + " in " + thrower.Color.OutputYellow("[REPL]") + "\n")
+		io.WriteString(thrower.writer(), thrower.Color.OutputYellow("[WARNING]")+" "+message+" in "+thrower.Color.OutputYellow("[REPL]")+"\n")
 	}
 }
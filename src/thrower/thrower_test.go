@@ -0,0 +1,123 @@
+package thrower
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/util"
+)
+
+type owner struct {
+	source Source
+	labels []string
+}
+
+func (owner *owner) Source() Source {
+	return owner.source
+}
+
+func (owner *owner) Labels() []string {
+	return owner.labels
+}
+
+func newThrower(anonymous bool, verbosity int, output *bytes.Buffer) Thrower {
+	return Thrower{
+		Owner: &owner{
+			source: Source{
+				Filename:       "main.bir",
+				URI:            "file:///main.bir",
+				Content:        "let a = 1\nlet b = c\n",
+				Anonymous:      anonymous,
+				VerbosityLevel: verbosity,
+			},
+			labels: []string{"main [main.bir]", "f"},
+		},
+		Color:  util.NewColor(false),
+		Output: output,
+	}
+}
+
+func TestThrow(t *testing.T) {
+	thrower := newThrower(false, 0, nil)
+	err := thrower.Throw(ReferenceError, "Could not find variable 'c' in the frame", ast.Position{Line: 2, Col: 9})
+
+	if err.Kind != ReferenceError || err.File != "main.bir" || err.URI != "file:///main.bir" || !err.Located || err.Anonymous {
+		t.Errorf("got %+v", err)
+	}
+	if len(err.Callstack) != 2 || err.Callstack[0] != "main [main.bir]" || err.Callstack[1] != "f" {
+		t.Errorf("got callstack %q", err.Callstack)
+	}
+	if err.Snippet != "let b = c\n        ^" {
+		t.Errorf("got snippet %q", err.Snippet)
+	}
+
+	want := "[ERROR] Could not find variable 'c' in the frame at 2:9 in main.bir\n\nlet b = c\n        ^\n\nCallstack:\n\tmain [main.bir] ()\n\tf ()\n\nFile:\n\tfile:///main.bir\n"
+	if formatted := err.Format(util.NewColor(false)); formatted != want {
+		t.Errorf("got %q, want %q", formatted, want)
+	}
+}
+
+func TestThrowAnonymous(t *testing.T) {
+	thrower := newThrower(false, 0, nil)
+	err := thrower.ThrowAnonymous(ImportError, "Could not read file 'x.bir'")
+	if err.Located {
+		t.Errorf("an anonymous error is located")
+	}
+	if formatted := err.Format(util.NewColor(false)); formatted != "[ERROR] Could not read file 'x.bir'\n" {
+		t.Errorf("got %q", formatted)
+	}
+
+	repl := newThrower(true, 0, nil)
+	err = repl.Throw(RuntimeError, "Division by zero", ast.Position{Line: 1, Col: 1})
+	if formatted := err.Format(util.NewColor(false)); formatted != "[ERROR] Division by zero in [REPL]\n" {
+		t.Errorf("got %q", formatted)
+	}
+}
+
+func TestSnippetOutOfRange(t *testing.T) {
+	thrower := newThrower(false, 0, nil)
+	for _, position := range []ast.Position{{Line: 0, Col: 1}, {Line: 9, Col: 1}} {
+		if snippet := thrower.GetSnippet(position); snippet != "" {
+			t.Errorf("%v: got %q, want no snippet", position, snippet)
+		}
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	thrower := newThrower(false, 0, nil)
+	err := thrower.Throw(CancelledError, "Bir process has been cancelled", ast.Position{Line: 1, Col: 1})
+	err.Cause = context.Canceled
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("the cause of the error is lost")
+	}
+	var bir_error *BirError
+	if !errors.As(error(err), &bir_error) || bir_error.Kind != CancelledError {
+		t.Errorf("could not find the bir error")
+	}
+}
+
+func TestWarn(t *testing.T) {
+	tests := []struct {
+		anonymous bool
+		verbosity int
+		want      string
+	}{
+		{false, 0, ""},
+		{false, 1, "[WARNING] Unused value at 2:1 in main.bir\n"},
+		{false, 2, "[WARNING] Unused value at 2:1 in main.bir\n\nlet b = c\n^\n\nCallstack:\n\tmain [main.bir] ()\n\tf ()\n\nFile:\n\tfile:///main.bir\n"},
+		{true, 1, "[WARNING] Unused value in [REPL]\n"},
+	}
+
+	for _, test := range tests {
+		output := &bytes.Buffer{}
+		thrower := newThrower(test.anonymous, test.verbosity, output)
+		thrower.Warn("Unused value", ast.Position{Line: 2, Col: 1})
+		if output.String() != test.want {
+			t.Errorf("anonymous %v, verbosity %d: got %q, want %q", test.anonymous, test.verbosity, output.String(), test.want)
+		}
+	}
+}
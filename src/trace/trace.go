@@ -0,0 +1,143 @@
+// Package trace logs what the engine executes so that two runs of a script can be diffed
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/engine"
+)
+
+type Format string
+
+const (
+	Text Format = "text"
+	JSON Format = "json"
+)
+
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case Text, JSON:
+		return Format(name), nil
+	}
+	return "", errors.New("Unknown trace format '" + name + "', expected 'text' or 'json'")
+}
+
+// Event is a line of the trace, statements have an operation and block calls have a block
+type Event struct {
+	Event     string  `json:"event"`
+	File      string  `json:"file"`
+	Line      uint32  `json:"line"`
+	Col       uint32  `json:"col"`
+	Label     string  `json:"label"`
+	Depth     int     `json:"depth"`
+	Operation string  `json:"operation,omitempty"`
+	Block     string  `json:"block,omitempty"`
+	Verbs     []int64 `json:"verbs,omitempty"`
+	Arguments []int64 `json:"arguments,omitempty"`
+	Arm       *int    `json:"arm,omitempty"`
+	Value     *int64  `json:"value,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Tracer is an engine tracer that writes one line per event
+type Tracer struct {
+	Output io.Writer
+	Format Format
+	depth  int
+}
+
+func New(output io.Writer, format Format) *Tracer {
+	return &Tracer{Output: output, Format: format}
+}
+
+func (tracer *Tracer) event(instance *engine.BirEngine, name string, position ast.Position) Event {
+	file := instance.Filename
+	if instance.Anonymous {
+		file = "[REPL]"
+	}
+	return Event{Event: name, File: file, Line: position.Line, Col: position.Col, Label: instance.GetCurrentCallStack().Label, Depth: tracer.depth}
+}
+
+func (tracer *Tracer) Statement(instance *engine.BirEngine, statement ast.Statement, value *ast.IntPrimitiveExpression, err error) {
+	event := tracer.event(instance, "statement", statement.GetPosition())
+	event.Operation = statement.GetOperation()
+	if value != nil {
+		event.Value = &value.Value
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	tracer.write(event)
+}
+
+func (tracer *Tracer) Branch(instance *engine.BirEngine, statement ast.Statement, arm int) {
+	event := tracer.event(instance, "branch", statement.GetPosition())
+	event.Operation = statement.GetOperation()
+	event.Arm = &arm
+	tracer.write(event)
+}
+
+func (tracer *Tracer) Enter(instance *engine.BirEngine, expression *ast.BlockCallExpression, label string, verbs []int64, arguments []int64) {
+	event := tracer.event(instance, "enter", expression.Position)
+	event.Block = label
+	event.Verbs = verbs
+	event.Arguments = arguments
+	tracer.write(event)
+	tracer.depth++
+}
+
+func (tracer *Tracer) Exit(instance *engine.BirEngine, expression *ast.BlockCallExpression, label string, value ast.IntPrimitiveExpression, err error) {
+	tracer.depth--
+	event := tracer.event(instance, "exit", expression.Position)
+	event.Block = label
+	if err != nil {
+		event.Error = err.Error()
+	} else {
+		event.Value = &value.Value
+	}
+	tracer.write(event)
+}
+
+func join(values []int64, separator string) string {
+	result := []string{}
+	for _, value := range values {
+		result = append(result, strconv.FormatInt(value, 10))
+	}
+	return strings.Join(result, separator)
+}
+
+func (tracer *Tracer) write(event Event) {
+	if tracer.Format == JSON {
+		line, _ := json.Marshal(event)
+		tracer.Output.Write(append(line, '\n'))
+		return
+	}
+
+	line := event.File + ":" + strconv.Itoa(int(event.Line)) + ":" + strconv.Itoa(int(event.Col)) + " " + strings.Repeat("  ", event.Depth)
+	switch event.Event {
+	case "statement":
+		line += event.Label + " " + event.Operation
+	case "branch":
+		line += event.Label + " " + event.Operation + " arm " + strconv.Itoa(*event.Arm)
+	case "enter":
+		line += "-> " + event.Block
+		if len(event.Verbs) > 0 {
+			line += ":" + join(event.Verbs, ":")
+		}
+		line += " (" + join(event.Arguments, ", ") + ")"
+	case "exit":
+		line += "<- " + event.Block
+	}
+
+	if event.Error != "" {
+		line += " ! " + event.Error
+	} else if event.Value != nil {
+		line += " = " + strconv.FormatInt(*event.Value, 10)
+	}
+	io.WriteString(tracer.Output, line+"\n")
+}
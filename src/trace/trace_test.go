@@ -0,0 +1,110 @@
+package trace_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/canpacis/birlang/src/engine"
+	"github.com/canpacis/birlang/src/trace"
+)
+
+const program = `split:by [n] {
+  return n / by
+}
+let a = split:2 (8)
+if a == 4 {
+  a++
+  split:0 (a)
+}
+`
+
+// run traces the program and returns the trace along with the error of the run
+func run(t *testing.T, format trace.Format) (string, error) {
+	t.Helper()
+	file_path := filepath.Join(t.TempDir(), "main.bir")
+	if err := os.WriteFile(file_path, []byte(program), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := &bytes.Buffer{}
+	instance := engine.NewEngine(filepath.ToSlash(file_path), "", false, false, 0)
+	instance.Stdout, instance.Stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	instance.Tracer = trace.New(output, format)
+	err := instance.Init()
+	if err == nil {
+		err = instance.Run()
+	}
+	return output.String(), err
+}
+
+func TestText(t *testing.T) {
+	output, err := run(t, trace.Text)
+	if err == nil {
+		t.Fatalf("the division by zero did not fail")
+	}
+
+	want := strings.Join([]string{
+		"main.bir:1:1 main [main.bir] block_declaration",
+		"main.bir:4:9 -> split:2 (8)",
+		"main.bir:2:3   split return_statement = 4",
+		"main.bir:4:9 <- split = 4",
+		"main.bir:4:1 main [main.bir] variable_declaration = 4",
+		"main.bir:5:1 main [main.bir] if_statement arm 0",
+		"main.bir:6:3 if-block [main.bir 5:1] quantity_modifier_statement = 5",
+		"main.bir:7:3 -> split:0 (5)",
+		"main.bir:2:3   split return_statement ! Division by zero",
+		"main.bir:7:3 <- split ! Division by zero",
+		"main.bir:7:3 split block_call ! Division by zero",
+		"main.bir:5:1 split if_statement ! Division by zero",
+		"",
+	}, "\n")
+	if output != want {
+		t.Errorf("got\n%s\nwant\n%s", output, want)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	output, _ := run(t, trace.JSON)
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) != 12 {
+		t.Fatalf("got %d events, want 12", len(lines))
+	}
+
+	events := []trace.Event{}
+	for _, line := range lines {
+		event := trace.Event{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		events = append(events, event)
+	}
+
+	enter := events[1]
+	if enter.Event != "enter" || enter.Block != "split" || len(enter.Verbs) != 1 || enter.Verbs[0] != 2 || len(enter.Arguments) != 1 || enter.Arguments[0] != 8 {
+		t.Errorf("got %+v, want the call to split", enter)
+	}
+	if events[2].Depth != 1 || events[3].Depth != 0 {
+		t.Errorf("got depths %d and %d, want the body of a block to be nested", events[2].Depth, events[3].Depth)
+	}
+	if branch := events[5]; branch.Event != "branch" || branch.Arm == nil || *branch.Arm != 0 {
+		t.Errorf("got %+v, want the first arm of the if", branch)
+	}
+	if last := events[len(events)-1]; last.Error == "" || last.Value != nil {
+		t.Errorf("got %+v, want the failed statement to have an error and no value", last)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"text", "json"} {
+		if format, err := trace.ParseFormat(name); err != nil || string(format) != name {
+			t.Errorf("got %q %v for %q", format, err, name)
+		}
+	}
+	if _, err := trace.ParseFormat("xml"); err == nil || err.Error() != "Unknown trace format 'xml', expected 'text' or 'json'" {
+		t.Errorf("got %v, want the format to be rejected", err)
+	}
+}
@@ -70,7 +70,7 @@ func GenerateNativeFunction(name string, body ast.NativeFunction) ast.BlockDecla
 		Populate:     nil,
 		Position:     ast.Position{Line: 1, Col: 0},
 		Instance:     nil,
-		Body:         body,
+		Function:     body,
 	}
 }
 
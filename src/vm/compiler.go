@@ -0,0 +1,1138 @@
+package vm
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/canpacis/birlang/src/ast"
+)
+
+type scopeKind uint8
+
+const (
+	scopeImport scopeKind = iota
+	scopeGlobal
+	scopeInstance
+	scopeLocal
+)
+
+type symbol struct {
+	reference Reference
+	kind      string
+	immutable bool
+	declared  bool
+}
+
+type blockSymbol struct {
+	reference Reference
+	template  *Template
+	native    bool
+	declared  bool
+}
+
+type compileScope struct {
+	kind      scopeKind
+	function  *functionState
+	variables map[string]*symbol
+	blocks    map[string]*blockSymbol
+	parent    *compileScope
+	// Block bodies share their scope with the instance, redeclaring an instance variable is an error
+	shared bool
+	// prefix qualifies the globals a namespace scope declares, as in 'codes.http.'
+	prefix string
+	// names index the names of the function the scope declares, they end when the scope is closed
+	names []int
+}
+
+type functionState struct {
+	function *Function
+	locals   int
+	instance bool
+	template *Template
+	// constants and strings index the pools of the function by value so that each value is stored once
+	constants map[int64]int
+	strings   map[string]int
+}
+
+type body struct {
+	main   bool
+	result int
+	exits  []int
+}
+
+type Compiler struct {
+	module   *Module
+	scope    *compileScope
+	state    *functionState
+	body     *body
+	position ast.Position
+	// global is the top level scope, the members of namespaces are in it by their qualified names
+	global     *compileScope
+	namespaces map[*ast.NamespaceDeclarationStatement]*compileScope
+}
+
+func newScope(kind scopeKind, state *functionState, parent *compileScope) *compileScope {
+	return &compileScope{
+		kind:      kind,
+		function:  state,
+		variables: map[string]*symbol{},
+		blocks:    map[string]*blockSymbol{},
+		parent:    parent,
+	}
+}
+
+// Compile turns a decoded program into the main function of the module, the imports of the module
+// must be loaded before compiling since their symbols are resolved statically
+func Compile(module *Module, program *ast.Program, natives []string) *Function {
+	compiler := Compiler{module: module, namespaces: map[*ast.NamespaceDeclarationStatement]*compileScope{}}
+
+	var parent *compileScope
+	for i := len(module.Imports) - 1; i >= 0; i-- {
+		if module.aliased(i) {
+			continue
+		}
+		parent = importScope(module, i, parent)
+	}
+
+	main := &Function{Name: "main [" + module.Filename + "]", Module: module}
+	compiler.state = &functionState{function: main}
+	compiler.scope = newScope(scopeGlobal, compiler.state, parent)
+	compiler.global = compiler.scope
+
+	for _, name := range natives {
+		compiler.scope.blocks[name] = &blockSymbol{
+			reference: Reference{Location: LocationGlobal, Index: module.addBlock(name, nil)},
+			native:    true,
+			declared:  true,
+		}
+	}
+
+	compiler.hoist(program.Program)
+	compiler.compileBody(program.Program, true)
+	compiler.emit(OpReturn, 0, 0)
+
+	return main
+}
+
+// importScope holds the globals and the blocks of an imported module
+func importScope(module *Module, i int, parent *compileScope) *compileScope {
+	imported := module.Imports[i]
+	import_scope := newScope(scopeImport, nil, parent)
+	visible := module.Visible[i]
+	for slot, name := range imported.GlobalNames {
+		if !visible[name] {
+			continue
+		}
+		import_scope.variables[name] = &symbol{
+			reference: Reference{Location: LocationImport, Module: i, Index: slot},
+			kind:      imported.GlobalKinds[slot],
+			immutable: imported.GlobalKinds[slot] == "const",
+			declared:  true,
+		}
+	}
+	for slot, name := range imported.BlockNames {
+		if !visible[name] {
+			continue
+		}
+		import_scope.blocks[name] = &blockSymbol{
+			reference: Reference{Location: LocationImport, Module: i, Index: slot},
+			template:  imported.BlockTemplates[slot],
+			native:    imported.BlockTemplates[slot] == nil,
+			declared:  true,
+		}
+	}
+	return import_scope
+}
+
+func (compiler *Compiler) emit(op Opcode, a int, b int) int {
+	function := compiler.state.function
+	function.Code = append(function.Code, Instruction{Op: op, A: int32(a), B: int32(b)})
+	function.Positions = append(function.Positions, compiler.position)
+	return len(function.Code) - 1
+}
+
+func (compiler *Compiler) patch(index int) {
+	compiler.state.function.Code[index].A = int32(len(compiler.state.function.Code))
+}
+
+func (compiler *Compiler) constant(value int64) {
+	state := compiler.state
+	if state.constants == nil {
+		state.constants = map[int64]int{}
+	}
+	i, ok := state.constants[value]
+	if !ok {
+		state.function.Constants = append(state.function.Constants, value)
+		i = len(state.function.Constants) - 1
+		state.constants[value] = i
+	}
+	compiler.emit(OpConstant, i, 0)
+}
+
+func (compiler *Compiler) addString(value string) int {
+	state := compiler.state
+	if state.strings == nil {
+		state.strings = map[string]int{}
+	}
+	i, ok := state.strings[value]
+	if !ok {
+		state.function.Strings = append(state.function.Strings, value)
+		i = len(state.function.Strings) - 1
+		state.strings[value] = i
+	}
+	return i
+}
+
+func (compiler *Compiler) fail(message string) {
+	compiler.emit(OpFail, compiler.addString(message), 0)
+}
+
+// failAt fails at the position the resolver of the engine reports the same mistake at
+func (compiler *Compiler) failAt(message string, position ast.Position) {
+	outer := compiler.position
+	compiler.position = position
+	compiler.fail(message)
+	compiler.position = outer
+}
+
+func (compiler *Compiler) label(name string, position ast.Position) string {
+	return name + " [" + compiler.module.Filename + " " + strconv.Itoa(int(position.Line)) + ":" + strconv.Itoa(int(position.Col)) + "]"
+}
+
+func (compiler *Compiler) local() int {
+	compiler.state.locals++
+	if compiler.state.locals > compiler.state.function.Locals {
+		compiler.state.function.Locals = compiler.state.locals
+	}
+	return compiler.state.locals - 1
+}
+
+func (compiler *Compiler) openScope() {
+	compiler.scope = newScope(scopeLocal, compiler.state, compiler.scope)
+}
+
+// closeScope releases the local slots of the scope so that sibling scopes can reuse them
+func (compiler *Compiler) closeScope(locals int) {
+	for _, i := range compiler.scope.names {
+		compiler.state.function.Names[i].End = len(compiler.state.function.Code)
+	}
+	compiler.scope = compiler.scope.parent
+	compiler.state.locals = locals
+}
+
+// hoist allocates slots for the blocks of a statement list before it is compiled so that blocks can
+// call blocks declared after them, top level variables and the members of namespaces are hoisted as
+// globals for the same reason
+func (compiler *Compiler) hoist(statements []ast.Statement) {
+	for _, statement := range statements {
+		switch statement := statement.(type) {
+		case *ast.BlockDeclarationStatement:
+			if _, exists := compiler.scope.blocks[statement.Name.Value]; exists {
+				continue
+			}
+			var reference Reference
+			if compiler.scope.kind == scopeGlobal {
+				reference = Reference{Location: LocationGlobal, Index: compiler.module.addBlock(compiler.scope.prefix+statement.Name.Value, nil)}
+			} else {
+				reference = Reference{Location: LocationLocal, Index: compiler.state.function.Blocks}
+				compiler.record(LocalName{Name: statement.Name.Value, Block: true, Slot: reference.Index})
+				compiler.state.function.Blocks++
+			}
+			compiler.scope.blocks[statement.Name.Value] = &blockSymbol{reference: reference}
+		case *ast.VariableDeclarationStatement:
+			if compiler.scope.kind != scopeGlobal {
+				continue
+			}
+			if _, exists := compiler.scope.variables[statement.Left.Value]; exists {
+				continue
+			}
+			compiler.scope.variables[statement.Left.Value] = &symbol{
+				reference: Reference{Location: LocationGlobal, Index: compiler.module.addGlobal(compiler.scope.prefix+statement.Left.Value, statement.Kind)},
+				kind:      statement.Kind,
+				immutable: statement.Kind == "const",
+			}
+		case *ast.NamespaceDeclarationStatement:
+			compiler.hoistNamespace(statement)
+		}
+	}
+}
+
+// hoistNamespace allocates the globals of a namespace, its members are known by their names in the
+// namespace and by their qualified names everywhere else
+func (compiler *Compiler) hoistNamespace(statement *ast.NamespaceDeclarationStatement) {
+	name := compiler.scope.prefix + statement.Name.Value
+	namespace_scope := newScope(scopeGlobal, compiler.state, compiler.scope)
+	namespace_scope.prefix = name + "."
+	compiler.namespaces[statement] = namespace_scope
+	compiler.module.Namespaces = append(compiler.module.Namespaces, name)
+
+	outer := compiler.scope
+	compiler.scope = namespace_scope
+	compiler.hoist(statement.Body)
+	compiler.scope = outer
+
+	for key, variable := range namespace_scope.variables {
+		compiler.global.variables[namespace_scope.prefix+key] = variable
+	}
+	for key, block := range namespace_scope.blocks {
+		compiler.global.blocks[namespace_scope.prefix+key] = block
+	}
+}
+
+// resolveQualified finds a name like 'codes.http.ok' in the namespaces of the module and then in the
+// namespaces its imports bring
+func (compiler *Compiler) resolveQualified(name string) *symbol {
+	if variable, ok := compiler.global.variables[name]; ok {
+		return variable
+	}
+	i, slot := findQualified(compiler.module, name, false)
+	if i < 0 {
+		return nil
+	}
+	imported := compiler.module.Imports[i]
+	return &symbol{
+		reference: Reference{Location: LocationImport, Module: i, Index: slot},
+		kind:      imported.GlobalKinds[slot],
+		immutable: true,
+		declared:  true,
+	}
+}
+
+func (compiler *Compiler) resolveQualifiedBlock(name string) *blockSymbol {
+	if block, ok := compiler.global.blocks[name]; ok {
+		return block
+	}
+	i, slot := findQualified(compiler.module, name, true)
+	if i < 0 {
+		return nil
+	}
+	imported := compiler.module.Imports[i]
+	return &blockSymbol{
+		reference: Reference{Location: LocationImport, Module: i, Index: slot},
+		template:  imported.BlockTemplates[slot],
+		native:    imported.BlockTemplates[slot] == nil,
+		declared:  true,
+	}
+}
+
+// importedQualified turns a qualified name of a module into the name it has in one of its imports, it
+// has to start with the alias of an aliased import and then with a namespace the import brings
+func importedQualified(module *Module, i int, name string) (string, bool) {
+	for alias, index := range module.Aliases {
+		if index != i {
+			continue
+		}
+		if !strings.HasPrefix(name, alias+".") {
+			return "", false
+		}
+		name = name[len(alias)+1:]
+	}
+	top := strings.SplitN(name, ".", 2)[0]
+	if !module.Visible[i][top] || !ownsNamespace(module.Imports[i], top) {
+		return "", false
+	}
+	return name, true
+}
+
+// findQualified searches the imports of a module for a qualified name, the last import that brings it
+// wins like it does with the namespaces of the engine
+func findQualified(module *Module, name string, block bool) (int, int) {
+	for i := len(module.Imports) - 1; i >= 0; i-- {
+		inner, ok := importedQualified(module, i, name)
+		if !ok {
+			continue
+		}
+		imported := module.Imports[i]
+		names := imported.GlobalNames
+		if block {
+			names = imported.BlockNames
+		}
+		for slot, candidate := range names {
+			if candidate == inner {
+				return i, slot
+			}
+		}
+	}
+	return -1, -1
+}
+
+// declaresNamespace tells if a module declares a namespace or brings it from one of its imports
+func declaresNamespace(module *Module, name string) bool {
+	if ownsNamespace(module, name) {
+		return true
+	}
+	for i, imported := range module.Imports {
+		if inner, ok := importedQualified(module, i, name); ok && ownsNamespace(imported, inner) {
+			return true
+		}
+	}
+	return false
+}
+
+func ownsNamespace(module *Module, name string) bool {
+	for _, namespace := range module.Namespaces {
+		if namespace == name {
+			return true
+		}
+	}
+	return false
+}
+
+// static tells if the names of a scope are bound while compiling. Blocks run on top of the frames of
+// their callers, the names a block does not find in its own scopes or in its namespaces are looked up
+// on those frames when it runs.
+func (compiler *Compiler) static(scope *compileScope) bool {
+	return compiler.state.template == nil || scope.function == compiler.state || scope.prefix != ""
+}
+
+// bindVariable resolves a name the function reads or updates, dynamic is true when the name is looked
+// up by its name when the function runs
+func (compiler *Compiler) bindVariable(name string) (variable *symbol, dynamic bool) {
+	for scope := compiler.scope; scope != nil; scope = scope.parent {
+		if !compiler.static(scope) {
+			return nil, true
+		}
+		if variable, ok := scope.variables[name]; ok {
+			return variable, false
+		}
+	}
+	return nil, false
+}
+
+func (compiler *Compiler) bindBlock(name string) (block *blockSymbol, dynamic bool) {
+	for scope := compiler.scope; scope != nil; scope = scope.parent {
+		if !compiler.static(scope) {
+			return nil, true
+		}
+		if block, ok := scope.blocks[name]; ok {
+			return block, false
+		}
+	}
+	return nil, false
+}
+
+func (compiler *Compiler) resolveBlock(name string) *blockSymbol {
+	for scope := compiler.scope; scope != nil; scope = scope.parent {
+		if (scope.kind == scopeLocal || scope.kind == scopeInstance) && scope.function != compiler.state {
+			continue
+		}
+		if block, ok := scope.blocks[name]; ok {
+			return block
+		}
+	}
+	return nil
+}
+
+// compileBody compiles a list of statements that produce a value, the value of a body is the value
+// of its last block call, its return statement or its last if or switch statement
+func (compiler *Compiler) compileBody(statements []ast.Statement, main bool) {
+	previous := compiler.body
+	compiler.body = &body{main: main, result: compiler.local()}
+	compiler.constant(-1)
+	compiler.emit(OpSetLocal, compiler.body.result, 0)
+
+	compiler.compileStatements(statements)
+
+	for _, exit := range compiler.body.exits {
+		compiler.patch(exit)
+	}
+	compiler.emit(OpGetLocal, compiler.body.result, 0)
+	compiler.body = previous
+}
+
+func (compiler *Compiler) compileStatements(statements []ast.Statement) {
+	for _, statement := range statements {
+		compiler.compileStatement(statement)
+	}
+}
+
+// compileNestedBody compiles the body of a loop or a branch in its own scope and label
+func (compiler *Compiler) compileNestedBody(name string, position ast.Position, statements []ast.Statement, setup func()) {
+	locals := compiler.state.locals
+	compiler.openScope()
+	if setup != nil {
+		setup()
+	}
+	compiler.emit(OpPushLabel, compiler.addString(compiler.label(name, position)), 0)
+	compiler.hoist(statements)
+	compiler.compileBody(statements, false)
+	compiler.emit(OpPopLabel, 0, 0)
+	compiler.closeScope(locals)
+}
+
+func (compiler *Compiler) exit() {
+	compiler.emit(OpSetLocal, compiler.body.result, 0)
+	compiler.body.exits = append(compiler.body.exits, compiler.emit(OpJump, 0, 0))
+}
+
+func (compiler *Compiler) compileStatement(statement ast.Statement) {
+	compiler.position = statement.GetPosition()
+
+	switch statement := statement.(type) {
+	case *ast.VariableDeclarationStatement:
+		compiler.compileVariableDeclaration(statement)
+	case *ast.ReturnStatement:
+		compiler.compileExpression(statement.Expression)
+		compiler.position = statement.Position
+		if compiler.body.main {
+			compiler.emit(OpPop, 0, 0)
+			compiler.fail("Top level return statements are not allowed")
+		} else {
+			compiler.exit()
+		}
+	case *ast.ThrowStatement:
+		compiler.compileExpression(statement.Expression)
+		compiler.position = statement.Position
+		if compiler.body.main {
+			compiler.emit(OpPop, 0, 0)
+			compiler.fail("Top level throw statements are not allowed")
+		} else {
+			compiler.emit(OpThrow, 0, 0)
+		}
+	case *ast.BlockDeclarationStatement:
+		compiler.compileBlockDeclaration(statement)
+	case *ast.NamespaceDeclarationStatement:
+		compiler.compileNamespaceDeclaration(statement)
+	case *ast.NamespaceIndexerExpression:
+		compiler.compileExpression(statement)
+		compiler.emit(OpPop, 0, 0)
+	case *ast.QuantityModifierStatement:
+		compiler.compileQuantityModifier(statement)
+	case *ast.AssignStatement:
+		compiler.compileExpression(statement.Right)
+		compiler.position = statement.Position
+		compiler.compileUpdate(statement.Left.Value, "assign to")
+	case *ast.BlockCallExpression:
+		compiler.compileExpression(statement)
+		compiler.emit(OpSetLocal, compiler.body.result, 0)
+	case *ast.ScopeMutaterExpression:
+		compiler.compileExpression(statement)
+		compiler.emit(OpPop, 0, 0)
+	case *ast.ForStatement:
+		compiler.compileForStatement(statement)
+	case *ast.WhileStatement:
+		compiler.compileWhileStatement(statement)
+	case *ast.IfStatement:
+		compiler.compileIfStatement(statement)
+		compiler.exit()
+	case *ast.SwitchStatement:
+		compiler.compileSwitchStatement(statement)
+		compiler.exit()
+	}
+}
+
+func (compiler *Compiler) compileVariableDeclaration(statement *ast.VariableDeclarationStatement) {
+	compiler.compileExpression(statement.Right)
+	compiler.position = statement.Position
+	name := statement.Left.Value
+
+	switch compiler.scope.kind {
+	case scopeGlobal:
+		variable := compiler.scope.variables[name]
+		if variable.declared {
+			compiler.fail("Could not redeclare an existing variable")
+			return
+		}
+		variable.declared = true
+		compiler.emit(OpSetGlobal, variable.reference.Index, 0)
+	case scopeInstance:
+		if _, exists := compiler.scope.variables[name]; exists {
+			compiler.fail("Could not redeclare an existing variable")
+			return
+		}
+		template := compiler.state.template
+		template.Instance = append(template.Instance, InstanceSlot{Name: name, Kind: statement.Kind, Start: len(compiler.state.function.Code)})
+		compiler.scope.variables[name] = &symbol{
+			reference: Reference{Location: LocationInstance, Index: len(template.Instance) - 1},
+			kind:      statement.Kind,
+			immutable: statement.Kind == "const",
+			declared:  true,
+		}
+		compiler.emit(OpSetInstance, len(template.Instance)-1, 0)
+	default:
+		_, exists := compiler.scope.variables[name]
+		if !exists && compiler.scope.shared {
+			_, exists = compiler.scope.parent.variables[name]
+		}
+		if exists {
+			compiler.fail("Could not redeclare an existing variable")
+			return
+		}
+		slot := compiler.declareLocal(name, statement.Kind)
+		compiler.emit(OpSetLocal, slot, 0)
+	}
+}
+
+func (compiler *Compiler) declareLocal(name string, kind string) int {
+	slot := compiler.local()
+	compiler.record(LocalName{Name: name, Kind: kind, Slot: slot})
+	compiler.scope.variables[name] = &symbol{
+		reference: Reference{Location: LocationLocal, Index: slot},
+		kind:      kind,
+		immutable: kind == "const",
+		declared:  true,
+	}
+	return slot
+}
+
+// record notes that a slot holds a name from the current instruction until its scope is closed
+func (compiler *Compiler) record(local LocalName) {
+	local.Start, local.End = len(compiler.state.function.Code), -1
+	compiler.state.function.Names = append(compiler.state.function.Names, local)
+	compiler.scope.names = append(compiler.scope.names, len(compiler.state.function.Names)-1)
+}
+
+// compileUpdate stores the value on top of the stack into an existing variable
+func (compiler *Compiler) compileUpdate(name string, verb string) {
+	variable, dynamic := compiler.bindVariable(name)
+
+	if dynamic {
+		compiler.emit(OpSetDynamic, compiler.addString(name), compiler.addString(verb))
+		return
+	}
+	if variable == nil {
+		compiler.fail("Could not " + verb + " a variable that does not exist")
+		return
+	}
+	if variable.immutable {
+		compiler.fail("Could not " + verb + " an immutable variable")
+		return
+	}
+
+	switch variable.reference.Location {
+	case LocationLocal:
+		compiler.emit(OpSetLocal, variable.reference.Index, 0)
+	case LocationInstance:
+		compiler.emit(OpSetInstance, variable.reference.Index, 0)
+	case LocationGlobal:
+		compiler.emit(OpSetGlobal, variable.reference.Index, compiler.addString("Could not "+verb+" a variable that does not exist")+1)
+	default:
+		compiler.fail("Could not " + verb + " a foreign variable")
+	}
+}
+
+func (compiler *Compiler) compileQuantityModifier(statement *ast.QuantityModifierStatement) {
+	compiler.compileExpression(statement.Statement)
+	compiler.position = statement.Position
+
+	switch statement.Type {
+	case "increment":
+		compiler.constant(1)
+		compiler.emit(OpAdd, 0, 0)
+	case "decrement":
+		compiler.constant(1)
+		compiler.emit(OpSubtract, 0, 0)
+	case "add":
+		compiler.compileExpression(statement.Right)
+		compiler.emit(OpAdd, 0, 0)
+	case "subtract":
+		compiler.compileExpression(statement.Right)
+		compiler.emit(OpSubtract, 0, 0)
+	case "multiply":
+		compiler.compileExpression(statement.Right)
+		compiler.emit(OpMultiply, 0, 0)
+	case "divide":
+		compiler.compileExpression(statement.Right)
+		// Division by zero is reported at the divisor like the engine does
+		compiler.position = statement.Right.GetPosition()
+		compiler.emit(OpDivide, 0, 0)
+	}
+	compiler.position = statement.Position
+
+	if target, ok := statement.Statement.(*ast.ReferenceExpression); ok {
+		compiler.compileUpdate(target.Value, "modify")
+	} else {
+		compiler.emit(OpPop, 0, 0)
+	}
+}
+
+func (compiler *Compiler) compileForStatement(statement *ast.ForStatement) {
+	locals := compiler.state.locals
+	limit := compiler.local()
+	counter := compiler.local()
+
+	compiler.compileExpression(statement.Statement)
+	compiler.position = statement.Position
+	compiler.emit(OpSetLocal, limit, 0)
+	compiler.constant(0)
+	compiler.emit(OpSetLocal, counter, 0)
+
+	loop := len(compiler.state.function.Code)
+	compiler.emit(OpGetLocal, counter, 0)
+	compiler.emit(OpGetLocal, limit, 0)
+	end := compiler.emit(OpJumpUnlessLess, 0, 0)
+	compiler.emit(OpStep, 0, 0)
+
+	compiler.compileNestedBody("for-block", statement.Position, statement.Body, func() {
+		placeholder := compiler.declareLocal(statement.Placeholder, "const")
+		compiler.emit(OpGetLocal, counter, 0)
+		compiler.emit(OpSetLocal, placeholder, 0)
+	})
+	compiler.emit(OpPop, 0, 0)
+
+	compiler.position = statement.Position
+	compiler.emit(OpGetLocal, counter, 0)
+	compiler.constant(1)
+	compiler.emit(OpAdd, 0, 0)
+	compiler.emit(OpSetLocal, counter, 0)
+	compiler.emit(OpJump, loop, 0)
+	compiler.patch(end)
+	compiler.state.locals = locals
+}
+
+func (compiler *Compiler) compileWhileStatement(statement *ast.WhileStatement) {
+	loop := len(compiler.state.function.Code)
+	compiler.compileExpression(statement.Statement)
+	compiler.position = statement.Position
+	end := compiler.emit(OpJumpUnlessTrue, 0, 0)
+	compiler.emit(OpStep, 0, 0)
+
+	compiler.compileNestedBody("while-block", statement.Position, statement.Body, nil)
+	compiler.emit(OpPop, 0, 0)
+	compiler.emit(OpJump, loop, 0)
+	compiler.patch(end)
+}
+
+// compileBranches selects the last branch whose condition holds, every condition is evaluated
+// before a branch is picked just like the tree walking engine does
+func (compiler *Compiler) compileBranches(name string, position ast.Position, conditions []func(), bodies [][]ast.Statement, fallback []ast.Statement, fallback_name string) {
+	locals := compiler.state.locals
+	selected := compiler.local()
+	compiler.constant(-1)
+	compiler.emit(OpSetLocal, selected, 0)
+
+	for i, condition := range conditions {
+		condition()
+		compiler.position = position
+		next := compiler.emit(OpJumpUnlessTrue, 0, 0)
+		compiler.constant(int64(i))
+		compiler.emit(OpSetLocal, selected, 0)
+		compiler.patch(next)
+	}
+
+	exits := []int{}
+	for i, statements := range bodies {
+		compiler.position = position
+		compiler.emit(OpGetLocal, selected, 0)
+		compiler.constant(int64(i))
+		compiler.emit(OpEqual, 0, 0)
+		next := compiler.emit(OpJumpUnlessTrue, 0, 0)
+		compiler.compileNestedBody(name, position, statements, nil)
+		exits = append(exits, compiler.emit(OpJump, 0, 0))
+		compiler.patch(next)
+	}
+
+	compiler.position = position
+	if fallback != nil {
+		compiler.compileNestedBody(fallback_name, position, fallback, nil)
+	} else {
+		compiler.constant(-1)
+	}
+
+	for _, exit := range exits {
+		compiler.patch(exit)
+	}
+	compiler.state.locals = locals
+}
+
+func (compiler *Compiler) compileIfStatement(statement *ast.IfStatement) {
+	compiler.compileExpression(statement.Condition)
+	compiler.position = statement.Position
+	otherwise := compiler.emit(OpJumpUnlessTrue, 0, 0)
+	compiler.compileNestedBody("if-block", statement.Position, statement.Body, nil)
+	end := compiler.emit(OpJump, 0, 0)
+	compiler.patch(otherwise)
+
+	if statement.Elifs != nil {
+		conditions := []func(){}
+		bodies := [][]ast.Statement{}
+		for _, elif := range statement.Elifs {
+			condition := elif.Condition
+			conditions = append(conditions, func() { compiler.compileExpression(condition) })
+			bodies = append(bodies, elif.Body)
+		}
+		compiler.compileBranches("elif-block", statement.Position, conditions, bodies, statement.Else, "else-block")
+	} else {
+		compiler.constant(-1)
+	}
+	compiler.patch(end)
+}
+
+func (compiler *Compiler) compileSwitchStatement(statement *ast.SwitchStatement) {
+	locals := compiler.state.locals
+	condition := compiler.local()
+	compiler.compileExpression(statement.Condition)
+	compiler.position = statement.Position
+	compiler.emit(OpSetLocal, condition, 0)
+
+	conditions := []func(){}
+	bodies := [][]ast.Statement{}
+	for _, c := range statement.Cases {
+		_case := c.Case
+		conditions = append(conditions, func() {
+			compiler.compileExpression(_case)
+			compiler.emit(OpGetLocal, condition, 0)
+			compiler.emit(OpEqual, 0, 0)
+		})
+		bodies = append(bodies, c.Body)
+	}
+	compiler.compileBranches("switch-case-block", statement.Position, conditions, bodies, statement.Default.Body, "switch-default-block")
+	compiler.state.locals = locals
+}
+
+func (compiler *Compiler) compileBlockDeclaration(statement *ast.BlockDeclarationStatement) {
+	name := statement.Name.Value
+	block := compiler.scope.blocks[name]
+
+	delete(compiler.scope.blocks, name)
+	existing := compiler.resolveBlock(name)
+	compiler.scope.blocks[name] = block
+	if block.declared || (existing != nil && existing.declared) {
+		compiler.fail("Could not redeclare an existing block")
+		return
+	}
+	block.declared = true
+
+	template := &Template{Name: name, Label: name, Slot: block.reference, Position: statement.Position}
+
+	if statement.Implementing {
+		implemented := compiler.resolveBlock(statement.Implements.Value)
+		if implemented == nil || (implemented.reference.Location != LocationImport && !implemented.declared) || implemented.native {
+			compiler.position = statement.Implements.Position
+			compiler.fail("Could not implement '" + statement.Implements.Value + "', block is non-existant")
+			return
+		}
+
+		template.Implementing = true
+		template.Label = name + "->" + statement.Implements.Value
+		template.Implements = CallSite{Name: statement.Implements.Value, Block: implemented.reference}
+		template.Source = implemented.template.arity()
+
+		for _, population := range statement.Populate {
+			compiler.position = population.Position
+			compiled := Population{Key: population.Key, Label: -1, Position: population.Position}
+
+			for i, slot := range template.Source.Instance {
+				if slot.Name == population.Key && slot.Kind == "local" {
+					compiled.Label = i
+				}
+			}
+
+			switch value := population.Value.(type) {
+			case *ast.StringPrimitiveExpression:
+				compiled.IsString = true
+				compiled.String = value.Value
+			case *ast.ArrayPrimitiveExpression:
+				for _, expression := range value.Values {
+					compiler.compileExpression(expression)
+				}
+				compiled.Values = len(value.Values)
+			}
+			template.Populate = append(template.Populate, compiled)
+		}
+
+		compiler.position = statement.Position
+		compiler.state.function.Templates = append(compiler.state.function.Templates, template)
+		compiler.emit(OpImplement, len(compiler.state.function.Templates)-1, 0)
+		block.template = template
+		compiler.registerBlock(block, template)
+		return
+	}
+
+	for _, verb := range statement.Verbs {
+		template.Verbs = append(template.Verbs, verb.Value)
+	}
+	for _, argument := range statement.Arguments {
+		template.Arguments = append(template.Arguments, argument.Value)
+	}
+	block.template = template
+	compiler.registerBlock(block, template)
+
+	outer_scope, outer_state, outer_body := compiler.scope, compiler.state, compiler.body
+
+	if statement.Body.Init != nil {
+		init := &Function{Name: name + ":init", Module: compiler.module, Namespace: outer_scope.prefix}
+		compiler.state = &functionState{function: init, instance: true, template: template}
+		compiler.scope = newScope(scopeInstance, compiler.state, outer_scope)
+		compiler.hoist(statement.Body.Init)
+		compiler.compileBody(statement.Body.Init, false)
+		compiler.emit(OpReturn, 0, 0)
+		template.Init = init
+	}
+
+	function := &Function{Name: name, Module: compiler.module, Namespace: outer_scope.prefix}
+	compiler.state = &functionState{function: function, instance: true, template: template}
+	instance_scope := newScope(scopeInstance, compiler.state, outer_scope)
+	for i, slot := range template.Instance {
+		instance_scope.variables[slot.Name] = &symbol{
+			reference: Reference{Location: LocationInstance, Index: i},
+			kind:      slot.Kind,
+			immutable: slot.Kind == "const",
+			declared:  true,
+		}
+	}
+	compiler.scope = newScope(scopeLocal, compiler.state, instance_scope)
+	compiler.scope.shared = true
+	for _, argument := range template.Arguments {
+		compiler.declareLocal(argument, "const")
+	}
+	for _, verb := range template.Verbs {
+		compiler.declareLocal(verb, "const")
+	}
+	compiler.hoist(statement.Body.Program)
+	compiler.compileBody(statement.Body.Program, false)
+	compiler.emit(OpReturn, 0, 0)
+	template.Body = function
+
+	compiler.scope, compiler.state, compiler.body = outer_scope, outer_state, outer_body
+	compiler.position = statement.Position
+	compiler.state.function.Templates = append(compiler.state.function.Templates, template)
+	compiler.emit(OpDeclareBlock, len(compiler.state.function.Templates)-1, 0)
+}
+
+func (compiler *Compiler) registerBlock(block *blockSymbol, template *Template) {
+	if block.reference.Location == LocationGlobal {
+		compiler.module.BlockTemplates[block.reference.Index] = template
+	}
+}
+
+// compileNamespaceDeclaration compiles the declarations of a namespace in its scope, its variables
+// and blocks are globals that were hoisted with the namespace
+func (compiler *Compiler) compileNamespaceDeclaration(statement *ast.NamespaceDeclarationStatement) {
+	outer := compiler.scope
+	compiler.scope = compiler.namespaces[statement]
+	compiler.compileStatements(statement.Body)
+	compiler.scope = outer
+}
+
+var arithmetic_opcodes = map[string]Opcode{
+	"addition":       OpAdd,
+	"subtraction":    OpSubtract,
+	"multiplication": OpMultiply,
+	"division":       OpDivide,
+	"exponent":       OpExponent,
+	"modulus":        OpModulus,
+	"root":           OpRoot,
+	"log10":          OpLog,
+}
+
+var condition_opcodes = map[string]Opcode{
+	"equals":                  OpEqual,
+	"not_equals":              OpNotEqual,
+	"less_than":               OpLess,
+	"less_than_equals":        OpLessEqual,
+	"not_less_than":           OpGreaterEqual,
+	"not_less_than_equals":    OpGreater,
+	"greater_than":            OpGreater,
+	"greater_than_equals":     OpGreaterEqual,
+	"not_greater_than":        OpLessEqual,
+	"not_greater_than_equals": OpLess,
+}
+
+func (compiler *Compiler) compileExpression(expression ast.Expression) {
+	compiler.position = expression.GetPosition()
+
+	switch expression := expression.(type) {
+	case *ast.IntPrimitiveExpression:
+		compiler.constant(expression.Value)
+	case *ast.StringPrimitiveExpression, *ast.ArrayPrimitiveExpression:
+		compiler.fail("Strings and arrays could only be used in populations")
+	case *ast.ReferenceExpression:
+		variable, dynamic := compiler.bindVariable(expression.Value)
+		if dynamic {
+			compiler.emit(OpGetDynamic, compiler.addString(expression.Value), 0)
+		} else if variable == nil {
+			compiler.fail("Could not find variable '" + expression.Value + "' in the frame")
+			return
+		} else {
+			compiler.get(variable.reference)
+		}
+		if expression.Negative {
+			compiler.emit(OpNegate, 0, 0)
+		}
+	case *ast.ArithmeticExpression:
+		compiler.compileExpression(expression.Left)
+		compiler.compileExpression(expression.Right)
+		compiler.position = expression.Position
+		op, ok := arithmetic_opcodes[expression.Type]
+		if !ok {
+			compiler.fail("Unknown arithmetic operation '" + expression.Type + "'")
+			return
+		}
+		compiler.emit(op, 0, 0)
+	case *ast.ConditionExpression:
+		compiler.compileExpression(expression.Left)
+		compiler.compileExpression(expression.Right)
+		compiler.position = expression.Position
+		op, ok := condition_opcodes[expression.Type]
+		if !ok {
+			compiler.emit(OpPop, 0, 0)
+			compiler.emit(OpPop, 0, 0)
+			compiler.constant(-1)
+			return
+		}
+		compiler.emit(op, 0, 0)
+	case *ast.NamespaceIndexerExpression:
+		compiler.compileNamespaceIndexer(expression)
+	case *ast.BlockCallExpression:
+		compiler.compileBlockCall(expression)
+	case *ast.ScopeMutaterExpression:
+		compiler.compileScopeMutater(expression)
+	default:
+		compiler.constant(-1)
+	}
+}
+
+func (compiler *Compiler) get(reference Reference) {
+	switch reference.Location {
+	case LocationLocal:
+		compiler.emit(OpGetLocal, reference.Index, 0)
+	case LocationInstance:
+		compiler.emit(OpGetInstance, reference.Index, 0)
+	case LocationGlobal:
+		compiler.emit(OpGetGlobal, reference.Index, 0)
+	case LocationImport:
+		compiler.emit(OpGetImport, reference.Module, reference.Index)
+	}
+}
+
+// compileNamespaceIndexer reads a member of a namespace or a variable of an aliased module, both are
+// resolved to their slots while compiling
+func (compiler *Compiler) compileNamespaceIndexer(expression *ast.NamespaceIndexerExpression) {
+	namespace, index := expression.Namespace.Value, expression.Index.Value
+
+	if variable := compiler.resolveQualified(namespace + "." + index); variable != nil {
+		compiler.get(variable.reference)
+		return
+	}
+	if declaresNamespace(compiler.module, namespace) {
+		compiler.failAt("Could not find variable '"+index+"' in the namespace '"+namespace+"'", expression.Index.Position)
+		return
+	}
+
+	i, ok := compiler.module.Aliases[namespace]
+	if !ok {
+		compiler.failAt("Could not find namespace '"+namespace+"'", expression.Namespace.Position)
+		return
+	}
+	variable := importScope(compiler.module, i, nil).variables[index]
+	if variable == nil {
+		compiler.failAt("Could not find variable '"+index+"' in module '"+namespace+"'", expression.Index.Position)
+		return
+	}
+	compiler.get(variable.reference)
+}
+
+func (compiler *Compiler) compileBlockCall(expression *ast.BlockCallExpression) {
+	name := expression.Name.Value
+	var block *blockSymbol
+
+	if namespace := expression.Namespace.Value; namespace != "" {
+		block = compiler.resolveQualifiedBlock(namespace + "." + name)
+		if block == nil && declaresNamespace(compiler.module, namespace) {
+			compiler.failAt("Could not find block '"+name+"' in the namespace '"+namespace+"'", expression.Name.Position)
+			return
+		}
+		if block == nil {
+			i, ok := compiler.module.Aliases[namespace]
+			if !ok {
+				compiler.failAt("Could not find namespace or module '"+namespace+"'", expression.Namespace.Position)
+				return
+			}
+			block = importScope(compiler.module, i, nil).blocks[name]
+			if block == nil {
+				compiler.failAt("Could not find block '"+name+"' in module '"+namespace+"'", expression.Name.Position)
+				return
+			}
+		}
+	} else {
+		var dynamic bool
+		block, dynamic = compiler.bindBlock(name)
+		if dynamic {
+			block = &blockSymbol{reference: Reference{Location: LocationDynamic}}
+		} else if block == nil {
+			compiler.fail("Could not find block '" + name + "'")
+			return
+		}
+	}
+
+	site := CallSite{Name: name, Block: block.reference}
+
+	if block.native || block.template == nil {
+		for _, argument := range expression.Arguments {
+			compiler.compileExpression(argument)
+		}
+		for _, verb := range expression.Verbs {
+			compiler.compileExpression(verb)
+		}
+		site.Arguments = len(expression.Arguments)
+		site.Verbs = len(expression.Verbs)
+	} else {
+		template := block.template.arity()
+		compiler.compileParameters(expression, expression.Arguments, len(template.Arguments), "argument(s)")
+		compiler.compileParameters(expression, expression.Verbs, len(template.Verbs), "verb(s)")
+		site.Arguments = len(template.Arguments)
+		site.Verbs = len(template.Verbs)
+	}
+
+	compiler.position = expression.Position
+	compiler.state.function.Calls = append(compiler.state.function.Calls, site)
+	compiler.emit(OpCall, len(compiler.state.function.Calls)-1, 0)
+}
+
+// compileParameters pushes the verbs or the arguments of a call, a call with the wrong number of
+// parameters is warned about and every parameter is given the value -1
+func (compiler *Compiler) compileParameters(expression *ast.BlockCallExpression, parameters []ast.Expression, expected int, what string) {
+	if len(parameters) == expected {
+		for _, parameter := range parameters {
+			compiler.compileExpression(parameter)
+		}
+		return
+	}
+
+	compiler.position = expression.Position
+	compiler.emit(OpWarn, compiler.addString("Expected "+strconv.Itoa(expected)+" "+what+", found "+strconv.Itoa(len(parameters))+" while calling '"+expression.Name.Value+"'"), 0)
+	for i := 0; i < expected; i++ {
+		compiler.constant(-1)
+	}
+}
+
+func (compiler *Compiler) compileScopeMutater(expression *ast.ScopeMutaterExpression) {
+	if compiler.body.main {
+		compiler.fail("Top level scope mutations are not allowed")
+		return
+	}
+
+	var op Opcode
+	var minimum int
+	var direction string
+
+	switch expression.Mutater.Value {
+	case "Write":
+		op, minimum, direction = OpWrite, 2, "write to"
+	case "Read":
+		op, minimum, direction = OpRead, 1, "read from"
+	case "Delete":
+		op, minimum, direction = OpDelete, 1, "delete from"
+	default:
+		compiler.position = expression.Mutater.Position
+		compiler.fail("Unknown mutater '" + expression.Mutater.Value + "'")
+		return
+	}
+
+	if len(expression.Arguments) < minimum {
+		compiler.fail("Scope mutation with '" + expression.Mutater.Value + "' operation needs at least " + strconv.Itoa(minimum) + " argument(s) but '" + strconv.Itoa(len(expression.Arguments)) + "' is given")
+		return
+	}
+
+	for _, argument := range expression.Arguments {
+		compiler.compileExpression(argument)
+	}
+	compiler.position = expression.Position
+
+	if !compiler.state.instance {
+		compiler.fail("Could not find an upper scope to " + direction)
+		return
+	}
+	compiler.emit(op, len(expression.Arguments), 0)
+}
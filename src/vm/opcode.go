@@ -0,0 +1,237 @@
+package vm
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/canpacis/birlang/src/ast"
+)
+
+type Opcode uint8
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	OpGetLocal
+	OpSetLocal
+	OpGetInstance
+	OpSetInstance
+	OpGetGlobal
+	OpSetGlobal
+	OpGetImport
+	OpGetDynamic
+	OpSetDynamic
+	OpNegate
+	OpAdd
+	OpSubtract
+	OpMultiply
+	OpDivide
+	OpModulus
+	OpExponent
+	OpRoot
+	OpLog
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpLessEqual
+	OpGreater
+	OpGreaterEqual
+	OpJump
+	OpJumpUnlessTrue
+	OpJumpUnlessLess
+	OpStep
+	OpCall
+	OpReturn
+	OpDeclareBlock
+	OpImplement
+	OpWrite
+	OpRead
+	OpDelete
+	OpPushLabel
+	OpPopLabel
+	OpWarn
+	OpFail
+	OpThrow
+)
+
+var opcode_names = [...]string{
+	OpConstant:       "constant",
+	OpPop:            "pop",
+	OpGetLocal:       "get_local",
+	OpSetLocal:       "set_local",
+	OpGetInstance:    "get_instance",
+	OpSetInstance:    "set_instance",
+	OpGetGlobal:      "get_global",
+	OpSetGlobal:      "set_global",
+	OpGetImport:      "get_import",
+	OpGetDynamic:     "get_dynamic",
+	OpSetDynamic:     "set_dynamic",
+	OpNegate:         "negate",
+	OpAdd:            "add",
+	OpSubtract:       "subtract",
+	OpMultiply:       "multiply",
+	OpDivide:         "divide",
+	OpModulus:        "modulus",
+	OpExponent:       "exponent",
+	OpRoot:           "root",
+	OpLog:            "log",
+	OpEqual:          "equal",
+	OpNotEqual:       "not_equal",
+	OpLess:           "less",
+	OpLessEqual:      "less_equal",
+	OpGreater:        "greater",
+	OpGreaterEqual:   "greater_equal",
+	OpJump:           "jump",
+	OpJumpUnlessTrue: "jump_unless_true",
+	OpJumpUnlessLess: "jump_unless_less",
+	OpStep:           "step",
+	OpCall:           "call",
+	OpReturn:         "return",
+	OpDeclareBlock:   "declare_block",
+	OpImplement:      "implement",
+	OpWrite:          "write",
+	OpRead:           "read",
+	OpDelete:         "delete",
+	OpPushLabel:      "push_label",
+	OpPopLabel:       "pop_label",
+	OpWarn:           "warn",
+	OpFail:           "fail",
+	OpThrow:          "throw",
+}
+
+func (op Opcode) String() string {
+	if int(op) < len(opcode_names) {
+		return opcode_names[op]
+	}
+	return "unknown(" + strconv.Itoa(int(op)) + ")"
+}
+
+type Instruction struct {
+	Op Opcode
+	A  int32
+	B  int32
+}
+
+// Function is a compiled unit of code, the main program of a module, a block body or a block init
+type Function struct {
+	Name      string         `json:"name"`
+	Module    *Module        `json:"-"`
+	Code      []Instruction  `json:"code"`
+	Positions []ast.Position `json:"positions"`
+	Constants []int64        `json:"constants"`
+	Strings   []string       `json:"strings"`
+	Calls     []CallSite     `json:"calls"`
+	Templates []*Template    `json:"templates"`
+	Locals    int            `json:"locals"`
+	Blocks    int            `json:"blocks"`
+	// Names tell which slots hold which names while the function runs, the blocks it calls look the
+	// names they do not declare themselves up in them
+	Names []LocalName `json:"names"`
+	// Namespace is the qualified name of the namespace the block of the function is declared in, as in
+	// 'codes.http.'
+	Namespace string `json:"namespace"`
+}
+
+// LocalName is a variable or a block slot of a function that holds a name from the instruction at Start
+// to the one at End, an End of -1 is the end of the function
+type LocalName struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Block bool   `json:"block"`
+	Slot  int    `json:"slot"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+func (local LocalName) live(ip int) bool {
+	return local.Start <= ip && (local.End < 0 || ip < local.End)
+}
+
+// Reference points at a variable or a block slot, Module is only meaningful for imported slots
+type Reference struct {
+	Location Location `json:"location"`
+	Module   int      `json:"module"`
+	Index    int      `json:"index"`
+}
+
+type Location uint8
+
+const (
+	LocationLocal Location = iota
+	LocationInstance
+	LocationGlobal
+	LocationImport
+	// LocationDynamic names are looked up by their names on the frames of the callers of a block and then
+	// in the globals and the imports of its module
+	LocationDynamic
+)
+
+type CallSite struct {
+	Name      string    `json:"name"`
+	Block     Reference `json:"block"`
+	Verbs     int       `json:"verbs"`
+	Arguments int       `json:"arguments"`
+}
+
+// Template is the compiled form of a block declaration, a runtime block is created from it
+// every time the declaration is executed
+type Template struct {
+	Name         string         `json:"name"`
+	Label        string         `json:"label"`
+	Slot         Reference      `json:"slot"`
+	Verbs        []string       `json:"verbs"`
+	Arguments    []string       `json:"arguments"`
+	Init         *Function      `json:"init"`
+	Body         *Function      `json:"body"`
+	Instance     []InstanceSlot `json:"instance"`
+	Implementing bool           `json:"implementing"`
+	Implements   CallSite       `json:"implements"`
+	Source       *Template      `json:"-"`
+	Populate     []Population   `json:"populate"`
+	Position     ast.Position   `json:"position"`
+}
+
+// arity returns the template whose verbs, arguments and body a call to this template runs
+func (template *Template) arity() *Template {
+	if template.Implementing {
+		return template.Source
+	}
+	return template
+}
+
+type InstanceSlot struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Start is the instruction of the init that declares the slot
+	Start int `json:"start"`
+}
+
+type Population struct {
+	Key      string       `json:"key"`
+	Label    int          `json:"label"`
+	String   string       `json:"string"`
+	IsString bool         `json:"is_string"`
+	Values   int          `json:"values"`
+	Position ast.Position `json:"position"`
+}
+
+func (function *Function) Disassemble() string {
+	var builder strings.Builder
+	builder.WriteString("== " + function.Name + " ==\n")
+
+	for i, instruction := range function.Code {
+		position := function.Positions[i]
+		builder.WriteString(strconv.Itoa(i) + "\t" + strconv.Itoa(int(position.Line)) + ":" + strconv.Itoa(int(position.Col)) + "\t" + instruction.Op.String() + " " + strconv.Itoa(int(instruction.A)) + " " + strconv.Itoa(int(instruction.B)) + "\n")
+	}
+
+	for _, template := range function.Templates {
+		if template.Init != nil {
+			builder.WriteString(template.Init.Disassemble())
+		}
+		if template.Body != nil {
+			builder.WriteString(template.Body.Disassemble())
+		}
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,949 @@
+package vm
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/implementor"
+	"github.com/canpacis/birlang/src/importer"
+	"github.com/canpacis/birlang/src/parser"
+	"github.com/canpacis/birlang/src/resolver"
+	"github.com/canpacis/birlang/src/thrower"
+	"github.com/canpacis/birlang/src/util"
+	"github.com/canpacis/birlang/std"
+)
+
+// Module is a loaded file, its globals and blocks live in slots that the compiler resolved statically
+type Module struct {
+	Path           string      `json:"path"`
+	URI            string      `json:"uri"`
+	Filename       string      `json:"filename"`
+	Directory      string      `json:"directory"`
+	Content        string      `json:"content"`
+	Globals        []int64     `json:"globals"`
+	Defined        []bool      `json:"defined"`
+	GlobalNames    []string    `json:"global_names"`
+	GlobalKinds    []string    `json:"global_kinds"`
+	Blocks         []*Block    `json:"blocks"`
+	BlockNames     []string    `json:"block_names"`
+	BlockTemplates []*Template `json:"-"`
+	// Namespaces are the qualified names of the namespaces the module declares, their members are globals
+	// named like 'codes.http.ok'
+	Namespaces []string  `json:"namespaces"`
+	Imports    []*Module `json:"-"`
+	Main       *Function `json:"-"`
+	// Aliases map the alias of an import to its index, aliased imports are only reachable through the alias
+	Aliases map[string]int `json:"aliases"`
+	// Visible holds the names each import brings, in the same order as the imports
+	Visible []map[string]bool `json:"-"`
+	// Exports tells for each top level declaration whether the modules importing this one can use it
+	Exports map[string]bool `json:"exports"`
+}
+
+func (module *Module) addGlobal(name string, kind string) int {
+	module.Globals = append(module.Globals, -1)
+	module.Defined = append(module.Defined, false)
+	module.GlobalNames = append(module.GlobalNames, name)
+	module.GlobalKinds = append(module.GlobalKinds, kind)
+	return len(module.Globals) - 1
+}
+
+func (module *Module) addBlock(name string, template *Template) int {
+	module.Blocks = append(module.Blocks, nil)
+	module.BlockNames = append(module.BlockNames, name)
+	module.BlockTemplates = append(module.BlockTemplates, template)
+	return len(module.Blocks) - 1
+}
+
+// aliased tells if an import is only reachable through its alias
+func (module *Module) aliased(i int) bool {
+	for _, index := range module.Aliases {
+		if index == i {
+			return true
+		}
+	}
+	return false
+}
+
+type Block struct {
+	Name     string             `json:"name"`
+	Template *Template          `json:"-"`
+	Instance *Instance          `json:"instance"`
+	Native   ast.NativeFunction `json:"-"`
+}
+
+// Instance holds the state of a block that outlives its calls, variables declared in its init and
+// the cells written by scope mutaters
+type Instance struct {
+	Slots []int64         `json:"slots"`
+	Cells map[int64]int64 `json:"cells"`
+}
+
+func (instance *Instance) copy() *Instance {
+	result := &Instance{Slots: make([]int64, len(instance.Slots)), Cells: map[int64]int64{}}
+	copy(result.Slots, instance.Slots)
+	for key, value := range instance.Cells {
+		result.Cells[key] = value
+	}
+	return result
+}
+
+type Frame struct {
+	function *Function
+	locals   []int64
+	blocks   []*Block
+	instance *Instance
+	// template is the block the frame runs the body or the init of, nil for the main function
+	template *Template
+	// caller is the frame that called the block and ip is where the frame is while its callees run
+	caller *Frame
+	ip     int
+}
+
+type Callstack struct {
+	Label string `json:"label"`
+}
+
+// owner is what the thrower reports for, a module and the callstack the machine had when it failed
+type owner struct {
+	module    *Module
+	callstack []Callstack
+	verbosity int
+}
+
+func (owner *owner) Source() thrower.Source {
+	return thrower.Source{
+		Filename:       owner.module.Filename,
+		URI:            owner.module.URI,
+		Content:        owner.module.Content,
+		VerbosityLevel: owner.verbosity,
+	}
+}
+
+func (owner *owner) Labels() []string {
+	labels := []string{}
+	for _, callstack := range owner.callstack {
+		labels = append(labels, callstack.Label)
+	}
+	return labels
+}
+
+type RuntimeError struct {
+	Kind      thrower.ErrorKind
+	Message   string
+	Position  ast.Position
+	Module    *Module
+	Callstack []Callstack
+	Value     int64
+	Cause     error
+}
+
+func (err RuntimeError) Error() string {
+	return err.Message
+}
+
+type Machine struct {
+	StdPath              string                    `json:"std_path"`
+	ColoredOutput        bool                      `json:"colored_output"`
+	VerbosityLevel       int                       `json:"verbosity_level"`
+	MaximumCallstackSize int                       `json:"maximum_callstack_size"`
+	Implementors         []implementor.Implementor `json:"implementors"`
+	Context              context.Context           `json:"-"`
+	StepBudget           int64                     `json:"step_budget"`
+	steps                int64
+	Stdin                io.Reader   `json:"-"`
+	Stdout               io.Writer   `json:"-"`
+	Stderr               io.Writer   `json:"-"`
+	Callstack            []Callstack `json:"callstack"`
+	stack                []int64
+	// SearchPaths are the directories 'module:' imports are looked up in when they are not next to the file
+	SearchPaths      []string                 `json:"search_paths"`
+	WarningsAsErrors bool                     `json:"warnings_as_errors"`
+	Permissions      *implementor.Permissions `json:"permissions"`
+	modules          map[string]*Module
+	loading          []*Module
+}
+
+func NewMachine(std_path string, colored_output bool, verbosity_level int) *Machine {
+	return &Machine{
+		StdPath:              std_path,
+		ColoredOutput:        colored_output,
+		VerbosityLevel:       verbosity_level,
+		MaximumCallstackSize: 8000,
+	}
+}
+
+func (machine *Machine) thrower(module *Module, callstack []Callstack) thrower.Thrower {
+	return thrower.Thrower{
+		Owner:  &owner{module: module, callstack: callstack, verbosity: machine.VerbosityLevel},
+		Color:  util.NewColor(machine.ColoredOutput),
+		Output: machine.Stderr,
+	}
+}
+
+// RunFile compiles and runs a file along with its imports, runtime errors are recovered and returned
+// as errors built by the thrower
+func (machine *Machine) RunFile(file_path string) error {
+	return machine.RunSource(file_path, "")
+}
+
+// RunSource runs a program that does not come from a file, the path names it in errors and module
+// imports are relative to its directory. An empty content reads the file at the path.
+func (machine *Machine) RunSource(file_path string, content string) (result error) {
+	if machine.Stdin == nil {
+		machine.Stdin = os.Stdin
+	}
+	if _, ok := machine.Stdin.(*bufio.Reader); !ok {
+		machine.Stdin = bufio.NewReader(machine.Stdin)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(RuntimeError); ok {
+				t := machine.thrower(err.Module, err.Callstack)
+				thrown := t.Throw(err.Kind, err.Message, err.Position)
+				thrown.Value = err.Value
+				thrown.Cause = err.Cause
+				result = thrown
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	module, err := machine.load(file_path, content)
+	if err != nil {
+		return err
+	}
+	machine.run(module)
+	return nil
+}
+
+// step counts a loop iteration or a block call against the budget of the machine and checks its context
+func (machine *Machine) step(module *Module, position ast.Position) {
+	machine.steps++
+
+	if machine.StepBudget > 0 && machine.steps > machine.StepBudget {
+		machine.fail(module, thrower.BudgetError, "Bir process has exceeded its budget of "+strconv.FormatInt(machine.StepBudget, 10)+" steps", position)
+	}
+
+	if machine.Context != nil {
+		select {
+		case <-machine.Context.Done():
+			panic(RuntimeError{Kind: thrower.CancelledError, Message: "Bir process has been cancelled, " + machine.Context.Err().Error(), Position: position, Module: module, Callstack: machine.Callstack, Cause: machine.Context.Err()})
+		default:
+		}
+	}
+}
+
+func (machine *Machine) fail(module *Module, kind thrower.ErrorKind, message string, position ast.Position) {
+	panic(RuntimeError{Kind: kind, Message: message, Position: position, Module: module, Callstack: machine.Callstack})
+}
+
+// warn reports a warning, the process fails with it instead when warnings are errors
+func (machine *Machine) warn(module *Module, message string, position ast.Position) {
+	if machine.WarningsAsErrors {
+		machine.fail(module, thrower.WarningError, message, position)
+	}
+	t := machine.thrower(module, machine.Callstack)
+	t.Warn(message, position)
+}
+
+// load reads, parses and compiles a module, its imports are loaded and run before it is compiled
+func (machine *Machine) load(file_path string, content string) (*Module, error) {
+	file_path = strings.ReplaceAll(file_path, "\\", "/")
+	dir, file := path.Split(file_path)
+	module := &Module{
+		Path:      file_path,
+		URI:       "file://" + file_path,
+		Filename:  file,
+		Directory: dir,
+	}
+
+	// Like an engine of the tree walker, a module is parsed with an empty callstack and resolves its
+	// imports under its own main entry
+	callstack := machine.Callstack
+	machine.Callstack = nil
+	defer func() { machine.Callstack = callstack }()
+
+	module.Content = content
+	if module.Content == "" {
+		raw, err := std.ReadFile(file_path)
+		if err != nil {
+			t := machine.thrower(module, nil)
+			return module, t.ThrowAnonymous(thrower.ImportError, "Could not read file '"+file_path+"'")
+		}
+		module.Content = string(raw)
+	}
+
+	result := parser.Parse(module.Content)
+	if result.Error {
+		content := result.Content.(map[string]interface{})
+		machine.fail(module, thrower.SyntaxError, content["message"].(string), content["position"].(ast.Position))
+	}
+
+	program, err := ast.Decode(result.Content)
+	if err != nil {
+		decode_error := err.(ast.DecodeError)
+		machine.fail(module, thrower.SyntaxError, decode_error.Message, decode_error.Position)
+	}
+
+	module.Exports = program.Exports()
+	if machine.modules == nil {
+		machine.modules = map[string]*Module{}
+	}
+	// The imports the names brought without an alias come from, two modules could not bring the same name
+	owners := map[string]int{}
+	machine.loading = append(machine.loading, module)
+	defer func() { machine.loading = machine.loading[:len(machine.loading)-1] }()
+	machine.Callstack = []Callstack{{Label: "main [" + module.Filename + "]"}}
+
+	for _, statement := range program.Imports {
+		use_path, _, err := importer.Importer{StdPath: machine.StdPath, SearchPaths: machine.SearchPaths}.Path(module.Directory, statement.Source.Value)
+		if err != nil {
+			machine.fail(module, thrower.ImportError, err.Error(), statement.Position)
+		}
+
+		chain := []string{}
+		for _, loading := range machine.loading {
+			chain = append(chain, loading.Path)
+		}
+		if err := importer.Cycle(chain, statement.Source.Value, use_path); err != nil {
+			machine.fail(module, thrower.ImportError, err.Error(), statement.Position)
+		}
+
+		key := importer.Key(use_path)
+
+		alias := statement.Alias.Value
+		if alias != "" {
+			if _, ok := module.Aliases[alias]; ok {
+				machine.fail(module, thrower.ImportError, "Could not import '"+statement.Source.Value+"' as '"+alias+"', another module is imported as '"+alias+"'", statement.Alias.Position)
+			}
+		}
+
+		use_module, loaded := machine.modules[key]
+		if !loaded {
+			var err error
+			use_module, err = machine.load(use_path, "")
+			if err != nil {
+				return module, err
+			}
+			machine.run(use_module)
+			machine.modules[key] = use_module
+		}
+
+		visible, err := statement.Visible(use_module.Exports)
+		if err != nil {
+			import_error := err.(ast.ImportError)
+			machine.fail(module, thrower.ImportError, import_error.Message, import_error.Position)
+		}
+
+		if alias == "" {
+			names := []string{}
+			for name := range visible {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				owner, ok := owners[name]
+				if ok && module.Imports[owner] != use_module {
+					machine.fail(module, thrower.ImportError, "Could not import '"+name+"' from '"+statement.Source.Value+"', it is already imported from '"+program.Imports[owner].Source.Value+"'", statement.Position)
+				}
+				owners[name] = len(module.Imports)
+			}
+		}
+
+		if alias != "" {
+			if module.Aliases == nil {
+				module.Aliases = map[string]int{}
+			}
+			module.Aliases[alias] = len(module.Imports)
+		}
+		module.Imports = append(module.Imports, use_module)
+		module.Visible = append(module.Visible, visible)
+	}
+
+	implementors := append([]implementor.Implementor{&implementor.Bir{Stdin: machine.Stdin, Stdout: machine.Stdout, Permissions: machine.Permissions}}, machine.Implementors...)
+	natives := []string{}
+	for _, i := range implementors {
+		natives = append(natives, i.Name())
+	}
+	if errors := resolve(module, program, natives); len(errors) > 0 {
+		machine.fail(module, thrower.ReferenceError, errors[0].Message, errors[0].Position)
+	}
+	module.Main = Compile(module, program, natives)
+	for slot, i := range implementors {
+		module.Blocks[slot] = &Block{Name: i.Name(), Native: implementor.Dispatch(i)}
+	}
+
+	return module, nil
+}
+
+// resolve runs the resolver of the engine on a module before it is compiled so that its reference errors
+// are thrown before it runs, the scopes mirror the ones an engine would have after importing
+func resolve(module *Module, program *ast.Program, natives []string) []resolver.ResolveError {
+	r := &resolver.Resolver{}
+	for i := len(module.Imports) - 1; i >= 0; i-- {
+		imported := module.Imports[i]
+		s := &resolver.Scope{Exported: module.Visible[i]}
+		for alias, index := range module.Aliases {
+			if index == i {
+				s.Alias = alias
+			}
+		}
+		for _, name := range imported.GlobalNames {
+			if !strings.Contains(name, ".") {
+				s.DeclareVariable(name, nil)
+			}
+		}
+		for slot, name := range imported.BlockNames {
+			if strings.Contains(name, ".") {
+				continue
+			}
+			if imported.BlockTemplates[slot] == nil {
+				s.DeclareNative(name)
+			} else {
+				s.DeclareBlock(name, nil)
+			}
+		}
+		r.Scopes = append(r.Scopes, s)
+	}
+
+	root := &resolver.Scope{}
+	for _, name := range natives {
+		root.DeclareNative(name)
+	}
+	r.Scopes = append(r.Scopes, root)
+
+	for i := range module.Imports {
+		declareNamespaces(r, module, i)
+	}
+	return r.Resolve(program.Program)
+}
+
+// declareNamespaces gives the resolver the namespaces an import brings, behind its alias if it has one
+func declareNamespaces(r *resolver.Resolver, module *Module, i int) {
+	imported := module.Imports[i]
+	for _, namespace := range imported.Namespaces {
+		name := namespace
+		for alias, index := range module.Aliases {
+			if index == i {
+				name = alias + "." + namespace
+			}
+		}
+		if _, ok := importedQualified(module, i, name); !ok {
+			continue
+		}
+
+		s := &resolver.Scope{}
+		prefix := namespace + "."
+		for _, member := range imported.GlobalNames {
+			if strings.HasPrefix(member, prefix) && !strings.Contains(member[len(prefix):], ".") {
+				s.DeclareVariable(member[len(prefix):], nil)
+			}
+		}
+		for _, member := range imported.BlockNames {
+			if strings.HasPrefix(member, prefix) && !strings.Contains(member[len(prefix):], ".") {
+				s.DeclareBlock(member[len(prefix):], nil)
+			}
+		}
+		r.DeclareNamespace(name, &resolver.Namespace{Scope: s})
+	}
+}
+
+func (machine *Machine) run(module *Module) {
+	callstack := machine.Callstack
+	machine.Callstack = []Callstack{{Label: "main [" + module.Filename + "]"}}
+	machine.execute(&Frame{
+		function: module.Main,
+		locals:   make([]int64, module.Main.Locals),
+		blocks:   make([]*Block, module.Main.Blocks),
+	})
+	machine.Callstack = callstack
+}
+
+func (machine *Machine) push(value int64) {
+	machine.stack = append(machine.stack, value)
+}
+
+func (machine *Machine) pop() int64 {
+	value := machine.stack[len(machine.stack)-1]
+	machine.stack = machine.stack[:len(machine.stack)-1]
+	return value
+}
+
+// popN removes the top n values of the stack and returns them in the order they were pushed
+func (machine *Machine) popN(n int) []int64 {
+	values := make([]int64, n)
+	copy(values, machine.stack[len(machine.stack)-n:])
+	machine.stack = machine.stack[:len(machine.stack)-n]
+	return values
+}
+
+func (machine *Machine) block(frame *Frame, site CallSite) *Block {
+	module := frame.function.Module
+
+	switch reference := site.Block; reference.Location {
+	case LocationLocal:
+		return frame.blocks[reference.Index]
+	case LocationGlobal:
+		return module.Blocks[reference.Index]
+	case LocationImport:
+		return module.Imports[reference.Module].Blocks[reference.Index]
+	case LocationDynamic:
+		return machine.findBlock(frame, site.Name)
+	}
+	return nil
+}
+
+// findVariable looks a name up on the frames of the callers of a block while they run code of its
+// module, then in the globals of the module and in the names its imports bring. Imported variables are
+// foreign and they could not be updated.
+func (machine *Machine) findVariable(frame *Frame, name string) (value *int64, kind string, foreign bool) {
+	module := frame.function.Module
+
+	for caller := frame.caller; caller != nil && caller.function.Module == module; caller = caller.caller {
+		function := caller.function
+		for i := len(function.Names) - 1; i >= 0; i-- {
+			local := function.Names[i]
+			if !local.Block && local.Name == name && local.live(caller.ip) {
+				return &caller.locals[local.Slot], local.Kind, false
+			}
+		}
+		if caller.template != nil {
+			for i, slot := range caller.template.Instance {
+				if slot.Name == name && (function != caller.template.Init || slot.Start < caller.ip) {
+					return &caller.instance.Slots[i], slot.Kind, false
+				}
+			}
+		}
+		for prefix := function.Namespace; prefix != ""; prefix = parentNamespace(prefix) {
+			if i := findGlobal(module, prefix+name); i >= 0 {
+				return &module.Globals[i], module.GlobalKinds[i], false
+			}
+		}
+	}
+
+	if i := findGlobal(module, name); i >= 0 {
+		return &module.Globals[i], module.GlobalKinds[i], false
+	}
+	for i, imported := range module.Imports {
+		if module.aliased(i) || !module.Visible[i][name] {
+			continue
+		}
+		if j := findGlobal(imported, name); j >= 0 {
+			return &imported.Globals[j], imported.GlobalKinds[j], true
+		}
+	}
+	return nil, "", false
+}
+
+// findBlock looks a block up the way findVariable looks up a variable
+func (machine *Machine) findBlock(frame *Frame, name string) *Block {
+	module := frame.function.Module
+
+	for caller := frame.caller; caller != nil && caller.function.Module == module; caller = caller.caller {
+		function := caller.function
+		for i := len(function.Names) - 1; i >= 0; i-- {
+			local := function.Names[i]
+			if local.Block && local.Name == name && local.live(caller.ip) && caller.blocks[local.Slot] != nil {
+				return caller.blocks[local.Slot]
+			}
+		}
+		for prefix := function.Namespace; prefix != ""; prefix = parentNamespace(prefix) {
+			if block := findBlock(module, prefix+name); block != nil {
+				return block
+			}
+		}
+	}
+
+	if block := findBlock(module, name); block != nil {
+		return block
+	}
+	for i, imported := range module.Imports {
+		if module.aliased(i) || !module.Visible[i][name] {
+			continue
+		}
+		if block := findBlock(imported, name); block != nil {
+			return block
+		}
+	}
+	return nil
+}
+
+// findGlobal returns the slot of a defined global of a module, -1 when there is none
+func findGlobal(module *Module, name string) int {
+	for i, global := range module.GlobalNames {
+		if global == name && module.Defined[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+func findBlock(module *Module, name string) *Block {
+	for i, block := range module.BlockNames {
+		if block == name && module.Blocks[i] != nil {
+			return module.Blocks[i]
+		}
+	}
+	return nil
+}
+
+// parentNamespace returns the prefix of the namespace a namespace is declared in, 'codes.' for
+// 'codes.http.'
+func parentNamespace(prefix string) string {
+	return prefix[:strings.LastIndex(prefix[:len(prefix)-1], ".")+1]
+}
+
+func (machine *Machine) setBlock(frame *Frame, reference Reference, block *Block) {
+	switch reference.Location {
+	case LocationLocal:
+		frame.blocks[reference.Index] = block
+	case LocationGlobal:
+		frame.function.Module.Blocks[reference.Index] = block
+	}
+}
+
+func (machine *Machine) execute(frame *Frame) int64 {
+	function := frame.function
+	module := function.Module
+	code := function.Code
+
+	for ip := 0; ip < len(code); ip++ {
+		instruction := code[ip]
+		a, b := int(instruction.A), int(instruction.B)
+
+		fail := func(kind thrower.ErrorKind, message string) {
+			machine.fail(module, kind, message, function.Positions[ip])
+		}
+
+		switch instruction.Op {
+		case OpConstant:
+			machine.push(function.Constants[a])
+		case OpPop:
+			machine.pop()
+		case OpGetLocal:
+			machine.push(frame.locals[a])
+		case OpSetLocal:
+			frame.locals[a] = machine.pop()
+		case OpGetInstance:
+			machine.push(frame.instance.Slots[a])
+		case OpSetInstance:
+			frame.instance.Slots[a] = machine.pop()
+		case OpGetGlobal:
+			if !module.Defined[a] {
+				fail(thrower.ReferenceError, "Could not find variable '"+module.GlobalNames[a]+"' in the frame")
+			}
+			machine.push(module.Globals[a])
+		case OpSetGlobal:
+			if b > 0 && !module.Defined[a] {
+				fail(thrower.RuntimeError, function.Strings[b-1])
+			}
+			module.Globals[a] = machine.pop()
+			module.Defined[a] = true
+		case OpGetImport:
+			imported := module.Imports[a]
+			if !imported.Defined[b] {
+				fail(thrower.ReferenceError, "Could not find variable '"+imported.GlobalNames[b]+"' in the frame")
+			}
+			machine.push(imported.Globals[b])
+		case OpNegate:
+			machine.push(-machine.pop())
+		case OpAdd, OpSubtract, OpMultiply, OpDivide, OpModulus, OpExponent, OpRoot, OpLog:
+			right := machine.pop()
+			left := machine.pop()
+			if (instruction.Op == OpDivide || instruction.Op == OpModulus || instruction.Op == OpRoot) && right == 0 {
+				fail(thrower.RuntimeError, "Division by zero")
+			}
+			machine.push(arithmetic(instruction.Op, left, right))
+		case OpEqual, OpNotEqual, OpLess, OpLessEqual, OpGreater, OpGreaterEqual:
+			right := machine.pop()
+			left := machine.pop()
+			machine.push(compare(instruction.Op, left, right))
+		case OpJump:
+			ip = a - 1
+		case OpStep:
+			machine.step(module, function.Positions[ip])
+		case OpJumpUnlessTrue:
+			if machine.pop() != 1 {
+				ip = a - 1
+			}
+		case OpJumpUnlessLess:
+			right := machine.pop()
+			left := machine.pop()
+			if !(left < right) {
+				ip = a - 1
+			}
+		case OpGetDynamic:
+			value, _, _ := machine.findVariable(frame, function.Strings[a])
+			if value == nil {
+				fail(thrower.ReferenceError, "Could not find variable '"+function.Strings[a]+"' in the frame")
+			}
+			machine.push(*value)
+		case OpSetDynamic:
+			value, kind, foreign := machine.findVariable(frame, function.Strings[a])
+			if value == nil {
+				fail(thrower.ReferenceError, "Could not "+function.Strings[b]+" a variable that does not exist")
+			}
+			if foreign || kind == "const" {
+				fail(thrower.RuntimeError, "Could not "+function.Strings[b]+" an immutable variable")
+			}
+			*value = machine.pop()
+		case OpCall:
+			frame.ip = ip
+			machine.call(frame, function.Calls[a], function.Positions[ip])
+		case OpReturn:
+			return machine.pop()
+		case OpDeclareBlock:
+			template := function.Templates[a]
+			block := &Block{
+				Name:     template.Name,
+				Template: template,
+				Instance: &Instance{Slots: make([]int64, len(template.Instance)), Cells: map[int64]int64{}},
+			}
+			if template.Init != nil {
+				frame.ip = ip
+				machine.Callstack = append(machine.Callstack, Callstack{Label: template.Name + ":init"})
+				machine.execute(&Frame{
+					function: template.Init,
+					locals:   make([]int64, template.Init.Locals),
+					blocks:   make([]*Block, template.Init.Blocks),
+					instance: block.Instance,
+					template: template,
+					caller:   frame,
+				})
+				machine.Callstack = machine.Callstack[:len(machine.Callstack)-1]
+			}
+			machine.setBlock(frame, template.Slot, block)
+		case OpImplement:
+			machine.implement(frame, function.Templates[a], function.Positions[ip])
+		case OpWrite:
+			arguments := machine.popN(a)
+			frame.instance.Cells[arguments[0]] = arguments[1]
+			machine.push(arguments[1])
+		case OpRead:
+			arguments := machine.popN(a)
+			value, ok := frame.instance.Cells[arguments[0]]
+			if !ok {
+				fail(thrower.RuntimeError, "Could not read index '"+strconv.Itoa(int(arguments[0]))+"', the value is non-existant")
+			}
+			machine.push(value)
+		case OpDelete:
+			arguments := machine.popN(a)
+			delete(frame.instance.Cells, arguments[0])
+			machine.push(-1)
+		case OpPushLabel:
+			machine.Callstack = append(machine.Callstack, Callstack{Label: function.Strings[a]})
+		case OpPopLabel:
+			machine.Callstack = machine.Callstack[:len(machine.Callstack)-1]
+		case OpWarn:
+			machine.warn(module, function.Strings[a], function.Positions[ip])
+		case OpFail:
+			fail(thrower.RuntimeError, function.Strings[a])
+		case OpThrow:
+			value := machine.pop()
+			panic(RuntimeError{Kind: thrower.ThrowError, Message: "Bir process has thrown error with value '" + strconv.Itoa(int(value)) + "'", Position: function.Positions[ip], Module: module, Callstack: machine.Callstack, Value: value})
+		}
+	}
+
+	return -1
+}
+
+func (machine *Machine) call(frame *Frame, site CallSite, position ast.Position) {
+	module := frame.function.Module
+	block := machine.block(frame, site)
+
+	if block == nil {
+		machine.fail(module, thrower.ReferenceError, "Could not find block '"+site.Name+"'", position)
+	}
+
+	if len(machine.Callstack) > machine.MaximumCallstackSize {
+		callstack := machine.Callstack
+		if len(callstack) >= 10 {
+			callstack = callstack[:10]
+		}
+		panic(RuntimeError{Kind: thrower.OverflowError, Message: "Bir process has overflown the maximum callstack size", Position: position, Module: module, Callstack: callstack})
+	}
+	machine.step(module, position)
+
+	verbs := machine.popN(site.Verbs)
+	arguments := machine.popN(site.Arguments)
+
+	if block.Native != nil {
+		native_verbs := []ast.IntPrimitiveExpression{}
+		native_arguments := []ast.IntPrimitiveExpression{}
+		for _, verb := range verbs {
+			native_verbs = append(native_verbs, util.GenerateIntPrimitive(verb))
+		}
+		for _, argument := range arguments {
+			native_arguments = append(native_arguments, util.GenerateIntPrimitive(argument))
+		}
+
+		machine.Callstack = append(machine.Callstack, Callstack{Label: site.Name})
+		native_function_return := block.Native(native_verbs, native_arguments)
+		if native_function_return.Error {
+			machine.fail(module, thrower.NativeError, native_function_return.Message, position)
+		} else if native_function_return.Warn {
+			machine.warn(module, native_function_return.Message, position)
+		}
+		machine.Callstack = machine.Callstack[:len(machine.Callstack)-1]
+		machine.push(native_function_return.Value.Value)
+		return
+	}
+
+	template := block.Template
+	source := template.arity()
+
+	if len(arguments) != len(source.Arguments) {
+		machine.warn(module, "Expected "+strconv.Itoa(len(source.Arguments))+" argument(s), found "+strconv.Itoa(len(arguments))+" while calling '"+site.Name+"'", position)
+		arguments = filled(len(source.Arguments))
+	}
+	if len(verbs) != len(source.Verbs) {
+		machine.warn(module, "Expected "+strconv.Itoa(len(source.Verbs))+" verb(s), found "+strconv.Itoa(len(verbs))+" while calling '"+site.Name+"'", position)
+		verbs = filled(len(source.Verbs))
+	}
+
+	locals := make([]int64, source.Body.Locals)
+	copy(locals, arguments)
+	copy(locals[len(arguments):], verbs)
+
+	label := site.Name
+	if template.Implementing {
+		label = template.Label
+	}
+
+	machine.Callstack = append(machine.Callstack, Callstack{Label: label})
+	value := machine.execute(&Frame{
+		function: source.Body,
+		locals:   locals,
+		blocks:   make([]*Block, source.Body.Blocks),
+		instance: block.Instance,
+		template: source,
+		caller:   frame,
+	})
+	machine.Callstack = machine.Callstack[:len(machine.Callstack)-1]
+	machine.push(value)
+}
+
+// implement creates a block that runs the body of another block with a copy of its instance, the
+// populations of the declaration are written into the cells of the copy
+func (machine *Machine) implement(frame *Frame, template *Template, position ast.Position) {
+	module := frame.function.Module
+	total := 0
+	for _, population := range template.Populate {
+		total += population.Values
+	}
+	values := machine.popN(total)
+
+	implemented := machine.block(frame, template.Implements)
+	if implemented == nil {
+		machine.fail(module, thrower.ReferenceError, "Could not implement '"+template.Implements.Name+"', block is non-existant", position)
+	}
+	if implemented.Native != nil {
+		machine.fail(module, thrower.ReferenceError, "Could not implement '"+template.Implements.Name+"', native blocks could not be implemented", position)
+	}
+
+	instance := implemented.Instance.copy()
+	for j, population := range template.Populate {
+		buffer := 0
+		if j > 0 {
+			previous := template.Populate[j-1]
+			if previous.IsString {
+				buffer = len(previous.String)
+			} else {
+				buffer = previous.Values
+			}
+		}
+
+		length := 0
+		if population.IsString {
+			for i, value := range population.String {
+				instance.Cells[int64(i+buffer)] = int64(value)
+			}
+			length = len(population.String)
+		} else {
+			for i, value := range values[:population.Values] {
+				instance.Cells[int64(i+buffer)] = value
+			}
+			values = values[population.Values:]
+			length = population.Values
+		}
+
+		if population.Key != "" {
+			if population.Label < 0 {
+				machine.fail(module, thrower.ReferenceError, "Could not find a local variable '"+population.Key+"' from population label. Labelled populations must have a local variable counterpart.", population.Position)
+			}
+			instance.Slots[population.Label] = int64(length)
+		}
+	}
+
+	machine.setBlock(frame, template.Slot, &Block{Name: template.Name, Template: template, Instance: instance})
+}
+
+func filled(n int) []int64 {
+	values := make([]int64, n)
+	for i := range values {
+		values[i] = -1
+	}
+	return values
+}
+
+func arithmetic(op Opcode, left int64, right int64) int64 {
+	switch op {
+	case OpAdd:
+		return left + right
+	case OpSubtract:
+		return left - right
+	case OpMultiply:
+		return left * right
+	case OpDivide:
+		return left / right
+	case OpModulus:
+		return left % right
+	case OpExponent:
+		return int64(math.Pow(float64(left), float64(right)))
+	case OpRoot:
+		return int64(math.Pow(float64(left), float64(1/right)))
+	case OpLog:
+		if left == 0 || left == 1 {
+			return 1
+		} else if util.IsPowerOfTen(left) {
+			return int64(math.Ceil(math.Log10(float64(left))) + 1)
+		}
+		return int64(math.Ceil(math.Log10(float64(left))))
+	}
+	return -1
+}
+
+func compare(op Opcode, left int64, right int64) int64 {
+	var result bool
+
+	switch op {
+	case OpEqual:
+		result = left == right
+	case OpNotEqual:
+		result = left != right
+	case OpLess:
+		result = left < right
+	case OpLessEqual:
+		result = left <= right
+	case OpGreater:
+		result = left > right
+	case OpGreaterEqual:
+		result = left >= right
+	}
+
+	if result {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,408 @@
+package vm_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/canpacis/birlang/internal/testfiles"
+	"github.com/canpacis/birlang/src/engine"
+	"github.com/canpacis/birlang/src/thrower"
+	"github.com/canpacis/birlang/src/vm"
+)
+
+// printer writes a number below a million and a newline to the standard output, an if statement ends
+// the block it is in so every condition is the last statement of a block of its own
+const printer = `use "std:util"
+shown [digit, started, last] {
+  if digit != 0 {
+    return 1
+  } elif last == 1 {
+    return 1
+  } elif started == 1 {
+    return 1
+  } else {
+    return 0
+  }
+}
+emit [digit, started] {
+  if started == 1 {
+    bir:util.push (digit + 48)
+  }
+}
+print [n] {
+  let started = 0
+  for 6 as i {
+    let digit = {n / {10 ^ {5 - i}}} % 10
+    started = shown (digit, started, i == 5)
+    emit (digit, started)
+  }
+  bir:util.push (10)
+  bir:util.write (util.out)
+}
+`
+
+// result is what a run leaves behind, the output and the error it failed with
+type result struct {
+	output string
+	err    string
+}
+
+func describe(output *bytes.Buffer, err error) result {
+	r := result{output: output.String()}
+	if err == nil {
+		return r
+	}
+	bir_error, ok := err.(*thrower.BirError)
+	if !ok {
+		r.err = err.Error()
+		return r
+	}
+	position := strconv.Itoa(int(bir_error.Position.Line)) + ":" + strconv.Itoa(int(bir_error.Position.Col))
+	r.err = string(bir_error.Kind) + ": " + bir_error.Message + " at " + bir_error.File + ":" + position + " in " + strings.Join(bir_error.Callstack, " < ")
+	return r
+}
+
+func runEngine(main string, budget int64) result {
+	output := &bytes.Buffer{}
+	instance := engine.NewEngine(main, "", false, false, 0)
+	instance.Stdout = output
+	instance.Stderr = &bytes.Buffer{}
+	instance.StepBudget = budget
+	err := instance.Init()
+	if err == nil {
+		err = instance.Run()
+	}
+	return describe(output, err)
+}
+
+func runMachine(main string, budget int64) result {
+	output := &bytes.Buffer{}
+	machine := vm.NewMachine("", false, 0)
+	machine.Stdout = output
+	machine.Stderr = &bytes.Buffer{}
+	machine.StepBudget = budget
+	return describe(output, machine.RunFile(main))
+}
+
+func TestParity(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		budget int64
+		output string
+	}{
+		{
+			name: "arithmetic",
+			files: map[string]string{"main.bir": printer + `
+print (1 + 2 * 3)
+print ({1 + 2} * 3)
+print (17 % 5)
+print (2 ^ 10)
+print (7 / 2)
+print (12 - 2 * 3)
+`},
+			output: "7\n9\n2\n1024\n3\n6\n",
+		},
+		{
+			name: "loops and conditions",
+			files: map[string]string{"main.bir": printer + `
+let total = 0
+for 10 as i {
+  if i % 2 == 0 {
+    total += i
+  } else {
+    total -= 1
+  }
+}
+print (total)
+let n = 0
+while n < 5 {
+  n++
+}
+print (n)
+switch n {
+  case 4 { print (4) }
+  case 5 { print (5) }
+  default { print (0) }
+}
+`},
+			output: "15\n5\n5\n",
+		},
+		{
+			name: "blocks, verbs and recursion",
+			files: map[string]string{"main.bir": printer + `
+fib [n] {
+  if n < 2 {
+    return n
+  } else {
+    return fib (n - 1) + fib (n - 2)
+  }
+}
+pick:verb [n] {
+  switch verb {
+    case 1 { return n * 10 }
+    case 2 { return n * 100 }
+    default { return n }
+  }
+}
+print (fib (15))
+print (pick:1 (3))
+print (pick:2 (3))
+print (pick:9 (3))
+`},
+			output: "610\n30\n300\n3\n",
+		},
+		{
+			name: "implements and scope mutaters",
+			files: map[string]string{"main.bir": printer + `
+counter:verb [n] {
+  init {
+    local count = 0
+  }
+  switch verb {
+    case util.write {
+      count += n
+      [Write count, n]
+      return count
+    }
+    case util.read {
+      return [Read n]
+    }
+  }
+}
+a implements counter
+b implements counter
+print (a:util.write (5))
+print (a:util.write (6))
+print (b:util.write (2))
+print (a:util.read (11))
+`},
+			output: "5\n11\n2\n6\n",
+		},
+		{
+			name: "namespaces",
+			files: map[string]string{
+				"lib.bir": `namespace codes {
+  const base = 40
+  namespace http {
+    const ok = 200
+  }
+  offset [n] {
+    return n + base
+  }
+}
+`,
+				"main.bir": printer + `use "./lib.bir"
+use "./lib.bir" as l
+namespace counter {
+  let count = 5
+  bump [] {
+    count++
+    return count
+  }
+}
+print (codes.http.ok)
+print (codes.offset (2))
+print (l.codes.base)
+print (counter.bump ())
+print (counter.count)
+`,
+			},
+			output: "200\n42\n40\n6\n6\n",
+		},
+		{
+			name: "exports and selective imports",
+			files: map[string]string{
+				"lib.bir": `export const limit = 7
+const hidden = 1
+export twice [n] {
+  return n * 2
+}
+`,
+				"main.bir": printer + `use "./lib.bir" { twice }
+use "./lib.bir" as l
+print (twice (4))
+print (l.limit)
+`,
+			},
+			output: "8\n7\n",
+		},
+		{
+			name: "modules loaded once",
+			files: map[string]string{
+				"lib/shared.bir": "use \"std:util\"\nbir:util.push (115)\nbir:util.write (util.out)\nexport let shared = 7\n",
+				"lib/a.bir":      "use \"./shared.bir\"\nexport a [] { return shared + 1 }\n",
+				"mods/b.bir":     "use \"../lib/shared.bir\"\nexport b [] { return shared + 2 }\n",
+				"main.bir": printer + `use "./lib/a.bir"
+use "./mods/b.bir" as m
+print (a () + m.b ())
+`,
+			},
+			output: "s17\n",
+		},
+		{
+			name: "dynamic scoping",
+			files: map[string]string{"main.bir": printer + `
+let v = 1
+inner [] {
+  return v
+}
+outer [] {
+  let v = 3
+  return inner ()
+}
+nested [] {
+  let a = 2
+  twice [] {
+    return a * 10
+  }
+  return twice ()
+}
+bump [] {
+  counter = counter + 1
+}
+run [] {
+  let counter = 5
+  bump ()
+  bump ()
+  return counter
+}
+namespace tally {
+  let count = 40
+  read [] {
+    return count + inner ()
+  }
+}
+print (inner ())
+print (outer ())
+print (nested ())
+print (run ())
+print (tally.read ())
+`},
+			output: "1\n3\n20\n7\n41\n",
+		},
+		{
+			name:  "assignment to a constant of a caller",
+			files: map[string]string{"main.bir": "bump [] {\n  c = 2\n}\nrun [] {\n  const c = 1\n  bump ()\n}\nrun ()\n"},
+		},
+		{
+			name:  "variable of a returned caller",
+			files: map[string]string{"main.bir": "inner [] {\n  return v\n}\nouter [] {\n  let v = 3\n}\nouter ()\ninner ()\n"},
+		},
+		{
+			name:  "undefined variable",
+			files: map[string]string{"main.bir": "let x = y\n"},
+		},
+		{
+			name:  "division by zero",
+			files: map[string]string{"main.bir": "f [] { return 1 / 0 }\nf ()\n"},
+		},
+		{
+			name:  "thrown value",
+			files: map[string]string{"main.bir": "f [] { throw 9 }\nf ()\n"},
+		},
+		{
+			name:  "callstack overflow",
+			files: map[string]string{"main.bir": "f [] { return f () }\nf ()\n"},
+		},
+		{
+			name:  "assignment to a constant",
+			files: map[string]string{"main.bir": "const c = 1\nc = 2\n"},
+		},
+		{
+			name:  "native implements",
+			files: map[string]string{"main.bir": "x implements bir\n"},
+		},
+		{
+			name:   "step budget",
+			files:  map[string]string{"main.bir": "let n = 0\nwhile 1 == 1 {\n  n++\n}\n"},
+			budget: 100,
+		},
+		{
+			name: "hidden name",
+			files: map[string]string{
+				"lib.bir":  "export const a = 1\nconst b = 2\n",
+				"main.bir": "use \"./lib.bir\" { b }\n",
+			},
+		},
+		{
+			name: "hidden namespace",
+			files: map[string]string{
+				"lib.bir":  "const y = 1\nnamespace codes {\n  const base = 40\n}\n",
+				"main.bir": "use \"./lib.bir\" { y }\nlet x = codes.base\n",
+			},
+		},
+		{
+			name:  "unknown namespace",
+			files: map[string]string{"main.bir": "nowhere.x (1)\n"},
+		},
+		{
+			name:  "namespace in a block",
+			files: map[string]string{"main.bir": "f [] {\n  namespace x {\n    let a = 1\n  }\n}\n"},
+		},
+		{
+			name:  "statement in a namespace",
+			files: map[string]string{"main.bir": "namespace x {\n  a = 1\n}\n"},
+		},
+		{
+			name: "import cycle",
+			files: map[string]string{
+				"a.bir":    "use \"./b.bir\"\n",
+				"b.bir":    "use \"./a.bir\"\n",
+				"main.bir": "use \"./a.bir\"\n",
+			},
+		},
+		{
+			name: "error in an import",
+			files: map[string]string{
+				"lib.bir":  "let x = 1 / 0\n",
+				"main.bir": "use \"./lib.bir\"\n",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			main := testfiles.Write(t, test.files) + "/main.bir"
+			tree := runEngine(main, test.budget)
+			machine := runMachine(main, test.budget)
+
+			if tree.output != test.output {
+				t.Errorf("engine printed %q, want %q", tree.output, test.output)
+			}
+			if machine.output != tree.output {
+				t.Errorf("vm printed %q, engine printed %q", machine.output, tree.output)
+			}
+			if machine.err != tree.err {
+				t.Errorf("vm failed with %q, engine failed with %q", machine.err, tree.err)
+			}
+			if test.output == "" && tree.err == "" {
+				t.Errorf("the engine did not fail")
+			}
+			if test.output != "" && tree.err != "" {
+				t.Errorf("the engine failed with %q", tree.err)
+			}
+		})
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	main := testfiles.Write(t, map[string]string{"main.bir": "let n = 0\nwhile 1 == 1 {\n  n++\n}\n"}) + "/main.bir"
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	machine := vm.NewMachine("", false, 0)
+	machine.Context = ctx
+	err := machine.RunFile(main)
+	var bir_error *thrower.BirError
+	if !errors.As(err, &bir_error) || bir_error.Kind != thrower.CancelledError {
+		t.Fatalf("got %v, want the process to be cancelled", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("the error does not wrap the error of the context")
+	}
+}
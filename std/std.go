@@ -0,0 +1,48 @@
+// Package std embeds the standard library of bir, 'std:' imports are read from it unless a standard
+// library directory is given
+package std
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+//go:embed *.bir
+var files embed.FS
+
+// Root is the directory embedded modules appear in, it is bracketed like the other programs that do
+// not come from a file
+const Root = "[std]"
+
+// Locate returns the path of a standard library module, from the directory when one is given and from
+// the embedded library otherwise. The path is empty when the module does not exist.
+func Locate(std_path string, name string) string {
+	if std_path != "" {
+		module_path := path.Join(std_path, name+".bir")
+		if _, err := os.Stat(module_path); err != nil {
+			return ""
+		}
+		return module_path
+	}
+
+	if _, err := fs.Stat(files, name+".bir"); err != nil {
+		return ""
+	}
+	return path.Join(Root, name+".bir")
+}
+
+// Embedded reports whether a path is one of an embedded module
+func Embedded(file_path string) bool {
+	return strings.HasPrefix(file_path, Root+"/")
+}
+
+// ReadFile reads an embedded module or a file on the disk
+func ReadFile(file_path string) ([]byte, error) {
+	if Embedded(file_path) {
+		return files.ReadFile(strings.TrimPrefix(file_path, Root+"/"))
+	}
+	return os.ReadFile(file_path)
+}
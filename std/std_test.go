@@ -0,0 +1,68 @@
+package std
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/canpacis/birlang/src/ast"
+	"github.com/canpacis/birlang/src/parser"
+)
+
+func TestLocate(t *testing.T) {
+	for _, name := range []string{"util", "io", "assert"} {
+		if located := Locate("", name); located != Root+"/"+name+".bir" || !Embedded(located) {
+			t.Errorf("%s: got %q", name, located)
+		}
+	}
+	if located := Locate("", "missing"); located != "" {
+		t.Errorf("got %q for a module that does not exist", located)
+	}
+
+	directory := filepath.ToSlash(t.TempDir())
+	if err := os.WriteFile(directory+"/util.bir", []byte("let own = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if located := Locate(directory, "util"); located != directory+"/util.bir" || Embedded(located) {
+		t.Errorf("got %q, want the module of the directory", located)
+	}
+	if located := Locate(directory, "io"); located != "" {
+		t.Errorf("got %q, a directory replaces the whole embedded library", located)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	entries, err := files.ReadDir(".")
+	if err != nil || len(entries) == 0 {
+		t.Fatalf("got %d embedded files, %v", len(entries), err)
+	}
+
+	// Every embedded module parses
+	for _, entry := range entries {
+		raw, err := ReadFile(Root + "/" + entry.Name())
+		if err != nil {
+			t.Errorf("%s: %v", entry.Name(), err)
+			continue
+		}
+		result := parser.Parse(string(raw))
+		if result.Error {
+			t.Errorf("%s: could not be parsed", entry.Name())
+			continue
+		}
+		if _, err := ast.Decode(result.Content); err != nil {
+			t.Errorf("%s: %v", entry.Name(), err)
+		}
+	}
+
+	raw, err := ReadFile(Root + "/util.bir")
+	if err != nil || !strings.Contains(string(raw), "namespace util") {
+		t.Errorf("got %q %v, want the util module", raw, err)
+	}
+	if _, err := ReadFile(Root + "/missing.bir"); err == nil {
+		t.Errorf("read an embedded module that does not exist")
+	}
+	if Embedded("std/util.bir") || Embedded("[std]util.bir") {
+		t.Errorf("took a path on the disk for an embedded one")
+	}
+}